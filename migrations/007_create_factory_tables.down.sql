@@ -0,0 +1,7 @@
+-- Drop indexes
+DROP INDEX IF EXISTS idx_factory_production_orders_product_id;
+DROP INDEX IF EXISTS idx_factory_products_status;
+
+-- Drop factory tables
+DROP TABLE IF EXISTS factory_production_orders;
+DROP TABLE IF EXISTS factory_products;
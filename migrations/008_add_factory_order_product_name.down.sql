@@ -0,0 +1,2 @@
+-- Drop denormalized product name from production orders
+ALTER TABLE factory_production_orders DROP COLUMN IF EXISTS product_name;
@@ -0,0 +1,3 @@
+-- Add denormalized product name to production orders
+ALTER TABLE factory_production_orders
+    ADD COLUMN IF NOT EXISTS product_name VARCHAR(255) NOT NULL DEFAULT '';
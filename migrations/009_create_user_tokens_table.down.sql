@@ -0,0 +1,9 @@
+-- Drop indexes
+DROP INDEX IF EXISTS idx_user_tokens_expires_at;
+DROP INDEX IF EXISTS idx_user_tokens_user_id;
+
+-- Drop user_tokens table
+DROP TABLE IF EXISTS user_tokens;
+
+-- Drop email verification flag
+ALTER TABLE users DROP COLUMN IF EXISTS email_verified;
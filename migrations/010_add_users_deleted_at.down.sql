@@ -0,0 +1,3 @@
+-- Drop soft-delete column
+DROP INDEX IF EXISTS idx_users_deleted_at;
+ALTER TABLE users DROP COLUMN IF EXISTS deleted_at;
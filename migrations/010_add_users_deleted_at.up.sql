@@ -0,0 +1,4 @@
+-- Soft-delete users: deleted users keep their row but are hidden from lookups
+ALTER TABLE users ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_users_deleted_at ON users(deleted_at);
@@ -0,0 +1,2 @@
+-- Drop tenant column
+ALTER TABLE users DROP COLUMN IF EXISTS tenant_id;
@@ -0,0 +1,3 @@
+-- Record which tenant a user signed up under, so plan user limits can be
+-- enforced per tenant. Users created outside a tenant have none.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS tenant_id UUID;
@@ -0,0 +1,2 @@
+-- Drop rotated flag
+ALTER TABLE refresh_tokens DROP COLUMN IF EXISTS rotated;
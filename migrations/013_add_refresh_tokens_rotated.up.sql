@@ -0,0 +1,3 @@
+-- Tell tokens exchanged for new ones apart from tokens revoked on logout,
+-- so only presenting a rotated token is treated as theft
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS rotated BOOLEAN NOT NULL DEFAULT FALSE;
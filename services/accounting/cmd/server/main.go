@@ -4,7 +4,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"math"
 	"net/http"
+	"sort"
 	"sync"
 	"time"
 
@@ -25,6 +27,14 @@ type Transaction struct {
 	CreatedAt   time.Time `json:"created_at"`
 }
 
+// CategorySummary holds per-category totals
+type CategorySummary struct {
+	Category string  `json:"category"`
+	Income   float64 `json:"income"`
+	Expense  float64 `json:"expense"`
+	Net      float64 `json:"net"`
+}
+
 var (
 	transactions = make(map[string]*Transaction)
 	mu           sync.RWMutex
@@ -44,6 +54,7 @@ func main() {
 	api.HandleFunc("/transactions", createTransaction).Methods("POST")
 	api.HandleFunc("/transactions/{id}", getTransaction).Methods("GET")
 	api.HandleFunc("/balance", getBalance).Methods("GET")
+	api.HandleFunc("/balance/by-category", getBalanceByCategory).Methods("GET")
 
 	handler := middleware.CORS(router)
 
@@ -81,11 +92,63 @@ func createTransaction(w http.ResponseWriter, r *http.Request) {
 }
 
 func listTransactions(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	var from, to time.Time
+	if value := query.Get("from"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+				"success": false,
+				"message": "Invalid from parameter: expected RFC3339 timestamp",
+			})
+			return
+		}
+		from = parsed
+	}
+	if value := query.Get("to"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+				"success": false,
+				"message": "Invalid to parameter: expected RFC3339 timestamp",
+			})
+			return
+		}
+		to = parsed
+	}
+	if !from.IsZero() && !to.IsZero() && to.Before(from) {
+		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"message": "to must not be before from",
+		})
+		return
+	}
+
+	txType := query.Get("type")
+	if txType != "" && txType != "income" && txType != "expense" {
+		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"message": "Invalid type parameter: expected income or expense",
+		})
+		return
+	}
+
 	mu.RLock()
 	defer mu.RUnlock()
 
+	// Both bounds are inclusive
 	txList := make([]*Transaction, 0, len(transactions))
 	for _, tx := range transactions {
+		if !from.IsZero() && tx.CreatedAt.Before(from) {
+			continue
+		}
+		if !to.IsZero() && tx.CreatedAt.After(to) {
+			continue
+		}
+		if txType != "" && tx.Type != txType {
+			continue
+		}
 		txList = append(txList, tx)
 	}
 
@@ -135,6 +198,52 @@ func getBalance(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+func getBalanceByCategory(w http.ResponseWriter, r *http.Request) {
+	mu.RLock()
+	summaries := summarizeByCategory(transactions)
+	mu.RUnlock()
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"success":    true,
+		"categories": summaries,
+	})
+}
+
+// summarizeByCategory groups transactions by category, sorted by absolute
+// net amount descending. Callers must hold mu.
+func summarizeByCategory(txs map[string]*Transaction) []CategorySummary {
+	byCategory := make(map[string]*CategorySummary)
+	for _, tx := range txs {
+		summary, exists := byCategory[tx.Category]
+		if !exists {
+			summary = &CategorySummary{Category: tx.Category}
+			byCategory[tx.Category] = summary
+		}
+
+		if tx.Type == "income" {
+			summary.Income += tx.Amount
+		} else if tx.Type == "expense" {
+			summary.Expense += tx.Amount
+		}
+	}
+
+	summaries := make([]CategorySummary, 0, len(byCategory))
+	for _, summary := range byCategory {
+		summary.Net = summary.Income - summary.Expense
+		summaries = append(summaries, *summary)
+	}
+
+	sort.Slice(summaries, func(i, j int) bool {
+		ni, nj := math.Abs(summaries[i].Net), math.Abs(summaries[j].Net)
+		if ni != nj {
+			return ni > nj
+		}
+		return summaries[i].Category < summaries[j].Category
+	})
+
+	return summaries
+}
+
 func healthCheck(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("Accounting Service OK"))
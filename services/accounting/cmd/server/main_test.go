@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetBalanceByCategory(t *testing.T) {
+	transactions = map[string]*Transaction{
+		"TXN-1": {ID: "TXN-1", Type: "income", Amount: 1000, Category: "sales"},
+		"TXN-2": {ID: "TXN-2", Type: "income", Amount: 500, Category: "sales"},
+		"TXN-3": {ID: "TXN-3", Type: "expense", Amount: 200, Category: "sales"},
+		"TXN-4": {ID: "TXN-4", Type: "expense", Amount: 3000, Category: "payroll"},
+		"TXN-5": {ID: "TXN-5", Type: "expense", Amount: 150, Category: "office"},
+		"TXN-6": {ID: "TXN-6", Type: "income", Amount: 50, Category: "office"},
+	}
+
+	rec := httptest.NewRecorder()
+	getBalanceByCategory(rec, httptest.NewRequest(http.MethodGet, "/api/accounting/balance/by-category", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+
+	var resp struct {
+		Categories []CategorySummary `json:"categories"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+
+	expected := []CategorySummary{
+		{Category: "payroll", Income: 0, Expense: 3000, Net: -3000},
+		{Category: "sales", Income: 1500, Expense: 200, Net: 1300},
+		{Category: "office", Income: 50, Expense: 150, Net: -100},
+	}
+
+	if len(resp.Categories) != len(expected) {
+		t.Fatalf("expected %d categories, got %d", len(expected), len(resp.Categories))
+	}
+	for i, want := range expected {
+		if resp.Categories[i] != want {
+			t.Errorf("category %d: got %+v, want %+v", i, resp.Categories[i], want)
+		}
+	}
+}
+
+func TestListTransactions_DateRange(t *testing.T) {
+	base := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	transactions = map[string]*Transaction{
+		"TXN-1": {ID: "TXN-1", Type: "income", CreatedAt: base.Add(-time.Second)},
+		"TXN-2": {ID: "TXN-2", Type: "income", CreatedAt: base},
+		"TXN-3": {ID: "TXN-3", Type: "expense", CreatedAt: base.Add(24 * time.Hour)},
+		"TXN-4": {ID: "TXN-4", Type: "income", CreatedAt: base.Add(48 * time.Hour)},
+		"TXN-5": {ID: "TXN-5", Type: "income", CreatedAt: base.Add(48*time.Hour + time.Second)},
+	}
+
+	from := base.Format(time.RFC3339)
+	to := base.Add(48 * time.Hour).Format(time.RFC3339)
+
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{"inclusive range", "?from=" + from + "&to=" + to, []string{"TXN-2", "TXN-3", "TXN-4"}},
+		{"from only", "?from=" + from, []string{"TXN-2", "TXN-3", "TXN-4", "TXN-5"}},
+		{"to only", "?to=" + from, []string{"TXN-1", "TXN-2"}},
+		{"range and type", "?from=" + from + "&to=" + to + "&type=income", []string{"TXN-2", "TXN-4"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			listTransactions(rec, httptest.NewRequest(http.MethodGet, "/api/accounting/transactions"+tt.query, nil))
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("expected 200, got %d", rec.Code)
+			}
+
+			var resp struct {
+				Transactions []Transaction `json:"transactions"`
+			}
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+
+			got := make([]string, 0, len(resp.Transactions))
+			for _, tx := range resp.Transactions {
+				got = append(got, tx.ID)
+			}
+			sort.Strings(got)
+
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestListTransactions_InvalidParams(t *testing.T) {
+	for _, query := range []string{"?from=yesterday", "?to=2024-03-01", "?type=refund"} {
+		rec := httptest.NewRecorder()
+		listTransactions(rec, httptest.NewRequest(http.MethodGet, "/api/accounting/transactions"+query, nil))
+
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", query, rec.Code)
+		}
+	}
+}
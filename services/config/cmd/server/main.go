@@ -2,9 +2,12 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
+	"strconv"
 	"sync"
+	"time"
 
 	"github.com/dayanch951/marimo/shared/middleware"
 	"github.com/gorilla/mux"
@@ -13,13 +16,42 @@ import (
 const port = ":8082"
 
 type ConfigItem struct {
-	Key   string `json:"key"`
-	Value string `json:"value"`
-	Type  string `json:"type"` // system, user, app
+	Key       string `json:"key"`
+	Value     string `json:"value"`
+	Type      string `json:"type"`       // system, user, app
+	ValueType string `json:"value_type"` // string, int, bool, float, json
 }
 
+// Config value types
+const (
+	ValueTypeString = "string"
+	ValueTypeInt    = "int"
+	ValueTypeBool   = "bool"
+	ValueTypeFloat  = "float"
+	ValueTypeJSON   = "json"
+)
+
+// typedConfigItem is a config item together with its parsed value
+type typedConfigItem struct {
+	*ConfigItem
+	Parsed interface{} `json:"parsed"`
+}
+
+// ConfigChange is an audit record of a config value being set
+type ConfigChange struct {
+	Key       string    `json:"key"`
+	OldValue  string    `json:"old_value"`
+	NewValue  string    `json:"new_value"`
+	ChangedBy string    `json:"changed_by"`
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+// maxHistoryPerKey bounds the number of changes kept for each key
+const maxHistoryPerKey = 50
+
 var (
 	configs = make(map[string]*ConfigItem)
+	history = make(map[string][]ConfigChange)
 	mu      sync.RWMutex
 )
 
@@ -37,6 +69,7 @@ func main() {
 	api.Use(middleware.AuthMiddleware)
 	api.HandleFunc("", listConfigs).Methods("GET")
 	api.HandleFunc("/{key}", getConfig).Methods("GET")
+	api.HandleFunc("/{key}/history", getConfigHistory).Methods("GET")
 	api.HandleFunc("", setConfig).Methods("POST")
 	api.HandleFunc("/{key}", deleteConfig).Methods("DELETE")
 
@@ -49,9 +82,9 @@ func main() {
 }
 
 func initDefaultConfigs() {
-	configs["app_name"] = &ConfigItem{Key: "app_name", Value: "Marimo ERP", Type: "system"}
-	configs["currency"] = &ConfigItem{Key: "currency", Value: "USD", Type: "system"}
-	configs["timezone"] = &ConfigItem{Key: "timezone", Value: "UTC", Type: "system"}
+	configs["app_name"] = &ConfigItem{Key: "app_name", Value: "Marimo ERP", Type: "system", ValueType: ValueTypeString}
+	configs["currency"] = &ConfigItem{Key: "currency", Value: "USD", Type: "system", ValueType: ValueTypeString}
+	configs["timezone"] = &ConfigItem{Key: "timezone", Value: "UTC", Type: "system", ValueType: ValueTypeString}
 	log.Println("Default configs initialized")
 }
 
@@ -76,6 +109,10 @@ func getConfig(w http.ResponseWriter, r *http.Request) {
 
 	mu.RLock()
 	item, exists := configs[key]
+	var stored ConfigItem
+	if exists {
+		stored = *item
+	}
 	mu.RUnlock()
 
 	if !exists {
@@ -86,10 +123,18 @@ func getConfig(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	respondJSON(w, http.StatusOK, item)
+	// Values are validated on write, so parsing only fails for legacy data
+	parsed, err := parseConfigValue(stored.ValueType, stored.Value)
+	if err != nil {
+		parsed = stored.Value
+	}
+
+	respondJSON(w, http.StatusOK, typedConfigItem{ConfigItem: &stored, Parsed: parsed})
 }
 
 func setConfig(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value(middleware.UserContextKey).(*middleware.Claims)
+
 	var item ConfigItem
 	if err := json.NewDecoder(r.Body).Decode(&item); err != nil {
 		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
@@ -99,8 +144,36 @@ func setConfig(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if item.Key == "" {
+		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"message": "Config key is required",
+		})
+		return
+	}
+
+	item.ValueType = normalizeValueType(item.ValueType)
+	if _, err := parseConfigValue(item.ValueType, item.Value); err != nil {
+		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"message": fmt.Sprintf("Invalid %s value for %s: %v", item.ValueType, item.Key, err),
+		})
+		return
+	}
+
 	mu.Lock()
+	var oldValue string
+	if existing, exists := configs[item.Key]; exists {
+		oldValue = existing.Value
+	}
 	configs[item.Key] = &item
+	recordChange(ConfigChange{
+		Key:       item.Key,
+		OldValue:  oldValue,
+		NewValue:  item.Value,
+		ChangedBy: claims.UserID,
+		ChangedAt: time.Now(),
+	})
 	mu.Unlock()
 
 	respondJSON(w, http.StatusOK, map[string]interface{}{
@@ -109,6 +182,32 @@ func setConfig(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+func getConfigHistory(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	key := vars["key"]
+
+	mu.RLock()
+	changes := make([]ConfigChange, len(history[key]))
+	copy(changes, history[key])
+	mu.RUnlock()
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"key":     key,
+		"history": changes,
+	})
+}
+
+// recordChange appends a change to the key's history, dropping the oldest
+// entries beyond maxHistoryPerKey. Callers must hold mu.
+func recordChange(change ConfigChange) {
+	changes := append(history[change.Key], change)
+	if len(changes) > maxHistoryPerKey {
+		changes = append([]ConfigChange(nil), changes[len(changes)-maxHistoryPerKey:]...)
+	}
+	history[change.Key] = changes
+}
+
 func deleteConfig(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	key := vars["key"]
@@ -123,6 +222,36 @@ func deleteConfig(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// normalizeValueType maps unknown or missing value types to string
+func normalizeValueType(valueType string) string {
+	switch valueType {
+	case ValueTypeInt, ValueTypeBool, ValueTypeFloat, ValueTypeJSON:
+		return valueType
+	default:
+		return ValueTypeString
+	}
+}
+
+// parseConfigValue parses a raw config value according to its value type
+func parseConfigValue(valueType, value string) (interface{}, error) {
+	switch normalizeValueType(valueType) {
+	case ValueTypeInt:
+		return strconv.ParseInt(value, 10, 64)
+	case ValueTypeBool:
+		return strconv.ParseBool(value)
+	case ValueTypeFloat:
+		return strconv.ParseFloat(value, 64)
+	case ValueTypeJSON:
+		var parsed interface{}
+		if err := json.Unmarshal([]byte(value), &parsed); err != nil {
+			return nil, err
+		}
+		return parsed, nil
+	default:
+		return value, nil
+	}
+}
+
 func healthCheck(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("Config Service OK"))
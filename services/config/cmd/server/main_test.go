@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/dayanch951/marimo/shared/middleware"
+	"github.com/gorilla/mux"
+)
+
+func TestParseConfigValue(t *testing.T) {
+	tests := []struct {
+		name      string
+		valueType string
+		value     string
+		want      interface{}
+		wantErr   bool
+	}{
+		{"int", ValueTypeInt, "42", int64(42), false},
+		{"invalid int", ValueTypeInt, "4.2", nil, true},
+		{"bool", ValueTypeBool, "true", true, false},
+		{"invalid bool", ValueTypeBool, "yes please", nil, true},
+		{"float", ValueTypeFloat, "1.5", 1.5, false},
+		{"invalid float", ValueTypeFloat, "abc", nil, true},
+		{"json", ValueTypeJSON, `{"a":1}`, map[string]interface{}{"a": float64(1)}, false},
+		{"invalid json", ValueTypeJSON, `{"a":`, nil, true},
+		{"string", ValueTypeString, "UTC", "UTC", false},
+		{"unknown type defaults to string", "color", "blue", "blue", false},
+		{"missing type defaults to string", "", "USD", "USD", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseConfigValue(tt.valueType, tt.value)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected error for %q", tt.value)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if m, ok := tt.want.(map[string]interface{}); ok {
+				gotMap, ok := got.(map[string]interface{})
+				if !ok || len(gotMap) != len(m) || gotMap["a"] != m["a"] {
+					t.Errorf("got %v, want %v", got, tt.want)
+				}
+				return
+			}
+			if got != tt.want {
+				t.Errorf("got %v (%T), want %v (%T)", got, got, tt.want, tt.want)
+			}
+		})
+	}
+}
+
+func setConfigAs(t *testing.T, userID, key, value string) {
+	t.Helper()
+
+	body, _ := json.Marshal(ConfigItem{Key: key, Value: value})
+	req := httptest.NewRequest(http.MethodPost, "/api/config", bytes.NewReader(body))
+	claims := &middleware.Claims{UserID: userID, Role: "admin"}
+	req = req.WithContext(context.WithValue(req.Context(), middleware.UserContextKey, claims))
+
+	rec := httptest.NewRecorder()
+	setConfig(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("setConfig returned %d", rec.Code)
+	}
+}
+
+func getHistory(t *testing.T, key string) []ConfigChange {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, "/api/config/"+key+"/history", nil)
+	req = mux.SetURLVars(req, map[string]string{"key": key})
+
+	rec := httptest.NewRecorder()
+	getConfigHistory(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("getConfigHistory returned %d", rec.Code)
+	}
+
+	var resp struct {
+		History []ConfigChange `json:"history"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	return resp.History
+}
+
+func TestConfigHistory_Ordering(t *testing.T) {
+	configs = make(map[string]*ConfigItem)
+	history = make(map[string][]ConfigChange)
+
+	setConfigAs(t, "admin-1", "currency", "USD")
+	setConfigAs(t, "admin-2", "currency", "EUR")
+	setConfigAs(t, "admin-1", "currency", "GBP")
+
+	changes := getHistory(t, "currency")
+	if len(changes) != 3 {
+		t.Fatalf("expected 3 changes, got %d", len(changes))
+	}
+
+	expected := []ConfigChange{
+		{OldValue: "", NewValue: "USD", ChangedBy: "admin-1"},
+		{OldValue: "USD", NewValue: "EUR", ChangedBy: "admin-2"},
+		{OldValue: "EUR", NewValue: "GBP", ChangedBy: "admin-1"},
+	}
+	for i, want := range expected {
+		got := changes[i]
+		if got.OldValue != want.OldValue || got.NewValue != want.NewValue || got.ChangedBy != want.ChangedBy {
+			t.Errorf("change %d: got %+v, want %+v", i, got, want)
+		}
+		if i > 0 && got.ChangedAt.Before(changes[i-1].ChangedAt) {
+			t.Errorf("change %d is older than change %d", i, i-1)
+		}
+	}
+}
+
+func TestConfigHistory_Cap(t *testing.T) {
+	configs = make(map[string]*ConfigItem)
+	history = make(map[string][]ConfigChange)
+
+	total := maxHistoryPerKey + 10
+	for i := 0; i < total; i++ {
+		setConfigAs(t, "admin-1", "counter", strconv.Itoa(i))
+	}
+
+	changes := getHistory(t, "counter")
+	if len(changes) != maxHistoryPerKey {
+		t.Fatalf("expected %d changes, got %d", maxHistoryPerKey, len(changes))
+	}
+
+	// Oldest entries are dropped first
+	if first := changes[0].NewValue; first != strconv.Itoa(total-maxHistoryPerKey) {
+		t.Errorf("expected oldest kept value %d, got %s", total-maxHistoryPerKey, first)
+	}
+	if last := changes[len(changes)-1].NewValue; last != strconv.Itoa(total-1) {
+		t.Errorf("expected newest value %d, got %s", total-1, last)
+	}
+}
@@ -2,14 +2,16 @@ package main
 
 import (
 	"encoding/json"
-	"fmt"
+	"errors"
 	"log"
 	"net/http"
-	"sync"
+	"os"
 	"time"
 
+	"github.com/dayanch951/marimo/shared/database"
 	"github.com/dayanch951/marimo/shared/middleware"
 	"github.com/dayanch951/marimo/shared/models"
+	"github.com/dayanch951/marimo/shared/monitoring"
 	"github.com/gorilla/mux"
 )
 
@@ -29,26 +31,45 @@ type Product struct {
 type ProductionOrder struct {
 	ID         string    `json:"id"`
 	ProductID  string    `json:"product_id"`
+	ProductName string   `json:"product_name"`
 	Quantity   int       `json:"quantity"`
 	Status     string    `json:"status"` // pending, in_progress, completed
 	CreatedBy  string    `json:"created_by"`
 	CreatedAt  time.Time `json:"created_at"`
 }
 
-var (
-	products   = make(map[string]*Product)
-	orders     = make(map[string]*ProductionOrder)
-	mu         sync.RWMutex
-	productCounter = 0
-	orderCounter   = 0
-)
+var repo Repository
 
 func main() {
-	initDefaultProducts()
+	usePostgres := getEnv("USE_POSTGRES", "false")
+
+	if usePostgres == "true" {
+		log.Println("Initializing PostgreSQL database...")
+		pgDB, err := database.NewPostgresDB(
+			getEnv("DB_HOST", "localhost"),
+			getEnv("DB_PORT", "5432"),
+			getEnv("DB_USER", "postgres"),
+			getEnv("DB_PASSWORD", "postgres"),
+			getEnv("DB_NAME", "marimo_dev"),
+			getEnv("DB_SSL_MODE", "disable"),
+			monitoring.Default(),
+		)
+		if err != nil {
+			log.Fatalf("Failed to connect to PostgreSQL: %v", err)
+		}
+		defer pgDB.Close()
+
+		repo = NewPostgresRepository(pgDB.DB())
+		log.Println("PostgreSQL database connected successfully")
+	} else {
+		repo = NewMemoryRepository()
+		initDefaultProducts()
+	}
 
 	router := mux.NewRouter()
 
 	router.HandleFunc("/health", healthCheck).Methods("GET")
+	router.Handle("/metrics", monitoring.Default().Handler()).Methods("GET")
 
 	// Protected routes
 	api := router.PathPrefix("/api/factory").Subrouter()
@@ -75,14 +96,17 @@ func main() {
 }
 
 func initDefaultProducts() {
-	products["PROD-1"] = &Product{
-		ID:        "PROD-1",
+	err := repo.CreateProduct(&Product{
 		Name:      "Widget A",
 		SKU:       "WGT-A-001",
 		Quantity:  100,
 		Status:    "completed",
 		CreatedBy: "system",
 		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		log.Printf("Failed to create default products: %v", err)
+		return
 	}
 	log.Println("Default products initialized")
 }
@@ -99,14 +123,19 @@ func createProduct(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	mu.Lock()
-	productCounter++
-	product.ID = fmt.Sprintf("PROD-%d", productCounter)
 	product.CreatedBy = claims.UserID
 	product.CreatedAt = time.Now()
 	product.Status = "pending"
-	products[product.ID] = &product
-	mu.Unlock()
+	product.CompletedAt = nil
+
+	if err := repo.CreateProduct(&product); err != nil {
+		log.Printf("Failed to create product: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"message": "Failed to create product",
+		})
+		return
+	}
 
 	respondJSON(w, http.StatusCreated, map[string]interface{}{
 		"success": true,
@@ -116,12 +145,14 @@ func createProduct(w http.ResponseWriter, r *http.Request) {
 }
 
 func listProducts(w http.ResponseWriter, r *http.Request) {
-	mu.RLock()
-	defer mu.RUnlock()
-
-	productList := make([]*Product, 0, len(products))
-	for _, p := range products {
-		productList = append(productList, p)
+	productList, err := repo.ListProducts()
+	if err != nil {
+		log.Printf("Failed to list products: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"message": "Failed to list products",
+		})
+		return
 	}
 
 	respondJSON(w, http.StatusOK, map[string]interface{}{
@@ -134,17 +165,22 @@ func getProduct(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
 
-	mu.RLock()
-	product, exists := products[id]
-	mu.RUnlock()
-
-	if !exists {
+	product, err := repo.GetProduct(id)
+	if errors.Is(err, ErrProductNotFound) {
 		respondJSON(w, http.StatusNotFound, map[string]interface{}{
 			"success": false,
 			"message": "Product not found",
 		})
 		return
 	}
+	if err != nil {
+		log.Printf("Failed to get product %s: %v", id, err)
+		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"message": "Failed to get product",
+		})
+		return
+	}
 
 	respondJSON(w, http.StatusOK, product)
 }
@@ -164,23 +200,22 @@ func updateProductStatus(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	mu.Lock()
-	product, exists := products[id]
-	if !exists {
-		mu.Unlock()
+	err := repo.UpdateProductStatus(id, req.Status)
+	if errors.Is(err, ErrProductNotFound) {
 		respondJSON(w, http.StatusNotFound, map[string]interface{}{
 			"success": false,
 			"message": "Product not found",
 		})
 		return
 	}
-
-	product.Status = req.Status
-	if req.Status == "completed" {
-		now := time.Now()
-		product.CompletedAt = &now
+	if err != nil {
+		log.Printf("Failed to update product %s: %v", id, err)
+		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"message": "Failed to update product status",
+		})
+		return
 	}
-	mu.Unlock()
 
 	respondJSON(w, http.StatusOK, map[string]interface{}{
 		"success": true,
@@ -200,14 +235,36 @@ func createOrder(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	mu.Lock()
-	orderCounter++
-	order.ID = fmt.Sprintf("ORD-%d", orderCounter)
+	product, err := repo.GetProduct(order.ProductID)
+	if errors.Is(err, ErrProductNotFound) {
+		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"message": "product not found",
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to get product %s: %v", order.ProductID, err)
+		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"message": "Failed to create order",
+		})
+		return
+	}
+
+	order.ProductName = product.Name
 	order.CreatedBy = claims.UserID
 	order.CreatedAt = time.Now()
 	order.Status = "pending"
-	orders[order.ID] = &order
-	mu.Unlock()
+
+	if err := repo.CreateOrder(&order); err != nil {
+		log.Printf("Failed to create order: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"message": "Failed to create order",
+		})
+		return
+	}
 
 	respondJSON(w, http.StatusCreated, map[string]interface{}{
 		"success": true,
@@ -217,12 +274,14 @@ func createOrder(w http.ResponseWriter, r *http.Request) {
 }
 
 func listOrders(w http.ResponseWriter, r *http.Request) {
-	mu.RLock()
-	defer mu.RUnlock()
-
-	orderList := make([]*ProductionOrder, 0, len(orders))
-	for _, o := range orders {
-		orderList = append(orderList, o)
+	orderList, err := repo.ListOrders()
+	if err != nil {
+		log.Printf("Failed to list orders: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"message": "Failed to list orders",
+		})
+		return
 	}
 
 	respondJSON(w, http.StatusOK, map[string]interface{}{
@@ -235,17 +294,22 @@ func getOrder(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
 
-	mu.RLock()
-	order, exists := orders[id]
-	mu.RUnlock()
-
-	if !exists {
+	order, err := repo.GetOrder(id)
+	if errors.Is(err, ErrOrderNotFound) {
 		respondJSON(w, http.StatusNotFound, map[string]interface{}{
 			"success": false,
 			"message": "Order not found",
 		})
 		return
 	}
+	if err != nil {
+		log.Printf("Failed to get order %s: %v", id, err)
+		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"message": "Failed to get order",
+		})
+		return
+	}
 
 	respondJSON(w, http.StatusOK, order)
 }
@@ -260,3 +324,10 @@ func respondJSON(w http.ResponseWriter, status int, data interface{}) {
 	w.WriteHeader(status)
 	json.NewEncoder(w).Encode(data)
 }
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
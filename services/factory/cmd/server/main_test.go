@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dayanch951/marimo/shared/middleware"
+)
+
+func newCreateOrderRequest(t *testing.T, order ProductionOrder) *http.Request {
+	t.Helper()
+
+	body, err := json.Marshal(order)
+	if err != nil {
+		t.Fatalf("failed to marshal order: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/factory/orders", bytes.NewReader(body))
+	claims := &middleware.Claims{UserID: "manager-1", Role: "manager"}
+	return req.WithContext(context.WithValue(req.Context(), middleware.UserContextKey, claims))
+}
+
+func TestCreateOrder_ProductNotFound(t *testing.T) {
+	repo = NewMemoryRepository()
+
+	rec := httptest.NewRecorder()
+	createOrder(rec, newCreateOrderRequest(t, ProductionOrder{ProductID: "PROD-404", Quantity: 5}))
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", rec.Code)
+	}
+
+	var resp map[string]interface{}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if resp["message"] != "product not found" {
+		t.Errorf("unexpected message: %v", resp["message"])
+	}
+
+	orderList, _ := repo.ListOrders()
+	if len(orderList) != 0 {
+		t.Errorf("expected no orders to be stored, got %d", len(orderList))
+	}
+}
+
+func TestCreateOrder_Success(t *testing.T) {
+	repo = NewMemoryRepository()
+
+	product := &Product{Name: "Widget A", SKU: "WGT-A-001", CreatedAt: time.Now()}
+	if err := repo.CreateProduct(product); err != nil {
+		t.Fatalf("failed to create product: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	createOrder(rec, newCreateOrderRequest(t, ProductionOrder{ProductID: product.ID, Quantity: 5}))
+
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", rec.Code)
+	}
+
+	var resp struct {
+		Order ProductionOrder `json:"order"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+
+	if resp.Order.ProductName != "Widget A" {
+		t.Errorf("expected product name %q, got %q", "Widget A", resp.Order.ProductName)
+	}
+	if resp.Order.CreatedBy != "manager-1" {
+		t.Errorf("expected created_by manager-1, got %q", resp.Order.CreatedBy)
+	}
+	if resp.Order.Status != "pending" {
+		t.Errorf("expected pending status, got %q", resp.Order.Status)
+	}
+}
@@ -0,0 +1,422 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrProductNotFound = errors.New("product not found")
+	ErrOrderNotFound   = errors.New("order not found")
+)
+
+const (
+	productIDPrefix = "PROD-"
+	orderIDPrefix   = "ORD-"
+)
+
+// Repository defines storage operations for the factory service
+type Repository interface {
+	CreateProduct(product *Product) error
+	GetProduct(id string) (*Product, error)
+	ListProducts() ([]*Product, error)
+	UpdateProductStatus(id, status string) error
+
+	CreateOrder(order *ProductionOrder) error
+	GetOrder(id string) (*ProductionOrder, error)
+	ListOrders() ([]*ProductionOrder, error)
+}
+
+// MemoryRepository keeps factory data in memory
+type MemoryRepository struct {
+	products       map[string]*Product
+	orders         map[string]*ProductionOrder
+	productCounter int
+	orderCounter   int
+	mu             sync.RWMutex
+}
+
+// NewMemoryRepository creates a new in-memory repository
+func NewMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{
+		products: make(map[string]*Product),
+		orders:   make(map[string]*ProductionOrder),
+	}
+}
+
+// CreateProduct stores a product and assigns it the next free ID
+func (r *MemoryRepository) CreateProduct(product *Product) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for {
+		r.productCounter++
+		product.ID = fmt.Sprintf("%s%d", productIDPrefix, r.productCounter)
+		if _, exists := r.products[product.ID]; !exists {
+			break
+		}
+	}
+
+	stored := *product
+	r.products[product.ID] = &stored
+	return nil
+}
+
+// GetProduct retrieves a product by ID
+func (r *MemoryRepository) GetProduct(id string) (*Product, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	product, exists := r.products[id]
+	if !exists {
+		return nil, ErrProductNotFound
+	}
+
+	p := *product
+	return &p, nil
+}
+
+// ListProducts returns all products ordered by creation time
+func (r *MemoryRepository) ListProducts() ([]*Product, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	products := make([]*Product, 0, len(r.products))
+	for _, product := range r.products {
+		p := *product
+		products = append(products, &p)
+	}
+
+	sort.Slice(products, func(i, j int) bool {
+		return products[i].CreatedAt.Before(products[j].CreatedAt)
+	})
+
+	return products, nil
+}
+
+// UpdateProductStatus changes a product's status
+func (r *MemoryRepository) UpdateProductStatus(id, status string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	product, exists := r.products[id]
+	if !exists {
+		return ErrProductNotFound
+	}
+
+	product.Status = status
+	if status == "completed" {
+		now := time.Now()
+		product.CompletedAt = &now
+	}
+
+	return nil
+}
+
+// CreateOrder stores a production order and assigns it the next ID
+func (r *MemoryRepository) CreateOrder(order *ProductionOrder) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.orderCounter++
+	order.ID = fmt.Sprintf("%s%d", orderIDPrefix, r.orderCounter)
+
+	stored := *order
+	r.orders[order.ID] = &stored
+	return nil
+}
+
+// GetOrder retrieves a production order by ID
+func (r *MemoryRepository) GetOrder(id string) (*ProductionOrder, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	order, exists := r.orders[id]
+	if !exists {
+		return nil, ErrOrderNotFound
+	}
+
+	o := *order
+	return &o, nil
+}
+
+// ListOrders returns all production orders ordered by creation time
+func (r *MemoryRepository) ListOrders() ([]*ProductionOrder, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	orderList := make([]*ProductionOrder, 0, len(r.orders))
+	for _, order := range r.orders {
+		o := *order
+		orderList = append(orderList, &o)
+	}
+
+	sort.Slice(orderList, func(i, j int) bool {
+		return orderList[i].CreatedAt.Before(orderList[j].CreatedAt)
+	})
+
+	return orderList, nil
+}
+
+// PostgresRepository stores factory data in PostgreSQL.
+// IDs come from identity columns so they survive restarts.
+type PostgresRepository struct {
+	db *sql.DB
+}
+
+// NewPostgresRepository creates a repository backed by the given connection
+func NewPostgresRepository(db *sql.DB) *PostgresRepository {
+	return &PostgresRepository{db: db}
+}
+
+// CreateProduct inserts a product and sets its generated ID
+func (r *PostgresRepository) CreateProduct(product *Product) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	query := `
+		INSERT INTO factory_products (name, sku, quantity, status, created_by, created_at, completed_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id`
+
+	var id int64
+	err := r.db.QueryRowContext(ctx, query,
+		product.Name, product.SKU, product.Quantity, product.Status,
+		product.CreatedBy, product.CreatedAt, product.CompletedAt,
+	).Scan(&id)
+	if err != nil {
+		return fmt.Errorf("failed to create product: %w", err)
+	}
+
+	product.ID = fmt.Sprintf("%s%d", productIDPrefix, id)
+	return nil
+}
+
+// GetProduct retrieves a product by ID
+func (r *PostgresRepository) GetProduct(id string) (*Product, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	dbID, ok := parseID(id, productIDPrefix)
+	if !ok {
+		return nil, ErrProductNotFound
+	}
+
+	query := `SELECT id, name, sku, quantity, status, created_by, created_at, completed_at
+			  FROM factory_products
+			  WHERE id = $1`
+
+	product, err := scanProduct(r.db.QueryRowContext(ctx, query, dbID))
+	if err == sql.ErrNoRows {
+		return nil, ErrProductNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get product: %w", err)
+	}
+
+	return product, nil
+}
+
+// ListProducts returns all products ordered by creation time
+func (r *PostgresRepository) ListProducts() ([]*Product, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	query := `SELECT id, name, sku, quantity, status, created_by, created_at, completed_at
+			  FROM factory_products
+			  ORDER BY created_at, id`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list products: %w", err)
+	}
+	defer rows.Close()
+
+	products := make([]*Product, 0)
+	for rows.Next() {
+		product, err := scanProduct(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan product: %w", err)
+		}
+		products = append(products, product)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	return products, nil
+}
+
+// UpdateProductStatus changes a product's status
+func (r *PostgresRepository) UpdateProductStatus(id, status string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	dbID, ok := parseID(id, productIDPrefix)
+	if !ok {
+		return ErrProductNotFound
+	}
+
+	query := `UPDATE factory_products
+			  SET status = $1,
+			      completed_at = CASE WHEN $1 = 'completed' THEN $2 ELSE completed_at END
+			  WHERE id = $3`
+
+	result, err := r.db.ExecContext(ctx, query, status, time.Now(), dbID)
+	if err != nil {
+		return fmt.Errorf("failed to update product status: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rows == 0 {
+		return ErrProductNotFound
+	}
+
+	return nil
+}
+
+// CreateOrder inserts a production order and sets its generated ID
+func (r *PostgresRepository) CreateOrder(order *ProductionOrder) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	query := `
+		INSERT INTO factory_production_orders (product_id, product_name, quantity, status, created_by, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id`
+
+	var id int64
+	err := r.db.QueryRowContext(ctx, query,
+		order.ProductID, order.ProductName, order.Quantity, order.Status, order.CreatedBy, order.CreatedAt,
+	).Scan(&id)
+	if err != nil {
+		return fmt.Errorf("failed to create order: %w", err)
+	}
+
+	order.ID = fmt.Sprintf("%s%d", orderIDPrefix, id)
+	return nil
+}
+
+// GetOrder retrieves a production order by ID
+func (r *PostgresRepository) GetOrder(id string) (*ProductionOrder, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	dbID, ok := parseID(id, orderIDPrefix)
+	if !ok {
+		return nil, ErrOrderNotFound
+	}
+
+	query := `SELECT id, product_id, product_name, quantity, status, created_by, created_at
+			  FROM factory_production_orders
+			  WHERE id = $1`
+
+	order, err := scanOrder(r.db.QueryRowContext(ctx, query, dbID))
+	if err == sql.ErrNoRows {
+		return nil, ErrOrderNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get order: %w", err)
+	}
+
+	return order, nil
+}
+
+// ListOrders returns all production orders ordered by creation time
+func (r *PostgresRepository) ListOrders() ([]*ProductionOrder, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	query := `SELECT id, product_id, product_name, quantity, status, created_by, created_at
+			  FROM factory_production_orders
+			  ORDER BY created_at, id`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list orders: %w", err)
+	}
+	defer rows.Close()
+
+	orderList := make([]*ProductionOrder, 0)
+	for rows.Next() {
+		order, err := scanOrder(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan order: %w", err)
+		}
+		orderList = append(orderList, order)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	return orderList, nil
+}
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanProduct(row rowScanner) (*Product, error) {
+	var (
+		id          int64
+		completedAt sql.NullTime
+		product     Product
+	)
+
+	err := row.Scan(&id, &product.Name, &product.SKU, &product.Quantity, &product.Status,
+		&product.CreatedBy, &product.CreatedAt, &completedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	product.ID = fmt.Sprintf("%s%d", productIDPrefix, id)
+	if completedAt.Valid {
+		product.CompletedAt = &completedAt.Time
+	}
+
+	return &product, nil
+}
+
+func scanOrder(row rowScanner) (*ProductionOrder, error) {
+	var (
+		id    int64
+		order ProductionOrder
+	)
+
+	err := row.Scan(&id, &order.ProductID, &order.ProductName, &order.Quantity, &order.Status,
+		&order.CreatedBy, &order.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	order.ID = fmt.Sprintf("%s%d", orderIDPrefix, id)
+	return &order, nil
+}
+
+// parseID extracts the numeric identity from an API ID such as "PROD-42"
+func parseID(id, prefix string) (int64, bool) {
+	if !strings.HasPrefix(id, prefix) {
+		return 0, false
+	}
+
+	n, err := strconv.ParseInt(strings.TrimPrefix(id, prefix), 10, 64)
+	if err != nil || n < 1 {
+		return 0, false
+	}
+
+	return n, true
+}
@@ -1,13 +1,19 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"io"
 	"log"
+	"net"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/dayanch951/marimo/shared/middleware"
 	"github.com/gorilla/mux"
@@ -48,6 +54,10 @@ func main() {
 	rateLimiter.AddEndpoint("/api/users/login", 10, 3)       // 10 req/min, burst 3
 	rateLimiter.AddEndpoint("/api/users/register", 5, 2)     // 5 req/min, burst 2
 	rateLimiter.AddEndpoint("/api/users/refresh", 30, 5)     // 30 req/min, burst 5
+	rateLimiter.AddEndpoint("/api/users/forgot-password", 5, 2) // 5 req/min, burst 2
+
+	// Authenticated requests get their own bucket per tenant (or user)
+	rateLimiter.EnableTenantKeys()
 
 	// API Gateway routes
 	router.PathPrefix("/api/users").HandlerFunc(proxyHandler("users"))
@@ -66,6 +76,7 @@ func main() {
 	log.Println("  - Login: 10 req/min (burst 3)")
 	log.Println("  - Register: 5 req/min (burst 2)")
 	log.Println("  - Refresh: 30 req/min (burst 5)")
+	log.Println("  - Authenticated requests are limited per tenant")
 	log.Println("Available services:")
 	for name, url := range services {
 		log.Printf("  - %s: %s", name, url)
@@ -77,54 +88,127 @@ func main() {
 }
 
 func proxyHandler(serviceName string) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		// Try Docker service URL first, fall back to local
-		serviceURL := services[serviceName]
-		targetURL, err := url.Parse(serviceURL)
-		if err != nil {
-			// Try local service
-			serviceURL = localServices[serviceName]
-			targetURL, err = url.Parse(serviceURL)
-			if err != nil {
-				http.Error(w, "Service unavailable", http.StatusServiceUnavailable)
-				return
-			}
-		}
-
-		// Create reverse proxy
-		proxy := httputil.NewSingleHostReverseProxy(targetURL)
+	proxy, err := newServiceProxy(services[serviceName], localServices[serviceName])
+	if err != nil {
+		log.Fatalf("Invalid URL configured for %s service: %v", serviceName, err)
+	}
 
-		// Update the request
-		r.URL.Host = targetURL.Host
-		r.URL.Scheme = targetURL.Scheme
-		r.Header.Set("X-Forwarded-Host", r.Header.Get("Host"))
-		r.Host = targetURL.Host
+	return func(w http.ResponseWriter, r *http.Request) {
+		r.Header.Set("X-Forwarded-Host", r.Host)
 
 		// Log the request
-		log.Printf("Proxying %s %s to %s", r.Method, r.URL.Path, serviceURL)
+		log.Printf("Proxying %s %s to %s", r.Method, r.URL.Path, serviceName)
 
 		// Proxy the request
 		proxy.ServeHTTP(w, r)
 	}
 }
 
-func healthCheck(w http.ResponseWriter, r *http.Request) {
-	// Check all services
-	statuses := make(map[string]string)
-	allHealthy := true
+// newServiceProxy creates a reverse proxy for the Docker service URL that
+// falls back to the local URL when the Docker host cannot be reached
+func newServiceProxy(serviceURL, fallbackURL string) (*httputil.ReverseProxy, error) {
+	targetURL, err := url.Parse(serviceURL)
+	if err != nil {
+		return nil, err
+	}
+
+	proxy := httputil.NewSingleHostReverseProxy(targetURL)
+
+	director := proxy.Director
+	proxy.Director = func(r *http.Request) {
+		director(r)
+		r.Host = targetURL.Host
+	}
+	proxy.ErrorHandler = proxyErrorHandler
+
+	if fallbackURL != "" && fallbackURL != serviceURL {
+		fallback, err := url.Parse(fallbackURL)
+		if err != nil {
+			return nil, err
+		}
+		proxy.Transport = &fallbackTransport{
+			base:     http.DefaultTransport,
+			primary:  targetURL,
+			fallback: fallback,
+			maxBody:  middleware.DefaultMaxProxyBodySize,
+		}
+	}
+
+	return proxy, nil
+}
+
+// proxyErrorHandler answers requests the proxy couldn't forward
+func proxyErrorHandler(w http.ResponseWriter, r *http.Request, err error) {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	log.Printf("Error proxying %s %s: %v", r.Method, r.URL.Path, err)
+	w.WriteHeader(http.StatusBadGateway)
+}
+
+// fallbackTransport retries a request against a fallback host when the
+// primary host can't be dialed. Responses with 4xx/5xx status codes are
+// returned as-is, since the service was reachable.
+type fallbackTransport struct {
+	base     http.RoundTripper
+	primary  *url.URL
+	fallback *url.URL
+	maxBody  int64 // Request bodies are buffered in memory for the retry
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *fallbackTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// The base transport closes the body even on dial errors, so buffer it
+	// up front to be able to send it a second time
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		body, err := io.ReadAll(http.MaxBytesReader(nil, req.Body, t.maxBody))
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		req.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(body)), nil
+		}
+	}
 
-	for name, serviceURL := range localServices {
-		resp, err := http.Get(serviceURL + "/health")
-		if err != nil || resp.StatusCode != http.StatusOK {
-			statuses[name] = "unhealthy"
-			allHealthy = false
-		} else {
-			body, _ := io.ReadAll(resp.Body)
-			resp.Body.Close()
-			statuses[name] = strings.TrimSpace(string(body))
+	resp, err := t.base.RoundTrip(req)
+	if err == nil || !isDialError(err) {
+		return resp, err
+	}
+
+	log.Printf("Service %s unreachable, retrying against %s: %v", t.primary.Host, t.fallback.Host, err)
+
+	retry := req.Clone(req.Context())
+	retry.URL.Scheme = t.fallback.Scheme
+	retry.URL.Host = t.fallback.Host
+	retry.Host = t.fallback.Host
+	if req.GetBody != nil {
+		body, bodyErr := req.GetBody()
+		if bodyErr != nil {
+			return nil, bodyErr
 		}
+		retry.Body = body
 	}
 
+	return t.base.RoundTrip(retry)
+}
+
+// isDialError reports whether err happened while establishing the connection
+func isDialError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// healthProbeTimeout bounds each service health probe
+const healthProbeTimeout = 2 * time.Second
+
+func healthCheck(w http.ResponseWriter, r *http.Request) {
+	statuses, allHealthy := probeServices(r.Context(), localServices, healthProbeTimeout)
+
 	status := http.StatusOK
 	if !allHealthy {
 		status = http.StatusServiceUnavailable
@@ -142,3 +226,71 @@ func healthCheck(w http.ResponseWriter, r *http.Request) {
 		log.Printf("Error encoding health check response: %v", err)
 	}
 }
+
+// probeServices checks every service's /health endpoint concurrently.
+// Each probe is bounded by timeout, so the call returns within roughly
+// that duration no matter how many services hang.
+func probeServices(ctx context.Context, serviceURLs map[string]string, timeout time.Duration) (map[string]string, bool) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	statuses := make(map[string]string, len(serviceURLs))
+	allHealthy := true
+
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+
+	for name, serviceURL := range serviceURLs {
+		wg.Add(1)
+		go func(name, serviceURL string) {
+			defer wg.Done()
+
+			status := probeService(ctx, serviceURL)
+
+			mu.Lock()
+			statuses[name] = status
+			if status == "timeout" || status == "unhealthy" {
+				allHealthy = false
+			}
+			mu.Unlock()
+		}(name, serviceURL)
+	}
+
+	wg.Wait()
+
+	return statuses, allHealthy
+}
+
+// probeService returns the service's health body, "timeout" if it did not
+// answer in time, or "unhealthy" on any other failure
+func probeService(ctx context.Context, serviceURL string) string {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, serviceURL+"/health", nil)
+	if err != nil {
+		return "unhealthy"
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return "timeout"
+		}
+		return "unhealthy"
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "unhealthy"
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return "timeout"
+		}
+		return "unhealthy"
+	}
+
+	return strings.TrimSpace(string(body))
+}
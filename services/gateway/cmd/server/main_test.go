@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProbeServices_TimeoutIsBounded(t *testing.T) {
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	}))
+	defer healthy.Close()
+
+	release := make(chan struct{})
+	hung := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer hung.Close()
+	defer close(release)
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+
+	start := time.Now()
+	statuses, allHealthy := probeServices(context.Background(), map[string]string{
+		"healthy": healthy.URL,
+		"hung1":   hung.URL,
+		"hung2":   hung.URL,
+		"failing": failing.URL,
+	}, 200*time.Millisecond)
+	elapsed := time.Since(start)
+
+	if elapsed > time.Second {
+		t.Errorf("probes took %v, expected them to run concurrently within the timeout", elapsed)
+	}
+	if allHealthy {
+		t.Error("expected aggregate status to be unhealthy")
+	}
+
+	expected := map[string]string{
+		"healthy": "OK",
+		"hung1":   "timeout",
+		"hung2":   "timeout",
+		"failing": "unhealthy",
+	}
+	for name, want := range expected {
+		if statuses[name] != want {
+			t.Errorf("%s: expected %q, got %q", name, want, statuses[name])
+		}
+	}
+}
+
+func TestServiceProxy_FallsBackOnDialError(t *testing.T) {
+	local := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Write([]byte("local:" + r.URL.Path + ":" + string(body)))
+	}))
+	defer local.Close()
+
+	// Reserve a port and release it so nothing is listening there
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to reserve port: %v", err)
+	}
+	downURL := "http://" + listener.Addr().String()
+	listener.Close()
+
+	proxy, err := newServiceProxy(downURL, local.URL)
+	if err != nil {
+		t.Fatalf("failed to create proxy: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/users/login", strings.NewReader("payload"))
+	rec := httptest.NewRecorder()
+	proxy.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	if got := rec.Body.String(); got != "local:/api/users/login:payload" {
+		t.Errorf("unexpected response body %q", got)
+	}
+}
+
+func TestServiceProxy_RejectsOversizedBody(t *testing.T) {
+	primaryHit := false
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		primaryHit = true
+	}))
+	defer primary.Close()
+
+	proxy, err := newServiceProxy(primary.URL, "http://localhost:1")
+	if err != nil {
+		t.Fatalf("failed to create proxy: %v", err)
+	}
+	proxy.Transport.(*fallbackTransport).maxBody = 4
+
+	rec := httptest.NewRecorder()
+	proxy.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/users/login", strings.NewReader("payload")))
+
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected 413, got %d", rec.Code)
+	}
+	if primaryHit {
+		t.Error("oversized request should not be forwarded")
+	}
+}
+
+func TestServiceProxy_DoesNotFallBackOnErrorStatus(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer primary.Close()
+
+	fallbackHit := false
+	local := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fallbackHit = true
+	}))
+	defer local.Close()
+
+	proxy, err := newServiceProxy(primary.URL, local.URL)
+	if err != nil {
+		t.Fatalf("failed to create proxy: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	proxy.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/users/list", nil))
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("expected 500, got %d", rec.Code)
+	}
+	if fallbackHit {
+		t.Error("fallback should not be used when the primary service responds")
+	}
+}
+
+func TestServiceProxy_BadGatewayWhenBothDown(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to reserve port: %v", err)
+	}
+	downURL := "http://" + listener.Addr().String()
+	listener.Close()
+
+	proxy, err := newServiceProxy("http://unreachable.invalid", downURL)
+	if err != nil {
+		t.Fatalf("failed to create proxy: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	proxy.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/users/list", nil))
+
+	if rec.Code != http.StatusBadGateway {
+		t.Errorf("expected 502, got %d", rec.Code)
+	}
+}
@@ -1,16 +1,33 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
+	"sync"
+	"time"
 
 	"github.com/dayanch951/marimo/shared/middleware"
+	"github.com/dayanch951/marimo/shared/models"
 	"github.com/gorilla/mux"
 )
 
 const port = ":8086"
 
+// statsTimeout bounds how long getStats waits on downstream services
+const statsTimeout = 3 * time.Second
+
+// Service URLs - in production, use service discovery
+var services = map[string]string{
+	"users":   "http://users:8081",
+	"factory": "http://factory:8084",
+	"shop":    "http://shop:8085",
+}
+
+var statsClient = &http.Client{Timeout: statsTimeout}
+
 type DashboardStats struct {
 	TotalUsers    int     `json:"total_users"`
 	TotalOrders   int     `json:"total_orders"`
@@ -60,18 +77,120 @@ func getDashboard(w http.ResponseWriter, r *http.Request) {
 }
 
 func getStats(w http.ResponseWriter, r *http.Request) {
-	// Mock stats - in production, this would aggregate from other services
-	stats := DashboardStats{
-		TotalUsers:     10,
-		TotalOrders:    25,
-		TotalRevenue:   1250.50,
-		ActiveProducts: 15,
+	claims := r.Context().Value(middleware.UserContextKey).(*middleware.Claims)
+
+	ctx, cancel := context.WithTimeout(r.Context(), statsTimeout)
+	defer cancel()
+
+	authHeader := r.Header.Get("Authorization")
+
+	// Only shop staff can see every order; everyone else gets their own
+	ordersPath := "/api/shop/orders"
+	if claims.Role == models.RoleAdmin || claims.Role == models.RoleShopManager {
+		ordersPath = "/api/shop/admin/orders"
 	}
 
-	respondJSON(w, http.StatusOK, map[string]interface{}{
+	var (
+		stats    DashboardStats
+		failed   []string
+		resultMu sync.Mutex
+		wg       sync.WaitGroup
+	)
+
+	fail := func(service string, err error) {
+		log.Printf("Failed to fetch stats from %s: %v", service, err)
+		resultMu.Lock()
+		failed = append(failed, service)
+		resultMu.Unlock()
+	}
+
+	wg.Add(3)
+
+	go func() {
+		defer wg.Done()
+		var resp struct {
+			Total int `json:"total"`
+		}
+		if err := fetchService(ctx, "users", "/api/users/list", authHeader, &resp); err != nil {
+			fail("users", err)
+			return
+		}
+		resultMu.Lock()
+		stats.TotalUsers = resp.Total
+		resultMu.Unlock()
+	}()
+
+	go func() {
+		defer wg.Done()
+		var resp struct {
+			Orders []struct {
+				Total float64 `json:"total"`
+			} `json:"orders"`
+		}
+		if err := fetchService(ctx, "shop", ordersPath, authHeader, &resp); err != nil {
+			fail("shop", err)
+			return
+		}
+		var revenue float64
+		for _, order := range resp.Orders {
+			revenue += order.Total
+		}
+		resultMu.Lock()
+		stats.TotalOrders = len(resp.Orders)
+		stats.TotalRevenue = revenue
+		resultMu.Unlock()
+	}()
+
+	go func() {
+		defer wg.Done()
+		var resp struct {
+			Products []json.RawMessage `json:"products"`
+		}
+		if err := fetchService(ctx, "factory", "/api/factory/products", authHeader, &resp); err != nil {
+			fail("factory", err)
+			return
+		}
+		resultMu.Lock()
+		stats.ActiveProducts = len(resp.Products)
+		resultMu.Unlock()
+	}()
+
+	wg.Wait()
+
+	response := map[string]interface{}{
 		"success": true,
 		"stats":   stats,
-	})
+		"partial": len(failed) > 0,
+	}
+	if len(failed) > 0 {
+		response["unavailable"] = failed
+	}
+
+	respondJSON(w, http.StatusOK, response)
+}
+
+// fetchService performs an authenticated GET against another service and
+// decodes the JSON response into out
+func fetchService(ctx context.Context, service, path, authHeader string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, services[service]+path, nil)
+	if err != nil {
+		return err
+	}
+	if authHeader != "" {
+		req.Header.Set("Authorization", authHeader)
+	}
+
+	resp, err := statsClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
 }
 
 func healthCheck(w http.ResponseWriter, r *http.Request) {
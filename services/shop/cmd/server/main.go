@@ -5,6 +5,9 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -15,6 +18,11 @@ import (
 
 const port = ":8085"
 
+const (
+	defaultProductLimit = 20
+	maxProductLimit     = 200
+)
+
 type ShopProduct struct {
 	ID          string  `json:"id"`
 	Name        string  `json:"name"`
@@ -40,6 +48,28 @@ type OrderItem struct {
 	Price     float64 `json:"price"`
 }
 
+// Order statuses
+const (
+	OrderStatusPending    = "pending"
+	OrderStatusProcessing = "processing"
+	OrderStatusShipped    = "shipped"
+	OrderStatusDelivered  = "delivered"
+)
+
+// orderTransitions lists the legal next status for each order status
+var orderTransitions = map[string]string{
+	OrderStatusPending:    OrderStatusProcessing,
+	OrderStatusProcessing: OrderStatusShipped,
+	OrderStatusShipped:    OrderStatusDelivered,
+}
+
+// InsufficientItem describes an order line that exceeds available stock
+type InsufficientItem struct {
+	ProductID string `json:"product_id"`
+	Requested int    `json:"requested"`
+	Available int    `json:"available"`
+}
+
 var (
 	shopProducts = make(map[string]*ShopProduct)
 	orders       = make(map[string]*Order)
@@ -73,6 +103,7 @@ func main() {
 	admin.HandleFunc("/products/{id}", updateProduct).Methods("PUT")
 	admin.HandleFunc("/products/{id}", deleteProduct).Methods("DELETE")
 	admin.HandleFunc("/orders", listAllOrders).Methods("GET")
+	admin.HandleFunc("/orders/{id}/status", updateOrderStatus).Methods("PUT")
 
 	handler := middleware.CORS(router)
 
@@ -105,20 +136,124 @@ func initDefaultProducts() {
 }
 
 func listProducts(w http.ResponseWriter, r *http.Request) {
-	mu.RLock()
-	defer mu.RUnlock()
+	query := r.URL.Query()
 
-	products := make([]*ShopProduct, 0, len(shopProducts))
+	page, err := parsePositiveInt(query.Get("page"), 1)
+	if err != nil {
+		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"message": "Invalid page parameter",
+		})
+		return
+	}
+
+	limit, err := parsePositiveInt(query.Get("limit"), defaultProductLimit)
+	if err != nil {
+		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"message": "Invalid limit parameter",
+		})
+		return
+	}
+	if limit > maxProductLimit {
+		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"message": fmt.Sprintf("limit must not exceed %d", maxProductLimit),
+		})
+		return
+	}
+
+	minPrice, err := parsePrice(query.Get("min_price"))
+	if err != nil {
+		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"message": "Invalid min_price parameter",
+		})
+		return
+	}
+
+	maxPrice, err := parsePrice(query.Get("max_price"))
+	if err != nil {
+		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"message": "Invalid max_price parameter",
+		})
+		return
+	}
+
+	category := query.Get("category")
+
+	mu.RLock()
+	products := make([]ShopProduct, 0, len(shopProducts))
 	for _, p := range shopProducts {
-		products = append(products, p)
+		if category != "" && !strings.EqualFold(p.Category, category) {
+			continue
+		}
+		if minPrice != nil && p.Price < *minPrice {
+			continue
+		}
+		if maxPrice != nil && p.Price > *maxPrice {
+			continue
+		}
+		products = append(products, *p)
+	}
+	mu.RUnlock()
+
+	// Map iteration order is random, so sort before paginating to keep
+	// pages stable across requests
+	sort.Slice(products, func(i, j int) bool {
+		return products[i].ID < products[j].ID
+	})
+
+	// Pages past the end are empty. Compare before multiplying so a huge
+	// page can't overflow the offset.
+	total := len(products)
+	start := total
+	if page-1 <= total/limit {
+		start = min((page-1)*limit, total)
+	}
+	end := start + limit
+	if end > total {
+		end = total
 	}
 
 	respondJSON(w, http.StatusOK, map[string]interface{}{
 		"success":  true,
-		"products": products,
+		"products": products[start:end],
+		"page":     page,
+		"limit":    limit,
+		"total":    total,
 	})
 }
 
+// parsePositiveInt parses an optional positive integer query parameter
+func parsePositiveInt(value string, def int) (int, error) {
+	if value == "" {
+		return def, nil
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("invalid positive integer: %q", value)
+	}
+
+	return n, nil
+}
+
+// parsePrice parses an optional non-negative price query parameter
+func parsePrice(value string) (*float64, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	price, err := strconv.ParseFloat(value, 64)
+	if err != nil || price < 0 {
+		return nil, fmt.Errorf("invalid price: %q", value)
+	}
+
+	return &price, nil
+}
+
 func getProduct(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
@@ -225,18 +360,91 @@ func createOrder(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if len(order.Items) == 0 {
+		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"message": "Order must contain at least one item",
+		})
+		return
+	}
+
+	for _, item := range order.Items {
+		if item.Quantity < 1 {
+			respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+				"success": false,
+				"message": fmt.Sprintf("Invalid quantity for product %s", item.ProductID),
+			})
+			return
+		}
+	}
+
 	mu.Lock()
+
+	// Sum requested quantities per product so duplicate lines can't bypass
+	// the stock check
+	requested := make(map[string]int)
+	for _, item := range order.Items {
+		requested[item.ProductID] += item.Quantity
+	}
+
+	missing := make([]string, 0)
+	insufficient := make([]InsufficientItem, 0)
+	for productID, quantity := range requested {
+		product, exists := shopProducts[productID]
+		if !exists {
+			missing = append(missing, productID)
+			continue
+		}
+		if quantity > product.Stock {
+			insufficient = append(insufficient, InsufficientItem{
+				ProductID: productID,
+				Requested: quantity,
+				Available: product.Stock,
+			})
+		}
+	}
+
+	if len(missing) > 0 {
+		mu.Unlock()
+		sort.Strings(missing)
+		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success":  false,
+			"message":  "Unknown products in order",
+			"products": missing,
+		})
+		return
+	}
+
+	if len(insufficient) > 0 {
+		mu.Unlock()
+		sort.Slice(insufficient, func(i, j int) bool {
+			return insufficient[i].ProductID < insufficient[j].ProductID
+		})
+		respondJSON(w, http.StatusConflict, map[string]interface{}{
+			"success": false,
+			"message": "Insufficient stock",
+			"items":   insufficient,
+		})
+		return
+	}
+
+	// Take prices from the catalog rather than trusting the client
+	var total float64
+	for i := range order.Items {
+		product := shopProducts[order.Items[i].ProductID]
+		order.Items[i].Price = product.Price
+		total += product.Price * float64(order.Items[i].Quantity)
+	}
+
+	for productID, quantity := range requested {
+		shopProducts[productID].Stock -= quantity
+	}
+
 	orderCounter++
 	order.ID = fmt.Sprintf("ORDER-%d", orderCounter)
 	order.UserID = claims.UserID
 	order.CreatedAt = time.Now()
-	order.Status = "pending"
-
-	// Calculate total
-	var total float64
-	for _, item := range order.Items {
-		total += item.Price * float64(item.Quantity)
-	}
+	order.Status = OrderStatusPending
 	order.Total = total
 
 	orders[order.ID] = &order
@@ -312,6 +520,53 @@ func getOrder(w http.ResponseWriter, r *http.Request) {
 	respondJSON(w, http.StatusOK, order)
 }
 
+func updateOrderStatus(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	var req struct {
+		Status string `json:"status"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Status == "" {
+		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"message": "Invalid request body",
+		})
+		return
+	}
+
+	mu.Lock()
+	order, exists := orders[id]
+	if !exists {
+		mu.Unlock()
+		respondJSON(w, http.StatusNotFound, map[string]interface{}{
+			"success": false,
+			"message": "Order not found",
+		})
+		return
+	}
+
+	if next, ok := orderTransitions[order.Status]; !ok || next != req.Status {
+		current := order.Status
+		mu.Unlock()
+		respondJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{
+			"success": false,
+			"message": fmt.Sprintf("Cannot transition order from %q to %q", current, req.Status),
+		})
+		return
+	}
+
+	order.Status = req.Status
+	updated := *order
+	mu.Unlock()
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"message": "Order status updated",
+		"order":   updated,
+	})
+}
+
 func healthCheck(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("Shop Service OK"))
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/dayanch951/marimo/shared/middleware"
+	"github.com/gorilla/mux"
+)
+
+func resetStore() {
+	mu.Lock()
+	shopProducts = make(map[string]*ShopProduct)
+	orders = make(map[string]*Order)
+	orderCounter = 0
+	mu.Unlock()
+}
+
+func newOrderRequest(t *testing.T, userID string, items []OrderItem) *http.Request {
+	t.Helper()
+
+	body, err := json.Marshal(Order{Items: items})
+	if err != nil {
+		t.Fatalf("failed to marshal order: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/shop/orders", bytes.NewReader(body))
+	claims := &middleware.Claims{UserID: userID, Role: "user"}
+	return req.WithContext(context.WithValue(req.Context(), middleware.UserContextKey, claims))
+}
+
+func TestCreateOrder_ConcurrentLastUnit(t *testing.T) {
+	resetStore()
+	shopProducts["SHOP-1"] = &ShopProduct{ID: "SHOP-1", Price: 10, Stock: 1}
+
+	var wg sync.WaitGroup
+	codes := make([]int, 2)
+	for i := range codes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			rec := httptest.NewRecorder()
+			createOrder(rec, newOrderRequest(t, "user-1", []OrderItem{{ProductID: "SHOP-1", Quantity: 1}}))
+			codes[i] = rec.Code
+		}(i)
+	}
+	wg.Wait()
+
+	created, conflicts := 0, 0
+	for _, code := range codes {
+		switch code {
+		case http.StatusCreated:
+			created++
+		case http.StatusConflict:
+			conflicts++
+		}
+	}
+
+	if created != 1 || conflicts != 1 {
+		t.Fatalf("expected one success and one conflict, got codes %v", codes)
+	}
+	if stock := shopProducts["SHOP-1"].Stock; stock != 0 {
+		t.Errorf("expected stock 0, got %d", stock)
+	}
+}
+
+func TestCreateOrder_UsesCatalogPrice(t *testing.T) {
+	resetStore()
+	shopProducts["SHOP-1"] = &ShopProduct{ID: "SHOP-1", Price: 25, Stock: 5}
+
+	rec := httptest.NewRecorder()
+	createOrder(rec, newOrderRequest(t, "user-1", []OrderItem{{ProductID: "SHOP-1", Quantity: 2, Price: 0.01}}))
+
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", rec.Code)
+	}
+
+	var resp struct {
+		Order Order `json:"order"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+
+	if resp.Order.Total != 50 {
+		t.Errorf("expected total 50, got %v", resp.Order.Total)
+	}
+	if stock := shopProducts["SHOP-1"].Stock; stock != 3 {
+		t.Errorf("expected stock 3, got %d", stock)
+	}
+}
+
+func TestCreateOrder_UnknownProduct(t *testing.T) {
+	resetStore()
+
+	rec := httptest.NewRecorder()
+	createOrder(rec, newOrderRequest(t, "user-1", []OrderItem{{ProductID: "MISSING", Quantity: 1}}))
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", rec.Code)
+	}
+}
+
+func TestUpdateOrderStatus_Transitions(t *testing.T) {
+	resetStore()
+	orders["ORDER-1"] = &Order{ID: "ORDER-1", Status: OrderStatusPending}
+
+	tests := []struct {
+		status string
+		code   int
+	}{
+		{OrderStatusShipped, http.StatusUnprocessableEntity},
+		{OrderStatusProcessing, http.StatusOK},
+		{OrderStatusPending, http.StatusUnprocessableEntity},
+		{OrderStatusShipped, http.StatusOK},
+		{OrderStatusDelivered, http.StatusOK},
+		{OrderStatusDelivered, http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		body, _ := json.Marshal(map[string]string{"status": tt.status})
+		req := httptest.NewRequest(http.MethodPut, "/api/shop/admin/orders/ORDER-1/status", bytes.NewReader(body))
+		req = mux.SetURLVars(req, map[string]string{"id": "ORDER-1"})
+
+		rec := httptest.NewRecorder()
+		updateOrderStatus(rec, req)
+
+		if rec.Code != tt.code {
+			t.Errorf("status %q: expected %d, got %d", tt.status, tt.code, rec.Code)
+		}
+	}
+
+	if status := orders["ORDER-1"].Status; status != OrderStatusDelivered {
+		t.Errorf("expected final status %q, got %q", OrderStatusDelivered, status)
+	}
+}
+
+func listProductIDs(t *testing.T, query string) (int, []string) {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	listProducts(rec, httptest.NewRequest(http.MethodGet, "/api/shop/products?"+query, nil))
+
+	var resp struct {
+		Products []ShopProduct `json:"products"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+
+	ids := make([]string, 0, len(resp.Products))
+	for _, p := range resp.Products {
+		ids = append(ids, p.ID)
+	}
+	return rec.Code, ids
+}
+
+func TestListProducts_Filters(t *testing.T) {
+	resetStore()
+	shopProducts["SHOP-1"] = &ShopProduct{ID: "SHOP-1", Price: 5, Category: "Books"}
+	shopProducts["SHOP-2"] = &ShopProduct{ID: "SHOP-2", Price: 15, Category: "Electronics"}
+	shopProducts["SHOP-3"] = &ShopProduct{ID: "SHOP-3", Price: 25, Category: "Electronics"}
+	shopProducts["SHOP-4"] = &ShopProduct{ID: "SHOP-4", Price: 35, Category: "Books"}
+	shopProducts["SHOP-5"] = &ShopProduct{ID: "SHOP-5", Price: 45, Category: "Electronics"}
+
+	tests := []struct {
+		query string
+		code  int
+		ids   []string
+	}{
+		{"", http.StatusOK, []string{"SHOP-1", "SHOP-2", "SHOP-3", "SHOP-4", "SHOP-5"}},
+		{"min_price=15&max_price=35", http.StatusOK, []string{"SHOP-2", "SHOP-3", "SHOP-4"}},
+		{"min_price=40", http.StatusOK, []string{"SHOP-5"}},
+		{"category=electronics&max_price=30", http.StatusOK, []string{"SHOP-2", "SHOP-3"}},
+		{"limit=2", http.StatusOK, []string{"SHOP-1", "SHOP-2"}},
+		{"limit=2&page=3", http.StatusOK, []string{"SHOP-5"}},
+		{"limit=2&page=4", http.StatusOK, []string{}},
+		{"limit=4&page=4611686018427387904", http.StatusOK, []string{}},
+		{"limit=1&page=9223372036854775807", http.StatusOK, []string{}},
+		{"page=0", http.StatusBadRequest, []string{}},
+		{"limit=201", http.StatusBadRequest, []string{}},
+		{"min_price=-1", http.StatusBadRequest, []string{}},
+		{"max_price=abc", http.StatusBadRequest, []string{}},
+	}
+
+	for _, tt := range tests {
+		code, ids := listProductIDs(t, tt.query)
+		if code != tt.code {
+			t.Errorf("query %q: expected %d, got %d", tt.query, tt.code, code)
+			continue
+		}
+		if strings.Join(ids, ",") != strings.Join(tt.ids, ",") {
+			t.Errorf("query %q: expected %v, got %v", tt.query, tt.ids, ids)
+		}
+	}
+}
@@ -7,9 +7,11 @@ import (
 
 	"github.com/dayanch951/marimo/services/users/internal/handlers"
 	"github.com/dayanch951/marimo/shared/database"
+	"github.com/dayanch951/marimo/shared/email"
 	"github.com/dayanch951/marimo/shared/logger"
 	"github.com/dayanch951/marimo/shared/middleware"
 	"github.com/dayanch951/marimo/shared/models"
+	"github.com/dayanch951/marimo/shared/monitoring"
 	"github.com/dayanch951/marimo/shared/utils"
 	"github.com/gorilla/mux"
 )
@@ -39,7 +41,7 @@ func main() {
 
 	if usePostgres == "true" {
 		log.Info("Initializing PostgreSQL database...")
-		pgDB, err := database.NewPostgresDB(dbHost, dbPort, dbUser, dbPassword, dbName, dbSSLMode)
+		pgDB, err := database.NewPostgresDB(dbHost, dbPort, dbUser, dbPassword, dbName, dbSSLMode, monitoring.Default())
 		if err != nil {
 			log.Fatalf("Failed to connect to PostgreSQL: %v", err)
 		}
@@ -60,15 +62,23 @@ func main() {
 	}
 
 	// Create default admin user
-	_, err = db.CreateUser("admin@example.com", "admin123", "Admin User", models.RoleAdmin)
+	adminUser, err := db.CreateUser("admin@example.com", "admin123", "Admin User", models.RoleAdmin)
 	if err != nil {
 		log.Infof("Admin user already exists or error: %v", err)
 	} else {
+		db.MarkEmailVerified(adminUser.ID)
 		log.Info("Default admin user created: admin@example.com / admin123")
 	}
 
+	mailer := email.NewEmailService()
+	defer mailer.Close()
+
 	// Create handlers
-	authHandler := handlers.NewAuthHandler(db)
+	authHandler := handlers.NewAuthHandler(db, mailer, handlers.AuthConfig{
+		PublicURL:            getEnv("PUBLIC_URL", "http://localhost:8080"),
+		ResetPasswordURL:     getEnv("RESET_PASSWORD_URL", "http://localhost:3000/reset-password"),
+		RequireVerifiedEmail: getEnv("REQUIRE_EMAIL_VERIFICATION", "false") == "true",
+	})
 
 	// Create router
 	router := mux.NewRouter()
@@ -78,12 +88,20 @@ func main() {
 	router.HandleFunc("/api/users/login", authHandler.Login).Methods("POST")
 	router.HandleFunc("/api/users/refresh", authHandler.RefreshToken).Methods("POST")
 	router.HandleFunc("/api/users/logout", authHandler.Logout).Methods("POST")
+	router.HandleFunc("/api/users/verify", authHandler.VerifyEmail).Methods("GET")
+	router.HandleFunc("/api/users/forgot-password", authHandler.ForgotPassword).Methods("POST")
+	router.HandleFunc("/api/users/reset-password", authHandler.ResetPassword).Methods("POST")
 	router.HandleFunc("/health", healthCheck(log)).Methods("GET")
+	router.Handle("/metrics", monitoring.Default().Handler()).Methods("GET")
 
 	// Protected routes
 	protected := router.PathPrefix("/api/users").Subrouter()
 	protected.Use(middleware.AuthMiddleware)
 	protected.HandleFunc("/profile", authHandler.GetProfile).Methods("GET")
+	protected.HandleFunc("/profile", authHandler.UpdateProfile).Methods("PUT")
+	protected.HandleFunc("/password", authHandler.ChangePassword).Methods("POST")
+	protected.HandleFunc("/sessions", authHandler.ListSessions).Methods("GET")
+	protected.HandleFunc("/sessions/{id}", authHandler.RevokeSession).Methods("DELETE")
 	protected.HandleFunc("/list", authHandler.ListUsers).Methods("GET")
 
 	// Admin only routes
@@ -91,6 +109,7 @@ func main() {
 	admin.Use(middleware.AuthMiddleware)
 	admin.Use(middleware.RoleMiddleware(models.RoleAdmin))
 	admin.HandleFunc("/assign-role", authHandler.AssignRole).Methods("POST")
+	admin.HandleFunc("/{id}", authHandler.DeleteUser).Methods("DELETE")
 
 	// Apply CORS
 	handler := middleware.CORS(router)
@@ -116,6 +135,7 @@ func main() {
 	utils.GracefulShutdown(server, 30*time.Second, func() {
 		log.Info("Shutting down Users Service gracefully...")
 	})
+	authHandler.Wait()
 
 	log.Info("Users Service stopped")
 }
@@ -1,22 +1,69 @@
 package handlers
 
 import (
+	"crypto/rand"
+	"encoding/base64"
 	"encoding/json"
+	"log"
 	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/dayanch951/marimo/shared/database"
+	apperrors "github.com/dayanch951/marimo/shared/errors"
 	"github.com/dayanch951/marimo/shared/middleware"
 	"github.com/dayanch951/marimo/shared/models"
+	"github.com/dayanch951/marimo/shared/tenancy"
 	"github.com/dayanch951/marimo/shared/utils"
 	"github.com/dayanch951/marimo/shared/validator"
+	"github.com/gorilla/mux"
+	"golang.org/x/crypto/bcrypt"
 )
 
+const (
+	// VerificationTokenDuration is how long email verification links work
+	VerificationTokenDuration = 24 * time.Hour
+	// PasswordResetTokenDuration is how long password reset links work
+	PasswordResetTokenDuration = time.Hour
+)
+
+// Mailer sends the emails of the auth flows. *email.EmailService
+// implements it.
+type Mailer interface {
+	SendVerificationEmail(to, name, verifyLink string) error
+	SendPasswordResetEmail(to, resetLink string) error
+}
+
+// AuthConfig holds the settings of the auth flows
+type AuthConfig struct {
+	// PublicURL is the address clients reach the API on, used for links
+	// in emails
+	PublicURL string
+	// ResetPasswordURL is the page where users choose a new password. The
+	// reset token is added to it as the token query parameter.
+	ResetPasswordURL string
+	// RequireVerifiedEmail refuses logins until the user has verified
+	// their email address
+	RequireVerifiedEmail bool
+}
+
 type AuthHandler struct {
-	db database.Database
+	db     database.Database
+	mailer Mailer
+	config AuthConfig
+
+	background sync.WaitGroup // Emails sent after responding
 }
 
-func NewAuthHandler(db database.Database) *AuthHandler {
-	return &AuthHandler{db: db}
+func NewAuthHandler(db database.Database, mailer Mailer, config AuthConfig) *AuthHandler {
+	return &AuthHandler{db: db, mailer: mailer, config: config}
+}
+
+// Wait blocks until emails sent in the background have been sent
+func (h *AuthHandler) Wait() {
+	h.background.Wait()
 }
 
 type LoginRequest struct {
@@ -31,14 +78,42 @@ type RegisterRequest struct {
 }
 
 type AuthResponse struct {
-	Success      bool               `json:"success"`
-	Message      string             `json:"message"`
-	Token        string             `json:"token,omitempty"` // Deprecated: use TokenPair
-	User         *models.User       `json:"user,omitempty"`
-	AccessToken  string             `json:"access_token,omitempty"`
-	RefreshToken string             `json:"refresh_token,omitempty"`
-	ExpiresIn    int64              `json:"expires_in,omitempty"`
-	TokenType    string             `json:"token_type,omitempty"`
+	Success      bool                `json:"success"`
+	Message      string              `json:"message"`
+	Token        string              `json:"token,omitempty"` // Deprecated: use TokenPair
+	User         *models.User        `json:"user,omitempty"`
+	AccessToken  string              `json:"access_token,omitempty"`
+	RefreshToken string              `json:"refresh_token,omitempty"`
+	ExpiresIn    int64               `json:"expires_in,omitempty"`
+	TokenType    string              `json:"token_type,omitempty"`
+	Code         apperrors.ErrorCode `json:"code,omitempty"`
+}
+
+type UpdateProfileRequest struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+type ChangePasswordRequest struct {
+	OldPassword string `json:"old_password"`
+	NewPassword string `json:"new_password"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+type ResetPasswordRequest struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"new_password"`
+}
+
+// Session is a refresh token as shown to its owner. The token itself is
+// left out so that listing sessions can't be used to take them over.
+type Session struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
 }
 
 type RefreshRequest struct {
@@ -82,6 +157,28 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Signups through a tenant count against its plan's user limit
+	tenant, hasTenant := tenancy.TenantFromContext(r.Context())
+	if hasTenant {
+		current, err := h.db.CountUsersByTenant(tenant.ID.String())
+		if err != nil {
+			respondJSON(w, http.StatusInternalServerError, AuthResponse{
+				Success: false,
+				Message: "Failed to create user",
+			})
+			return
+		}
+
+		if err := tenant.CheckUserQuota(current); err != nil {
+			respondJSON(w, http.StatusForbidden, AuthResponse{
+				Success: false,
+				Message: err.Error(),
+				Code:    apperrors.ErrQuotaExceeded,
+			})
+			return
+		}
+	}
+
 	user, err := h.db.CreateUser(req.Email, req.Password, req.Name, models.RoleUser)
 	if err != nil {
 		if err == database.ErrUserAlreadyExists {
@@ -98,13 +195,87 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if hasTenant {
+		if err := h.db.AssignTenant(user.ID, tenant.ID.String()); err != nil {
+			respondJSON(w, http.StatusInternalServerError, AuthResponse{
+				Success: false,
+				Message: "Failed to create user",
+			})
+			return
+		}
+	}
+
+	// The account exists at this point, so a failed email doesn't fail
+	// the request
+	message := "User created successfully, check your email to verify your address"
+	if err := h.sendVerificationEmail(user); err != nil {
+		message = "User created successfully, but the verification email could not be sent"
+	}
+
 	respondJSON(w, http.StatusCreated, AuthResponse{
 		Success: true,
-		Message: "User created successfully",
+		Message: message,
 		User:    user,
 	})
 }
 
+// sendVerificationEmail emails user a link to VerifyEmail
+func (h *AuthHandler) sendVerificationEmail(user *models.User) error {
+	token, err := generateUserToken()
+	if err != nil {
+		return err
+	}
+
+	_, err = h.db.CreateUserToken(user.ID, models.TokenPurposeEmailVerification, token, time.Now().Add(VerificationTokenDuration))
+	if err != nil {
+		return err
+	}
+
+	link := strings.TrimRight(h.config.PublicURL, "/") + "/api/users/verify?token=" + url.QueryEscape(token)
+	return h.mailer.SendVerificationEmail(user.Email, user.Name, link)
+}
+
+// VerifyEmail marks the owner of the token in the query string as verified
+func (h *AuthHandler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		respondJSON(w, http.StatusBadRequest, AuthResponse{
+			Success: false,
+			Message: "Verification token is required",
+		})
+		return
+	}
+
+	userToken, err := h.db.ConsumeUserToken(models.TokenPurposeEmailVerification, token)
+	if err != nil {
+		if err == database.ErrUserTokenInvalid || err == database.ErrUserTokenExpired {
+			respondJSON(w, http.StatusBadRequest, AuthResponse{
+				Success: false,
+				Message: "Invalid or expired verification token",
+			})
+			return
+		}
+		respondJSON(w, http.StatusInternalServerError, AuthResponse{
+			Success: false,
+			Message: "Failed to verify email",
+		})
+		return
+	}
+
+	if err := h.db.MarkEmailVerified(userToken.UserID); err != nil {
+		respondJSON(w, http.StatusInternalServerError, AuthResponse{
+			Success: false,
+			Message: "Failed to verify email",
+		})
+		return
+	}
+
+	respondJSON(w, http.StatusOK, AuthResponse{
+		Success: true,
+		Message: "Email verified successfully",
+	})
+}
+
 func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	var req LoginRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -142,6 +313,15 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if h.config.RequireVerifiedEmail && !user.EmailVerified {
+		respondJSON(w, http.StatusForbidden, AuthResponse{
+			Success: false,
+			Message: "Email address has not been verified",
+			Code:    apperrors.ErrEmailNotVerified,
+		})
+		return
+	}
+
 	// Generate token pair (access + refresh)
 	tokenPair, refreshToken, refreshExpiry, err := utils.GenerateTokenPair(user)
 	if err != nil {
@@ -195,6 +375,312 @@ func (h *AuthHandler) GetProfile(w http.ResponseWriter, r *http.Request) {
 	respondJSON(w, http.StatusOK, user)
 }
 
+// UpdateProfile changes the name and email of the authenticated user
+func (h *AuthHandler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(middleware.UserContextKey).(*middleware.Claims)
+	if !ok {
+		respondJSON(w, http.StatusUnauthorized, AuthResponse{
+			Success: false,
+			Message: "Unauthorized",
+		})
+		return
+	}
+
+	var req UpdateProfileRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondJSON(w, http.StatusBadRequest, AuthResponse{
+			Success: false,
+			Message: "Invalid request body",
+		})
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	req.Email = strings.TrimSpace(req.Email)
+
+	if err := validator.ValidateEmail(req.Email); err != nil {
+		respondJSON(w, http.StatusBadRequest, AuthResponse{
+			Success: false,
+			Message: "Invalid email format",
+		})
+		return
+	}
+
+	if err := validator.ValidateName(req.Name); err != nil {
+		respondJSON(w, http.StatusBadRequest, AuthResponse{
+			Success: false,
+			Message: "Invalid name format",
+		})
+		return
+	}
+
+	// The email may only belong to this user. Not finding it means it
+	// changed.
+	existing, err := h.db.GetUserByEmail(req.Email)
+	emailChanged := err == database.ErrUserNotFound
+	if err == nil && existing.ID != claims.UserID {
+		respondJSON(w, http.StatusConflict, AuthResponse{
+			Success: false,
+			Message: "Email is already in use",
+		})
+		return
+	}
+	if err != nil && err != database.ErrUserNotFound {
+		respondJSON(w, http.StatusInternalServerError, AuthResponse{
+			Success: false,
+			Message: "Failed to update profile",
+		})
+		return
+	}
+
+	if err := h.db.UpdateUser(claims.UserID, req.Name, req.Email); err != nil {
+		switch err {
+		case database.ErrUserNotFound:
+			respondJSON(w, http.StatusNotFound, AuthResponse{
+				Success: false,
+				Message: "User not found",
+			})
+		case database.ErrUserAlreadyExists:
+			respondJSON(w, http.StatusConflict, AuthResponse{
+				Success: false,
+				Message: "Email is already in use",
+			})
+		default:
+			respondJSON(w, http.StatusInternalServerError, AuthResponse{
+				Success: false,
+				Message: "Failed to update profile",
+			})
+		}
+		return
+	}
+
+	user, err := h.db.GetUserByID(claims.UserID)
+	if err != nil {
+		respondJSON(w, http.StatusInternalServerError, AuthResponse{
+			Success: false,
+			Message: "Failed to update profile",
+		})
+		return
+	}
+
+	// A new address has to be verified again
+	message := "Profile updated successfully"
+	if emailChanged {
+		message = "Profile updated successfully, check your email to verify your new address"
+		if err := h.sendVerificationEmail(user); err != nil {
+			message = "Profile updated successfully, but the verification email could not be sent"
+		}
+	}
+
+	respondJSON(w, http.StatusOK, AuthResponse{
+		Success: true,
+		Message: message,
+		User:    user,
+	})
+}
+
+// ChangePassword replaces the authenticated user's password after checking
+// the current one, and logs out every session
+func (h *AuthHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(middleware.UserContextKey).(*middleware.Claims)
+	if !ok {
+		respondJSON(w, http.StatusUnauthorized, AuthResponse{
+			Success: false,
+			Message: "Unauthorized",
+		})
+		return
+	}
+
+	var req ChangePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondJSON(w, http.StatusBadRequest, AuthResponse{
+			Success: false,
+			Message: "Invalid request body",
+		})
+		return
+	}
+
+	if err := validator.ValidatePassword(req.NewPassword, validator.DefaultPasswordRequirements()); err != nil {
+		respondJSON(w, http.StatusBadRequest, AuthResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	// The email in the token may be stale if the profile was updated
+	user, err := h.db.GetUserByID(claims.UserID)
+	if err != nil {
+		respondJSON(w, http.StatusNotFound, AuthResponse{
+			Success: false,
+			Message: "User not found",
+		})
+		return
+	}
+
+	if _, err := h.db.ValidatePassword(user.Email, req.OldPassword); err != nil {
+		respondJSON(w, http.StatusForbidden, AuthResponse{
+			Success: false,
+			Message: "Current password is incorrect",
+		})
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		respondJSON(w, http.StatusInternalServerError, AuthResponse{
+			Success: false,
+			Message: "Failed to change password",
+		})
+		return
+	}
+
+	if err := h.db.UpdatePassword(user.ID, string(hashedPassword)); err != nil {
+		respondJSON(w, http.StatusInternalServerError, AuthResponse{
+			Success: false,
+			Message: "Failed to change password",
+		})
+		return
+	}
+
+	// Sessions opened with the old password must not outlive it
+	if err := h.db.RevokeAllUserTokens(user.ID); err != nil {
+		respondJSON(w, http.StatusInternalServerError, AuthResponse{
+			Success: false,
+			Message: "Password changed, but failed to log out other sessions",
+		})
+		return
+	}
+
+	respondJSON(w, http.StatusOK, AuthResponse{
+		Success: true,
+		Message: "Password changed successfully",
+	})
+}
+
+// ForgotPassword emails a password reset link to the given address. It
+// answers the same whether or not the address belongs to a user, so it
+// can't be used to find out who has an account.
+func (h *AuthHandler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req ForgotPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondJSON(w, http.StatusBadRequest, AuthResponse{
+			Success: false,
+			Message: "Invalid request body",
+		})
+		return
+	}
+
+	// Failures aren't reported, as that would reveal that the account
+	// exists. For the same reason the email is sent after responding, so
+	// known and unknown addresses take as long to answer.
+	if user, err := h.db.GetUserByEmail(strings.TrimSpace(req.Email)); err == nil {
+		h.background.Add(1)
+		go func() {
+			defer h.background.Done()
+			if err := h.sendPasswordResetEmail(user); err != nil {
+				log.Printf("Failed to send password reset email to user %s: %v", user.ID, err)
+			}
+		}()
+	}
+
+	respondJSON(w, http.StatusOK, AuthResponse{
+		Success: true,
+		Message: "If an account with that email exists, a password reset link has been sent",
+	})
+}
+
+// sendPasswordResetEmail emails user a link to reset their password
+func (h *AuthHandler) sendPasswordResetEmail(user *models.User) error {
+	token, err := generateUserToken()
+	if err != nil {
+		return err
+	}
+
+	_, err = h.db.CreateUserToken(user.ID, models.TokenPurposePasswordReset, token, time.Now().Add(PasswordResetTokenDuration))
+	if err != nil {
+		return err
+	}
+
+	link, err := url.Parse(h.config.ResetPasswordURL)
+	if err != nil {
+		return err
+	}
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+
+	return h.mailer.SendPasswordResetEmail(user.Email, link.String())
+}
+
+// ResetPassword sets a new password for the owner of a reset token and
+// logs out every session
+func (h *AuthHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req ResetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondJSON(w, http.StatusBadRequest, AuthResponse{
+			Success: false,
+			Message: "Invalid request body",
+		})
+		return
+	}
+
+	// Check the password first so a rejected one doesn't use up the token
+	if err := validator.ValidatePassword(req.NewPassword, validator.DefaultPasswordRequirements()); err != nil {
+		respondJSON(w, http.StatusBadRequest, AuthResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	userToken, err := h.db.ConsumeUserToken(models.TokenPurposePasswordReset, req.Token)
+	if err != nil {
+		if err == database.ErrUserTokenInvalid || err == database.ErrUserTokenExpired {
+			respondJSON(w, http.StatusBadRequest, AuthResponse{
+				Success: false,
+				Message: "Invalid or expired reset token",
+			})
+			return
+		}
+		respondJSON(w, http.StatusInternalServerError, AuthResponse{
+			Success: false,
+			Message: "Failed to reset password",
+		})
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		respondJSON(w, http.StatusInternalServerError, AuthResponse{
+			Success: false,
+			Message: "Failed to reset password",
+		})
+		return
+	}
+
+	if err := h.db.UpdatePassword(userToken.UserID, string(hashedPassword)); err != nil {
+		respondJSON(w, http.StatusInternalServerError, AuthResponse{
+			Success: false,
+			Message: "Failed to reset password",
+		})
+		return
+	}
+
+	// Whoever knew the old password must not stay logged in
+	if err := h.db.RevokeAllUserTokens(userToken.UserID); err != nil {
+		respondJSON(w, http.StatusInternalServerError, AuthResponse{
+			Success: false,
+			Message: "Password reset, but failed to log out other sessions",
+		})
+		return
+	}
+
+	respondJSON(w, http.StatusOK, AuthResponse{
+		Success: true,
+		Message: "Password reset successfully",
+	})
+}
+
 func (h *AuthHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
 	users, total, err := h.db.ListUsers(1, 100)
 	if err != nil {
@@ -241,6 +727,57 @@ func (h *AuthHandler) AssignRole(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// DeleteUser soft-deletes the user in the path and logs out all of their
+// sessions
+func (h *AuthHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(middleware.UserContextKey).(*middleware.Claims)
+	if !ok {
+		respondJSON(w, http.StatusUnauthorized, AuthResponse{
+			Success: false,
+			Message: "Unauthorized",
+		})
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+	if id == claims.UserID {
+		// Otherwise the last admin could lock everyone out
+		respondJSON(w, http.StatusBadRequest, AuthResponse{
+			Success: false,
+			Message: "You can't delete your own account",
+		})
+		return
+	}
+
+	if err := h.db.DeleteUser(id); err != nil {
+		if err == database.ErrUserNotFound {
+			respondJSON(w, http.StatusNotFound, AuthResponse{
+				Success: false,
+				Message: "User not found",
+			})
+			return
+		}
+		respondJSON(w, http.StatusInternalServerError, AuthResponse{
+			Success: false,
+			Message: "Failed to delete user",
+		})
+		return
+	}
+
+	if err := h.db.RevokeAllUserTokens(id); err != nil {
+		respondJSON(w, http.StatusInternalServerError, AuthResponse{
+			Success: false,
+			Message: "User deleted, but failed to revoke their sessions",
+		})
+		return
+	}
+
+	respondJSON(w, http.StatusOK, AuthResponse{
+		Success: true,
+		Message: "User deleted successfully",
+	})
+}
+
 // RefreshToken refreshes an access token using a refresh token
 func (h *AuthHandler) RefreshToken(w http.ResponseWriter, r *http.Request) {
 	var req RefreshRequest
@@ -262,6 +799,10 @@ func (h *AuthHandler) RefreshToken(w http.ResponseWriter, r *http.Request) {
 
 	// Validate refresh token
 	storedToken, err := h.db.GetRefreshToken(req.RefreshToken)
+	if err == database.ErrTokenRevoked && storedToken != nil && storedToken.Rotated {
+		h.respondTokenReuse(w, storedToken.UserID)
+		return
+	}
 	if err != nil {
 		if err == database.ErrTokenNotFound || err == database.ErrTokenExpired || err == database.ErrTokenRevoked {
 			respondJSON(w, http.StatusUnauthorized, AuthResponse{
@@ -287,6 +828,35 @@ func (h *AuthHandler) RefreshToken(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Rotate the old refresh token before issuing new ones. Rotation
+	// succeeds only once, so when two requests race with the same token
+	// the loser is treated as a replay. A token logged out in the meantime
+	// is merely invalid.
+	if err := h.db.RotateRefreshToken(req.RefreshToken); err != nil {
+		switch err {
+		case database.ErrTokenRevoked:
+			if current, _ := h.db.GetRefreshToken(req.RefreshToken); current != nil && current.Rotated {
+				h.respondTokenReuse(w, storedToken.UserID)
+				return
+			}
+			respondJSON(w, http.StatusUnauthorized, AuthResponse{
+				Success: false,
+				Message: "Invalid or expired refresh token",
+			})
+		case database.ErrTokenNotFound:
+			respondJSON(w, http.StatusUnauthorized, AuthResponse{
+				Success: false,
+				Message: "Invalid or expired refresh token",
+			})
+		default:
+			respondJSON(w, http.StatusInternalServerError, AuthResponse{
+				Success: false,
+				Message: "Failed to validate refresh token",
+			})
+		}
+		return
+	}
+
 	// Generate new token pair
 	tokenPair, newRefreshToken, refreshExpiry, err := utils.GenerateTokenPair(user)
 	if err != nil {
@@ -297,11 +867,6 @@ func (h *AuthHandler) RefreshToken(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Revoke old refresh token
-	if err := h.db.RevokeRefreshToken(req.RefreshToken); err != nil {
-		// Log error but don't fail the request
-	}
-
 	// Store new refresh token
 	_, err = h.db.CreateRefreshToken(user.ID, newRefreshToken, refreshExpiry)
 	if err != nil {
@@ -322,6 +887,111 @@ func (h *AuthHandler) RefreshToken(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// respondTokenReuse answers a replayed refresh token. Rotated tokens are
+// never presented again by their owner, so a replay means the token was
+// copied. The user is logged out everywhere.
+func (h *AuthHandler) respondTokenReuse(w http.ResponseWriter, userID string) {
+	if err := h.db.RevokeAllUserTokens(userID); err != nil {
+		respondJSON(w, http.StatusInternalServerError, AuthResponse{
+			Success: false,
+			Message: "Failed to validate refresh token",
+		})
+		return
+	}
+
+	respondJSON(w, http.StatusUnauthorized, AuthResponse{
+		Success: false,
+		Message: "Refresh token reuse detected, all sessions have been revoked",
+		Code:    apperrors.ErrTokenReuse,
+	})
+}
+
+// ListSessions returns the authenticated user's active sessions
+func (h *AuthHandler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(middleware.UserContextKey).(*middleware.Claims)
+	if !ok {
+		respondJSON(w, http.StatusUnauthorized, AuthResponse{
+			Success: false,
+			Message: "Unauthorized",
+		})
+		return
+	}
+
+	tokens, err := h.db.ListUserTokens(claims.UserID)
+	if err != nil {
+		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"message": "Failed to list sessions",
+		})
+		return
+	}
+
+	sessions := make([]Session, 0, len(tokens))
+	for _, token := range tokens {
+		sessions = append(sessions, Session{
+			ID:        token.ID,
+			CreatedAt: token.CreatedAt,
+			ExpiresAt: token.ExpiresAt,
+		})
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"success":  true,
+		"sessions": sessions,
+		"total":    len(sessions),
+	})
+}
+
+// RevokeSession logs out one of the authenticated user's sessions
+func (h *AuthHandler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(middleware.UserContextKey).(*middleware.Claims)
+	if !ok {
+		respondJSON(w, http.StatusUnauthorized, AuthResponse{
+			Success: false,
+			Message: "Unauthorized",
+		})
+		return
+	}
+
+	// Only look among the user's own tokens, so other users' sessions
+	// can't be revoked by ID
+	tokens, err := h.db.ListUserTokens(claims.UserID)
+	if err != nil {
+		respondJSON(w, http.StatusInternalServerError, AuthResponse{
+			Success: false,
+			Message: "Failed to revoke session",
+		})
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+	for _, token := range tokens {
+		if token.ID != id {
+			continue
+		}
+
+		// A concurrent request may have revoked it first
+		if err := h.db.RevokeRefreshToken(token.Token); err != nil && err != database.ErrTokenRevoked {
+			respondJSON(w, http.StatusInternalServerError, AuthResponse{
+				Success: false,
+				Message: "Failed to revoke session",
+			})
+			return
+		}
+
+		respondJSON(w, http.StatusOK, AuthResponse{
+			Success: true,
+			Message: "Session revoked successfully",
+		})
+		return
+	}
+
+	respondJSON(w, http.StatusNotFound, AuthResponse{
+		Success: false,
+		Message: "Session not found",
+	})
+}
+
 // Logout revokes a refresh token
 func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
 	var req RefreshRequest
@@ -354,6 +1024,15 @@ func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// generateUserToken returns a random token for links sent by email
+func generateUserToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
 func respondJSON(w http.ResponseWriter, status int, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
@@ -0,0 +1,675 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	apperrors "github.com/dayanch951/marimo/shared/errors"
+	"github.com/dayanch951/marimo/shared/middleware"
+	"github.com/dayanch951/marimo/shared/models"
+	"github.com/dayanch951/marimo/shared/tenancy"
+	"github.com/dayanch951/marimo/shared/utils"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// fakeMailer records the links it is asked to send
+type fakeMailer struct {
+	links map[string]string // Recipient to link
+}
+
+func (m *fakeMailer) SendVerificationEmail(to, name, verifyLink string) error {
+	m.links[to] = verifyLink
+	return nil
+}
+
+func (m *fakeMailer) SendPasswordResetEmail(to, resetLink string) error {
+	m.links[to] = resetLink
+	return nil
+}
+
+func newTestHandler(t *testing.T) (*AuthHandler, *utils.MemoryDB, *models.User) {
+	t.Helper()
+
+	db := utils.NewMemoryDB()
+	user, err := db.CreateUser("user@example.com", "Password123!", "Test User", models.RoleUser)
+	if err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+
+	mailer := &fakeMailer{links: make(map[string]string)}
+	return NewAuthHandler(db, mailer, AuthConfig{
+		PublicURL:        "https://erp.example.com",
+		ResetPasswordURL: "https://erp.example.com/reset-password",
+	}), db, user
+}
+
+// serve runs req through handler and decodes the response
+func serve(t *testing.T, handler http.HandlerFunc, req *http.Request) (int, AuthResponse) {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+
+	var resp AuthResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	return rec.Code, resp
+}
+
+func jsonRequest(t *testing.T, method, path string, body interface{}) *http.Request {
+	t.Helper()
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("failed to marshal request: %v", err)
+	}
+	return httptest.NewRequest(method, path, bytes.NewReader(data))
+}
+
+// newTestRouter mounts the protected routes the way the server does
+func newTestRouter(h *AuthHandler) http.Handler {
+	router := mux.NewRouter()
+	protected := router.PathPrefix("/api/users").Subrouter()
+	protected.Use(middleware.AuthMiddleware)
+	protected.HandleFunc("/profile", h.GetProfile).Methods("GET")
+	protected.HandleFunc("/profile", h.UpdateProfile).Methods("PUT")
+	protected.HandleFunc("/password", h.ChangePassword).Methods("POST")
+	protected.HandleFunc("/sessions", h.ListSessions).Methods("GET")
+	protected.HandleFunc("/sessions/{id}", h.RevokeSession).Methods("DELETE")
+	protected.HandleFunc("/list", h.ListUsers).Methods("GET")
+
+	admin := router.PathPrefix("/api/users/admin").Subrouter()
+	admin.Use(middleware.AuthMiddleware)
+	admin.Use(middleware.RoleMiddleware(models.RoleAdmin))
+	admin.HandleFunc("/{id}", h.DeleteUser).Methods("DELETE")
+	return router
+}
+
+// authorize adds a bearer token for user to req
+func authorize(t *testing.T, req *http.Request, user *models.User) *http.Request {
+	t.Helper()
+
+	token, err := middleware.GenerateToken(user.ID, user.Email, user.Role)
+	if err != nil {
+		t.Fatalf("GenerateToken() error = %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return req
+}
+
+func refresh(t *testing.T, h *AuthHandler, token string) (int, AuthResponse) {
+	t.Helper()
+	return serve(t, h.RefreshToken, jsonRequest(t, http.MethodPost, "/api/users/refresh", RefreshRequest{RefreshToken: token}))
+}
+
+func TestAuthHandler_RefreshToken(t *testing.T) {
+	h, db, user := newTestHandler(t)
+
+	if _, err := db.CreateRefreshToken(user.ID, "valid", time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("CreateRefreshToken() error = %v", err)
+	}
+
+	code, resp := refresh(t, h, "valid")
+	if code != http.StatusOK || resp.AccessToken == "" || resp.RefreshToken == "" {
+		t.Fatalf("refresh with a valid token = %d %+v, want 200 with a new pair", code, resp)
+	}
+	if _, err := db.GetRefreshToken("valid"); err != utils.ErrTokenRevoked {
+		t.Errorf("GetRefreshToken() of the rotated token error = %v, want %v", err, utils.ErrTokenRevoked)
+	}
+	if _, err := db.GetRefreshToken(resp.RefreshToken); err != nil {
+		t.Errorf("GetRefreshToken() of the new token error = %v", err)
+	}
+}
+
+// staleReadDB reports revoked refresh tokens as valid, like a lookup that
+// ran before a concurrent request revoked the token
+type staleReadDB struct {
+	*utils.MemoryDB
+}
+
+func (db staleReadDB) GetRefreshToken(token string) (*models.RefreshToken, error) {
+	stored, err := db.MemoryDB.GetRefreshToken(token)
+	if err == utils.ErrTokenRevoked {
+		return stored, nil
+	}
+	return stored, err
+}
+
+func TestAuthHandler_RefreshTokenRace(t *testing.T) {
+	h, db, user := newTestHandler(t)
+	h.db = staleReadDB{db}
+
+	db.CreateRefreshToken(user.ID, "valid", time.Now().Add(time.Hour))
+
+	code, first := refresh(t, h, "valid")
+	if code != http.StatusOK {
+		t.Fatalf("first refresh = %d %+v, want 200", code, first)
+	}
+
+	// The second request passed the lookup too, but lost the revocation
+	code, second := refresh(t, h, "valid")
+	if code != http.StatusUnauthorized || second.Code != apperrors.ErrTokenReuse || second.RefreshToken != "" {
+		t.Fatalf("racing refresh = %d %+v, want 401 %s without tokens", code, second, apperrors.ErrTokenReuse)
+	}
+	if _, err := db.GetRefreshToken(first.RefreshToken); err != utils.ErrTokenRevoked {
+		t.Errorf("GetRefreshToken() of the winner's token error = %v, want %v", err, utils.ErrTokenRevoked)
+	}
+}
+
+func TestAuthHandler_RefreshTokenExpired(t *testing.T) {
+	h, db, user := newTestHandler(t)
+
+	db.CreateRefreshToken(user.ID, "expired", time.Now().Add(-time.Minute))
+	db.CreateRefreshToken(user.ID, "other", time.Now().Add(time.Hour))
+
+	code, resp := refresh(t, h, "expired")
+	if code != http.StatusUnauthorized || resp.Code != "" {
+		t.Errorf("refresh with an expired token = %d %+v, want 401 without a code", code, resp)
+	}
+
+	// An expired token is not a sign of theft, so other sessions survive
+	if _, err := db.GetRefreshToken("other"); err != nil {
+		t.Errorf("GetRefreshToken() of another session error = %v", err)
+	}
+}
+
+func TestAuthHandler_RefreshTokenReuse(t *testing.T) {
+	h, db, user := newTestHandler(t)
+
+	db.CreateRefreshToken(user.ID, "stolen", time.Now().Add(time.Hour))
+	db.CreateRefreshToken(user.ID, "other", time.Now().Add(time.Hour))
+
+	_, rotated := refresh(t, h, "stolen")
+
+	code, resp := refresh(t, h, "stolen")
+	if code != http.StatusUnauthorized || resp.Code != apperrors.ErrTokenReuse {
+		t.Fatalf("refresh with a reused token = %d %+v, want 401 %s", code, resp, apperrors.ErrTokenReuse)
+	}
+
+	// Every session of the user is revoked, including the one issued by
+	// the legitimate rotation
+	for _, token := range []string{"other", rotated.RefreshToken} {
+		if _, err := db.GetRefreshToken(token); err != utils.ErrTokenRevoked {
+			t.Errorf("GetRefreshToken(%q) error = %v, want %v", token, err, utils.ErrTokenRevoked)
+		}
+	}
+}
+
+func TestAuthHandler_RefreshTokenLoggedOut(t *testing.T) {
+	h, db, user := newTestHandler(t)
+	router := newTestRouter(h)
+
+	phone, _ := db.CreateRefreshToken(user.ID, "phone", time.Now().Add(time.Hour))
+	db.CreateRefreshToken(user.ID, "laptop", time.Now().Add(time.Hour))
+	db.CreateRefreshToken(user.ID, "tablet", time.Now().Add(time.Hour))
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, authorize(t, httptest.NewRequest(http.MethodDelete, "/api/users/sessions/"+phone.ID, nil), user))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("RevokeSession() = %d, want 200", rec.Code)
+	}
+	if code, resp := serve(t, h.Logout, jsonRequest(t, http.MethodPost, "/api/users/logout", RefreshRequest{RefreshToken: "tablet"})); code != http.StatusOK {
+		t.Fatalf("Logout() = %d %+v, want 200", code, resp)
+	}
+
+	// Logged out tokens are invalid, but presenting one is not theft
+	for _, token := range []string{"phone", "tablet"} {
+		if code, resp := refresh(t, h, token); code != http.StatusUnauthorized || resp.Code != "" {
+			t.Errorf("refresh with logged out token %q = %d %+v, want 401 without a code", token, code, resp)
+		}
+	}
+	if code, resp := refresh(t, h, "laptop"); code != http.StatusOK {
+		t.Errorf("refresh with another session = %d %+v, want 200", code, resp)
+	}
+}
+
+func TestAuthHandler_UpdateProfile(t *testing.T) {
+	h, db, user := newTestHandler(t)
+	router := newTestRouter(h)
+	db.CreateUser("taken@example.com", "Password123!", "Other User", models.RoleUser)
+
+	update := func(body UpdateProfileRequest) (int, AuthResponse) {
+		req := authorize(t, jsonRequest(t, http.MethodPut, "/api/users/profile", body), user)
+		return serve(t, router.ServeHTTP, req)
+	}
+
+	code, resp := update(UpdateProfileRequest{Name: "New Name", Email: "new@example.com"})
+	if code != http.StatusOK || resp.User == nil || resp.User.Name != "New Name" || resp.User.Email != "new@example.com" {
+		t.Fatalf("UpdateProfile() = %d %+v, want 200 with the updated user", code, resp)
+	}
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, authorize(t, httptest.NewRequest(http.MethodGet, "/api/users/profile", nil), user))
+	var profile models.User
+	if err := json.NewDecoder(rec.Body).Decode(&profile); err != nil {
+		t.Fatalf("failed to decode profile: %v", err)
+	}
+	if rec.Code != http.StatusOK || profile.Name != "New Name" || profile.Email != "new@example.com" {
+		t.Errorf("GetProfile() = %d %+v, want the updated profile", rec.Code, profile)
+	}
+	if _, err := db.GetUserByEmail("user@example.com"); err != utils.ErrUserNotFound {
+		t.Errorf("GetUserByEmail() of the old email error = %v, want %v", err, utils.ErrUserNotFound)
+	}
+
+	tests := []struct {
+		name string
+		body UpdateProfileRequest
+		want int
+	}{
+		{"email of another user", UpdateProfileRequest{Name: "New Name", Email: "taken@example.com"}, http.StatusConflict},
+		{"invalid email", UpdateProfileRequest{Name: "New Name", Email: "not-an-email"}, http.StatusBadRequest},
+		{"invalid name", UpdateProfileRequest{Name: "<script>", Email: "new@example.com"}, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code, resp := update(tt.body); code != tt.want {
+				t.Errorf("UpdateProfile() = %d %+v, want %d", code, resp, tt.want)
+			}
+		})
+	}
+
+	req := jsonRequest(t, http.MethodPut, "/api/users/profile", UpdateProfileRequest{Name: "New Name", Email: "new@example.com"})
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("UpdateProfile() without a token = %d, want 401", rec.Code)
+	}
+}
+
+func TestAuthHandler_ChangePassword(t *testing.T) {
+	h, db, user := newTestHandler(t)
+	router := newTestRouter(h)
+	db.CreateRefreshToken(user.ID, "session", time.Now().Add(time.Hour))
+
+	change := func(body ChangePasswordRequest) (int, AuthResponse) {
+		req := authorize(t, jsonRequest(t, http.MethodPost, "/api/users/password", body), user)
+		return serve(t, router.ServeHTTP, req)
+	}
+
+	code, resp := change(ChangePasswordRequest{OldPassword: "Wrong123!", NewPassword: "NewPassword456!"})
+	if code != http.StatusForbidden {
+		t.Errorf("ChangePassword() with a wrong old password = %d %+v, want 403", code, resp)
+	}
+	code, resp = change(ChangePasswordRequest{OldPassword: "Password123!", NewPassword: "weak"})
+	if code != http.StatusBadRequest {
+		t.Errorf("ChangePassword() with a weak new password = %d %+v, want 400", code, resp)
+	}
+	if _, err := db.GetRefreshToken("session"); err != nil {
+		t.Fatalf("GetRefreshToken() after failed changes error = %v", err)
+	}
+
+	code, resp = change(ChangePasswordRequest{OldPassword: "Password123!", NewPassword: "NewPassword456!"})
+	if code != http.StatusOK {
+		t.Fatalf("ChangePassword() = %d %+v, want 200", code, resp)
+	}
+
+	if _, err := db.ValidatePassword(user.Email, "NewPassword456!"); err != nil {
+		t.Errorf("ValidatePassword() with the new password error = %v", err)
+	}
+	if _, err := db.ValidatePassword(user.Email, "Password123!"); err != utils.ErrInvalidPassword {
+		t.Errorf("ValidatePassword() with the old password error = %v, want %v", err, utils.ErrInvalidPassword)
+	}
+	if _, err := db.GetRefreshToken("session"); err != utils.ErrTokenRevoked {
+		t.Errorf("GetRefreshToken() after the change error = %v, want %v", err, utils.ErrTokenRevoked)
+	}
+}
+
+func TestAuthHandler_RegisterTenantQuota(t *testing.T) {
+	h, db, _ := newTestHandler(t)
+
+	tenant := &tenancy.Tenant{ID: uuid.New(), Settings: tenancy.Settings{MaxUsers: 2}}
+	register := func(tenant *tenancy.Tenant, email string) (int, AuthResponse) {
+		req := jsonRequest(t, http.MethodPost, "/api/users/register", RegisterRequest{
+			Email: email, Password: "Password123!", Name: "New User",
+		})
+		return serve(t, h.Register, req.WithContext(tenancy.WithTenant(req.Context(), tenant)))
+	}
+
+	// Users of other tenants don't count
+	other := &tenancy.Tenant{ID: uuid.New(), Settings: tenancy.Settings{MaxUsers: 10}}
+	for _, email := range []string{"other1@example.com", "other2@example.com"} {
+		if code, resp := register(other, email); code != http.StatusCreated {
+			t.Fatalf("Register(%s) = %d %+v, want 201", email, code, resp)
+		}
+	}
+
+	for _, email := range []string{"first@example.com", "second@example.com"} {
+		if code, resp := register(tenant, email); code != http.StatusCreated {
+			t.Fatalf("Register(%s) = %d %+v, want 201", email, code, resp)
+		}
+	}
+
+	code, resp := register(tenant, "third@example.com")
+	if code != http.StatusForbidden || resp.Code != apperrors.ErrQuotaExceeded {
+		t.Fatalf("Register() over quota = %d %+v, want 403 %s", code, resp, apperrors.ErrQuotaExceeded)
+	}
+	if _, err := db.GetUserByEmail("third@example.com"); err == nil {
+		t.Error("Register() over quota created the user")
+	}
+}
+
+func TestAuthHandler_VerifyEmail(t *testing.T) {
+	h, _, _ := newTestHandler(t)
+	h.config.RequireVerifiedEmail = true
+	mailer := h.mailer.(*fakeMailer)
+
+	credentials := LoginRequest{Email: "new@example.com", Password: "Password123!"}
+	login := func() (int, AuthResponse) {
+		return serve(t, h.Login, jsonRequest(t, http.MethodPost, "/api/users/login", credentials))
+	}
+	verify := func(target string) (int, AuthResponse) {
+		return serve(t, h.VerifyEmail, httptest.NewRequest(http.MethodGet, target, nil))
+	}
+
+	code, resp := serve(t, h.Register, jsonRequest(t, http.MethodPost, "/api/users/register", RegisterRequest{
+		Email: credentials.Email, Password: credentials.Password, Name: "New User",
+	}))
+	if code != http.StatusCreated || resp.User.EmailVerified {
+		t.Fatalf("Register() = %d %+v, want 201 with an unverified user", code, resp)
+	}
+
+	link, ok := mailer.links[credentials.Email]
+	if !ok || !strings.HasPrefix(link, "https://erp.example.com/api/users/verify?token=") {
+		t.Fatalf("verification link = %q, want one for the verify endpoint", link)
+	}
+
+	if code, resp := login(); code != http.StatusForbidden || resp.Code != apperrors.ErrEmailNotVerified {
+		t.Errorf("Login() before verifying = %d %+v, want 403 %s", code, resp, apperrors.ErrEmailNotVerified)
+	}
+
+	target := strings.TrimPrefix(link, "https://erp.example.com")
+	if code, resp := verify(target); code != http.StatusOK {
+		t.Fatalf("VerifyEmail() = %d %+v, want 200", code, resp)
+	}
+	if code, resp := login(); code != http.StatusOK || !resp.User.EmailVerified {
+		t.Errorf("Login() after verifying = %d %+v, want 200 with a verified user", code, resp)
+	}
+
+	// Links work once
+	if code, _ := verify(target); code != http.StatusBadRequest {
+		t.Errorf("VerifyEmail() with a used token = %d, want 400", code)
+	}
+}
+
+func TestAuthHandler_UpdateProfileEmailChange(t *testing.T) {
+	h, db, user := newTestHandler(t)
+	h.config.RequireVerifiedEmail = true
+	router := newTestRouter(h)
+	mailer := h.mailer.(*fakeMailer)
+
+	// A link to the old address is still outstanding
+	db.CreateUserToken(user.ID, models.TokenPurposeEmailVerification, "stale", time.Now().Add(time.Hour))
+	db.MarkEmailVerified(user.ID)
+
+	update := func(body UpdateProfileRequest) (int, AuthResponse) {
+		req := authorize(t, jsonRequest(t, http.MethodPut, "/api/users/profile", body), user)
+		return serve(t, router.ServeHTTP, req)
+	}
+	verify := func(target string) int {
+		code, _ := serve(t, h.VerifyEmail, httptest.NewRequest(http.MethodGet, target, nil))
+		return code
+	}
+
+	// Keeping the email keeps it verified
+	code, resp := update(UpdateProfileRequest{Name: "New Name", Email: user.Email})
+	if code != http.StatusOK || !resp.User.EmailVerified || len(mailer.links) != 0 {
+		t.Fatalf("UpdateProfile() with the same email = %d %+v, want 200 with a verified user and no email", code, resp)
+	}
+
+	code, resp = update(UpdateProfileRequest{Name: "New Name", Email: "new@example.com"})
+	if code != http.StatusOK || resp.User.EmailVerified {
+		t.Fatalf("UpdateProfile() with a new email = %d %+v, want 200 with an unverified user", code, resp)
+	}
+
+	credentials := LoginRequest{Email: "new@example.com", Password: "Password123!"}
+	if code, resp := serve(t, h.Login, jsonRequest(t, http.MethodPost, "/api/users/login", credentials)); code != http.StatusForbidden {
+		t.Errorf("Login() with the unverified email = %d %+v, want 403", code, resp)
+	}
+
+	if code := verify("/api/users/verify?token=stale"); code != http.StatusBadRequest {
+		t.Errorf("VerifyEmail() with a link sent to the old email = %d, want 400", code)
+	}
+
+	link, ok := mailer.links["new@example.com"]
+	if !ok {
+		t.Fatal("no verification email was sent to the new address")
+	}
+	if code := verify(strings.TrimPrefix(link, "https://erp.example.com")); code != http.StatusOK {
+		t.Fatalf("VerifyEmail() with the new link = %d, want 200", code)
+	}
+	if verified, _ := db.GetUserByID(user.ID); !verified.EmailVerified {
+		t.Error("user is not verified after following the new link")
+	}
+}
+
+func TestAuthHandler_VerifyEmailInvalidToken(t *testing.T) {
+	h, db, user := newTestHandler(t)
+
+	db.CreateUserToken(user.ID, models.TokenPurposeEmailVerification, "expired", time.Now().Add(-time.Minute))
+
+	for _, target := range []string{
+		"/api/users/verify?token=expired",
+		"/api/users/verify?token=unknown",
+		"/api/users/verify",
+	} {
+		rec := httptest.NewRecorder()
+		h.VerifyEmail(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("GET %s = %d, want 400", target, rec.Code)
+		}
+	}
+
+	if verified, _ := db.GetUserByID(user.ID); verified.EmailVerified {
+		t.Error("user was verified with an invalid token")
+	}
+}
+
+func TestAuthHandler_ResetPassword(t *testing.T) {
+	h, db, user := newTestHandler(t)
+	mailer := h.mailer.(*fakeMailer)
+	db.CreateRefreshToken(user.ID, "session", time.Now().Add(time.Hour))
+
+	forgot := func(email string) int {
+		code, _ := serve(t, h.ForgotPassword, jsonRequest(t, http.MethodPost, "/api/users/forgot-password", ForgotPasswordRequest{Email: email}))
+		h.Wait() // For the email
+		return code
+	}
+	reset := func(body ResetPasswordRequest) (int, AuthResponse) {
+		return serve(t, h.ResetPassword, jsonRequest(t, http.MethodPost, "/api/users/reset-password", body))
+	}
+
+	// Unknown addresses get the same answer, but no email
+	if code := forgot("nobody@example.com"); code != http.StatusOK || len(mailer.links) != 0 {
+		t.Errorf("ForgotPassword() for an unknown email = %d with %d emails sent, want 200 and none", code, len(mailer.links))
+	}
+
+	if code := forgot(user.Email); code != http.StatusOK {
+		t.Fatalf("ForgotPassword() = %d, want 200", code)
+	}
+	link, ok := mailer.links[user.Email]
+	if !ok || !strings.HasPrefix(link, "https://erp.example.com/reset-password?token=") {
+		t.Fatalf("reset link = %q, want one for the reset page", link)
+	}
+	token := strings.TrimPrefix(link, "https://erp.example.com/reset-password?token=")
+
+	// A weak password is rejected without using up the token
+	if code, resp := reset(ResetPasswordRequest{Token: token, NewPassword: "weak"}); code != http.StatusBadRequest {
+		t.Errorf("ResetPassword() with a weak password = %d %+v, want 400", code, resp)
+	}
+
+	if code, resp := reset(ResetPasswordRequest{Token: token, NewPassword: "NewPassword456!"}); code != http.StatusOK {
+		t.Fatalf("ResetPassword() = %d %+v, want 200", code, resp)
+	}
+	if _, err := db.ValidatePassword(user.Email, "NewPassword456!"); err != nil {
+		t.Errorf("ValidatePassword() with the new password error = %v", err)
+	}
+	if _, err := db.GetRefreshToken("session"); err != utils.ErrTokenRevoked {
+		t.Errorf("GetRefreshToken() after the reset error = %v, want %v", err, utils.ErrTokenRevoked)
+	}
+
+	if code, _ := reset(ResetPasswordRequest{Token: token, NewPassword: "Another789!"}); code != http.StatusBadRequest {
+		t.Errorf("ResetPassword() with a used token = %d, want 400", code)
+	}
+}
+
+// blockingMailer holds password reset emails until release is closed
+type blockingMailer struct {
+	*fakeMailer
+	release chan struct{}
+}
+
+func (m blockingMailer) SendPasswordResetEmail(to, resetLink string) error {
+	<-m.release
+	return m.fakeMailer.SendPasswordResetEmail(to, resetLink)
+}
+
+func TestAuthHandler_ForgotPasswordRespondsBeforeSending(t *testing.T) {
+	h, _, user := newTestHandler(t)
+	mailer := blockingMailer{fakeMailer: h.mailer.(*fakeMailer), release: make(chan struct{})}
+	h.mailer = mailer
+
+	// A slow mail server doesn't delay the answer, which would reveal
+	// that the account exists
+	code, _ := serve(t, h.ForgotPassword, jsonRequest(t, http.MethodPost, "/api/users/forgot-password", ForgotPasswordRequest{Email: user.Email}))
+	if code != http.StatusOK {
+		t.Fatalf("ForgotPassword() = %d, want 200", code)
+	}
+
+	close(mailer.release)
+	h.Wait()
+	if _, ok := mailer.links[user.Email]; !ok {
+		t.Error("ForgotPassword() sent no reset email")
+	}
+}
+
+func TestAuthHandler_ResetPasswordExpiredToken(t *testing.T) {
+	h, db, user := newTestHandler(t)
+
+	db.CreateUserToken(user.ID, models.TokenPurposePasswordReset, "expired", time.Now().Add(-time.Minute))
+	// Tokens for other purposes can't reset passwords
+	db.CreateUserToken(user.ID, models.TokenPurposeEmailVerification, "verify", time.Now().Add(time.Hour))
+
+	for _, token := range []string{"expired", "verify"} {
+		code, resp := serve(t, h.ResetPassword, jsonRequest(t, http.MethodPost, "/api/users/reset-password",
+			ResetPasswordRequest{Token: token, NewPassword: "NewPassword456!"}))
+		if code != http.StatusBadRequest {
+			t.Errorf("ResetPassword() with token %q = %d %+v, want 400", token, code, resp)
+		}
+	}
+
+	if _, err := db.ValidatePassword(user.Email, "Password123!"); err != nil {
+		t.Errorf("ValidatePassword() with the original password error = %v", err)
+	}
+}
+
+func TestAuthHandler_Sessions(t *testing.T) {
+	h, db, user := newTestHandler(t)
+	router := newTestRouter(h)
+	other, _ := db.CreateUser("other@example.com", "Password123!", "Other User", models.RoleUser)
+
+	laptop, _ := db.CreateRefreshToken(user.ID, "laptop", time.Now().Add(time.Hour))
+	phone, _ := db.CreateRefreshToken(user.ID, "phone", time.Now().Add(time.Hour))
+	db.CreateRefreshToken(user.ID, "expired", time.Now().Add(-time.Hour))
+	othersSession, _ := db.CreateRefreshToken(other.ID, "other", time.Now().Add(time.Hour))
+
+	list := func() []Session {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, authorize(t, httptest.NewRequest(http.MethodGet, "/api/users/sessions", nil), user))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("ListSessions() = %d, want 200", rec.Code)
+		}
+		if strings.Contains(rec.Body.String(), "laptop") {
+			t.Errorf("ListSessions() reveals refresh tokens: %s", rec.Body.String())
+		}
+
+		var resp struct {
+			Sessions []Session `json:"sessions"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("failed to decode sessions: %v", err)
+		}
+		return resp.Sessions
+	}
+	revoke := func(id string) int {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, authorize(t, httptest.NewRequest(http.MethodDelete, "/api/users/sessions/"+id, nil), user))
+		return rec.Code
+	}
+
+	if sessions := list(); len(sessions) != 2 {
+		t.Fatalf("ListSessions() = %+v, want the 2 active sessions", sessions)
+	}
+
+	if code := revoke(phone.ID); code != http.StatusOK {
+		t.Fatalf("RevokeSession() = %d, want 200", code)
+	}
+	if sessions := list(); len(sessions) != 1 || sessions[0].ID != laptop.ID {
+		t.Errorf("ListSessions() after revoking one = %+v, want only %s", sessions, laptop.ID)
+	}
+	if _, err := db.GetRefreshToken("phone"); err != utils.ErrTokenRevoked {
+		t.Errorf("GetRefreshToken() of the revoked session error = %v, want %v", err, utils.ErrTokenRevoked)
+	}
+
+	// Sessions of other users are out of reach
+	if code := revoke(othersSession.ID); code != http.StatusNotFound {
+		t.Errorf("RevokeSession() of another user's session = %d, want 404", code)
+	}
+	if _, err := db.GetRefreshToken("other"); err != nil {
+		t.Errorf("GetRefreshToken() of another user's session error = %v", err)
+	}
+}
+
+func TestAuthHandler_DeleteUser(t *testing.T) {
+	h, db, user := newTestHandler(t)
+	router := newTestRouter(h)
+	admin, _ := db.CreateUser("admin@example.com", "Password123!", "Admin User", models.RoleAdmin)
+	db.CreateRefreshToken(user.ID, "session", time.Now().Add(time.Hour))
+
+	deleteUser := func(as *models.User, id string) int {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, authorize(t, httptest.NewRequest(http.MethodDelete, "/api/users/admin/"+id, nil), as))
+		return rec.Code
+	}
+
+	if code := deleteUser(user, admin.ID); code != http.StatusForbidden {
+		t.Errorf("DeleteUser() by a non-admin = %d, want 403", code)
+	}
+	if code := deleteUser(admin, admin.ID); code != http.StatusBadRequest {
+		t.Errorf("DeleteUser() of the admin's own account = %d, want 400", code)
+	}
+
+	if code := deleteUser(admin, user.ID); code != http.StatusOK {
+		t.Fatalf("DeleteUser() = %d, want 200", code)
+	}
+	if code := deleteUser(admin, user.ID); code != http.StatusNotFound {
+		t.Errorf("DeleteUser() of a deleted user = %d, want 404", code)
+	}
+
+	code, _ := serve(t, h.Login, jsonRequest(t, http.MethodPost, "/api/users/login", LoginRequest{Email: user.Email, Password: "Password123!"}))
+	if code != http.StatusUnauthorized {
+		t.Errorf("Login() of a deleted user = %d, want 401", code)
+	}
+	if _, err := db.GetRefreshToken("session"); err != utils.ErrTokenRevoked {
+		t.Errorf("GetRefreshToken() of a deleted user error = %v, want %v", err, utils.ErrTokenRevoked)
+	}
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, authorize(t, httptest.NewRequest(http.MethodGet, "/api/users/list", nil), admin))
+	var list struct {
+		Users []models.User `json:"users"`
+		Total int           `json:"total"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&list); err != nil {
+		t.Fatalf("failed to decode users: %v", err)
+	}
+	if list.Total != 1 || len(list.Users) != 1 || list.Users[0].ID != admin.ID {
+		t.Errorf("ListUsers() = %+v, want only the admin", list)
+	}
+}
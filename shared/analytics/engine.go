@@ -2,11 +2,16 @@ package analytics
 
 import (
 	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"time"
 
+	"github.com/dayanch951/marimo/shared/cache"
+	"github.com/dayanch951/marimo/shared/monitoring"
+	"github.com/dayanch951/marimo/shared/search"
 	"github.com/google/uuid"
 )
 
@@ -20,6 +25,7 @@ const (
 	MetricTypeMin       MetricType = "min"
 	MetricTypeMax       MetricType = "max"
 	MetricTypePercentage MetricType = "percentage"
+	MetricTypeExpression MetricType = "expression"
 )
 
 // Dimension represents a dimension for grouping data
@@ -28,7 +34,10 @@ type Dimension struct {
 	Field string `json:"field"`
 }
 
-// Metric represents a calculated metric
+// Metric represents a calculated metric. For MetricTypePercentage, Field
+// is a boolean column or condition and the metric is the percentage of
+// rows for which it holds, from 0 to 100. For MetricTypeExpression, Field
+// is an aggregate expression such as "SUM(amount) - SUM(refunds)".
 type Metric struct {
 	Name  string     `json:"name"`
 	Type  MetricType `json:"type"`
@@ -36,6 +45,9 @@ type Metric struct {
 	Label string     `json:"label"`
 }
 
+// Filter is a condition on a field, using the search package's operators
+type Filter = search.Filter
+
 // TimeRange represents a time period for analysis
 type TimeRange struct {
 	Start time.Time `json:"start"`
@@ -51,11 +63,14 @@ type Query struct {
 	Source      string              `json:"source"` // table or view name
 	Metrics     []Metric            `json:"metrics"`
 	Dimensions  []Dimension         `json:"dimensions"`
-	Filters     map[string]interface{} `json:"filters,omitempty"`
+	Filters     map[string]interface{} `json:"filters,omitempty"` // field = value conditions
+	Where       []Filter            `json:"where,omitempty"`  // conditions with operators such as gt or between
+	Having      []Filter            `json:"having,omitempty"` // conditions on metrics, by metric name
 	TimeRange   *TimeRange          `json:"time_range,omitempty"`
 	GroupBy     []string            `json:"group_by,omitempty"`
 	OrderBy     []OrderBy           `json:"order_by,omitempty"`
 	Limit       int                 `json:"limit,omitempty"`
+	CacheTTL    time.Duration       `json:"cache_ttl,omitempty"` // 0 disables result caching
 }
 
 // OrderBy represents sorting criteria
@@ -76,7 +91,9 @@ type Result struct {
 
 // Engine is the analytics query engine
 type Engine struct {
-	db *sql.DB
+	db      *sql.DB
+	cache   cache.Cache
+	metrics *monitoring.Metrics
 }
 
 // NewEngine creates a new analytics engine
@@ -84,8 +101,92 @@ func NewEngine(db *sql.DB) *Engine {
 	return &Engine{db: db}
 }
 
-// Execute runs an analytics query
+// NewEngineWithCache creates an analytics engine that caches the results
+// of queries with a CacheTTL
+func NewEngineWithCache(db *sql.DB, cache cache.Cache) *Engine {
+	return &Engine{db: db, cache: cache}
+}
+
+// SetMetrics makes the engine report cache hits and misses
+func (e *Engine) SetMetrics(metrics *monitoring.Metrics) {
+	e.metrics = metrics
+}
+
+// Execute runs an analytics query. If the engine has a cache and the query
+// a CacheTTL, an identical earlier result is returned instead, with
+// CachedAt set to when it was stored.
 func (e *Engine) Execute(ctx context.Context, query *Query) (*Result, error) {
+	if e.cache == nil || query.CacheTTL <= 0 {
+		return e.execute(ctx, query)
+	}
+
+	key, err := cacheKey(query)
+	if err != nil {
+		return nil, err
+	}
+
+	tenantID := query.TenantID.String()
+
+	var cached Result
+	if err := e.cache.Get(ctx, key, &cached); err == nil {
+		if e.metrics != nil {
+			e.metrics.AnalyticsCacheHits.WithLabelValues(tenantID).Inc()
+		}
+		cached.Query = query
+		return &cached, nil
+	}
+
+	if e.metrics != nil {
+		e.metrics.AnalyticsCacheMisses.WithLabelValues(tenantID).Inc()
+	}
+
+	result, err := e.execute(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	stored := *result
+	cachedAt := time.Now()
+	stored.CachedAt = &cachedAt
+	if err := e.cache.Set(ctx, key, &stored, query.CacheTTL); err != nil {
+		// Log error but don't fail the request
+		fmt.Printf("Failed to cache analytics result: %v\n", err)
+	}
+
+	return result, nil
+}
+
+// cacheKey derives a cache key from everything that affects a query's
+// result, so queries differing only by ID, name or TTL share an entry
+func cacheKey(query *Query) (string, error) {
+	normalized := struct {
+		TenantID   uuid.UUID
+		Source     string
+		Metrics    []Metric
+		Dimensions []Dimension
+		Filters    map[string]interface{} // encoded with sorted keys
+		Where      []Filter
+		Having     []Filter
+		TimeRange  *TimeRange
+		GroupBy    []string
+		OrderBy    []OrderBy
+		Limit      int
+	}{
+		query.TenantID, query.Source, query.Metrics, query.Dimensions, query.Filters,
+		query.Where, query.Having, query.TimeRange, query.GroupBy, query.OrderBy, query.Limit,
+	}
+
+	data, err := json.Marshal(normalized)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash query: %w", err)
+	}
+
+	sum := sha256.Sum256(data)
+	return "analytics:" + hex.EncodeToString(sum[:]), nil
+}
+
+// execute runs a query against the database
+func (e *Engine) execute(ctx context.Context, query *Query) (*Result, error) {
 	startTime := time.Now()
 
 	// Build SQL query
@@ -123,6 +224,10 @@ func (e *Engine) Execute(ctx context.Context, query *Query) (*Result, error) {
 
 // buildSQL builds SQL query from analytics query
 func (e *Engine) buildSQL(query *Query) (string, []interface{}, error) {
+	if err := validateQuery(query); err != nil {
+		return "", nil, err
+	}
+
 	// SELECT clause
 	selectClause := e.buildSelectClause(query.Metrics, query.Dimensions)
 
@@ -130,11 +235,20 @@ func (e *Engine) buildSQL(query *Query) (string, []interface{}, error) {
 	fromClause := query.Source
 
 	// WHERE clause
-	whereClause, args := e.buildWhereClause(query.TenantID, query.Filters, query.TimeRange)
+	whereClause, args, err := e.buildWhereClause(query.TenantID, query.Filters, query.Where, query.TimeRange)
+	if err != nil {
+		return "", nil, err
+	}
 
 	// GROUP BY clause
 	groupByClause := e.buildGroupByClause(query.Dimensions, query.GroupBy)
 
+	// HAVING clause
+	havingClause, args, err := e.buildHavingClause(query.Having, query.Metrics, args)
+	if err != nil {
+		return "", nil, err
+	}
+
 	// ORDER BY clause
 	orderByClause := e.buildOrderByClause(query.OrderBy)
 
@@ -146,11 +260,12 @@ func (e *Engine) buildSQL(query *Query) (string, []interface{}, error) {
 
 	// Combine all clauses
 	sqlQuery := fmt.Sprintf(
-		"SELECT %s FROM %s WHERE %s %s %s %s",
+		"SELECT %s FROM %s WHERE %s %s %s %s %s",
 		selectClause,
 		fromClause,
 		whereClause,
 		groupByClause,
+		havingClause,
 		orderByClause,
 		limitClause,
 	)
@@ -169,29 +284,37 @@ func (e *Engine) buildSelectClause(metrics []Metric, dimensions []Dimension) str
 
 	// Add metrics
 	for _, metric := range metrics {
-		var expr string
-		switch metric.Type {
-		case MetricTypeCount:
-			expr = fmt.Sprintf("COUNT(%s)", metric.Field)
-		case MetricTypeSum:
-			expr = fmt.Sprintf("SUM(%s)", metric.Field)
-		case MetricTypeAverage:
-			expr = fmt.Sprintf("AVG(%s)", metric.Field)
-		case MetricTypeMin:
-			expr = fmt.Sprintf("MIN(%s)", metric.Field)
-		case MetricTypeMax:
-			expr = fmt.Sprintf("MAX(%s)", metric.Field)
-		default:
-			expr = metric.Field
-		}
-		parts = append(parts, fmt.Sprintf("%s AS %s", expr, metric.Name))
+		parts = append(parts, fmt.Sprintf("%s AS %s", metricExpression(metric), metric.Name))
 	}
 
 	return joinStrings(parts, ", ")
 }
 
+// metricExpression returns the SQL aggregate computing a metric
+func metricExpression(metric Metric) string {
+	switch metric.Type {
+	case MetricTypeCount:
+		return fmt.Sprintf("COUNT(%s)", metric.Field)
+	case MetricTypeSum:
+		return fmt.Sprintf("SUM(%s)", metric.Field)
+	case MetricTypeAverage:
+		return fmt.Sprintf("AVG(%s)", metric.Field)
+	case MetricTypeMin:
+		return fmt.Sprintf("MIN(%s)", metric.Field)
+	case MetricTypeMax:
+		return fmt.Sprintf("MAX(%s)", metric.Field)
+	case MetricTypePercentage:
+		return fmt.Sprintf("AVG(CASE WHEN %s THEN 100.0 ELSE 0 END)", metric.Field)
+	case MetricTypeExpression:
+		// Already checked by validateExpression
+		return metric.Field
+	default:
+		return metric.Field
+	}
+}
+
 // buildWhereClause builds WHERE part of SQL
-func (e *Engine) buildWhereClause(tenantID uuid.UUID, filters map[string]interface{}, timeRange *TimeRange) (string, []interface{}) {
+func (e *Engine) buildWhereClause(tenantID uuid.UUID, filters map[string]interface{}, where []Filter, timeRange *TimeRange) (string, []interface{}, error) {
 	var conditions []string
 	var args []interface{}
 	argIndex := 1
@@ -219,7 +342,64 @@ func (e *Engine) buildWhereClause(tenantID uuid.UUID, filters map[string]interfa
 		argIndex++
 	}
 
-	return joinStrings(conditions, " AND "), args
+	// Add conditions with operators
+	for _, filter := range where {
+		condition, conditionArgs, err := buildFilterCondition(filter, args)
+		if err != nil {
+			return "", nil, err
+		}
+		conditions = append(conditions, condition)
+		args = conditionArgs
+	}
+
+	return joinStrings(conditions, " AND "), args, nil
+}
+
+// buildHavingClause builds HAVING part of SQL. Filters name a metric,
+// which is replaced by its aggregate since HAVING can't refer to aliases.
+func (e *Engine) buildHavingClause(having []Filter, metrics []Metric, args []interface{}) (string, []interface{}, error) {
+	if len(having) == 0 {
+		return "", args, nil
+	}
+
+	var conditions []string
+	for _, filter := range having {
+		var expr string
+		for _, metric := range metrics {
+			if metric.Name == filter.Field {
+				expr = metricExpression(metric)
+				break
+			}
+		}
+		if expr == "" {
+			return "", nil, fmt.Errorf("having: unknown metric %q", filter.Field)
+		}
+
+		filter.Field = expr
+		condition, conditionArgs, err := buildFilterCondition(filter, args)
+		if err != nil {
+			return "", nil, err
+		}
+		conditions = append(conditions, condition)
+		args = conditionArgs
+	}
+
+	return "HAVING " + joinStrings(conditions, " AND "), args, nil
+}
+
+// buildFilterCondition builds a single condition whose placeholders follow
+// args, returning it with args extended by its values
+func buildFilterCondition(filter Filter, args []interface{}) (string, []interface{}, error) {
+	qb := search.NewQueryBuilderWithParams(args)
+	condition, err := qb.BuildWhereClause(search.FilterGroup{Filters: []search.Filter{filter}})
+	if err != nil {
+		return "", nil, err
+	}
+	if condition == "" {
+		return "", nil, fmt.Errorf("invalid %q filter on %s", filter.Operator, filter.Field)
+	}
+
+	return condition, qb.GetParams(), nil
 }
 
 // buildGroupByClause builds GROUP BY part of SQL
@@ -280,6 +460,11 @@ func (e *Engine) parseRows(rows *sql.Rows) ([]map[string]interface{}, error) {
 
 		row := make(map[string]interface{})
 		for i, col := range columns {
+			// Drivers return text and numeric columns as []byte, which
+			// would be base64-encoded in JSON
+			if b, ok := values[i].([]byte); ok {
+				values[i] = string(b)
+			}
 			row[col] = values[i]
 		}
 
@@ -294,6 +479,12 @@ func (e *Engine) calculateSummary(data []map[string]interface{}, metrics []Metri
 	summary := make(map[string]interface{})
 
 	for _, metric := range metrics {
+		// An expression can be a ratio or difference whose total or
+		// average across rows means nothing
+		if metric.Type == MetricTypeExpression {
+			continue
+		}
+
 		var sum float64
 		var count int
 		var min, max float64
@@ -0,0 +1,322 @@
+package analytics
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/dayanch951/marimo/shared/cache"
+	"github.com/dayanch951/marimo/shared/search"
+	"github.com/google/uuid"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// newTestDB opens an in-memory SQLite database with the given schema
+func newTestDB(t *testing.T, schema string) *sql.DB {
+	t.Helper()
+
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("failed to open sqlite: %v", err)
+	}
+	// Each connection to :memory: is a separate database
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	if _, err := db.Exec(schema); err != nil {
+		t.Fatalf("failed to create schema: %v", err)
+	}
+
+	return db
+}
+
+func TestValidateQuery(t *testing.T) {
+	base := func() *Query {
+		return &Query{
+			Source: "transactions",
+			Metrics: []Metric{
+				{Name: "total_revenue", Type: MetricTypeSum, Field: "amount"},
+				{Name: "customers", Type: MetricTypeCount, Field: "DISTINCT customer_id"},
+				{Name: "transactions", Type: MetricTypeCount, Field: "*"},
+			},
+			Dimensions: []Dimension{{Name: "date", Field: "DATE(created_at)"}},
+			GroupBy:    []string{"DATE(created_at)"},
+			OrderBy:    []OrderBy{{Field: "total_revenue", Desc: true}},
+		}
+	}
+
+	if err := validateQuery(base()); err != nil {
+		t.Fatalf("validateQuery() on a legitimate query error = %v", err)
+	}
+
+	for _, expr := range []string{
+		"SUM(amount) - SUM(refunds)",
+		"(SUM(amount) + SUM(tax)) / COUNT(*)",
+		"SUM(amount * 0.2)",
+	} {
+		if err := validateExpression(expr); err != nil {
+			t.Errorf("validateExpression(%q) error = %v", expr, err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		mutate func(q *Query)
+	}{
+		{"metric field", func(q *Query) { q.Metrics[0].Field = "amount; DROP TABLE transactions" }},
+		{"metric name", func(q *Query) { q.Metrics[0].Name = "total FROM users --" }},
+		{"dimension field", func(q *Query) { q.Dimensions[0].Field = "DATE(created_at)) UNION SELECT password FROM users --" }},
+		{"unknown function", func(q *Query) { q.Dimensions[0].Field = "pg_sleep(10)" }},
+		{"source", func(q *Query) { q.Source = "transactions t JOIN users u ON true" }},
+		{"group by", func(q *Query) { q.GroupBy = []string{"1; DELETE FROM transactions"} }},
+		{"order by", func(q *Query) { q.OrderBy[0].Field = "amount DESC, (SELECT 1)" }},
+		{"filter field", func(q *Query) { q.Filters = map[string]interface{}{"status = 'paid' OR 1": 1} }},
+		{"identifier after call", func(q *Query) { q.Metrics[0].Field = "SUM(amount) amount" }},
+		{"comment after operator", func(q *Query) { q.Metrics[0].Field = "SUM(amount) -- x" }},
+		{"block comment", func(q *Query) { q.Metrics[0].Field = "SUM(amount) /* x */" }},
+		{"trailing operator", func(q *Query) { q.Metrics[0].Field = "SUM(amount) -" }},
+		{"operator after star", func(q *Query) { q.Metrics[0].Field = "COUNT(* - 1)" }},
+		{"where field", func(q *Query) {
+			q.Where = []Filter{{Field: "1=1 OR amount", Operator: search.OpGreaterThan, Value: 0}}
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := base()
+			tt.mutate(query)
+
+			_, _, err := NewEngine(nil).buildSQL(query)
+			if !errors.Is(err, ErrInvalidIdentifier) {
+				t.Errorf("buildSQL() error = %v, want ErrInvalidIdentifier", err)
+			}
+		})
+	}
+}
+
+func TestBuildSQL_WhereAndHaving(t *testing.T) {
+	tenantID := uuid.New()
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC)
+
+	query := &Query{
+		TenantID:   tenantID,
+		Source:     "transactions",
+		Metrics:    []Metric{{Name: "total_revenue", Type: MetricTypeSum, Field: "amount"}},
+		Dimensions: []Dimension{{Name: "customer_id", Field: "customer_id"}},
+		Filters:    map[string]interface{}{"status": "paid"},
+		Where:      []Filter{search.DateRangeFilter("created_at", from, to)},
+		Having:     []Filter{{Field: "total_revenue", Operator: search.OpGreaterThan, Value: 1000}},
+	}
+
+	sqlQuery, args, err := NewEngine(nil).buildSQL(query)
+	if err != nil {
+		t.Fatalf("buildSQL() error = %v", err)
+	}
+
+	for _, want := range []string{
+		"WHERE tenant_id = $1 AND status = $2 AND created_at BETWEEN $3 AND $4",
+		"GROUP BY customer_id HAVING SUM(amount) > $5",
+	} {
+		if !strings.Contains(sqlQuery, want) {
+			t.Errorf("buildSQL() = %q, want it to contain %q", sqlQuery, want)
+		}
+	}
+
+	wantArgs := []interface{}{tenantID, "paid", from, to, 1000}
+	if !reflect.DeepEqual(args, wantArgs) {
+		t.Errorf("buildSQL() args = %v, want %v", args, wantArgs)
+	}
+
+	t.Run("unknown having metric", func(t *testing.T) {
+		query.Having = []Filter{{Field: "revenue", Operator: search.OpGreaterThan, Value: 1000}}
+		if _, _, err := NewEngine(nil).buildSQL(query); err == nil {
+			t.Error("buildSQL() error = nil, want an error")
+		}
+	})
+
+	t.Run("malformed between", func(t *testing.T) {
+		query.Having = nil
+		query.Where = []Filter{{Field: "created_at", Operator: search.OpBetween, Value: from}}
+		if _, _, err := NewEngine(nil).buildSQL(query); err == nil {
+			t.Error("buildSQL() error = nil, want an error")
+		}
+	})
+}
+
+func TestExecute_Percentage(t *testing.T) {
+	db := newTestDB(t, `CREATE TABLE performance_metrics (
+		tenant_id TEXT, endpoint TEXT, errors BOOLEAN, created_at DATETIME
+	)`)
+
+	tenantID := uuid.New()
+	seed := []struct {
+		tenant   uuid.UUID
+		endpoint string
+		errors   bool
+	}{
+		{tenantID, "/orders", true},
+		{tenantID, "/orders", false},
+		{tenantID, "/orders", false},
+		{tenantID, "/orders", false},
+		{tenantID, "/users", true},
+		{tenantID, "/users", false},
+		{uuid.New(), "/users", true}, // another tenant
+	}
+	for _, row := range seed {
+		if _, err := db.Exec("INSERT INTO performance_metrics VALUES ($1, $2, $3, CURRENT_TIMESTAMP)",
+			row.tenant, row.endpoint, row.errors); err != nil {
+			t.Fatalf("failed to seed: %v", err)
+		}
+	}
+
+	result, err := NewEngine(db).Execute(context.Background(), &Query{
+		TenantID:   tenantID,
+		Source:     "performance_metrics",
+		Metrics:    []Metric{{Name: "error_rate", Type: MetricTypePercentage, Field: "errors"}},
+		Dimensions: []Dimension{{Name: "endpoint", Field: "endpoint"}},
+		OrderBy:    []OrderBy{{Field: "endpoint"}},
+	})
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	want := map[string]float64{"/orders": 25, "/users": 50}
+	if result.Count != len(want) {
+		t.Fatalf("Execute() returned %d rows, want %d", result.Count, len(want))
+	}
+	for _, row := range result.Data {
+		endpoint := row["endpoint"].(string)
+		if rate := row["error_rate"]; rate != want[endpoint] {
+			t.Errorf("error_rate for %s = %v, want %v", endpoint, rate, want[endpoint])
+		}
+	}
+}
+
+func TestExecute_Expression(t *testing.T) {
+	db := newTestDB(t, `CREATE TABLE transactions (
+		tenant_id TEXT, payment_method TEXT, amount REAL, refunds REAL, created_at DATETIME
+	)`)
+
+	tenantID := uuid.New()
+	seed := []struct {
+		method  string
+		amount  float64
+		refunds float64
+	}{
+		{"card", 100, 0},
+		{"card", 250, 50},
+		{"cash", 80, 30},
+	}
+	for _, row := range seed {
+		if _, err := db.Exec("INSERT INTO transactions VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP)",
+			tenantID, row.method, row.amount, row.refunds); err != nil {
+			t.Fatalf("failed to seed: %v", err)
+		}
+	}
+
+	result, err := NewEngine(db).Execute(context.Background(), &Query{
+		TenantID: tenantID,
+		Source:   "transactions",
+		Metrics: []Metric{
+			{Name: "net_revenue", Type: MetricTypeExpression, Field: "SUM(amount) - SUM(refunds)"},
+			{Name: "transactions", Type: MetricTypeCount, Field: "*"},
+		},
+		Dimensions: []Dimension{{Name: "payment_method", Field: "payment_method"}},
+		OrderBy:    []OrderBy{{Field: "payment_method"}},
+	})
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	want := map[string]float64{"card": 300, "cash": 50}
+	for _, row := range result.Data {
+		method := row["payment_method"].(string)
+		if net := row["net_revenue"]; net != want[method] {
+			t.Errorf("net_revenue for %s = %v, want %v", method, net, want[method])
+		}
+	}
+
+	if _, ok := result.Summary["net_revenue_total"]; ok {
+		t.Error("summary has a total for an expression metric")
+	}
+	if total := result.Summary["transactions_total"]; total != float64(3) {
+		t.Errorf("transactions_total = %v, want 3", total)
+	}
+}
+
+func TestExecute_CachesResults(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New() error = %v", err)
+	}
+	defer db.Close()
+
+	server := miniredis.RunT(t)
+	redisCache, err := cache.NewRedisCache(server.Addr(), "", 0, "test")
+	if err != nil {
+		t.Fatalf("NewRedisCache() error = %v", err)
+	}
+	defer redisCache.Close()
+
+	engine := NewEngineWithCache(db, redisCache)
+	ctx := context.Background()
+
+	newQuery := func() *Query {
+		return &Query{
+			ID:         uuid.New(), // differs per run but doesn't affect the key
+			TenantID:   uuid.MustParse("5b4c1f5e-8d3a-4c1e-9f4b-2a6d7e8f9a0b"),
+			Source:     "transactions",
+			Metrics:    []Metric{{Name: "total_revenue", Type: MetricTypeSum, Field: "amount"}},
+			Dimensions: []Dimension{{Name: "payment_method", Field: "payment_method"}},
+			GroupBy:    []string{"payment_method"},
+			CacheTTL:   time.Minute,
+		}
+	}
+
+	mock.ExpectQuery("SELECT payment_method AS payment_method, SUM\\(amount\\) AS total_revenue FROM transactions").
+		WillReturnRows(sqlmock.NewRows([]string{"payment_method", "total_revenue"}).
+			AddRow("card", 1200.5).
+			AddRow("cash", 300.0))
+
+	first, err := engine.Execute(ctx, newQuery())
+	if err != nil {
+		t.Fatalf("first Execute() error = %v", err)
+	}
+	if first.CachedAt != nil {
+		t.Error("fresh result has CachedAt set")
+	}
+
+	second, err := engine.Execute(ctx, newQuery())
+	if err != nil {
+		t.Fatalf("second Execute() error = %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("database expectations: %v", err)
+	}
+	if second.CachedAt == nil {
+		t.Error("cached result has no CachedAt")
+	}
+	if second.Count != 2 || second.Data[0]["payment_method"] != "card" || second.Data[0]["total_revenue"] != 1200.5 {
+		t.Errorf("cached data = %v, want the first result's rows", second.Data)
+	}
+	if ttl := server.TTL("test:" + mustCacheKey(t, newQuery())); ttl != time.Minute {
+		t.Errorf("cache TTL = %v, want %v", ttl, time.Minute)
+	}
+}
+
+func mustCacheKey(t *testing.T, query *Query) string {
+	t.Helper()
+	key, err := cacheKey(query)
+	if err != nil {
+		t.Fatalf("cacheKey() error = %v", err)
+	}
+	return key
+}
@@ -310,10 +310,13 @@ func (ds *DashboardService) RenderDashboard(ctx context.Context, dashboard *Dash
 			continue
 		}
 
-		// Set tenant ID
-		widget.Query.TenantID = dashboard.TenantID
+		// Widgets always run as the dashboard's tenant, whatever tenant
+		// their stored query names. The query is copied so the stored
+		// widget isn't modified.
+		query := *widget.Query
+		query.TenantID = dashboard.TenantID
 
-		result, err := ds.engine.Execute(ctx, widget.Query)
+		result, err := ds.engine.Execute(ctx, &query)
 		if err != nil {
 			return nil, fmt.Errorf("failed to execute query for widget %s: %w", widget.ID, err)
 		}
@@ -0,0 +1,52 @@
+package analytics
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+)
+
+func TestRenderDashboard_UsesDashboardTenant(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New() error = %v", err)
+	}
+	defer db.Close()
+
+	dashboardTenant := uuid.New()
+	otherTenant := uuid.New()
+
+	dashboard := &Dashboard{
+		ID:       uuid.New(),
+		TenantID: dashboardTenant,
+		Widgets: []Widget{{
+			ID: "users",
+			Query: &Query{
+				TenantID: otherTenant,
+				Source:   "users",
+				Metrics:  []Metric{{Name: "count", Type: MetricTypeCount, Field: "*"}},
+			},
+		}},
+	}
+
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) AS count FROM users WHERE tenant_id = \\$1").
+		WithArgs(dashboardTenant).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(int64(7)))
+
+	results, err := NewDashboardService(NewEngine(db)).RenderDashboard(context.Background(), dashboard)
+	if err != nil {
+		t.Fatalf("RenderDashboard() error = %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("query was not scoped to the dashboard tenant: %v", err)
+	}
+	if result := results["users"]; result == nil || result.Query.TenantID != dashboardTenant {
+		t.Errorf("result query tenant = %v, want %v", result, dashboardTenant)
+	}
+	if got := dashboard.Widgets[0].Query.TenantID; got != otherTenant {
+		t.Errorf("stored widget query tenant = %v, want it unchanged (%v)", got, otherTenant)
+	}
+}
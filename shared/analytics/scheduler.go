@@ -0,0 +1,279 @@
+package analytics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/dayanch951/marimo/shared/email"
+)
+
+// ErrUnsupportedSchedule is returned for schedules the Scheduler can't run
+var ErrUnsupportedSchedule = errors.New("unsupported report schedule")
+
+// ReportStore loads and saves scheduled reports
+type ReportStore interface {
+	// DueReports returns enabled reports whose NextRunAt is unset or not
+	// after now
+	DueReports(ctx context.Context, now time.Time) ([]*Report, error)
+	SaveReport(ctx context.Context, report *Report) error
+}
+
+// ReportRenderer converts a report result into a file in the given format
+// (pdf, csv or excel). export.ExportService.ExportResult can back it; it
+// is injected because the export package depends on this one.
+type ReportRenderer func(result *Result, format string) ([]byte, error)
+
+// ReportMailer sends rendered reports. *email.EmailService implements it.
+type ReportMailer interface {
+	SendEmail(msg email.EmailMessage) error
+}
+
+// Scheduler runs due reports and emails them to their recipients
+type Scheduler struct {
+	store    ReportStore
+	builder  *ReportBuilder
+	render   ReportRenderer
+	mailer   ReportMailer
+	location *time.Location
+	now      func() time.Time
+}
+
+// NewScheduler creates a report scheduler. Schedules are computed in UTC
+// unless SetLocation is called.
+func NewScheduler(store ReportStore, builder *ReportBuilder, render ReportRenderer, mailer ReportMailer) *Scheduler {
+	return &Scheduler{
+		store:    store,
+		builder:  builder,
+		render:   render,
+		mailer:   mailer,
+		location: time.UTC,
+		now:      time.Now,
+	}
+}
+
+// SetLocation sets the time zone whose wall clock reports are scheduled in
+func (s *Scheduler) SetLocation(loc *time.Location) {
+	s.location = loc
+}
+
+// NextRunTime returns the first run of schedule strictly after after. Runs
+// happen at anchor's time of day in anchor's location: daily, weekly on
+// anchor's weekday, or monthly on anchor's day of the month, moved to the
+// last day in shorter months.
+func NextRunTime(schedule ReportSchedule, anchor, after time.Time) (time.Time, error) {
+	loc := anchor.Location()
+	after = after.In(loc)
+	hour, minute, second := anchor.Clock()
+
+	at := func(year int, month time.Month, day int) time.Time {
+		t := time.Date(year, month, day, hour, minute, second, 0, loc)
+		if h, m, s := t.Clock(); h != hour || m != minute || s != second {
+			// The time falls in a daylight saving gap, which time.Date may
+			// resolve to before the gap; run just after it instead
+			_, offset := t.Zone()
+			_, offsetAfter := t.Add(12 * time.Hour).Zone()
+			t = t.Add(time.Duration(offsetAfter-offset) * time.Second)
+		}
+		return t
+	}
+
+	switch schedule {
+	case ScheduleDaily:
+		next := at(after.Year(), after.Month(), after.Day())
+		if !next.After(after) {
+			next = at(after.Year(), after.Month(), after.Day()+1)
+		}
+		return next, nil
+
+	case ScheduleWeekly:
+		days := (int(anchor.Weekday()) - int(after.Weekday()) + 7) % 7
+		next := at(after.Year(), after.Month(), after.Day()+days)
+		if !next.After(after) {
+			next = at(after.Year(), after.Month(), after.Day()+days+7)
+		}
+		return next, nil
+
+	case ScheduleMonthly:
+		monthDay := func(year int, month time.Month) time.Time {
+			return at(year, month, min(anchor.Day(), daysIn(year, month)))
+		}
+		next := monthDay(after.Year(), after.Month())
+		if !next.After(after) {
+			next = monthDay(after.Year(), after.Month()+1)
+		}
+		return next, nil
+
+	default:
+		return time.Time{}, fmt.Errorf("%w: %q", ErrUnsupportedSchedule, schedule)
+	}
+}
+
+// daysIn returns the number of days in a month. month may be out of range,
+// e.g. 13 for January of the following year.
+func daysIn(year int, month time.Month) int {
+	return time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
+
+// Start runs due reports every interval until ctx is canceled. The
+// returned channel is closed once the loop has exited.
+func (s *Scheduler) Start(ctx context.Context, interval time.Duration) <-chan struct{} {
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := s.RunDue(ctx); err != nil && ctx.Err() == nil {
+					log.Printf("report scheduler: %v", err)
+				}
+			}
+		}
+	}()
+
+	return done
+}
+
+// RunDue runs every due report and schedules its next run. Reports that
+// have never been scheduled only get a NextRunAt. A failing report is
+// still rescheduled so it doesn't block later runs.
+func (s *Scheduler) RunDue(ctx context.Context) error {
+	now := s.now()
+
+	reports, err := s.store.DueReports(ctx, now)
+	if err != nil {
+		return fmt.Errorf("failed to load due reports: %w", err)
+	}
+
+	var errs []error
+	for _, report := range reports {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if report.NextRunAt != nil {
+			if err := s.Run(ctx, report, *report.NextRunAt); err != nil {
+				errs = append(errs, fmt.Errorf("report %s: %w", report.ID, err))
+			}
+			report.LastRunAt = &now
+		}
+
+		next, err := NextRunTime(report.Schedule, report.CreatedAt.In(s.location), now)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("report %s: %w", report.ID, err))
+			continue
+		}
+		report.NextRunAt = &next
+		report.UpdatedAt = now
+
+		if err := s.store.SaveReport(ctx, report); err != nil {
+			errs = append(errs, fmt.Errorf("failed to save report %s: %w", report.ID, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Run builds a report for the period ending at runAt and emails it to
+// its recipients
+func (s *Scheduler) Run(ctx context.Context, report *Report, runAt time.Time) error {
+	timeRange, err := reportPeriod(report, runAt)
+	if err != nil {
+		return err
+	}
+
+	result, err := s.build(ctx, report, timeRange)
+	if err != nil {
+		return fmt.Errorf("failed to build report: %w", err)
+	}
+
+	content, err := s.render(result, report.Format)
+	if err != nil {
+		return fmt.Errorf("failed to render report: %w", err)
+	}
+
+	if len(report.Recipients) == 0 {
+		return nil
+	}
+
+	return s.mailer.SendEmail(email.EmailMessage{
+		To:      report.Recipients,
+		Subject: fmt.Sprintf("%s: %s", report.Name, runAt.In(s.location).Format("2006-01-02")),
+		Body: fmt.Sprintf("Your %s report for %s to %s is attached.",
+			report.Schedule, timeRange.Start.In(s.location).Format("2006-01-02 15:04"),
+			timeRange.End.In(s.location).Format("2006-01-02 15:04")),
+		Attachments: []email.Attachment{{
+			Filename: reportFilename(report, runAt),
+			Content:  content,
+		}},
+	})
+}
+
+// build executes the query for a report's type
+func (s *Scheduler) build(ctx context.Context, report *Report, timeRange TimeRange) (*Result, error) {
+	switch report.Type {
+	case ReportTypeUserActivity:
+		return s.builder.BuildUserActivityReport(ctx, report.TenantID, timeRange)
+	case ReportTypeRevenue:
+		return s.builder.BuildRevenueReport(ctx, report.TenantID, timeRange)
+	case ReportTypeUsage:
+		return s.builder.BuildUsageReport(ctx, report.TenantID, timeRange)
+	case ReportTypePerformance:
+		return s.builder.BuildPerformanceReport(ctx, report.TenantID, timeRange)
+	case ReportTypeCustom:
+		if report.Query == nil {
+			return nil, fmt.Errorf("custom report has no query")
+		}
+		query := *report.Query
+		query.TenantID = report.TenantID
+		query.TimeRange = &timeRange
+		return s.builder.engine.Execute(ctx, &query)
+	default:
+		return nil, fmt.Errorf("unknown report type %q", report.Type)
+	}
+}
+
+// reportPeriod returns the schedule period that ends at runAt
+func reportPeriod(report *Report, runAt time.Time) (TimeRange, error) {
+	var start time.Time
+	switch report.Schedule {
+	case ScheduleDaily:
+		start = runAt.AddDate(0, 0, -1)
+	case ScheduleWeekly:
+		start = runAt.AddDate(0, 0, -7)
+	case ScheduleMonthly:
+		// AddDate would turn March 31 into March 3
+		year, month, day := runAt.Date()
+		hour, minute, second := runAt.Clock()
+		start = time.Date(year, month-1, min(day, daysIn(year, month-1)), hour, minute, second, 0, runAt.Location())
+	default:
+		return TimeRange{}, fmt.Errorf("%w: %q", ErrUnsupportedSchedule, report.Schedule)
+	}
+
+	return TimeRange{Start: start, End: runAt}, nil
+}
+
+// reportFilename names a report attachment, e.g. "revenue_report_20240301.pdf"
+func reportFilename(report *Report, runAt time.Time) string {
+	name := strings.ToLower(strings.Join(strings.Fields(report.Name), "_"))
+	if name == "" {
+		name = string(report.Type)
+	}
+
+	ext := report.Format
+	if ext == "excel" {
+		ext = "xlsx"
+	}
+
+	return fmt.Sprintf("%s_%s.%s", name, runAt.Format("20060102"), ext)
+}
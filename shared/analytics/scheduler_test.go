@@ -0,0 +1,247 @@
+package analytics
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+	_ "time/tzdata"
+
+	"github.com/dayanch951/marimo/shared/email"
+	"github.com/google/uuid"
+)
+
+func TestNextRunTime(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatalf("LoadLocation() error = %v", err)
+	}
+
+	date := func(year int, month time.Month, day, hour, minute int, loc *time.Location) time.Time {
+		return time.Date(year, month, day, hour, minute, 0, 0, loc)
+	}
+
+	tests := []struct {
+		name     string
+		schedule ReportSchedule
+		anchor   time.Time
+		after    time.Time
+		want     time.Time
+	}{
+		{
+			name:     "daily later today",
+			schedule: ScheduleDaily,
+			anchor:   date(2024, 1, 1, 9, 0, time.UTC),
+			after:    date(2024, 5, 10, 8, 0, time.UTC),
+			want:     date(2024, 5, 10, 9, 0, time.UTC),
+		},
+		{
+			name:     "daily at the run time moves to tomorrow",
+			schedule: ScheduleDaily,
+			anchor:   date(2024, 1, 1, 9, 0, time.UTC),
+			after:    date(2024, 5, 10, 9, 0, time.UTC),
+			want:     date(2024, 5, 11, 9, 0, time.UTC),
+		},
+		{
+			name:     "daily across spring forward keeps the wall clock",
+			schedule: ScheduleDaily,
+			anchor:   date(2024, 1, 1, 9, 0, newYork),
+			after:    date(2024, 3, 9, 10, 0, newYork),
+			want:     date(2024, 3, 10, 9, 0, newYork),
+		},
+		{
+			name:     "daily across fall back keeps the wall clock",
+			schedule: ScheduleDaily,
+			anchor:   date(2024, 1, 1, 9, 0, newYork),
+			after:    date(2024, 11, 2, 10, 0, newYork),
+			want:     date(2024, 11, 3, 9, 0, newYork),
+		},
+		{
+			name:     "daily in the skipped hour",
+			schedule: ScheduleDaily,
+			anchor:   date(2024, 1, 1, 2, 30, newYork),
+			after:    date(2024, 3, 9, 12, 0, newYork),
+			want:     date(2024, 3, 10, 3, 30, newYork),
+		},
+		{
+			name:     "weekly on the anchor weekday",
+			schedule: ScheduleWeekly,
+			anchor:   date(2024, 1, 1, 6, 0, time.UTC),  // Monday
+			after:    date(2024, 5, 8, 12, 0, time.UTC), // Wednesday
+			want:     date(2024, 5, 13, 6, 0, time.UTC),
+		},
+		{
+			name:     "weekly on the anchor weekday after the run time",
+			schedule: ScheduleWeekly,
+			anchor:   date(2024, 1, 1, 6, 0, time.UTC),
+			after:    date(2024, 5, 13, 7, 0, time.UTC),
+			want:     date(2024, 5, 20, 6, 0, time.UTC),
+		},
+		{
+			name:     "monthly on the 31st in a leap February",
+			schedule: ScheduleMonthly,
+			anchor:   date(2024, 1, 31, 0, 0, time.UTC),
+			after:    date(2024, 1, 31, 0, 0, time.UTC),
+			want:     date(2024, 2, 29, 0, 0, time.UTC),
+		},
+		{
+			name:     "monthly returns to the 31st after a short month",
+			schedule: ScheduleMonthly,
+			anchor:   date(2024, 1, 31, 0, 0, time.UTC),
+			after:    date(2024, 2, 29, 0, 0, time.UTC),
+			want:     date(2024, 3, 31, 0, 0, time.UTC),
+		},
+		{
+			name:     "monthly on the 30th in a 30-day month",
+			schedule: ScheduleMonthly,
+			anchor:   date(2023, 8, 31, 8, 0, time.UTC),
+			after:    date(2023, 9, 1, 0, 0, time.UTC),
+			want:     date(2023, 9, 30, 8, 0, time.UTC),
+		},
+		{
+			name:     "monthly across the year end",
+			schedule: ScheduleMonthly,
+			anchor:   date(2023, 1, 15, 8, 0, time.UTC),
+			after:    date(2023, 12, 20, 0, 0, time.UTC),
+			want:     date(2024, 1, 15, 8, 0, time.UTC),
+		},
+		{
+			name:     "after in another zone",
+			schedule: ScheduleDaily,
+			anchor:   date(2024, 1, 1, 9, 0, newYork),
+			after:    date(2024, 7, 1, 12, 0, time.UTC), // 08:00 in New York
+			want:     date(2024, 7, 1, 9, 0, newYork),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NextRunTime(tt.schedule, tt.anchor, tt.after)
+			if err != nil {
+				t.Fatalf("NextRunTime() error = %v", err)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("NextRunTime() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := NextRunTime(ScheduleCustom, time.Now(), time.Now()); err == nil {
+		t.Error("NextRunTime(custom) error = nil, want ErrUnsupportedSchedule")
+	}
+}
+
+type memoryReportStore struct {
+	reports []*Report
+	saved   []*Report
+}
+
+func (m *memoryReportStore) DueReports(ctx context.Context, now time.Time) ([]*Report, error) {
+	var due []*Report
+	for _, report := range m.reports {
+		if report.Enabled && (report.NextRunAt == nil || !report.NextRunAt.After(now)) {
+			due = append(due, report)
+		}
+	}
+	return due, nil
+}
+
+func (m *memoryReportStore) SaveReport(ctx context.Context, report *Report) error {
+	m.saved = append(m.saved, report)
+	return nil
+}
+
+type recordingMailer struct {
+	sent []email.EmailMessage
+}
+
+func (m *recordingMailer) SendEmail(msg email.EmailMessage) error {
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+func TestScheduler_RunDue(t *testing.T) {
+	db := newTestDB(t, `CREATE TABLE transactions (tenant_id TEXT, amount REAL, created_at DATETIME)`)
+
+	tenantID := uuid.New()
+	if _, err := db.Exec("INSERT INTO transactions VALUES ($1, 150, $2)",
+		tenantID, time.Date(2024, 3, 4, 12, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatalf("failed to seed: %v", err)
+	}
+
+	now := time.Date(2024, 3, 5, 6, 1, 0, 0, time.UTC)
+	due := time.Date(2024, 3, 5, 6, 0, 0, 0, time.UTC)
+	report := &Report{
+		ID:       uuid.New(),
+		TenantID: tenantID,
+		Name:     "Daily Revenue",
+		Type:     ReportTypeCustom,
+		Query: &Query{
+			Source:  "transactions",
+			Metrics: []Metric{{Name: "revenue", Type: MetricTypeSum, Field: "amount"}},
+		},
+		Schedule:   ScheduleDaily,
+		Recipients: []string{"finance@example.com"},
+		Format:     "csv",
+		Enabled:    true,
+		CreatedAt:  time.Date(2024, 1, 1, 6, 0, 0, 0, time.UTC),
+		NextRunAt:  &due,
+	}
+	unscheduled := &Report{
+		ID:        uuid.New(),
+		Type:      ReportTypeRevenue,
+		Schedule:  ScheduleWeekly,
+		Enabled:   true,
+		CreatedAt: time.Date(2024, 1, 1, 6, 0, 0, 0, time.UTC),
+	}
+	store := &memoryReportStore{reports: []*Report{report, unscheduled}}
+	mailer := &recordingMailer{}
+
+	var rendered *Result
+	render := func(result *Result, format string) ([]byte, error) {
+		rendered = result
+		return []byte(format), nil
+	}
+
+	scheduler := NewScheduler(store, NewReportBuilder(NewEngine(db)), render, mailer)
+	scheduler.now = func() time.Time { return now }
+
+	if err := scheduler.RunDue(context.Background()); err != nil {
+		t.Fatalf("RunDue() error = %v", err)
+	}
+
+	if len(mailer.sent) != 1 {
+		t.Fatalf("sent %d emails, want 1", len(mailer.sent))
+	}
+	msg := mailer.sent[0]
+	if msg.To[0] != "finance@example.com" || len(msg.Attachments) != 1 {
+		t.Errorf("email = %+v, want one attachment to finance@example.com", msg)
+	}
+	if name := msg.Attachments[0].Filename; name != "daily_revenue_20240305.csv" {
+		t.Errorf("attachment name = %q, want daily_revenue_20240305.csv", name)
+	}
+	if rendered == nil || rendered.Count != 1 || rendered.Data[0]["revenue"] != float64(150) {
+		t.Errorf("rendered result = %+v, want the seeded revenue", rendered)
+	}
+	if !strings.Contains(msg.Subject, "Daily Revenue") {
+		t.Errorf("subject = %q, want it to name the report", msg.Subject)
+	}
+
+	wantNext := time.Date(2024, 3, 6, 6, 0, 0, 0, time.UTC)
+	if report.NextRunAt == nil || !report.NextRunAt.Equal(wantNext) {
+		t.Errorf("NextRunAt = %v, want %v", report.NextRunAt, wantNext)
+	}
+	if report.LastRunAt == nil || !report.LastRunAt.Equal(now) {
+		t.Errorf("LastRunAt = %v, want %v", report.LastRunAt, now)
+	}
+
+	// A report seen for the first time is only scheduled
+	wantFirst := time.Date(2024, 3, 11, 6, 0, 0, 0, time.UTC)
+	if unscheduled.NextRunAt == nil || !unscheduled.NextRunAt.Equal(wantFirst) || unscheduled.LastRunAt != nil {
+		t.Errorf("unscheduled report NextRunAt = %v, LastRunAt = %v, want %v and nil",
+			unscheduled.NextRunAt, unscheduled.LastRunAt, wantFirst)
+	}
+	if len(store.saved) != 2 {
+		t.Errorf("saved %d reports, want 2", len(store.saved))
+	}
+}
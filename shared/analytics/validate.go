@@ -0,0 +1,218 @@
+package analytics
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrInvalidIdentifier is returned when a query references a table, field
+// or alias that isn't a safe SQL identifier or expression
+var ErrInvalidIdentifier = errors.New("invalid identifier")
+
+// allowedFunctions are the SQL functions query expressions may call
+var allowedFunctions = map[string]bool{
+	"ABS":      true,
+	"AVG":      true,
+	"COALESCE": true,
+	"COUNT":    true,
+	"DATE":     true,
+	"LENGTH":   true,
+	"LOWER":    true,
+	"MAX":      true,
+	"MIN":      true,
+	"ROUND":    true,
+	"SUM":      true,
+	"UPPER":    true,
+}
+
+// validateQuery checks every name the query interpolates into SQL, since
+// only values can be passed as bind parameters
+func validateQuery(query *Query) error {
+	if err := validateName(query.Source, true); err != nil {
+		return fmt.Errorf("source: %w", err)
+	}
+
+	for _, dim := range query.Dimensions {
+		if err := validateName(dim.Name, false); err != nil {
+			return fmt.Errorf("dimension name: %w", err)
+		}
+		if err := validateExpression(dim.Field); err != nil {
+			return fmt.Errorf("dimension %s: %w", dim.Name, err)
+		}
+	}
+
+	for _, metric := range query.Metrics {
+		if err := validateName(metric.Name, false); err != nil {
+			return fmt.Errorf("metric name: %w", err)
+		}
+		if err := validateExpression(metric.Field); err != nil {
+			return fmt.Errorf("metric %s: %w", metric.Name, err)
+		}
+	}
+
+	for field := range query.Filters {
+		if err := validateExpression(field); err != nil {
+			return fmt.Errorf("filter: %w", err)
+		}
+	}
+
+	for _, filter := range query.Where {
+		if err := validateExpression(filter.Field); err != nil {
+			return fmt.Errorf("where: %w", err)
+		}
+	}
+
+	for _, field := range query.GroupBy {
+		if err := validateExpression(field); err != nil {
+			return fmt.Errorf("group by: %w", err)
+		}
+	}
+
+	for _, ob := range query.OrderBy {
+		if err := validateExpression(ob.Field); err != nil {
+			return fmt.Errorf("order by: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// validateName checks a table name or column alias. Table names may be
+// schema-qualified with a dot.
+func validateName(name string, qualified bool) error {
+	if name == "" {
+		return fmt.Errorf("%w: empty name", ErrInvalidIdentifier)
+	}
+
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if isWordChar(c) || (qualified && c == '.') {
+			continue
+		}
+		return fmt.Errorf("%w %q: unexpected character %q", ErrInvalidIdentifier, name, c)
+	}
+
+	return nil
+}
+
+// Token kinds seen by validateExpression
+const (
+	tokenNone = iota
+	tokenWord
+	tokenOpen
+	tokenClose
+	tokenStar
+	tokenComma
+	tokenOperator
+)
+
+// validateExpression checks a field expression such as "amount", "*",
+// "DISTINCT user_id", "DATE(created_at)" or "SUM(amount) - SUM(refunds)".
+// Only identifiers, numbers, *, commas, parentheses, the arithmetic
+// operators + - * / and calls to allowedFunctions are accepted.
+func validateExpression(expr string) error {
+	invalid := func(reason string) error {
+		return fmt.Errorf("%w %q: %s", ErrInvalidIdentifier, expr, reason)
+	}
+
+	depth := 0
+	last, lastWord := tokenNone, ""
+
+	for i := 0; i < len(expr); {
+		c := expr[i]
+
+		switch {
+		case c == ' ':
+			i++
+			continue
+
+		case isWordChar(c) || c == '.':
+			start := i
+			for i < len(expr) && (isWordChar(expr[i]) || expr[i] == '.') {
+				i++
+			}
+			word := expr[start:i]
+
+			// Only DISTINCT may be followed by another identifier
+			afterDistinct := last == tokenWord && strings.EqualFold(lastWord, "DISTINCT")
+			if !startsOperand(last) && !afterDistinct {
+				return invalid(fmt.Sprintf("unexpected %q", word))
+			}
+			last, lastWord = tokenWord, word
+
+		case c == '(':
+			// Either a function call or grouping of an operand
+			isCall := last == tokenWord && allowedFunctions[strings.ToUpper(lastWord)]
+			if !isCall && (last == tokenWord || !startsOperand(last)) {
+				return invalid(fmt.Sprintf("function %q is not allowed", lastWord))
+			}
+			depth++
+			last = tokenOpen
+			i++
+
+		case c == ')':
+			if depth == 0 || !(endsOperand(last) || last == tokenStar) {
+				return invalid("unbalanced parentheses")
+			}
+			depth--
+			last = tokenClose
+			i++
+
+		case c == '*' && endsOperand(last):
+			// Multiplication
+			last = tokenOperator
+			i++
+
+		case c == '*':
+			if last != tokenNone && last != tokenOpen && last != tokenComma {
+				return invalid("unexpected *")
+			}
+			last = tokenStar
+			i++
+
+		case c == '+' || c == '-' || c == '/':
+			// Operators must sit between operands, which also rules out
+			// the comment markers -- and /*
+			if !endsOperand(last) {
+				return invalid(fmt.Sprintf("unexpected %q", c))
+			}
+			last = tokenOperator
+			i++
+
+		case c == ',':
+			if depth == 0 || !(endsOperand(last) || last == tokenStar) {
+				return invalid("unexpected ,")
+			}
+			last = tokenComma
+			i++
+
+		default:
+			return invalid(fmt.Sprintf("unexpected character %q", c))
+		}
+	}
+
+	if last == tokenNone {
+		return invalid("empty expression")
+	}
+	if depth != 0 || last == tokenOpen || last == tokenComma || last == tokenOperator {
+		return invalid("incomplete expression")
+	}
+
+	return nil
+}
+
+// startsOperand reports whether an operand may follow a token of kind last
+func startsOperand(last int) bool {
+	return last == tokenNone || last == tokenOpen || last == tokenComma || last == tokenOperator
+}
+
+// endsOperand reports whether a token of kind last completes an operand
+// that an operator may follow
+func endsOperand(last int) bool {
+	return last == tokenWord || last == tokenClose
+}
+
+func isWordChar(c byte) bool {
+	return c == '_' || (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
@@ -3,9 +3,10 @@ package async
 import (
 	"fmt"
 	"log"
+	"time"
 
+	"github.com/dayanch951/marimo/shared/email"
 	"github.com/dayanch951/marimo/shared/queue"
-	"github.com/google/uuid"
 )
 
 // EventType represents different types of events
@@ -28,9 +29,27 @@ const (
 	QueueEvents       = "events_queue"
 )
 
+// eventQueues lists the queues each event type is published to
+var eventQueues = map[EventType][]string{
+	EventUserRegistered: {QueueEmail, QueueAudit, QueueEvents},
+	EventUserLogin:      {QueueAudit},
+	EventUserLogout:     {QueueAudit},
+	EventAuditLog:       {QueueAudit},
+	EventEmailSend:      {QueueEmail},
+	EventNotification:   {QueueNotification},
+}
+
+// messageQueue is the subset of *queue.MessageQueue events use
+type messageQueue interface {
+	Publish(queueName string, message queue.Message) error
+	Consume(queueName string, handler func(queue.Message) error) error
+	ConsumeWithBackoff(queueName string, delays []time.Duration, handler func(queue.Message) error) error
+	Close() error
+}
+
 // EventPublisher publishes events to RabbitMQ
 type EventPublisher struct {
-	mq *queue.MessageQueue
+	mq messageQueue
 }
 
 // NewEventPublisher creates a new event publisher
@@ -59,26 +78,12 @@ func NewEventPublisher(rabbitmqURL string) (*EventPublisher, error) {
 
 // PublishUserRegistered publishes a user registration event
 func (ep *EventPublisher) PublishUserRegistered(userID, email string) error {
-	msg := queue.Message{
-		ID:   uuid.New().String(),
-		Type: string(EventUserRegistered),
-		Payload: map[string]interface{}{
-			"user_id": userID,
-			"email":   email,
-		},
-	}
-
-	// Send to multiple queues
-	if err := ep.mq.Publish(QueueEmail, msg); err != nil {
-		return fmt.Errorf("failed to publish to email queue: %w", err)
-	}
-
-	if err := ep.mq.Publish(QueueAudit, msg); err != nil {
-		return fmt.Errorf("failed to publish to audit queue: %w", err)
-	}
-
-	if err := ep.mq.Publish(QueueEvents, msg); err != nil {
-		return fmt.Errorf("failed to publish to events queue: %w", err)
+	err := PublishEvent(ep, EventUserRegistered, UserRegisteredPayload{
+		UserID: userID,
+		Email:  email,
+	})
+	if err != nil {
+		return err
 	}
 
 	log.Printf("Published user registration event: %s", userID)
@@ -87,18 +92,13 @@ func (ep *EventPublisher) PublishUserRegistered(userID, email string) error {
 
 // PublishUserLogin publishes a user login event
 func (ep *EventPublisher) PublishUserLogin(userID, email, ipAddress string) error {
-	msg := queue.Message{
-		ID:   uuid.New().String(),
-		Type: string(EventUserLogin),
-		Payload: map[string]interface{}{
-			"user_id":    userID,
-			"email":      email,
-			"ip_address": ipAddress,
-		},
-	}
-
-	if err := ep.mq.Publish(QueueAudit, msg); err != nil {
-		return fmt.Errorf("failed to publish login event: %w", err)
+	err := PublishEvent(ep, EventUserLogin, UserLoginPayload{
+		UserID:    userID,
+		Email:     email,
+		IPAddress: ipAddress,
+	})
+	if err != nil {
+		return err
 	}
 
 	log.Printf("Published user login event: %s", userID)
@@ -107,18 +107,13 @@ func (ep *EventPublisher) PublishUserLogin(userID, email, ipAddress string) erro
 
 // PublishEmail publishes an email send event
 func (ep *EventPublisher) PublishEmail(to, subject, body string) error {
-	msg := queue.Message{
-		ID:   uuid.New().String(),
-		Type: string(EventEmailSend),
-		Payload: map[string]interface{}{
-			"to":      to,
-			"subject": subject,
-			"body":    body,
-		},
-	}
-
-	if err := ep.mq.Publish(QueueEmail, msg); err != nil {
-		return fmt.Errorf("failed to publish email event: %w", err)
+	err := PublishEvent(ep, EventEmailSend, EmailPayload{
+		To:      to,
+		Subject: subject,
+		Body:    body,
+	})
+	if err != nil {
+		return err
 	}
 
 	log.Printf("Published email event to: %s", to)
@@ -138,14 +133,8 @@ func (ep *EventPublisher) PublishAuditLog(userID, action, resource string, metad
 		payload[k] = v
 	}
 
-	msg := queue.Message{
-		ID:      uuid.New().String(),
-		Type:    string(EventAuditLog),
-		Payload: payload,
-	}
-
-	if err := ep.mq.Publish(QueueAudit, msg); err != nil {
-		return fmt.Errorf("failed to publish audit log: %w", err)
+	if err := PublishEvent(ep, EventAuditLog, payload); err != nil {
+		return err
 	}
 
 	log.Printf("Published audit log: %s - %s", action, resource)
@@ -157,63 +146,89 @@ func (ep *EventPublisher) Close() error {
 	return ep.mq.Close()
 }
 
+// EmailSender sends the emails of email events. *email.EmailService
+// implements it.
+type EmailSender interface {
+	SendEmail(msg email.EmailMessage) error
+}
+
+// NopEmailSender logs emails instead of sending them, for tests and local
+// development
+type NopEmailSender struct{}
+
+// SendEmail logs msg
+func (NopEmailSender) SendEmail(msg email.EmailMessage) error {
+	log.Printf("Not sending email to %v: %s", msg.To, msg.Subject)
+	return nil
+}
+
 // EventHandler handles different types of events
 type EventHandler struct {
-	mq *queue.MessageQueue
+	mq     messageQueue
+	sender EmailSender
 }
 
-// NewEventHandler creates a new event handler
-func NewEventHandler(rabbitmqURL string) (*EventHandler, error) {
+// NewEventHandler creates a new event handler that sends emails with sender
+func NewEventHandler(rabbitmqURL string, sender EmailSender) (*EventHandler, error) {
 	mq, err := queue.NewMessageQueue(rabbitmqURL)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create message queue: %w", err)
 	}
 
-	return &EventHandler{mq: mq}, nil
+	return &EventHandler{mq: mq, sender: sender}, nil
 }
 
-// StartEmailWorker starts consuming email events
+// StartEmailWorker starts consuming email events. Failed emails are
+// retried after queue.DefaultRetryDelays and then dead-lettered.
 func (eh *EventHandler) StartEmailWorker() error {
 	log.Println("Starting email worker...")
 
-	handler := func(msg queue.Message) error {
-		log.Printf("Processing email: %s", msg.Type)
+	return eh.mq.ConsumeWithBackoff(QueueEmail, queue.DefaultRetryDelays, eh.handleEmail)
+}
 
-		to, _ := msg.Payload["to"].(string)
-		subject, _ := msg.Payload["subject"].(string)
-		body, _ := msg.Payload["body"].(string)
+// handleEmail sends the email described by an email event. Other events
+// published to the email queue are acknowledged without sending anything.
+func (eh *EventHandler) handleEmail(msg queue.Message) error {
+	log.Printf("Processing email: %s", msg.Type)
 
-		// Simulate sending email
-		log.Printf("Sending email to %s: %s", to, subject)
+	if msg.Type != string(EventEmailSend) {
+		log.Printf("No email to send for %s event %s", msg.Type, msg.ID)
+		return nil
+	}
 
-		// In production, use actual email service (SendGrid, AWS SES, etc.)
-		// For now, just log
-		log.Printf("Email sent successfully: %s", msg.ID)
+	payload, err := decodePayload[EmailPayload](msg)
+	if err != nil {
+		return err
+	}
+	if payload.To == "" {
+		return fmt.Errorf("email event %s has no recipient", msg.ID)
+	}
 
-		return nil
+	err = eh.sender.SendEmail(email.EmailMessage{
+		To:      []string{payload.To},
+		Subject: payload.Subject,
+		Body:    payload.Body,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send email %s: %w", msg.ID, err)
 	}
 
-	return eh.mq.Consume(QueueEmail, handler)
+	log.Printf("Email sent successfully: %s", msg.ID)
+	return nil
 }
 
 // StartAuditWorker starts consuming audit log events
 func (eh *EventHandler) StartAuditWorker() error {
 	log.Println("Starting audit worker...")
 
-	handler := func(msg queue.Message) error {
-		log.Printf("Processing audit log: %s", msg.Type)
-
-		userID, _ := msg.Payload["user_id"].(string)
-		action, _ := msg.Payload["action"].(string)
-		resource, _ := msg.Payload["resource"].(string)
-
+	handler := func(payload AuditLogPayload) error {
 		// In production, write to database or log aggregation service
-		log.Printf("Audit: User %s performed %s on %s", userID, action, resource)
+		log.Printf("Audit: User %s performed %s on %s", payload.UserID, payload.Action, payload.Resource)
 
 		return nil
 	}
 
-	return eh.mq.Consume(QueueAudit, handler)
+	return RegisterConsumer(eh, QueueAudit, handler)
 }
 
 // StartNotificationWorker starts consuming notification events
@@ -0,0 +1,62 @@
+package async
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/dayanch951/marimo/shared/email"
+	"github.com/dayanch951/marimo/shared/queue"
+)
+
+type fakeEmailSender struct {
+	sent []email.EmailMessage
+	err  error
+}
+
+func (f *fakeEmailSender) SendEmail(msg email.EmailMessage) error {
+	f.sent = append(f.sent, msg)
+	return f.err
+}
+
+func TestEventHandler_HandleEmail(t *testing.T) {
+	// Decode the event as the queue would deliver it
+	body, err := json.Marshal(queue.Message{
+		ID:   "msg-1",
+		Type: string(EventEmailSend),
+		Payload: map[string]interface{}{
+			"to":      "user@example.com",
+			"subject": "Your invoice",
+			"body":    "Invoice #42 is attached.",
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to encode message: %v", err)
+	}
+	var msg queue.Message
+	if err := json.Unmarshal(body, &msg); err != nil {
+		t.Fatalf("failed to decode message: %v", err)
+	}
+
+	sender := &fakeEmailSender{}
+	eh := &EventHandler{sender: sender}
+
+	if err := eh.handleEmail(msg); err != nil {
+		t.Fatalf("handleEmail() error = %v", err)
+	}
+
+	if len(sender.sent) != 1 {
+		t.Fatalf("sent %d emails, want 1", len(sender.sent))
+	}
+	sent := sender.sent[0]
+	if len(sent.To) != 1 || sent.To[0] != "user@example.com" ||
+		sent.Subject != "Your invoice" || sent.Body != "Invoice #42 is attached." {
+		t.Errorf("sent %+v, want the event's recipient, subject and body", sent)
+	}
+
+	// Send failures are returned so the queue retries the message
+	sender.err = errors.New("smtp: 421 service not available")
+	if err := eh.handleEmail(msg); !errors.Is(err, sender.err) {
+		t.Errorf("handleEmail() error = %v, want the send error", err)
+	}
+}
@@ -0,0 +1,106 @@
+package async
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/dayanch951/marimo/shared/queue"
+	"github.com/google/uuid"
+)
+
+// UserRegisteredPayload is the payload of EventUserRegistered
+type UserRegisteredPayload struct {
+	UserID string `json:"user_id"`
+	Email  string `json:"email"`
+}
+
+// UserLoginPayload is the payload of EventUserLogin
+type UserLoginPayload struct {
+	UserID    string `json:"user_id"`
+	Email     string `json:"email"`
+	IPAddress string `json:"ip_address"`
+}
+
+// EmailPayload is the payload of EventEmailSend
+type EmailPayload struct {
+	To      string `json:"to"`
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+}
+
+// AuditLogPayload is the payload of EventAuditLog. Events may carry extra
+// metadata fields, which it ignores.
+type AuditLogPayload struct {
+	UserID   string `json:"user_id"`
+	Action   string `json:"action"`
+	Resource string `json:"resource"`
+}
+
+// PublishEvent publishes payload as an event of eventType to every queue
+// that receives that type. payload must encode to a JSON object.
+func PublishEvent[T any](ep *EventPublisher, eventType EventType, payload T) error {
+	queues, ok := eventQueues[eventType]
+	if !ok {
+		return fmt.Errorf("unknown event type %q", eventType)
+	}
+
+	fields, err := encodePayload(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s payload: %w", eventType, err)
+	}
+
+	msg := queue.Message{
+		ID:      uuid.New().String(),
+		Type:    string(eventType),
+		Payload: fields,
+	}
+
+	for _, q := range queues {
+		if err := ep.mq.Publish(q, msg); err != nil {
+			return fmt.Errorf("failed to publish %s event to %s: %w", eventType, q, err)
+		}
+	}
+
+	return nil
+}
+
+// RegisterConsumer consumes queueName, decoding each event's payload into
+// a T for handler. Events that fail to decode or whose handler fails are
+// retried and then dead-lettered like any other failing message.
+func RegisterConsumer[T any](eh *EventHandler, queueName string, handler func(T) error) error {
+	return eh.mq.Consume(queueName, func(msg queue.Message) error {
+		payload, err := decodePayload[T](msg)
+		if err != nil {
+			return err
+		}
+		return handler(payload)
+	})
+}
+
+// encodePayload converts a payload into the field map queue.Message carries
+func encodePayload[T any](payload T) (map[string]interface{}, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("payload is not a JSON object: %w", err)
+	}
+	return fields, nil
+}
+
+// decodePayload converts a message's fields back into a T
+func decodePayload[T any](msg queue.Message) (T, error) {
+	var payload T
+
+	data, err := json.Marshal(msg.Payload)
+	if err != nil {
+		return payload, fmt.Errorf("failed to encode %s payload: %w", msg.Type, err)
+	}
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return payload, fmt.Errorf("failed to decode %s payload: %w", msg.Type, err)
+	}
+	return payload, nil
+}
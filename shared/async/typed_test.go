@@ -0,0 +1,103 @@
+package async
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/dayanch951/marimo/shared/queue"
+)
+
+// memoryQueue is a messageQueue that delivers published messages to the
+// queue's handler straight away, encoded as they would be on the wire
+type memoryQueue struct {
+	handlers  map[string]func(queue.Message) error
+	published map[string][]queue.Message
+}
+
+func newMemoryQueue() *memoryQueue {
+	return &memoryQueue{
+		handlers:  make(map[string]func(queue.Message) error),
+		published: make(map[string][]queue.Message),
+	}
+}
+
+func (m *memoryQueue) Publish(queueName string, message queue.Message) error {
+	body, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	var delivered queue.Message
+	if err := json.Unmarshal(body, &delivered); err != nil {
+		return err
+	}
+	m.published[queueName] = append(m.published[queueName], delivered)
+
+	if handler, ok := m.handlers[queueName]; ok {
+		return handler(delivered)
+	}
+	return nil
+}
+
+func (m *memoryQueue) Consume(queueName string, handler func(queue.Message) error) error {
+	m.handlers[queueName] = handler
+	return nil
+}
+
+func (m *memoryQueue) ConsumeWithBackoff(queueName string, delays []time.Duration, handler func(queue.Message) error) error {
+	return m.Consume(queueName, handler)
+}
+
+func (m *memoryQueue) Close() error {
+	return nil
+}
+
+func TestPublishEvent_RoundTrip(t *testing.T) {
+	mq := newMemoryQueue()
+	ep := &EventPublisher{mq: mq}
+	eh := &EventHandler{mq: mq, sender: NopEmailSender{}}
+
+	var received []UserRegisteredPayload
+	if err := RegisterConsumer(eh, QueueEvents, func(payload UserRegisteredPayload) error {
+		received = append(received, payload)
+		return nil
+	}); err != nil {
+		t.Fatalf("RegisterConsumer() error = %v", err)
+	}
+
+	want := UserRegisteredPayload{UserID: "user-1", Email: "user@example.com"}
+	if err := PublishEvent(ep, EventUserRegistered, want); err != nil {
+		t.Fatalf("PublishEvent() error = %v", err)
+	}
+
+	if len(received) != 1 || received[0] != want {
+		t.Errorf("received %+v, want [%+v]", received, want)
+	}
+
+	// The event fans out to every queue for its type
+	for _, q := range []string{QueueEmail, QueueAudit, QueueEvents} {
+		msgs := mq.published[q]
+		if len(msgs) != 1 || msgs[0].Type != string(EventUserRegistered) {
+			t.Errorf("%s got %+v, want one %s event", q, msgs, EventUserRegistered)
+		}
+	}
+
+	// The existing publisher produces the same payload
+	if err := ep.PublishUserRegistered("user-2", "other@example.com"); err != nil {
+		t.Fatalf("PublishUserRegistered() error = %v", err)
+	}
+	if len(received) != 2 || received[1] != (UserRegisteredPayload{UserID: "user-2", Email: "other@example.com"}) {
+		t.Errorf("received %+v, want user-2 second", received)
+	}
+}
+
+func TestPublishEvent_UnknownType(t *testing.T) {
+	ep := &EventPublisher{mq: newMemoryQueue()}
+	if err := PublishEvent(ep, EventType("order.created"), struct{}{}); err == nil {
+		t.Error("PublishEvent() with an unknown type error = nil")
+	}
+	if err := PublishEvent(ep, EventEmailSend, "not an object"); err == nil {
+		t.Error("PublishEvent() with a non-object payload error = nil")
+	}
+}
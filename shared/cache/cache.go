@@ -4,6 +4,11 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-redis/redis/v8"
@@ -13,12 +18,21 @@ import (
 type Cache interface {
 	Get(ctx context.Context, key string, dest interface{}) error
 	Set(ctx context.Context, key string, value interface{}, ttl time.Duration) error
+	GetMany(ctx context.Context, keys []string, dest map[string]json.RawMessage) error
+	SetMany(ctx context.Context, items map[string]interface{}, ttl time.Duration) error
 	Delete(ctx context.Context, keys ...string) error
 	Exists(ctx context.Context, key string) (bool, error)
 	Increment(ctx context.Context, key string) (int64, error)
 	Decrement(ctx context.Context, key string) (int64, error)
 	Expire(ctx context.Context, key string, ttl time.Duration) error
+	TTL(ctx context.Context, key string) (time.Duration, error)
 	FlushAll(ctx context.Context) error
+	SetAdd(ctx context.Context, key string, members ...string) error
+	SetMembers(ctx context.Context, key string) ([]string, error)
+	SortedSetAdd(ctx context.Context, key string, score float64, member string) error
+	SortedSetRemove(ctx context.Context, key string, members ...string) error
+	SortedSetRemoveRangeByScore(ctx context.Context, key string, min, max float64) error
+	SortedSetCard(ctx context.Context, key string) (int64, error)
 }
 
 // RedisCache implements Cache using Redis
@@ -86,14 +100,92 @@ func (rc *RedisCache) Set(ctx context.Context, key string, value interface{}, tt
 	return rc.client.Set(ctx, rc.prefixKey(key), data, ttl).Err()
 }
 
-// Delete removes keys from cache
+// GetMany retrieves several values in one round trip. Values found are
+// stored in dest by key; missing keys are left out.
+func (rc *RedisCache) GetMany(ctx context.Context, keys []string, dest map[string]json.RawMessage) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	prefixedKeys := make([]string, len(keys))
+	for i, key := range keys {
+		prefixedKeys[i] = rc.prefixKey(key)
+	}
+
+	values, err := rc.client.MGet(ctx, prefixedKeys...).Result()
+	if err != nil {
+		return err
+	}
+
+	for i, value := range values {
+		if s, ok := value.(string); ok {
+			dest[keys[i]] = json.RawMessage(s)
+		}
+	}
+
+	return nil
+}
+
+// SetMany stores several values in one round trip
+func (rc *RedisCache) SetMany(ctx context.Context, items map[string]interface{}, ttl time.Duration) error {
+	if len(items) == 0 {
+		return nil
+	}
+
+	encoded := make(map[string]interface{}, len(items))
+	for key, value := range items {
+		data, err := json.Marshal(value)
+		if err != nil {
+			return fmt.Errorf("failed to encode %s: %w", key, err)
+		}
+		encoded[rc.prefixKey(key)] = data
+	}
+
+	// MSET can't set expirations, so keys with a TTL are set one by one
+	// in a pipeline
+	if ttl == 0 {
+		return rc.client.MSet(ctx, encoded).Err()
+	}
+
+	pipe := rc.client.Pipeline()
+	for key, data := range encoded {
+		pipe.Set(ctx, key, data, ttl)
+	}
+
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// deleteBatchSize caps the number of keys sent in a single DEL command
+const deleteBatchSize = 500
+
+// Delete removes keys from cache. Large deletes are split into batches
+// sent in one pipeline.
 func (rc *RedisCache) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
 	prefixedKeys := make([]string, len(keys))
 	for i, key := range keys {
 		prefixedKeys[i] = rc.prefixKey(key)
 	}
 
-	return rc.client.Del(ctx, prefixedKeys...).Err()
+	if len(prefixedKeys) <= deleteBatchSize {
+		return rc.client.Del(ctx, prefixedKeys...).Err()
+	}
+
+	pipe := rc.client.Pipeline()
+	for start := 0; start < len(prefixedKeys); start += deleteBatchSize {
+		end := start + deleteBatchSize
+		if end > len(prefixedKeys) {
+			end = len(prefixedKeys)
+		}
+		pipe.Del(ctx, prefixedKeys[start:end]...)
+	}
+
+	_, err := pipe.Exec(ctx)
+	return err
 }
 
 // Exists checks if key exists in cache
@@ -117,6 +209,70 @@ func (rc *RedisCache) Expire(ctx context.Context, key string, ttl time.Duration)
 	return rc.client.Expire(ctx, rc.prefixKey(key), ttl).Err()
 }
 
+// TTL returns how long key has left to live, or 0 if it never expires.
+// It returns ErrCacheMiss if the key doesn't exist.
+func (rc *RedisCache) TTL(ctx context.Context, key string) (time.Duration, error) {
+	ttl, err := rc.client.PTTL(ctx, rc.prefixKey(key)).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	switch ttl {
+	case -2:
+		return 0, ErrCacheMiss
+	case -1:
+		return 0, nil
+	}
+
+	return ttl, nil
+}
+
+// SetAdd adds members to the set stored at key
+func (rc *RedisCache) SetAdd(ctx context.Context, key string, members ...string) error {
+	if len(members) == 0 {
+		return nil
+	}
+
+	values := make([]interface{}, len(members))
+	for i, member := range members {
+		values[i] = member
+	}
+
+	return rc.client.SAdd(ctx, rc.prefixKey(key), values...).Err()
+}
+
+// SetMembers returns all members of the set stored at key
+func (rc *RedisCache) SetMembers(ctx context.Context, key string) ([]string, error) {
+	return rc.client.SMembers(ctx, rc.prefixKey(key)).Result()
+}
+
+// SortedSetAdd adds a member with the given score to the sorted set at key
+func (rc *RedisCache) SortedSetAdd(ctx context.Context, key string, score float64, member string) error {
+	return rc.client.ZAdd(ctx, rc.prefixKey(key), &redis.Z{Score: score, Member: member}).Err()
+}
+
+// SortedSetRemove removes members from the sorted set at key
+func (rc *RedisCache) SortedSetRemove(ctx context.Context, key string, members ...string) error {
+	values := make([]interface{}, len(members))
+	for i, member := range members {
+		values[i] = member
+	}
+
+	return rc.client.ZRem(ctx, rc.prefixKey(key), values...).Err()
+}
+
+// SortedSetRemoveRangeByScore removes members scored between min and max
+// (inclusive) from the sorted set at key
+func (rc *RedisCache) SortedSetRemoveRangeByScore(ctx context.Context, key string, min, max float64) error {
+	return rc.client.ZRemRangeByScore(ctx, rc.prefixKey(key),
+		strconv.FormatFloat(min, 'f', -1, 64), strconv.FormatFloat(max, 'f', -1, 64)).Err()
+}
+
+// SortedSetCard returns the number of members in the sorted set at key
+func (rc *RedisCache) SortedSetCard(ctx context.Context, key string) (int64, error) {
+	return rc.client.ZCard(ctx, rc.prefixKey(key)).Result()
+}
+
 // FlushAll removes all keys from cache
 func (rc *RedisCache) FlushAll(ctx context.Context) error {
 	return rc.client.FlushDB(ctx).Err()
@@ -147,25 +303,45 @@ const (
 	RefreshAhead CacheStrategy = "refresh_ahead"
 )
 
+// DefaultRefreshThreshold is how close to expiry a RefreshAhead hit has to
+// be to trigger a background reload
+const DefaultRefreshThreshold = 30 * time.Second
+
 // CacheManager manages caching with different strategies
 type CacheManager struct {
-	cache    Cache
-	strategy CacheStrategy
+	cache            Cache
+	strategy         CacheStrategy
+	refreshThreshold time.Duration
+
+	mu         sync.Mutex
+	refreshing map[string]bool
+	refreshes  sync.WaitGroup
 }
 
 // NewCacheManager creates a new cache manager
 func NewCacheManager(cache Cache, strategy CacheStrategy) *CacheManager {
 	return &CacheManager{
-		cache:    cache,
-		strategy: strategy,
+		cache:            cache,
+		strategy:         strategy,
+		refreshThreshold: DefaultRefreshThreshold,
+		refreshing:       make(map[string]bool),
 	}
 }
 
-// GetOrSet implements cache-aside pattern
+// SetRefreshThreshold sets how close to expiry a RefreshAhead hit has to be
+// to trigger a background reload
+func (cm *CacheManager) SetRefreshThreshold(threshold time.Duration) {
+	cm.refreshThreshold = threshold
+}
+
+// GetOrSet implements cache-aside pattern. With the RefreshAhead strategy,
+// hits close to expiry also reload the value in the background so it
+// doesn't expire under load.
 func (cm *CacheManager) GetOrSet(ctx context.Context, key string, dest interface{}, ttl time.Duration, loader func() (interface{}, error)) error {
 	// Try to get from cache
 	err := cm.cache.Get(ctx, key, dest)
 	if err == nil {
+		cm.refreshAhead(ctx, key, ttl, loader)
 		return nil // Cache hit
 	}
 
@@ -190,6 +366,107 @@ func (cm *CacheManager) GetOrSet(ctx context.Context, key string, dest interface
 	return json.Unmarshal(data, dest)
 }
 
+// GetOrSetTyped implements the cache-aside pattern for a typed value. On a
+// miss the loaded value is returned as is and only marshaled once for
+// storage, unlike GetOrSet which copies it into dest through JSON.
+func GetOrSetTyped[T any](ctx context.Context, cm *CacheManager, key string, ttl time.Duration, loader func() (T, error)) (T, error) {
+	var value T
+
+	// Try to get from cache
+	err := cm.cache.Get(ctx, key, &value)
+	if err == nil {
+		if cm.strategy == RefreshAhead {
+			cm.refreshAhead(ctx, key, ttl, func() (interface{}, error) { return loader() })
+		}
+		return value, nil // Cache hit
+	}
+
+	if err != ErrCacheMiss {
+		return value, err // Actual error
+	}
+
+	// Cache miss - load from source
+	value, err = loader()
+	if err != nil {
+		return value, err
+	}
+
+	// Store in cache
+	if err := cm.cache.Set(ctx, key, value, ttl); err != nil {
+		// Log error but don't fail the request
+		fmt.Printf("Failed to set cache: %v\n", err)
+	}
+
+	return value, nil
+}
+
+// refreshAhead reloads key in the background if the strategy is
+// RefreshAhead and the cached value expires within the refresh threshold.
+// Only one reload per key runs at a time.
+func (cm *CacheManager) refreshAhead(ctx context.Context, key string, ttl time.Duration, loader func() (interface{}, error)) {
+	if cm.strategy != RefreshAhead {
+		return
+	}
+
+	remaining, err := cm.cache.TTL(ctx, key)
+	if err != nil || remaining <= 0 || remaining > cm.refreshThreshold {
+		return
+	}
+
+	cm.mu.Lock()
+	if cm.refreshing[key] {
+		cm.mu.Unlock()
+		return
+	}
+	cm.refreshing[key] = true
+	cm.mu.Unlock()
+
+	// The reload outlives the request that triggered it
+	ctx = context.WithoutCancel(ctx)
+
+	cm.refreshes.Add(1)
+	go func() {
+		defer cm.refreshes.Done()
+		defer func() {
+			cm.mu.Lock()
+			delete(cm.refreshing, key)
+			cm.mu.Unlock()
+		}()
+
+		value, err := loader()
+		if err != nil {
+			fmt.Printf("Failed to refresh cache for %s: %v\n", key, err)
+			return
+		}
+
+		if err := cm.cache.Set(ctx, key, value, ttl); err != nil {
+			fmt.Printf("Failed to refresh cache for %s: %v\n", key, err)
+		}
+	}()
+}
+
+// Write saves value to the backing store using persister and keeps the
+// cache consistent with it. With the WriteThrough strategy the new value is
+// cached right away; otherwise the cached copy is invalidated and reloaded
+// on the next read. Nothing is cached if persister fails.
+func (cm *CacheManager) Write(ctx context.Context, key string, value interface{}, ttl time.Duration, persister func() error) error {
+	if err := persister(); err != nil {
+		return err
+	}
+
+	if cm.strategy != WriteThrough {
+		return cm.cache.Delete(ctx, key)
+	}
+
+	if err := cm.cache.Set(ctx, key, value, ttl); err != nil {
+		// Don't leave the old value behind now that the store has changed
+		cm.cache.Delete(ctx, key)
+		return fmt.Errorf("failed to cache %s: %w", key, err)
+	}
+
+	return nil
+}
+
 // CacheKeyBuilder helps build consistent cache keys
 type CacheKeyBuilder struct {
 	namespace string
@@ -255,6 +532,11 @@ func NewCacheTags(cache Cache) *CacheTags {
 	return &CacheTags{cache: cache}
 }
 
+// tagKey returns the key of the set tracking keys with the given tag
+func tagKey(tag string) string {
+	return fmt.Sprintf("tag:%s", tag)
+}
+
 // Set stores a value with tags
 func (ct *CacheTags) Set(ctx context.Context, key string, value interface{}, ttl time.Duration, tags ...string) error {
 	// Store the main value
@@ -262,34 +544,40 @@ func (ct *CacheTags) Set(ctx context.Context, key string, value interface{}, ttl
 		return err
 	}
 
-	// Store tag associations
+	// Track the key in each tag's set
 	for _, tag := range tags {
-		tagKey := fmt.Sprintf("tag:%s", tag)
-		// Add key to tag set (simplified - in production use Redis SADD)
-		// This is a simplified version
-		ct.cache.Set(ctx, fmt.Sprintf("%s:%s", tagKey, key), true, ttl)
+		if err := ct.cache.SetAdd(ctx, tagKey(tag), key); err != nil {
+			return fmt.Errorf("failed to tag %s with %s: %w", key, tag, err)
+		}
 	}
 
 	return nil
 }
 
-// InvalidateByTag removes all cache entries with a specific tag
+// InvalidateByTag removes all cache entries with a specific tag, then the
+// tag itself
 func (ct *CacheTags) InvalidateByTag(ctx context.Context, tag string) error {
-	// In production, use Redis SMEMBERS to get all keys with this tag
-	// Then delete them all
-	// This is a simplified placeholder
-	tagKey := fmt.Sprintf("tag:%s", tag)
-	return ct.cache.Delete(ctx, tagKey)
+	keys, err := ct.cache.SetMembers(ctx, tagKey(tag))
+	if err != nil {
+		return err
+	}
+
+	if err := ct.cache.Delete(ctx, keys...); err != nil {
+		return err
+	}
+
+	return ct.cache.Delete(ctx, tagKey(tag))
 }
 
 // RateLimiter implements rate limiting using cache
 type RateLimiter struct {
 	cache Cache
+	now   func() time.Time
 }
 
 // NewRateLimiter creates a new rate limiter
 func NewRateLimiter(cache Cache) *RateLimiter {
-	return &RateLimiter{cache: cache}
+	return &RateLimiter{cache: cache, now: time.Now}
 }
 
 // Allow checks if request is allowed based on rate limit
@@ -309,6 +597,52 @@ func (rl *RateLimiter) Allow(ctx context.Context, key string, limit int64, windo
 	return current <= limit, nil
 }
 
+// AllowSlidingWindow checks if a request is allowed when at most limit
+// requests may happen in any window-long period. Unlike Allow, bursts
+// straddling a window boundary are not let through. It also returns how
+// many requests remain in the current window.
+func (rl *RateLimiter) AllowSlidingWindow(ctx context.Context, key string, limit int64, window time.Duration) (bool, int64, error) {
+	// Requests are stored in a sorted set scored by their time in
+	// microseconds, which float64 scores represent exactly
+	now := rl.now()
+	score := float64(now.UnixMicro())
+	member := fmt.Sprintf("%d-%d", now.UnixNano(), atomic.AddUint64(&slidingWindowSeq, 1))
+
+	// Forget requests that have left the window
+	cutoff := float64(now.Add(-window).UnixMicro())
+	if err := rl.cache.SortedSetRemoveRangeByScore(ctx, key, math.Inf(-1), cutoff); err != nil {
+		return false, 0, err
+	}
+
+	// Record the request before counting so concurrent callers can't all
+	// slip in under the limit
+	if err := rl.cache.SortedSetAdd(ctx, key, score, member); err != nil {
+		return false, 0, err
+	}
+
+	count, err := rl.cache.SortedSetCard(ctx, key)
+	if err != nil {
+		return false, 0, err
+	}
+
+	if err := rl.cache.Expire(ctx, key, window); err != nil {
+		return false, 0, err
+	}
+
+	if count > limit {
+		// Rejected requests don't count against the window
+		if err := rl.cache.SortedSetRemove(ctx, key, member); err != nil {
+			return false, 0, err
+		}
+		return false, 0, nil
+	}
+
+	return true, limit - count, nil
+}
+
+// slidingWindowSeq keeps sliding window members unique within a process
+var slidingWindowSeq uint64
+
 // CacheStats provides cache statistics
 type CacheStats struct {
 	Hits        int64
@@ -322,16 +656,49 @@ type CacheStats struct {
 
 // GetStats returns cache statistics (Redis specific)
 func (rc *RedisCache) GetStats(ctx context.Context) (*CacheStats, error) {
-	info, err := rc.client.Info(ctx, "stats").Result()
+	// The default sections include both "stats" and "memory"
+	info, err := rc.client.Info(ctx).Result()
 	if err != nil {
 		return nil, err
 	}
 
-	// Parse Redis INFO output
-	// This is simplified - in production, parse the actual INFO output
+	stats := parseInfoStats(info)
+
+	// Get key count
+	dbSize, err := rc.client.DBSize(ctx).Result()
+	if err == nil {
+		stats.KeyCount = dbSize
+	}
+
+	return stats, nil
+}
+
+// parseInfoStats extracts cache statistics from Redis INFO output. Missing
+// or malformed fields are left at zero.
+func parseInfoStats(info string) *CacheStats {
+	fields := make(map[string]string)
+	for _, line := range strings.Split(info, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		name, value, ok := strings.Cut(line, ":")
+		if ok {
+			fields[name] = value
+		}
+	}
+
+	field := func(name string) int64 {
+		n, _ := strconv.ParseInt(fields[name], 10, 64)
+		return n
+	}
+
 	stats := &CacheStats{
-		Hits:   0,
-		Misses: 0,
+		Hits:        field("keyspace_hits"),
+		Misses:      field("keyspace_misses"),
+		Evictions:   field("evicted_keys"),
+		MemoryUsage: field("used_memory"),
 	}
 
 	// Calculate hit rate
@@ -340,15 +707,7 @@ func (rc *RedisCache) GetStats(ctx context.Context) (*CacheStats, error) {
 		stats.HitRate = float64(stats.Hits) / float64(total)
 	}
 
-	// Get key count
-	dbSize, err := rc.client.DBSize(ctx).Result()
-	if err == nil {
-		stats.KeyCount = dbSize
-	}
-
-	fmt.Println(info) // For debugging
-
-	return stats, nil
+	return stats
 }
 
 // WarmUp preloads cache with frequently accessed data
@@ -0,0 +1,528 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// newTestRedisCache returns a RedisCache backed by an in-process Redis stub
+func newTestRedisCache(t *testing.T) (*RedisCache, *miniredis.Miniredis) {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+	cache, err := NewRedisCache(server.Addr(), "", 0, "test")
+	if err != nil {
+		t.Fatalf("NewRedisCache() error = %v", err)
+	}
+	t.Cleanup(func() { cache.Close() })
+
+	return cache, server
+}
+
+func TestCacheTags_InvalidateByTag(t *testing.T) {
+	cache, server := newTestRedisCache(t)
+	tags := NewCacheTags(cache)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		key := fmt.Sprintf("product:%d", i)
+		if err := tags.Set(ctx, key, i, time.Hour, "products", "catalog"); err != nil {
+			t.Fatalf("Set(%s) error = %v", key, err)
+		}
+	}
+	if err := tags.Set(ctx, "user:1", "ada", time.Hour, "users"); err != nil {
+		t.Fatalf("Set(user:1) error = %v", err)
+	}
+
+	if err := tags.InvalidateByTag(ctx, "products"); err != nil {
+		t.Fatalf("InvalidateByTag() error = %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		key := fmt.Sprintf("test:product:%d", i)
+		if server.Exists(key) {
+			t.Errorf("%s still cached after invalidation", key)
+		}
+	}
+	if server.Exists("test:tag:products") {
+		t.Error("tag set still exists after invalidation")
+	}
+	if !server.Exists("test:user:1") {
+		t.Error("key with a different tag was invalidated")
+	}
+}
+
+func TestRedisCache_DeleteBatches(t *testing.T) {
+	cache, server := newTestRedisCache(t)
+	ctx := context.Background()
+
+	keys := make([]string, deleteBatchSize*2+10)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("k%d", i)
+		server.Set("test:"+keys[i], "v")
+	}
+
+	if err := cache.Delete(ctx, keys...); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if n := len(server.Keys()); n != 0 {
+		t.Errorf("%d keys left after Delete", n)
+	}
+}
+
+// memoryCache is a Cache that keeps JSON-encoded values in a map, like
+// RedisCache does in Redis
+type memoryCache struct {
+	data    map[string][]byte
+	expires map[string]time.Time
+	now     func() time.Time
+}
+
+func newMemoryCache() *memoryCache {
+	return &memoryCache{
+		data:    make(map[string][]byte),
+		expires: make(map[string]time.Time),
+		now:     time.Now,
+	}
+}
+
+func (m *memoryCache) expired(key string) bool {
+	expiresAt, ok := m.expires[key]
+	return ok && !m.now().Before(expiresAt)
+}
+
+func (m *memoryCache) Get(ctx context.Context, key string, dest interface{}) error {
+	data, ok := m.data[key]
+	if !ok || m.expired(key) {
+		return ErrCacheMiss
+	}
+	return json.Unmarshal(data, dest)
+}
+
+func (m *memoryCache) Set(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	m.data[key] = data
+	delete(m.expires, key)
+	if ttl > 0 {
+		m.expires[key] = m.now().Add(ttl)
+	}
+	return nil
+}
+
+func (m *memoryCache) TTL(ctx context.Context, key string) (time.Duration, error) {
+	if _, ok := m.data[key]; !ok || m.expired(key) {
+		return 0, ErrCacheMiss
+	}
+	if expiresAt, ok := m.expires[key]; ok {
+		return expiresAt.Sub(m.now()), nil
+	}
+	return 0, nil
+}
+
+func (m *memoryCache) GetMany(ctx context.Context, keys []string, dest map[string]json.RawMessage) error {
+	for _, key := range keys {
+		if data, ok := m.data[key]; ok {
+			dest[key] = data
+		}
+	}
+	return nil
+}
+
+func (m *memoryCache) SetMany(ctx context.Context, items map[string]interface{}, ttl time.Duration) error {
+	for key, value := range items {
+		if err := m.Set(ctx, key, value, ttl); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *memoryCache) Delete(ctx context.Context, keys ...string) error {
+	for _, key := range keys {
+		delete(m.data, key)
+	}
+	return nil
+}
+
+func (m *memoryCache) Exists(ctx context.Context, key string) (bool, error) {
+	_, ok := m.data[key]
+	return ok, nil
+}
+
+func (m *memoryCache) Increment(ctx context.Context, key string) (int64, error) {
+	return 0, errors.New("not implemented")
+}
+
+func (m *memoryCache) Decrement(ctx context.Context, key string) (int64, error) {
+	return 0, errors.New("not implemented")
+}
+
+func (m *memoryCache) Expire(ctx context.Context, key string, ttl time.Duration) error {
+	return nil
+}
+
+func (m *memoryCache) FlushAll(ctx context.Context) error {
+	m.data = make(map[string][]byte)
+	m.expires = make(map[string]time.Time)
+	return nil
+}
+
+func (m *memoryCache) SetAdd(ctx context.Context, key string, members ...string) error {
+	return errors.New("not implemented")
+}
+
+func (m *memoryCache) SetMembers(ctx context.Context, key string) ([]string, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (m *memoryCache) SortedSetAdd(ctx context.Context, key string, score float64, member string) error {
+	return errors.New("not implemented")
+}
+
+func (m *memoryCache) SortedSetRemove(ctx context.Context, key string, members ...string) error {
+	return errors.New("not implemented")
+}
+
+func (m *memoryCache) SortedSetRemoveRangeByScore(ctx context.Context, key string, min, max float64) error {
+	return errors.New("not implemented")
+}
+
+func (m *memoryCache) SortedSetCard(ctx context.Context, key string) (int64, error) {
+	return 0, errors.New("not implemented")
+}
+
+type cachedReport struct {
+	ID     int                `json:"id"`
+	Title  string             `json:"title"`
+	Totals map[string]float64 `json:"totals"`
+	Rows   []string           `json:"rows"`
+}
+
+func loadReport() (cachedReport, error) {
+	return cachedReport{
+		ID:     42,
+		Title:  "Monthly revenue",
+		Totals: map[string]float64{"revenue": 1250.5, "costs": 830.25},
+		Rows:   []string{"january", "february", "march", "april"},
+	}, nil
+}
+
+func TestGetOrSetTyped(t *testing.T) {
+	cm := NewCacheManager(newMemoryCache(), CacheAside)
+	ctx := context.Background()
+
+	loads := 0
+	loader := func() (cachedReport, error) {
+		loads++
+		return loadReport()
+	}
+
+	first, err := GetOrSetTyped(ctx, cm, "report", time.Minute, loader)
+	if err != nil {
+		t.Fatalf("GetOrSetTyped() miss error = %v", err)
+	}
+	second, err := GetOrSetTyped(ctx, cm, "report", time.Minute, loader)
+	if err != nil {
+		t.Fatalf("GetOrSetTyped() hit error = %v", err)
+	}
+
+	if loads != 1 {
+		t.Errorf("loader called %d times, want 1", loads)
+	}
+	if !reflect.DeepEqual(first, second) {
+		t.Errorf("cached value = %+v, want %+v", second, first)
+	}
+}
+
+func TestCacheManager_RefreshAhead(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	store := newMemoryCache()
+	store.now = func() time.Time { return now }
+
+	cm := NewCacheManager(store, RefreshAhead)
+	cm.SetRefreshThreshold(10 * time.Second)
+	ctx := context.Background()
+
+	loads := 0
+	loader := func() (interface{}, error) {
+		loads++
+		return loads, nil
+	}
+	get := func() int {
+		t.Helper()
+		var got int
+		if err := cm.GetOrSet(ctx, "counter", &got, time.Minute, loader); err != nil {
+			t.Fatalf("GetOrSet() error = %v", err)
+		}
+		cm.refreshes.Wait()
+		return got
+	}
+
+	if got := get(); got != 1 || loads != 1 {
+		t.Fatalf("first read = %d with %d loads, want 1 with 1", got, loads)
+	}
+
+	// Far from expiry: plain hit
+	now = now.Add(30 * time.Second)
+	if got := get(); got != 1 || loads != 1 {
+		t.Fatalf("early hit = %d with %d loads, want 1 with 1", got, loads)
+	}
+
+	// Within the threshold: the stale value is served and reloaded behind it
+	now = now.Add(25 * time.Second)
+	if got := get(); got != 1 || loads != 2 {
+		t.Fatalf("hit near expiry = %d with %d loads, want 1 with 2", got, loads)
+	}
+
+	// The original expiry has passed but the refreshed value is still hot
+	now = now.Add(10 * time.Second)
+	if got := get(); got != 2 || loads != 2 {
+		t.Errorf("read after refresh = %d with %d loads, want 2 with 2", got, loads)
+	}
+}
+
+func TestCacheManager_CacheAsideDoesNotRefresh(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	store := newMemoryCache()
+	store.now = func() time.Time { return now }
+
+	cm := NewCacheManager(store, CacheAside)
+	cm.SetRefreshThreshold(10 * time.Second)
+	ctx := context.Background()
+
+	loads := 0
+	loader := func() (interface{}, error) {
+		loads++
+		return loads, nil
+	}
+
+	var got int
+	cm.GetOrSet(ctx, "counter", &got, time.Minute, loader)
+	now = now.Add(55 * time.Second)
+	cm.GetOrSet(ctx, "counter", &got, time.Minute, loader)
+	cm.refreshes.Wait()
+
+	if loads != 1 {
+		t.Errorf("loader called %d times, want 1", loads)
+	}
+}
+
+func TestCacheManager_WriteThrough(t *testing.T) {
+	store := newMemoryCache()
+	cm := NewCacheManager(store, WriteThrough)
+	ctx := context.Background()
+
+	loads := 0
+	loader := func() (interface{}, error) {
+		loads++
+		return "from store", nil
+	}
+
+	persisted := ""
+	err := cm.Write(ctx, "profile", "updated", time.Minute, func() error {
+		persisted = "updated"
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if persisted != "updated" {
+		t.Errorf("persisted = %q, want %q", persisted, "updated")
+	}
+
+	var got string
+	if err := cm.GetOrSet(ctx, "profile", &got, time.Minute, loader); err != nil {
+		t.Fatalf("GetOrSet() error = %v", err)
+	}
+	if got != "updated" || loads != 0 {
+		t.Errorf("read after write = %q with %d loads, want %q with 0", got, loads, "updated")
+	}
+
+	// A failed write leaves the cache alone
+	errStore := errors.New("store unavailable")
+	err = cm.Write(ctx, "profile", "lost", time.Minute, func() error { return errStore })
+	if !errors.Is(err, errStore) {
+		t.Fatalf("Write() error = %v, want %v", err, errStore)
+	}
+	if err := cm.GetOrSet(ctx, "profile", &got, time.Minute, loader); err != nil {
+		t.Fatalf("GetOrSet() error = %v", err)
+	}
+	if got != "updated" {
+		t.Errorf("read after failed write = %q, want %q", got, "updated")
+	}
+}
+
+func BenchmarkGetOrSet_Miss(b *testing.B) {
+	cm := NewCacheManager(newMemoryCache(), CacheAside)
+	ctx := context.Background()
+	loader := func() (interface{}, error) { return loadReport() }
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		cm.cache.FlushAll(ctx)
+
+		var report cachedReport
+		if err := cm.GetOrSet(ctx, "report", &report, time.Minute, loader); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkGetOrSetTyped_Miss(b *testing.B) {
+	cm := NewCacheManager(newMemoryCache(), CacheAside)
+	ctx := context.Background()
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		cm.cache.FlushAll(ctx)
+
+		if _, err := GetOrSetTyped(ctx, cm, "report", time.Minute, loadReport); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestRateLimiter_BoundaryBurst(t *testing.T) {
+	const limit = 5
+	window := time.Second
+	ctx := context.Background()
+
+	// Fixed window: a burst at the end of one window and another at the
+	// start of the next are both allowed
+	cache, server := newTestRedisCache(t)
+	fixed := NewRateLimiter(cache)
+
+	allowed := 0
+	for i := 0; i < limit; i++ {
+		if ok, _ := fixed.Allow(ctx, "fixed", limit, window); ok {
+			allowed++
+		}
+	}
+	server.FastForward(window) // next window starts a moment later
+	for i := 0; i < limit; i++ {
+		if ok, _ := fixed.Allow(ctx, "fixed", limit, window); ok {
+			allowed++
+		}
+	}
+	if allowed != 2*limit {
+		t.Fatalf("fixed window allowed %d requests, expected the %d-request boundary burst", allowed, 2*limit)
+	}
+
+	// Sliding window: the second burst falls inside the same window
+	now := time.Date(2024, 1, 1, 12, 0, 0, 900_000_000, time.UTC)
+	sliding := NewRateLimiter(cache)
+	sliding.now = func() time.Time { return now }
+
+	for i := 0; i < limit; i++ {
+		ok, remaining, err := sliding.AllowSlidingWindow(ctx, "sliding", limit, window)
+		if err != nil {
+			t.Fatalf("AllowSlidingWindow() error = %v", err)
+		}
+		if !ok {
+			t.Fatalf("request %d rejected within the limit", i+1)
+		}
+		if want := int64(limit - i - 1); remaining != want {
+			t.Errorf("remaining = %d, want %d", remaining, want)
+		}
+	}
+
+	now = now.Add(200 * time.Millisecond)
+	for i := 0; i < limit; i++ {
+		ok, remaining, err := sliding.AllowSlidingWindow(ctx, "sliding", limit, window)
+		if err != nil {
+			t.Fatalf("AllowSlidingWindow() error = %v", err)
+		}
+		if ok || remaining != 0 {
+			t.Fatalf("boundary burst request %d allowed (remaining %d)", i+1, remaining)
+		}
+	}
+
+	// Once the first burst leaves the window, requests are allowed again
+	now = now.Add(window)
+	if ok, _, err := sliding.AllowSlidingWindow(ctx, "sliding", limit, window); err != nil || !ok {
+		t.Errorf("AllowSlidingWindow() after window = %v, %v; want allowed", ok, err)
+	}
+}
+
+func TestParseInfoStats(t *testing.T) {
+	info := "# Server\r\nredis_version:7.2.4\r\n\r\n" +
+		"# Memory\r\nused_memory:1048576\r\nused_memory_human:1.00M\r\n\r\n" +
+		"# Stats\r\ntotal_connections_received:12\r\nevicted_keys:7\r\n" +
+		"keyspace_hits:300\r\nkeyspace_misses:100\r\n"
+
+	stats := parseInfoStats(info)
+
+	if stats.Hits != 300 || stats.Misses != 100 {
+		t.Errorf("hits/misses = %d/%d, want 300/100", stats.Hits, stats.Misses)
+	}
+	if stats.Evictions != 7 {
+		t.Errorf("Evictions = %d, want 7", stats.Evictions)
+	}
+	if stats.MemoryUsage != 1048576 {
+		t.Errorf("MemoryUsage = %d, want 1048576", stats.MemoryUsage)
+	}
+	if stats.HitRate != 0.75 {
+		t.Errorf("HitRate = %v, want 0.75", stats.HitRate)
+	}
+
+	// Missing and malformed fields are treated as zero
+	stats = parseInfoStats("# Stats\r\nkeyspace_hits:abc\r\n")
+	if stats.Hits != 0 || stats.Misses != 0 || stats.HitRate != 0 || stats.MemoryUsage != 0 {
+		t.Errorf("stats from incomplete INFO = %+v, want zeros", stats)
+	}
+}
+
+func TestRedisCache_GetManySetMany(t *testing.T) {
+	cache, server := newTestRedisCache(t)
+	ctx := context.Background()
+
+	type widget struct {
+		Title string `json:"title"`
+		Value int    `json:"value"`
+	}
+
+	items := map[string]interface{}{
+		"widget:1": widget{Title: "Revenue", Value: 1200},
+		"widget:2": widget{Title: "Orders", Value: 34},
+	}
+	if err := cache.SetMany(ctx, items, time.Minute); err != nil {
+		t.Fatalf("SetMany() error = %v", err)
+	}
+	if ttl := server.TTL("test:widget:1"); ttl != time.Minute {
+		t.Errorf("TTL = %v, want %v", ttl, time.Minute)
+	}
+
+	if err := cache.SetMany(ctx, map[string]interface{}{"widget:3": widget{Title: "Users", Value: 9}}, 0); err != nil {
+		t.Fatalf("SetMany() without TTL error = %v", err)
+	}
+
+	dest := make(map[string]json.RawMessage)
+	if err := cache.GetMany(ctx, []string{"widget:1", "widget:missing", "widget:2", "widget:3"}, dest); err != nil {
+		t.Fatalf("GetMany() error = %v", err)
+	}
+
+	if len(dest) != 3 {
+		t.Fatalf("GetMany() returned %d entries, want 3", len(dest))
+	}
+	if _, ok := dest["widget:missing"]; ok {
+		t.Error("missing key present in result")
+	}
+
+	var got widget
+	if err := json.Unmarshal(dest["widget:2"], &got); err != nil {
+		t.Fatalf("decode widget:2: %v", err)
+	}
+	if got != (widget{Title: "Orders", Value: 34}) {
+		t.Errorf("widget:2 = %+v", got)
+	}
+}
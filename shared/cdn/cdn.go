@@ -1,10 +1,17 @@
 package cdn
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
 	"net/url"
+	"os"
 	"path"
 	"strings"
+	"time"
 )
 
 // CDNProvider represents different CDN providers
@@ -18,11 +25,23 @@ const (
 	BunnyCDN   CDNProvider = "bunnycdn"
 )
 
+const (
+	// CloudFlareAPIURL is the base URL of the CloudFlare v4 API
+	CloudFlareAPIURL = "https://api.cloudflare.com/client/v4"
+
+	// cloudFlarePurgeBatchSize is the most URLs CloudFlare accepts per
+	// purge request
+	cloudFlarePurgeBatchSize = 30
+)
+
+// ErrPurgeNotConfigured is returned when purging without API credentials
+var ErrPurgeNotConfigured = errors.New("cdn purge requires an API key and zone")
+
 // CDNConfig holds CDN configuration
 type CDNConfig struct {
 	Provider    CDNProvider
 	BaseURL     string
-	PullZone    string
+	PullZone    string // Pull zone, or zone ID for CloudFlare
 	APIKey      string
 	Enabled     bool
 	StaticPaths []string // Paths to serve via CDN
@@ -30,12 +49,24 @@ type CDNConfig struct {
 
 // CDN provides CDN URL generation and management
 type CDN struct {
-	config *CDNConfig
+	config        *CDNConfig
+	httpClient    *http.Client
+	cloudFlareAPI string
 }
 
 // NewCDN creates a new CDN instance
 func NewCDN(config *CDNConfig) *CDN {
-	return &CDN{config: config}
+	return NewCDNWithClient(config, &http.Client{Timeout: 30 * time.Second})
+}
+
+// NewCDNWithClient creates a CDN instance that calls provider APIs with
+// the given HTTP client
+func NewCDNWithClient(config *CDNConfig, client *http.Client) *CDN {
+	return &CDN{
+		config:        config,
+		httpClient:    client,
+		cloudFlareAPI: CloudFlareAPIURL,
+	}
 }
 
 // URL generates a CDN URL for a given path
@@ -187,11 +218,54 @@ func (c *CDN) PurgeCache(urls []string) error {
 	}
 }
 
-// purgeCloudFlare purges CloudFlare cache
+// purgeCloudFlare purges CloudFlare cache, in batches of at most 30 URLs
 func (c *CDN) purgeCloudFlare(urls []string) error {
-	// Implementation would use CloudFlare API
-	// https://api.cloudflare.com/client/v4/zones/{zone_id}/purge_cache
-	fmt.Printf("Purging CloudFlare cache for %d URLs\n", len(urls))
+	if c.config.APIKey == "" || c.config.PullZone == "" {
+		return ErrPurgeNotConfigured
+	}
+
+	for start := 0; start < len(urls); start += cloudFlarePurgeBatchSize {
+		end := start + cloudFlarePurgeBatchSize
+		if end > len(urls) {
+			end = len(urls)
+		}
+
+		if err := c.purgeCloudFlareBatch(urls[start:end]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// purgeCloudFlareBatch sends a single purge_cache request
+func (c *CDN) purgeCloudFlareBatch(urls []string) error {
+	body, err := json.Marshal(map[string][]string{"files": urls})
+	if err != nil {
+		return fmt.Errorf("failed to encode purge request: %w", err)
+	}
+
+	endpoint := fmt.Sprintf("%s/zones/%s/purge_cache",
+		strings.TrimSuffix(c.cloudFlareAPI, "/"), url.PathEscape(c.config.PullZone))
+
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create purge request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.config.APIKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("cloudflare purge failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("cloudflare purge failed with status %d: %s", resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+
 	return nil
 }
 
@@ -244,21 +318,46 @@ type AssetVersioning struct {
 	manifest map[string]string
 }
 
-// NewAssetVersioning creates a new asset versioning instance
-func NewAssetVersioning(manifestPath string) *AssetVersioning {
-	// In production, load manifest from file
-	// manifest.json maps original filenames to versioned ones
-	manifest := map[string]string{
-		"app.js":     "app.abc123.js",
-		"app.css":    "app.def456.css",
-		"logo.png":   "logo.ghi789.png",
+// NewAssetVersioning loads a bundler manifest, a JSON object mapping
+// original asset paths to versioned ones such as
+// {"app.js": "app.abc123.js"}
+func NewAssetVersioning(manifestPath string) (*AssetVersioning, error) {
+	data, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read asset manifest: %w", err)
 	}
 
-	return &AssetVersioning{manifest: manifest}
+	manifest := make(map[string]string)
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse asset manifest %s: %w", manifestPath, err)
+	}
+
+	return &AssetVersioning{manifest: manifest}, nil
 }
 
-// Get returns the versioned asset path
+// NewAssetVersioningOrEmpty loads a bundler manifest like
+// NewAssetVersioning, but falls back to an empty manifest if it can't be
+// loaded, so assets are served unversioned
+func NewAssetVersioningOrEmpty(manifestPath string) *AssetVersioning {
+	av, err := NewAssetVersioning(manifestPath)
+	if err != nil {
+		fmt.Printf("Using empty asset manifest: %v\n", err)
+		return &AssetVersioning{manifest: make(map[string]string)}
+	}
+
+	return av
+}
+
+// Get returns the versioned asset path. Manifest entries keyed by the full
+// path take precedence over ones keyed by file name.
 func (av *AssetVersioning) Get(assetPath string) string {
+	if versioned, ok := av.manifest[strings.TrimPrefix(assetPath, "/")]; ok {
+		if strings.HasPrefix(assetPath, "/") {
+			return "/" + strings.TrimPrefix(versioned, "/")
+		}
+		return versioned
+	}
+
 	if versioned, ok := av.manifest[path.Base(assetPath)]; ok {
 		dir := path.Dir(assetPath)
 		if dir == "." {
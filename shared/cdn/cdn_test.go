@@ -0,0 +1,149 @@
+package cdn
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPurgeCache_CloudFlare(t *testing.T) {
+	var batches [][]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/zones/zone-123/purge_cache" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer secret-token" {
+			t.Errorf("Authorization = %q, want %q", got, "Bearer secret-token")
+		}
+
+		var body struct {
+			Files []string `json:"files"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decode request body: %v", err)
+		}
+		batches = append(batches, body.Files)
+
+		w.Write([]byte(`{"success":true,"errors":[],"messages":[],"result":{"id":"zone-123"}}`))
+	}))
+	defer server.Close()
+
+	c := NewCDNWithClient(&CDNConfig{
+		Provider: CloudFlare,
+		PullZone: "zone-123",
+		APIKey:   "secret-token",
+	}, server.Client())
+	c.cloudFlareAPI = server.URL
+
+	urls := make([]string, 45)
+	for i := range urls {
+		urls[i] = fmt.Sprintf("https://cdn.example.com/assets/%d.js", i)
+	}
+
+	if err := c.PurgeCache(urls); err != nil {
+		t.Fatalf("PurgeCache() error = %v", err)
+	}
+
+	if len(batches) != 2 || len(batches[0]) != 30 || len(batches[1]) != 15 {
+		t.Fatalf("batch sizes = %v, want [30 15]", batchSizes(batches))
+	}
+	if batches[0][0] != urls[0] || batches[1][14] != urls[44] {
+		t.Errorf("request bodies don't carry the URL list: %v", batches)
+	}
+}
+
+func TestPurgeCache_CloudFlareError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"success":false,"errors":[{"code":10000,"message":"Authentication error"}]}`))
+	}))
+	defer server.Close()
+
+	c := NewCDNWithClient(&CDNConfig{
+		Provider: CloudFlare,
+		PullZone: "zone-123",
+		APIKey:   "wrong-token",
+	}, server.Client())
+	c.cloudFlareAPI = server.URL
+
+	if err := c.PurgeCache([]string{"https://cdn.example.com/app.js"}); err == nil {
+		t.Fatal("PurgeCache() error = nil, want error for non-200 response")
+	}
+}
+
+func batchSizes(batches [][]string) []int {
+	sizes := make([]int, len(batches))
+	for i, batch := range batches {
+		sizes[i] = len(batch)
+	}
+	return sizes
+}
+
+func writeManifest(t *testing.T, dir, contents string) string {
+	t.Helper()
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatalf("create manifest dir: %v", err)
+	}
+	manifestPath := filepath.Join(dir, "manifest.json")
+	if err := os.WriteFile(manifestPath, []byte(contents), 0o644); err != nil {
+		t.Fatalf("write manifest: %v", err)
+	}
+	return manifestPath
+}
+
+func TestNewAssetVersioning(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "public", "build")
+	manifestPath := writeManifest(t, dir, `{
+		"app.js": "app.abc123.js",
+		"app.css": "app.def456.css",
+		"static/js/vendor.js": "static/js/vendor.789aaa.js"
+	}`)
+
+	av, err := NewAssetVersioning(manifestPath)
+	if err != nil {
+		t.Fatalf("NewAssetVersioning() error = %v", err)
+	}
+
+	tests := []struct {
+		asset string
+		want  string
+	}{
+		{"app.js", "app.abc123.js"},
+		{"/static/app.js", "/static/app.abc123.js"},
+		{"css/app.css", "css/app.def456.css"},
+		{"static/js/vendor.js", "static/js/vendor.789aaa.js"},
+		{"/static/js/vendor.js", "/static/js/vendor.789aaa.js"},
+		{"/static/unknown.js", "/static/unknown.js"},
+	}
+	for _, tt := range tests {
+		if got := av.Get(tt.asset); got != tt.want {
+			t.Errorf("Get(%q) = %q, want %q", tt.asset, got, tt.want)
+		}
+	}
+}
+
+func TestNewAssetVersioning_LoadErrors(t *testing.T) {
+	dir := t.TempDir()
+
+	missing := filepath.Join(dir, "missing", "manifest.json")
+	if _, err := NewAssetVersioning(missing); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("NewAssetVersioning(missing) error = %v, want fs.ErrNotExist", err)
+	}
+
+	malformed := writeManifest(t, dir, `{"app.js": `)
+	if _, err := NewAssetVersioning(malformed); err == nil {
+		t.Error("NewAssetVersioning(malformed) error = nil, want error")
+	}
+
+	av := NewAssetVersioningOrEmpty(missing)
+	if got := av.Get("/static/app.js"); got != "/static/app.js" {
+		t.Errorf("fallback Get() = %q, want unversioned path", got)
+	}
+}
@@ -0,0 +1,271 @@
+package cdn
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+// Content encodings supported by the compression middleware
+const (
+	encodingBrotli = "br"
+	encodingGzip   = "gzip"
+)
+
+// compressedContentTypes are formats that are already compressed, so
+// compressing them again only costs CPU
+var compressedContentTypes = []string{
+	"image/png",
+	"image/jpeg",
+	"image/gif",
+	"image/webp",
+	"image/avif",
+	"video/",
+	"audio/",
+	"font/woff",
+	"application/zip",
+	"application/gzip",
+	"application/x-gzip",
+	"application/x-brotli",
+	"application/pdf",
+}
+
+// Middleware returns HTTP middleware that compresses responses with brotli
+// or gzip, depending on what the client accepts, whenever ShouldCompress
+// allows it. Responses are buffered until MinSize bytes are written so
+// small bodies are sent as is.
+func (cc *CompressionConfig) Middleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !cc.Enabled || cc.isExcluded(r.URL.Path) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// The response differs by Accept-Encoding even when this client
+			// gets it uncompressed
+			w.Header().Add("Vary", "Accept-Encoding")
+
+			encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+			if encoding == "" || r.Method == http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			cw := &compressWriter{
+				ResponseWriter: w,
+				config:         cc,
+				encoding:       encoding,
+				path:           r.URL.Path,
+				status:         http.StatusOK,
+			}
+			defer cw.close()
+
+			next.ServeHTTP(cw, r)
+		})
+	}
+}
+
+// isExcluded reports whether path is never compressed
+func (cc *CompressionConfig) isExcluded(path string) bool {
+	for _, excluded := range cc.ExcludedPaths {
+		if strings.HasPrefix(path, excluded) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// negotiateEncoding picks brotli or gzip from an Accept-Encoding header,
+// preferring brotli. It returns "" if the client accepts neither.
+func negotiateEncoding(acceptEncoding string) string {
+	accepted := make(map[string]bool)
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+				q = parsed
+			}
+		}
+
+		accepted[name] = q > 0
+	}
+
+	switch {
+	case accepted[encodingBrotli]:
+		return encodingBrotli
+	case accepted[encodingGzip]:
+		return encodingGzip
+	default:
+		return ""
+	}
+}
+
+// isCompressedContentType reports whether contentType is already compressed
+func isCompressedContentType(contentType string) bool {
+	contentType = strings.ToLower(contentType)
+	for _, ct := range compressedContentTypes {
+		if strings.HasPrefix(contentType, ct) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// compressWriter buffers the start of a response until it knows whether
+// to compress it, then either streams it through an encoder or passes it
+// through unchanged
+type compressWriter struct {
+	http.ResponseWriter
+	config   *CompressionConfig
+	encoding string
+	path     string
+
+	status      int
+	buf         []byte
+	decided     bool
+	wroteHeader bool
+	encoder     io.WriteCloser
+}
+
+// WriteHeader records the status code; it is sent once the body is
+// known to be compressed or not
+func (cw *compressWriter) WriteHeader(status int) {
+	if cw.wroteHeader {
+		return
+	}
+	cw.wroteHeader = true
+	cw.status = status
+}
+
+// Write buffers data until MinSize bytes are available, then writes it
+// compressed or as is
+func (cw *compressWriter) Write(data []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+
+	if cw.decided {
+		return cw.writeBody(data)
+	}
+
+	cw.buf = append(cw.buf, data...)
+	if len(cw.buf) < cw.config.MinSize {
+		return len(data), nil
+	}
+
+	if err := cw.decide(); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+// Flush sends whatever has been written so far
+func (cw *compressWriter) Flush() {
+	if !cw.decided {
+		if err := cw.decide(); err != nil {
+			return
+		}
+	}
+
+	if flusher, ok := cw.encoder.(interface{ Flush() error }); ok {
+		flusher.Flush()
+	}
+	if flusher, ok := cw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// decide chooses whether to compress based on the buffered body, sends the
+// headers and writes out the buffer
+func (cw *compressWriter) decide() error {
+	cw.decided = true
+	header := cw.Header()
+
+	contentType := header.Get("Content-Type")
+	if contentType == "" && len(cw.buf) > 0 {
+		contentType = http.DetectContentType(cw.buf)
+		header.Set("Content-Type", contentType)
+	}
+
+	compress := header.Get("Content-Encoding") == "" &&
+		cw.status != http.StatusNoContent &&
+		cw.status != http.StatusNotModified &&
+		!isCompressedContentType(contentType) &&
+		cw.config.ShouldCompress(contentType, len(cw.buf), cw.path)
+
+	if compress {
+		header.Set("Content-Encoding", cw.encoding)
+		header.Del("Content-Length")
+		cw.encoder = cw.newEncoder()
+	}
+
+	cw.ResponseWriter.WriteHeader(cw.status)
+
+	buf := cw.buf
+	cw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+
+	_, err := cw.writeBody(buf)
+	return err
+}
+
+// newEncoder creates an encoder for the negotiated encoding at the
+// configured level, using the library default if it's out of range
+func (cw *compressWriter) newEncoder() io.WriteCloser {
+	level := cw.config.Level
+
+	if cw.encoding == encodingBrotli {
+		if level < brotli.BestSpeed || level > brotli.BestCompression {
+			level = brotli.DefaultCompression
+		}
+		return brotli.NewWriterLevel(cw.ResponseWriter, level)
+	}
+
+	if level < gzip.BestSpeed || level > gzip.BestCompression {
+		level = gzip.DefaultCompression
+	}
+	gz, _ := gzip.NewWriterLevel(cw.ResponseWriter, level)
+	return gz
+}
+
+func (cw *compressWriter) writeBody(data []byte) (int, error) {
+	if cw.encoder != nil {
+		return cw.encoder.Write(data)
+	}
+	return cw.ResponseWriter.Write(data)
+}
+
+// close sends a response that never reached MinSize and finishes the
+// compressed stream
+func (cw *compressWriter) close() {
+	if !cw.decided {
+		if !cw.wroteHeader && len(cw.buf) == 0 {
+			// The handler wrote nothing; let net/http send its default
+			return
+		}
+		if err := cw.decide(); err != nil {
+			return
+		}
+	}
+
+	if cw.encoder != nil {
+		cw.encoder.Close()
+	}
+}
@@ -0,0 +1,107 @@
+package cdn
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+)
+
+func serveCompressed(t *testing.T, config *CompressionConfig, path, acceptEncoding, contentType, body string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	handler := config.Middleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		// Write in chunks to exercise buffering across writes
+		for len(body) > 0 {
+			n := min(len(body), 300)
+			io.WriteString(w, body[:n])
+			body = body[n:]
+		}
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if acceptEncoding != "" {
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestCompressionMiddleware_RoundTrip(t *testing.T) {
+	body := strings.Repeat(`{"id":1,"name":"widget","tags":["a","b"]},`, 100)
+
+	tests := []struct {
+		acceptEncoding string
+		wantEncoding   string
+		decode         func(io.Reader) (io.Reader, error)
+	}{
+		{"gzip, deflate", "gzip", func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) }},
+		{"gzip;q=0.8, br", "br", func(r io.Reader) (io.Reader, error) { return brotli.NewReader(r), nil }},
+		{"br;q=0, gzip", "gzip", func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.acceptEncoding, func(t *testing.T) {
+			rec := serveCompressed(t, DefaultCompressionConfig(), "/api/widgets", tt.acceptEncoding, "application/json", body)
+
+			if got := rec.Header().Get("Content-Encoding"); got != tt.wantEncoding {
+				t.Fatalf("Content-Encoding = %q, want %q", got, tt.wantEncoding)
+			}
+			if got := rec.Header().Get("Vary"); got != "Accept-Encoding" {
+				t.Errorf("Vary = %q, want Accept-Encoding", got)
+			}
+			if rec.Body.Len() >= len(body) {
+				t.Errorf("compressed size %d not smaller than %d", rec.Body.Len(), len(body))
+			}
+
+			reader, err := tt.decode(rec.Body)
+			if err != nil {
+				t.Fatalf("open decoder: %v", err)
+			}
+			decoded, err := io.ReadAll(reader)
+			if err != nil {
+				t.Fatalf("decompress: %v", err)
+			}
+			if string(decoded) != body {
+				t.Error("decompressed body differs from the original")
+			}
+		})
+	}
+}
+
+func TestCompressionMiddleware_Skips(t *testing.T) {
+	large := strings.Repeat("<p>hello</p>", 200)
+
+	tests := []struct {
+		name           string
+		path           string
+		acceptEncoding string
+		contentType    string
+		body           string
+	}{
+		{"small body", "/page", "gzip, br", "text/html", "<p>hello</p>"},
+		{"excluded path", "/health/live", "gzip, br", "text/html", large},
+		{"no accepted encoding", "/page", "identity", "text/html", large},
+		{"compressed content type", "/logo.png", "gzip, br", "image/png", large},
+		{"unlisted content type", "/data.bin", "gzip, br", "application/octet-stream", large},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serveCompressed(t, DefaultCompressionConfig(), tt.path, tt.acceptEncoding, tt.contentType, tt.body)
+
+			if got := rec.Header().Get("Content-Encoding"); got != "" {
+				t.Errorf("Content-Encoding = %q, want none", got)
+			}
+			if rec.Body.String() != tt.body {
+				t.Error("body was modified")
+			}
+		})
+	}
+}
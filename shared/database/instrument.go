@@ -0,0 +1,139 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/dayanch951/marimo/shared/monitoring"
+)
+
+// queryer is the part of *sql.DB that PostgresDB runs queries through
+type queryer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// instrumentedDB records the count and duration of every query, labeled
+// by operation and table
+type instrumentedDB struct {
+	db      *sql.DB
+	metrics *monitoring.Metrics
+}
+
+func (i *instrumentedDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	start := time.Now()
+	result, err := i.db.ExecContext(ctx, query, args...)
+	i.observe(query, start, err)
+	return result, err
+}
+
+func (i *instrumentedDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	start := time.Now()
+	rows, err := i.db.QueryContext(ctx, query, args...)
+	i.observe(query, start, err)
+	return rows, err
+}
+
+func (i *instrumentedDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	start := time.Now()
+	row := i.db.QueryRowContext(ctx, query, args...)
+
+	// No rows is an answer, not a failed query
+	err := row.Err()
+	if err == sql.ErrNoRows {
+		err = nil
+	}
+	i.observe(query, start, err)
+	return row
+}
+
+func (i *instrumentedDB) observe(query string, start time.Time, err error) {
+	operation, table := queryLabels(query)
+
+	status := "success"
+	if err != nil {
+		status = "error"
+	}
+
+	i.metrics.DBQueriesTotal.WithLabelValues(operation, table, status).Inc()
+	i.metrics.DBQueryDuration.WithLabelValues(operation, table).Observe(time.Since(start).Seconds())
+}
+
+// reportStats updates the connection gauges every interval until ctx is
+// canceled. The returned channel is closed once the loop has exited.
+func (i *instrumentedDB) reportStats(ctx context.Context, interval time.Duration) <-chan struct{} {
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			i.updateStats()
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return done
+}
+
+// updateStats copies the pool's connection counts into the gauges
+func (i *instrumentedDB) updateStats() {
+	stats := i.db.Stats()
+	i.metrics.DBConnectionsOpen.Set(float64(stats.OpenConnections))
+	i.metrics.DBConnectionsIdle.Set(float64(stats.Idle))
+}
+
+// queryLabels returns the operation (select, insert, update, delete or
+// other) and the first table a query touches
+func queryLabels(query string) (operation, table string) {
+	words := strings.Fields(strings.ToLower(query))
+	if len(words) == 0 {
+		return "other", "unknown"
+	}
+
+	operation = words[0]
+	var after string
+	switch operation {
+	case "select", "delete":
+		after = "from"
+	case "insert":
+		after = "into"
+	case "update":
+		if len(words) > 1 {
+			return operation, tableName(words[1])
+		}
+		return operation, "unknown"
+	default:
+		return "other", "unknown"
+	}
+
+	for i := 1; i < len(words)-1; i++ {
+		if words[i] == after {
+			return operation, tableName(words[i+1])
+		}
+	}
+	return operation, "unknown"
+}
+
+// tableName trims what can follow a table name without a space, as in
+// "users(email" or "users;"
+func tableName(word string) string {
+	if i := strings.IndexAny(word, "(;,)"); i >= 0 {
+		word = word[:i]
+	}
+	if word == "" {
+		return "unknown"
+	}
+	return word
+}
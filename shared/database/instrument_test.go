@@ -0,0 +1,82 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/dayanch951/marimo/shared/monitoring"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestPostgresDB_RecordsQueryMetrics(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	if _, err := db.Exec(`CREATE TABLE users (
+		id TEXT, email TEXT, name TEXT, password TEXT, role TEXT, email_verified BOOLEAN,
+		created_at DATETIME, updated_at DATETIME, deleted_at DATETIME)`); err != nil {
+		t.Fatalf("failed to create schema: %v", err)
+	}
+	if _, err := db.Exec(`CREATE TABLE user_tokens (user_id TEXT, purpose TEXT, used BOOLEAN)`); err != nil {
+		t.Fatalf("failed to create schema: %v", err)
+	}
+
+	metrics := monitoring.NewMetrics(nil)
+	pg := newPostgresDB(db, metrics)
+
+	if _, err := pg.GetUserByEmail("missing@example.com"); !errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("GetUserByEmail() error = %v, want ErrUserNotFound", err)
+	}
+	if err := pg.UpdateUser("1", "Name", "name@example.com"); !errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("UpdateUser() error = %v, want ErrUserNotFound", err)
+	}
+	pg.conn.ExecContext(t.Context(), "SELECT * FROM missing_table")
+
+	for _, tt := range []struct {
+		labels []string
+		want   float64
+	}{
+		{[]string{"select", "users", "success"}, 1},
+		{[]string{"update", "users", "success"}, 1},
+		{[]string{"select", "missing_table", "error"}, 1},
+	} {
+		if got := testutil.ToFloat64(metrics.DBQueriesTotal.WithLabelValues(tt.labels...)); got != tt.want {
+			t.Errorf("db_queries_total%v = %v, want %v", tt.labels, got, tt.want)
+		}
+	}
+
+	if err := pg.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if got := testutil.ToFloat64(metrics.DBConnectionsOpen); got != 1 {
+		t.Errorf("db_connections_open = %v, want 1", got)
+	}
+}
+
+func TestQueryLabels(t *testing.T) {
+	tests := []struct {
+		query     string
+		operation string
+		table     string
+	}{
+		{"SELECT EXISTS(SELECT 1 FROM users WHERE email = $1)", "select", "users"},
+		{"\n\t\tINSERT INTO refresh_tokens (user_id, token) VALUES ($1, $2)", "insert", "refresh_tokens"},
+		{"UPDATE users SET role = $1 WHERE id = $2", "update", "users"},
+		{"DELETE FROM refresh_tokens WHERE expires_at < $1", "delete", "refresh_tokens"},
+		{"SELECT 1", "select", "unknown"},
+		{"BEGIN", "other", "unknown"},
+	}
+
+	for _, tt := range tests {
+		operation, table := queryLabels(tt.query)
+		if operation != tt.operation || table != tt.table {
+			t.Errorf("queryLabels(%q) = %s, %s, want %s, %s", tt.query, operation, table, tt.operation, tt.table)
+		}
+	}
+}
@@ -14,23 +14,54 @@ var (
 	ErrTokenNotFound        = errors.New("refresh token not found")
 	ErrTokenExpired         = errors.New("refresh token expired")
 	ErrTokenRevoked         = errors.New("refresh token revoked")
+	ErrUserTokenInvalid     = errors.New("token not found or already used")
+	ErrUserTokenExpired     = errors.New("token expired")
 )
 
 // Database defines the interface for database operations
 type Database interface {
-	// User operations
+	// User operations. Deleted users are not returned, so they can't log
+	// in either.
 	CreateUser(email, password, name, role string) (*models.User, error)
 	GetUserByEmail(email string) (*models.User, error)
 	GetUserByID(id string) (*models.User, error)
+	// UpdateUser changes a user's name and email. Changing the email clears
+	// EmailVerified and invalidates outstanding verification links.
 	UpdateUser(id, name, email string) error
+	UpdatePassword(userID, passwordHash string) error
+	MarkEmailVerified(userID string) error
 	AssignRole(userID, role string) error
 	ValidatePassword(email, password string) (*models.User, error)
 	ListUsers(page, limit int) ([]*models.User, int, error)
+	// DeleteUser soft-deletes a user. Their email stays taken.
+	DeleteUser(userID string) error
+
+	// Tenant operations
+	AssignTenant(userID, tenantID string) error
+	// CountUsersByTenant counts the tenant's users that are not deleted
+	CountUsersByTenant(tenantID string) (int, error)
 
 	// Refresh token operations
 	CreateRefreshToken(userID, token string, expiresAt time.Time) (*models.RefreshToken, error)
+	// GetRefreshToken returns the stored token along with ErrTokenRevoked
+	// if it has been revoked, so callers can tell whose token was replayed
 	GetRefreshToken(token string) (*models.RefreshToken, error)
+	// RevokeRefreshToken returns ErrTokenRevoked if the token was already
+	// revoked, so of several concurrent calls exactly one succeeds
 	RevokeRefreshToken(token string) error
+	// RotateRefreshToken revokes a token exchanged for a new one, like
+	// RevokeRefreshToken, and marks it rotated. Only rotated tokens are
+	// never presented again by their owner.
+	RotateRefreshToken(token string) error
 	RevokeAllUserTokens(userID string) error
+	// ListUserTokens returns the user's refresh tokens that are neither
+	// revoked nor expired, newest first
+	ListUserTokens(userID string) ([]*models.RefreshToken, error)
 	CleanupExpiredTokens() error
+
+	// Single-use token operations
+	CreateUserToken(userID, purpose, token string, expiresAt time.Time) (*models.UserToken, error)
+	// ConsumeUserToken marks a token for purpose as used and returns it. A
+	// token can only be consumed once.
+	ConsumeUserToken(purpose, token string) (*models.UserToken, error)
 }
@@ -2,11 +2,32 @@ package database
 
 import (
 	"context"
+	"errors"
 	"fmt"
-
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
+// ErrInvalidBatchModel is returned when LoadMap isn't given a pointer to a
+// slice of structs with an ID field
+var ErrInvalidBatchModel = errors.New("batch model must be a pointer to a slice of structs with an ID field")
+
+// ErrKeyNotFound is returned by Load when it joins a LoadMany batch whose
+// batch function didn't return the key
+var ErrKeyNotFound = errors.New("key not found")
+
+// ErrLoadPanicked is returned to callers waiting on a load or batch
+// function that panicked
+var ErrLoadPanicked = errors.New("load panicked")
+
 // PreloadConfig defines preload configuration
 type PreloadConfig struct {
 	Associations []string
@@ -55,35 +76,195 @@ func (el *EagerLoader) LoadUsersWithRelations(ctx context.Context, tenantID stri
 	return users, err
 }
 
-// DataLoader provides data loader pattern implementation
+// DefaultBatchWindow is how long LoadMany waits for other keys to join a
+// batch before loading it
+const DefaultBatchWindow = 2 * time.Millisecond
+
+// DataLoader provides data loader pattern implementation. It is meant to
+// live for a single request: loaded values are cached for its lifetime,
+// concurrent loads of a key share one call, and keys requested through
+// LoadMany around the same time are fetched in one batch.
 type DataLoader struct {
-	cache map[string]interface{}
+	mu          sync.Mutex
+	cache       map[string]interface{}
+	inflight    map[string]*loadCall
+	batch       *loadBatch
+	batchWindow time.Duration
+}
+
+// loadCall is a load of a single key that other callers can wait on
+type loadCall struct {
+	done  chan struct{}
+	value interface{}
+	found bool
+	err   error
+}
+
+// loadBatch collects keys for a single batch function call
+type loadBatch struct {
+	keys    []string
+	calls   []*loadCall
+	batchFn func([]string) (map[string]interface{}, error)
 }
 
 // NewDataLoader creates a new data loader
 func NewDataLoader() *DataLoader {
 	return &DataLoader{
-		cache: make(map[string]interface{}),
+		cache:       make(map[string]interface{}),
+		inflight:    make(map[string]*loadCall),
+		batchWindow: DefaultBatchWindow,
 	}
 }
 
-// Load loads data using cache
+// SetBatchWindow sets how long LoadMany waits for other keys to join a
+// batch
+func (dl *DataLoader) SetBatchWindow(window time.Duration) {
+	dl.mu.Lock()
+	defer dl.mu.Unlock()
+
+	dl.batchWindow = window
+}
+
+// Load loads data using cache. If another goroutine is already loading
+// key, Load waits for its result instead of calling loader again. If that
+// load is a LoadMany batch that doesn't return key, Load returns
+// ErrKeyNotFound.
 func (dl *DataLoader) Load(key string, loader func() (interface{}, error)) (interface{}, error) {
+	dl.mu.Lock()
+
 	// Check cache
 	if data, ok := dl.cache[key]; ok {
+		dl.mu.Unlock()
 		return data, nil
 	}
 
-	// Load data
+	// Join a load already in flight
+	if call, ok := dl.inflight[key]; ok {
+		dl.mu.Unlock()
+		<-call.done
+		if call.err == nil && !call.found {
+			return nil, ErrKeyNotFound
+		}
+		return call.value, call.err
+	}
+
+	call := &loadCall{done: make(chan struct{})}
+	dl.inflight[key] = call
+	dl.mu.Unlock()
+
+	// Load data. If loader panics, the callers waiting on the load get an
+	// error and the panic carries on in this goroutine.
+	defer func() {
+		if r := recover(); r != nil {
+			dl.finish(key, call, nil, false, fmt.Errorf("%w: %v", ErrLoadPanicked, r))
+			panic(r)
+		}
+	}()
+
 	data, err := loader()
-	if err != nil {
-		return nil, err
+	dl.finish(key, call, data, err == nil, err)
+
+	return data, err
+}
+
+// LoadMany loads several keys, returning the values found by key. Keys
+// that aren't cached or already loading are queued, and every key queued
+// by any caller within the batch window is fetched with a single
+// batchFn call. Keys batchFn doesn't return are left out of the result.
+//
+// Each batch uses the batchFn of the call that started it, so callers
+// sharing a DataLoader must pass equivalent functions.
+func (dl *DataLoader) LoadMany(keys []string, batchFn func([]string) (map[string]interface{}, error)) (map[string]interface{}, error) {
+	result := make(map[string]interface{}, len(keys))
+	calls := make(map[string]*loadCall)
+
+	dl.mu.Lock()
+	for _, key := range keys {
+		if data, ok := dl.cache[key]; ok {
+			result[key] = data
+			continue
+		}
+		if _, ok := calls[key]; ok {
+			continue
+		}
+
+		call, ok := dl.inflight[key]
+		if !ok {
+			call = &loadCall{done: make(chan struct{})}
+			dl.inflight[key] = call
+			dl.enqueue(key, call, batchFn)
+		}
+		calls[key] = call
+	}
+	dl.mu.Unlock()
+
+	for key, call := range calls {
+		<-call.done
+		if call.err != nil {
+			return nil, call.err
+		}
+		if call.found {
+			result[key] = call.value
+		}
+	}
+
+	return result, nil
+}
+
+// enqueue adds key to the pending batch, starting a new one if needed.
+// The caller must hold dl.mu.
+func (dl *DataLoader) enqueue(key string, call *loadCall, batchFn func([]string) (map[string]interface{}, error)) {
+	if dl.batch == nil {
+		batch := &loadBatch{batchFn: batchFn}
+		dl.batch = batch
+		time.AfterFunc(dl.batchWindow, func() { dl.dispatch(batch) })
 	}
 
-	// Cache data
-	dl.cache[key] = data
+	dl.batch.keys = append(dl.batch.keys, key)
+	dl.batch.calls = append(dl.batch.calls, call)
+}
 
-	return data, nil
+// dispatch loads a batch once its window has passed
+func (dl *DataLoader) dispatch(batch *loadBatch) {
+	dl.mu.Lock()
+	if dl.batch == batch {
+		dl.batch = nil
+	}
+	dl.mu.Unlock()
+
+	values, err := runBatch(batch)
+
+	for i, key := range batch.keys {
+		value, found := values[key]
+		dl.finish(key, batch.calls[i], value, found, err)
+	}
+}
+
+// runBatch calls the batch function of batch. It runs on a timer's
+// goroutine, so a panic is turned into an error for the batch's callers
+// rather than crashing the process.
+func runBatch(batch *loadBatch) (values map[string]interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			values, err = nil, fmt.Errorf("%w: %v", ErrLoadPanicked, r)
+		}
+	}()
+
+	return batch.batchFn(batch.keys)
+}
+
+// finish records the result of a load and wakes up everyone waiting on it
+func (dl *DataLoader) finish(key string, call *loadCall, value interface{}, found bool, err error) {
+	call.value, call.found, call.err = value, found && err == nil, err
+
+	dl.mu.Lock()
+	if call.found {
+		dl.cache[key] = value
+	}
+	delete(dl.inflight, key)
+	dl.mu.Unlock()
+
+	close(call.done)
 }
 
 // BatchLoader loads multiple records in a single query
@@ -108,28 +289,74 @@ func (bl *BatchLoader) LoadByIDs(ctx context.Context, model interface{}, ids []s
 		Find(model).Error
 }
 
-// LoadMap loads records and returns them as a map indexed by ID
+// LoadMap loads records into model, a pointer to a slice such as
+// *[]User or *[]*User, and returns them as a map indexed by ID.
+// Map values are pointers to the loaded records (*User).
 // Useful for quick lookups without iteration
 func (bl *BatchLoader) LoadMap(ctx context.Context, model interface{}, ids []string) (map[string]interface{}, error) {
-	if len(ids) == 0 {
-		return make(map[string]interface{}), nil
+	slice := reflect.ValueOf(model)
+	if slice.Kind() != reflect.Ptr || slice.Elem().Kind() != reflect.Slice {
+		return nil, ErrInvalidBatchModel
 	}
+	slice = slice.Elem()
 
-	// This is a simplified version - in production, use reflection
-	// to properly handle the generic type
 	result := make(map[string]interface{})
+	if len(ids) == 0 {
+		return result, nil
+	}
 
 	// Load records
 	if err := bl.LoadByIDs(ctx, model, ids); err != nil {
 		return nil, err
 	}
 
-	// Convert to map (simplified - needs proper implementation)
-	// In production, use reflection to extract ID field and create map
+	for i := 0; i < slice.Len(); i++ {
+		record := slice.Index(i)
+		if record.Kind() == reflect.Ptr {
+			if record.IsNil() {
+				continue
+			}
+			record = record.Elem()
+		}
+		if record.Kind() != reflect.Struct {
+			return nil, ErrInvalidBatchModel
+		}
+
+		id, err := recordID(record)
+		if err != nil {
+			return nil, err
+		}
+
+		result[id] = record.Addr().Interface()
+	}
 
 	return result, nil
 }
 
+// recordID returns the ID field of a struct as a string
+func recordID(record reflect.Value) (string, error) {
+	field := record.FieldByName("ID")
+	if !field.IsValid() {
+		return "", ErrInvalidBatchModel
+	}
+
+	switch id := field.Interface().(type) {
+	case string:
+		return id, nil
+	case uuid.UUID:
+		return id.String(), nil
+	}
+
+	switch field.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(field.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(field.Uint(), 10), nil
+	}
+
+	return "", fmt.Errorf("%w: unsupported ID type %s", ErrInvalidBatchModel, field.Type())
+}
+
 // QueryOptimizer provides query optimization helpers
 type QueryOptimizer struct {
 	db *gorm.DB
@@ -247,20 +474,42 @@ func (ph *PreloadHelper) DashboardWithWidgets() *gorm.DB {
 	return ph.db.Preload("Widgets").Preload("Widgets.Query")
 }
 
+// DefaultN1Threshold is how many times the same query may run before
+// N1Detector reports it
+const DefaultN1Threshold = 5
+
 // N+1 Detection Helper
 type N1Detector struct {
-	enabled bool
-	queries []string
+	enabled   bool
+	threshold int
+	queries   []string
+}
+
+// N1Warning reports a query that ran often enough to suggest an N+1 pattern
+type N1Warning struct {
+	Query string // Normalized query
+	Count int    // Number of times it ran
+}
+
+func (w N1Warning) String() string {
+	return fmt.Sprintf("Potential N+1: Query executed %d times: %s", w.Count, w.Query)
 }
 
 // NewN1Detector creates a new N+1 detector
 func NewN1Detector(enabled bool) *N1Detector {
 	return &N1Detector{
-		enabled: enabled,
-		queries: make([]string, 0),
+		enabled:   enabled,
+		threshold: DefaultN1Threshold,
+		queries:   make([]string, 0),
 	}
 }
 
+// SetThreshold sets how many times the same query may run before it is
+// reported
+func (n *N1Detector) SetThreshold(threshold int) {
+	n.threshold = threshold
+}
+
 // RecordQuery records a query for analysis
 func (n *N1Detector) RecordQuery(query string) {
 	if !n.enabled {
@@ -270,32 +519,117 @@ func (n *N1Detector) RecordQuery(query string) {
 	n.queries = append(n.queries, query)
 }
 
-// Analyze analyzes recorded queries for N+1 patterns
-func (n *N1Detector) Analyze() []string {
+// Analyze analyzes recorded queries for N+1 patterns. Queries that only
+// differ by literal values are counted together; the most frequent are
+// reported first.
+func (n *N1Detector) Analyze() []N1Warning {
 	if !n.enabled {
 		return nil
 	}
 
-	warnings := make([]string, 0)
+	warnings := make([]N1Warning, 0)
 
-	// Simple analysis: look for repeated similar queries
+	// Look for repeated similar queries
 	queryCount := make(map[string]int)
 
 	for _, query := range n.queries {
-		// Simplified - in production, normalize queries before counting
-		queryCount[query]++
+		queryCount[NormalizeQuery(query)]++
 	}
 
-	// Report queries that appear more than 5 times
+	// Report queries that appear more than the threshold
 	for query, count := range queryCount {
-		if count > 5 {
-			warnings = append(warnings, fmt.Sprintf("Potential N+1: Query executed %d times: %s", count, query))
+		if count > n.threshold {
+			warnings = append(warnings, N1Warning{Query: query, Count: count})
 		}
 	}
 
+	sort.Slice(warnings, func(i, j int) bool {
+		if warnings[i].Count != warnings[j].Count {
+			return warnings[i].Count > warnings[j].Count
+		}
+		return warnings[i].Query < warnings[j].Query
+	})
+
 	return warnings
 }
 
+// inListPattern matches a parenthesized list of placeholders
+var inListPattern = regexp.MustCompile(`\(\s*\?(?:\s*,\s*\?)*\s*\)`)
+
+// NormalizeQuery replaces string and numeric literals and bind parameters
+// ($1, ?) with ?, collapses IN lists to (?) and squeezes whitespace, so
+// queries that differ only by their values compare equal
+func NormalizeQuery(query string) string {
+	var b strings.Builder
+	b.Grow(len(query))
+
+	for i := 0; i < len(query); {
+		c := query[i]
+
+		switch {
+		case c == '\'':
+			// String literal; '' is an escaped quote
+			i++
+			for i < len(query) {
+				if query[i] == '\'' {
+					if i+1 < len(query) && query[i+1] == '\'' {
+						i += 2
+						continue
+					}
+					break
+				}
+				i++
+			}
+			i++
+			b.WriteByte('?')
+
+		case c == '"':
+			// Quoted identifier, kept as is
+			end := strings.IndexByte(query[i+1:], '"')
+			if end < 0 {
+				b.WriteString(query[i:])
+				i = len(query)
+				continue
+			}
+			b.WriteString(query[i : i+end+2])
+			i += end + 2
+
+		case c == '$' && i+1 < len(query) && isDigit(query[i+1]):
+			i++
+			for i < len(query) && isDigit(query[i]) {
+				i++
+			}
+			b.WriteByte('?')
+
+		case isDigit(c) && (i == 0 || !isIdentChar(query[i-1])):
+			for i < len(query) && (isDigit(query[i]) || query[i] == '.') {
+				i++
+			}
+			b.WriteByte('?')
+
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			for i < len(query) && (query[i] == ' ' || query[i] == '\t' || query[i] == '\n' || query[i] == '\r') {
+				i++
+			}
+			b.WriteByte(' ')
+
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+
+	return inListPattern.ReplaceAllString(strings.TrimSpace(b.String()), "(?)")
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || isDigit(c) || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
 // Clear clears recorded queries
 func (n *N1Detector) Clear() {
 	n.queries = make([]string, 0)
@@ -0,0 +1,335 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type batchProduct struct {
+	ID   string `gorm:"primaryKey"`
+	Name string
+}
+
+type batchOrder struct {
+	ID    uuid.UUID `gorm:"type:text;primaryKey"`
+	Total int
+}
+
+func newTestGormDB(t *testing.T, models ...interface{}) *gorm.DB {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(models...); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("get sql.DB: %v", err)
+	}
+	// Every connection to :memory: gets its own database
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	return db
+}
+
+func TestBatchLoader_LoadMap(t *testing.T) {
+	db := newTestGormDB(t, &batchProduct{})
+	products := []batchProduct{{ID: "p1", Name: "Bolt"}, {ID: "p2", Name: "Nut"}, {ID: "p3", Name: "Washer"}}
+	if err := db.Create(&products).Error; err != nil {
+		t.Fatalf("seed products: %v", err)
+	}
+
+	loader := NewBatchLoader(db)
+
+	var loaded []batchProduct
+	result, err := loader.LoadMap(context.Background(), &loaded, []string{"p1", "p3", "missing"})
+	if err != nil {
+		t.Fatalf("LoadMap() error = %v", err)
+	}
+
+	if len(result) != 2 {
+		t.Fatalf("LoadMap() returned %d records, want 2", len(result))
+	}
+	if p, ok := result["p1"].(*batchProduct); !ok || p.Name != "Bolt" {
+		t.Errorf("result[p1] = %#v, want Bolt", result["p1"])
+	}
+	if p, ok := result["p3"].(*batchProduct); !ok || p.Name != "Washer" {
+		t.Errorf("result[p3] = %#v, want Washer", result["p3"])
+	}
+}
+
+func TestBatchLoader_LoadMapUUID(t *testing.T) {
+	db := newTestGormDB(t, &batchOrder{})
+	first, second := uuid.New(), uuid.New()
+	orders := []*batchOrder{{ID: first, Total: 10}, {ID: second, Total: 20}}
+	if err := db.Create(&orders).Error; err != nil {
+		t.Fatalf("seed orders: %v", err)
+	}
+
+	var loaded []*batchOrder
+	result, err := NewBatchLoader(db).LoadMap(context.Background(), &loaded, []string{first.String(), second.String()})
+	if err != nil {
+		t.Fatalf("LoadMap() error = %v", err)
+	}
+
+	if o, ok := result[second.String()].(*batchOrder); !ok || o.Total != 20 {
+		t.Errorf("result[%s] = %#v, want total 20", second, result[second.String()])
+	}
+	if len(result) != 2 {
+		t.Errorf("LoadMap() returned %d records, want 2", len(result))
+	}
+}
+
+func TestBatchLoader_LoadMapInvalidModel(t *testing.T) {
+	db := newTestGormDB(t, &batchProduct{})
+
+	var product batchProduct
+	if _, err := NewBatchLoader(db).LoadMap(context.Background(), &product, []string{"p1"}); !errors.Is(err, ErrInvalidBatchModel) {
+		t.Errorf("LoadMap(non-slice) error = %v, want ErrInvalidBatchModel", err)
+	}
+}
+
+func TestNormalizeQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"SELECT * FROM posts WHERE user_id = 42", "SELECT * FROM posts WHERE user_id = ?"},
+		{"SELECT * FROM users WHERE email = 'o''brien@example.com'", "SELECT * FROM users WHERE email = ?"},
+		{"SELECT * FROM orders WHERE id = $1 AND total > 10.5", "SELECT * FROM orders WHERE id = ? AND total > ?"},
+		{"SELECT * FROM tags WHERE id IN (1, 2, 3)", "SELECT * FROM tags WHERE id IN (?)"},
+		{"SELECT col1 FROM \"table 2\"\n  WHERE x = ?", "SELECT col1 FROM \"table 2\" WHERE x = ?"},
+	}
+
+	for _, tt := range tests {
+		if got := NormalizeQuery(tt.query); got != tt.want {
+			t.Errorf("NormalizeQuery(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestN1Detector_Analyze(t *testing.T) {
+	detector := NewN1Detector(true)
+
+	detector.RecordQuery("SELECT * FROM users")
+	for i := 1; i <= 10; i++ {
+		detector.RecordQuery(fmt.Sprintf("SELECT * FROM posts WHERE user_id = %d", i))
+	}
+
+	warnings := detector.Analyze()
+	if len(warnings) != 1 {
+		t.Fatalf("Analyze() returned %d warnings, want 1: %v", len(warnings), warnings)
+	}
+	want := N1Warning{Query: "SELECT * FROM posts WHERE user_id = ?", Count: 10}
+	if warnings[0] != want {
+		t.Errorf("warning = %+v, want %+v", warnings[0], want)
+	}
+
+	detector.SetThreshold(10)
+	if warnings := detector.Analyze(); len(warnings) != 0 {
+		t.Errorf("Analyze() with threshold 10 = %v, want none", warnings)
+	}
+}
+
+func TestDataLoader_ConcurrentLoadRunsOnce(t *testing.T) {
+	dl := NewDataLoader()
+
+	var calls int32
+	release := make(chan struct{})
+	loader := func() (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return "tenant-1", nil
+	}
+
+	const goroutines = 20
+	var wg sync.WaitGroup
+	results := make([]interface{}, goroutines)
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			value, err := dl.Load("tenant:1", loader)
+			if err != nil {
+				t.Errorf("Load() error = %v", err)
+			}
+			results[i] = value
+		}(i)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("loader called %d times, want 1", n)
+	}
+	for i, value := range results {
+		if value != "tenant-1" {
+			t.Errorf("result %d = %v, want tenant-1", i, value)
+		}
+	}
+}
+
+func TestDataLoader_LoadManyCoalescesKeys(t *testing.T) {
+	dl := NewDataLoader()
+	dl.SetBatchWindow(20 * time.Millisecond)
+
+	var mu sync.Mutex
+	var batches [][]string
+	batchFn := func(keys []string) (map[string]interface{}, error) {
+		mu.Lock()
+		batches = append(batches, append([]string(nil), keys...))
+		mu.Unlock()
+
+		values := make(map[string]interface{})
+		for _, key := range keys {
+			if key != "missing" {
+				values[key] = "user " + key
+			}
+		}
+		return values, nil
+	}
+
+	requests := [][]string{{"1", "2"}, {"2", "3"}, {"3", "missing"}}
+	results := make([]map[string]interface{}, len(requests))
+
+	var wg sync.WaitGroup
+	for i, keys := range requests {
+		wg.Add(1)
+		go func(i int, keys []string) {
+			defer wg.Done()
+			result, err := dl.LoadMany(keys, batchFn)
+			if err != nil {
+				t.Errorf("LoadMany() error = %v", err)
+			}
+			results[i] = result
+		}(i, keys)
+	}
+	wg.Wait()
+
+	if len(batches) != 1 {
+		t.Fatalf("batch function called %d times, want 1: %v", len(batches), batches)
+	}
+	if len(batches[0]) != 4 {
+		t.Errorf("batch keys = %v, want 4 unique keys", batches[0])
+	}
+
+	if results[1]["2"] != "user 2" || results[1]["3"] != "user 3" {
+		t.Errorf("results[1] = %v", results[1])
+	}
+	if _, ok := results[2]["missing"]; ok || len(results[2]) != 1 {
+		t.Errorf("results[2] = %v, want only key 3", results[2])
+	}
+
+	// Loaded keys are served from the cache afterwards
+	if _, err := dl.LoadMany([]string{"1", "2"}, batchFn); err != nil {
+		t.Fatalf("LoadMany() error = %v", err)
+	}
+	if len(batches) != 1 {
+		t.Errorf("cached keys were loaded again")
+	}
+}
+
+func TestDataLoader_LoadJoiningBatchMissingKey(t *testing.T) {
+	dl := NewDataLoader()
+	dl.SetBatchWindow(20 * time.Millisecond)
+
+	batchFn := func(keys []string) (map[string]interface{}, error) {
+		return map[string]interface{}{"1": "user 1"}, nil
+	}
+	loader := func() (interface{}, error) {
+		t.Error("Load() called its loader for a key already in flight")
+		return nil, nil
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		dl.LoadMany([]string{"1", "missing"}, batchFn)
+	}()
+
+	// Join the batch while it waits for its window
+	time.Sleep(5 * time.Millisecond)
+	if value, err := dl.Load("missing", loader); !errors.Is(err, ErrKeyNotFound) || value != nil {
+		t.Errorf("Load() of a key the batch didn't return = %v, %v, want %v", value, err, ErrKeyNotFound)
+	}
+	<-done
+
+	value, err := dl.Load("1", loader)
+	if err != nil || value != "user 1" {
+		t.Errorf("Load() of a batched key = %v, %v, want user 1", value, err)
+	}
+}
+
+func TestDataLoader_LoadManyBatchPanics(t *testing.T) {
+	dl := NewDataLoader()
+
+	batchFn := func(keys []string) (map[string]interface{}, error) {
+		panic("boom")
+	}
+
+	if _, err := dl.LoadMany([]string{"1", "2"}, batchFn); !errors.Is(err, ErrLoadPanicked) {
+		t.Errorf("LoadMany() with a panicking batch function error = %v, want %v", err, ErrLoadPanicked)
+	}
+
+	// The keys can be loaded again
+	value, err := dl.Load("1", func() (interface{}, error) { return "user 1", nil })
+	if err != nil || value != "user 1" {
+		t.Errorf("Load() after the panic = %v, %v, want user 1", value, err)
+	}
+}
+
+func TestDataLoader_LoadPanics(t *testing.T) {
+	dl := NewDataLoader()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	loader := func() (interface{}, error) {
+		close(started)
+		<-release
+		panic("boom")
+	}
+
+	panicked := make(chan interface{})
+	go func() {
+		defer func() { panicked <- recover() }()
+		dl.Load("1", loader)
+	}()
+
+	// Join the load while it runs
+	<-started
+	joined := make(chan error)
+	go func() {
+		_, err := dl.Load("1", func() (interface{}, error) {
+			return nil, errors.New("Load() called its loader for a key already in flight")
+		})
+		joined <- err
+	}()
+	time.Sleep(5 * time.Millisecond)
+	close(release)
+
+	if r := <-panicked; r != "boom" {
+		t.Errorf("Load() with a panicking loader recovered %v, want the panic to carry on", r)
+	}
+	if err := <-joined; !errors.Is(err, ErrLoadPanicked) {
+		t.Errorf("Load() joining a panicking load error = %v, want %v", err, ErrLoadPanicked)
+	}
+}
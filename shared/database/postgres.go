@@ -3,21 +3,27 @@ package database
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/dayanch951/marimo/shared/models"
-	_ "github.com/lib/pq"
+	"github.com/dayanch951/marimo/shared/monitoring"
+	"github.com/lib/pq"
 	"golang.org/x/crypto/bcrypt"
 )
 
 // PostgresDB implements database operations with PostgreSQL
 type PostgresDB struct {
-	db *sql.DB
+	db        *sql.DB
+	conn      queryer // db, instrumented when metrics are enabled
+	stopStats context.CancelFunc
+	statsDone <-chan struct{}
 }
 
-// NewPostgresDB creates a new PostgreSQL database connection
-func NewPostgresDB(host, port, user, password, dbname, sslmode string) (*PostgresDB, error) {
+// NewPostgresDB creates a new PostgreSQL database connection. If metrics
+// is not nil, queries and connection pool usage are recorded in it.
+func NewPostgresDB(host, port, user, password, dbname, sslmode string, metrics *monitoring.Metrics) (*PostgresDB, error) {
 	connStr := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
 		host, port, user, password, dbname, sslmode)
 
@@ -39,14 +45,51 @@ func NewPostgresDB(host, port, user, password, dbname, sslmode string) (*Postgre
 	db.SetMaxIdleConns(5)
 	db.SetConnMaxLifetime(5 * time.Minute)
 
-	return &PostgresDB{db: db}, nil
+	return newPostgresDB(db, metrics), nil
+}
+
+// newPostgresDB wraps an open connection pool
+func newPostgresDB(db *sql.DB, metrics *monitoring.Metrics) *PostgresDB {
+	if metrics == nil {
+		return &PostgresDB{db: db, conn: db}
+	}
+
+	instrumented := &instrumentedDB{db: db, metrics: metrics}
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &PostgresDB{
+		db:        db,
+		conn:      instrumented,
+		stopStats: cancel,
+		statsDone: instrumented.reportStats(ctx, 15*time.Second),
+	}
 }
 
 // Close closes the database connection
 func (d *PostgresDB) Close() error {
+	if d.stopStats != nil {
+		d.stopStats()
+		<-d.statsDone
+	}
 	return d.db.Close()
 }
 
+// DB returns the underlying connection pool for service-specific repositories
+func (d *PostgresDB) DB() *sql.DB {
+	return d.db
+}
+
+// uniqueViolation is the PostgreSQL error code for a unique constraint
+// violation
+const uniqueViolation = "23505"
+
+// isUniqueViolation reports whether err was caused by a unique constraint,
+// such as the one on users.email
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == uniqueViolation
+}
+
 // CreateUser creates a new user
 func (d *PostgresDB) CreateUser(email, password, name, role string) (*models.User, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -54,7 +97,7 @@ func (d *PostgresDB) CreateUser(email, password, name, role string) (*models.Use
 
 	// Check if user exists
 	var exists bool
-	err := d.db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM users WHERE email = $1)", email).Scan(&exists)
+	err := d.conn.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM users WHERE email = $1)", email).Scan(&exists)
 	if err != nil {
 		return nil, fmt.Errorf("failed to check user existence: %w", err)
 	}
@@ -87,10 +130,14 @@ func (d *PostgresDB) CreateUser(email, password, name, role string) (*models.Use
 		VALUES ($1, $2, $3, $4, $5, $6)
 		RETURNING id`
 
-	err = d.db.QueryRowContext(ctx, query,
+	err = d.conn.QueryRowContext(ctx, query,
 		user.Email, user.Name, user.Password, user.Role, user.CreatedAt, user.UpdatedAt,
 	).Scan(&user.ID)
 
+	// The email may have been taken since the check above
+	if isUniqueViolation(err) {
+		return nil, ErrUserAlreadyExists
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to create user: %w", err)
 	}
@@ -104,10 +151,10 @@ func (d *PostgresDB) GetUserByEmail(email string) (*models.User, error) {
 	defer cancel()
 
 	user := &models.User{}
-	query := `SELECT id, email, name, password, role, created_at, updated_at FROM users WHERE email = $1`
+	query := `SELECT id, email, name, password, role, email_verified, created_at, updated_at FROM users WHERE email = $1 AND deleted_at IS NULL`
 
-	err := d.db.QueryRowContext(ctx, query, email).Scan(
-		&user.ID, &user.Email, &user.Name, &user.Password, &user.Role, &user.CreatedAt, &user.UpdatedAt,
+	err := d.conn.QueryRowContext(ctx, query, email).Scan(
+		&user.ID, &user.Email, &user.Name, &user.Password, &user.Role, &user.EmailVerified, &user.CreatedAt, &user.UpdatedAt,
 	)
 
 	if err == sql.ErrNoRows {
@@ -126,10 +173,10 @@ func (d *PostgresDB) GetUserByID(id string) (*models.User, error) {
 	defer cancel()
 
 	user := &models.User{}
-	query := `SELECT id, email, name, password, role, created_at, updated_at FROM users WHERE id = $1`
+	query := `SELECT id, email, name, password, role, email_verified, created_at, updated_at FROM users WHERE id = $1 AND deleted_at IS NULL`
 
-	err := d.db.QueryRowContext(ctx, query, id).Scan(
-		&user.ID, &user.Email, &user.Name, &user.Password, &user.Role, &user.CreatedAt, &user.UpdatedAt,
+	err := d.conn.QueryRowContext(ctx, query, id).Scan(
+		&user.ID, &user.Email, &user.Name, &user.Password, &user.Role, &user.EmailVerified, &user.CreatedAt, &user.UpdatedAt,
 	)
 
 	if err == sql.ErrNoRows {
@@ -142,14 +189,28 @@ func (d *PostgresDB) GetUserByID(id string) (*models.User, error) {
 	return user, nil
 }
 
-// UpdateUser updates user information
+// UpdateUser updates user information. Changing the email clears
+// email_verified and invalidates outstanding verification links.
 func (d *PostgresDB) UpdateUser(id, name, email string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	query := `UPDATE users SET name = $1, email = $2, updated_at = $3 WHERE id = $4`
+	// Invalidate links first, so a failed update leaves at worst a user
+	// who has to request a new one
+	tokensQuery := `UPDATE user_tokens SET used = true
+			  WHERE user_id = $1 AND purpose = $2 AND used = false
+			  AND EXISTS (SELECT 1 FROM users WHERE id = $1 AND email <> $3)`
+
+	if _, err := d.conn.ExecContext(ctx, tokensQuery, id, models.TokenPurposeEmailVerification, email); err != nil {
+		return fmt.Errorf("failed to invalidate verification tokens: %w", err)
+	}
+
+	query := `UPDATE users SET name = $1, email = $2, email_verified = (email_verified AND email = $2), updated_at = $3 WHERE id = $4`
 
-	result, err := d.db.ExecContext(ctx, query, name, email, time.Now(), id)
+	result, err := d.conn.ExecContext(ctx, query, name, email, time.Now(), id)
+	if isUniqueViolation(err) {
+		return ErrUserAlreadyExists
+	}
 	if err != nil {
 		return fmt.Errorf("failed to update user: %w", err)
 	}
@@ -166,6 +227,54 @@ func (d *PostgresDB) UpdateUser(id, name, email string) error {
 	return nil
 }
 
+// UpdatePassword replaces a user's password hash
+func (d *PostgresDB) UpdatePassword(userID, passwordHash string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	query := `UPDATE users SET password = $1, updated_at = $2 WHERE id = $3`
+
+	result, err := d.conn.ExecContext(ctx, query, passwordHash, time.Now(), userID)
+	if err != nil {
+		return fmt.Errorf("failed to update password: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rows == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+// MarkEmailVerified records that a user has verified their email address
+func (d *PostgresDB) MarkEmailVerified(userID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	query := `UPDATE users SET email_verified = true, updated_at = $1 WHERE id = $2`
+
+	result, err := d.conn.ExecContext(ctx, query, time.Now(), userID)
+	if err != nil {
+		return fmt.Errorf("failed to mark email verified: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rows == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
 // AssignRole assigns a role to a user
 func (d *PostgresDB) AssignRole(userID, role string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -173,7 +282,7 @@ func (d *PostgresDB) AssignRole(userID, role string) error {
 
 	query := `UPDATE users SET role = $1, updated_at = $2 WHERE id = $3`
 
-	result, err := d.db.ExecContext(ctx, query, role, time.Now(), userID)
+	result, err := d.conn.ExecContext(ctx, query, role, time.Now(), userID)
 	if err != nil {
 		return fmt.Errorf("failed to assign role: %w", err)
 	}
@@ -190,6 +299,44 @@ func (d *PostgresDB) AssignRole(userID, role string) error {
 	return nil
 }
 
+// AssignTenant records which tenant a user belongs to
+func (d *PostgresDB) AssignTenant(userID, tenantID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	query := `UPDATE users SET tenant_id = $1, updated_at = $2 WHERE id = $3`
+
+	result, err := d.conn.ExecContext(ctx, query, tenantID, time.Now(), userID)
+	if err != nil {
+		return fmt.Errorf("failed to assign tenant: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rows == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+// CountUsersByTenant counts the tenant's users that are not deleted
+func (d *PostgresDB) CountUsersByTenant(tenantID string) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var count int
+	query := `SELECT COUNT(*) FROM users WHERE tenant_id = $1 AND deleted_at IS NULL`
+	if err := d.conn.QueryRowContext(ctx, query, tenantID).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count users: %w", err)
+	}
+
+	return count, nil
+}
+
 // ValidatePassword validates a user's password
 func (d *PostgresDB) ValidatePassword(email, password string) (*models.User, error) {
 	user, err := d.GetUserByEmail(email)
@@ -212,19 +359,20 @@ func (d *PostgresDB) ListUsers(page, limit int) ([]*models.User, int, error) {
 
 	// Get total count
 	var total int
-	err := d.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM users").Scan(&total)
+	err := d.conn.QueryRowContext(ctx, "SELECT COUNT(*) FROM users WHERE deleted_at IS NULL").Scan(&total)
 	if err != nil {
 		return nil, 0, fmt.Errorf("failed to count users: %w", err)
 	}
 
 	// Get users with pagination
 	offset := (page - 1) * limit
-	query := `SELECT id, email, name, role, created_at, updated_at
+	query := `SELECT id, email, name, role, email_verified, created_at, updated_at
 			  FROM users
+			  WHERE deleted_at IS NULL
 			  ORDER BY created_at DESC
 			  LIMIT $1 OFFSET $2`
 
-	rows, err := d.db.QueryContext(ctx, query, limit, offset)
+	rows, err := d.conn.QueryContext(ctx, query, limit, offset)
 	if err != nil {
 		return nil, 0, fmt.Errorf("failed to list users: %w", err)
 	}
@@ -233,7 +381,7 @@ func (d *PostgresDB) ListUsers(page, limit int) ([]*models.User, int, error) {
 	users := make([]*models.User, 0)
 	for rows.Next() {
 		user := &models.User{}
-		err := rows.Scan(&user.ID, &user.Email, &user.Name, &user.Role, &user.CreatedAt, &user.UpdatedAt)
+		err := rows.Scan(&user.ID, &user.Email, &user.Name, &user.Role, &user.EmailVerified, &user.CreatedAt, &user.UpdatedAt)
 		if err != nil {
 			return nil, 0, fmt.Errorf("failed to scan user: %w", err)
 		}
@@ -247,6 +395,31 @@ func (d *PostgresDB) ListUsers(page, limit int) ([]*models.User, int, error) {
 	return users, total, nil
 }
 
+// DeleteUser soft-deletes a user by setting deleted_at
+func (d *PostgresDB) DeleteUser(userID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	query := `UPDATE users SET deleted_at = $1, updated_at = $2 WHERE id = $3 AND deleted_at IS NULL`
+
+	result, err := d.conn.ExecContext(ctx, query, now, now, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete user: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rows == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
 // CreateRefreshToken creates a new refresh token
 func (d *PostgresDB) CreateRefreshToken(userID, token string, expiresAt time.Time) (*models.RefreshToken, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -264,7 +437,7 @@ func (d *PostgresDB) CreateRefreshToken(userID, token string, expiresAt time.Tim
 			  VALUES ($1, $2, $3, $4, $5)
 			  RETURNING id`
 
-	err := d.db.QueryRowContext(ctx, query, refreshToken.UserID, refreshToken.Token,
+	err := d.conn.QueryRowContext(ctx, query, refreshToken.UserID, refreshToken.Token,
 		refreshToken.ExpiresAt, refreshToken.CreatedAt, refreshToken.Revoked).Scan(&refreshToken.ID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create refresh token: %w", err)
@@ -279,13 +452,14 @@ func (d *PostgresDB) GetRefreshToken(token string) (*models.RefreshToken, error)
 	defer cancel()
 
 	refreshToken := &models.RefreshToken{}
-	query := `SELECT id, user_id, token, expires_at, created_at, revoked
+	query := `SELECT id, user_id, token, expires_at, created_at, revoked, rotated
 			  FROM refresh_tokens
 			  WHERE token = $1`
 
-	err := d.db.QueryRowContext(ctx, query, token).Scan(
+	err := d.conn.QueryRowContext(ctx, query, token).Scan(
 		&refreshToken.ID, &refreshToken.UserID, &refreshToken.Token,
 		&refreshToken.ExpiresAt, &refreshToken.CreatedAt, &refreshToken.Revoked,
+		&refreshToken.Rotated,
 	)
 
 	if err == sql.ErrNoRows {
@@ -302,7 +476,7 @@ func (d *PostgresDB) GetRefreshToken(token string) (*models.RefreshToken, error)
 
 	// Check if token is revoked
 	if refreshToken.Revoked {
-		return nil, ErrTokenRevoked
+		return refreshToken, ErrTokenRevoked
 	}
 
 	return refreshToken, nil
@@ -310,11 +484,21 @@ func (d *PostgresDB) GetRefreshToken(token string) (*models.RefreshToken, error)
 
 // RevokeRefreshToken revokes a specific refresh token
 func (d *PostgresDB) RevokeRefreshToken(token string) error {
+	return d.revokeRefreshToken(token, false)
+}
+
+// RotateRefreshToken revokes a refresh token that was exchanged for a new one
+func (d *PostgresDB) RotateRefreshToken(token string) error {
+	return d.revokeRefreshToken(token, true)
+}
+
+func (d *PostgresDB) revokeRefreshToken(token string, rotated bool) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	query := `UPDATE refresh_tokens SET revoked = true WHERE token = $1`
-	result, err := d.db.ExecContext(ctx, query, token)
+	// Only one of several concurrent revocations of a token may succeed
+	query := `UPDATE refresh_tokens SET revoked = true, rotated = $1 WHERE token = $2 AND revoked = false`
+	result, err := d.conn.ExecContext(ctx, query, rotated, token)
 	if err != nil {
 		return fmt.Errorf("failed to revoke token: %w", err)
 	}
@@ -325,6 +509,14 @@ func (d *PostgresDB) RevokeRefreshToken(token string) error {
 	}
 
 	if rows == 0 {
+		var exists bool
+		query = `SELECT EXISTS(SELECT 1 FROM refresh_tokens WHERE token = $1)`
+		if err := d.conn.QueryRowContext(ctx, query, token).Scan(&exists); err != nil {
+			return fmt.Errorf("failed to check token: %w", err)
+		}
+		if exists {
+			return ErrTokenRevoked
+		}
 		return ErrTokenNotFound
 	}
 
@@ -337,7 +529,7 @@ func (d *PostgresDB) RevokeAllUserTokens(userID string) error {
 	defer cancel()
 
 	query := `UPDATE refresh_tokens SET revoked = true WHERE user_id = $1 AND revoked = false`
-	_, err := d.db.ExecContext(ctx, query, userID)
+	_, err := d.conn.ExecContext(ctx, query, userID)
 	if err != nil {
 		return fmt.Errorf("failed to revoke user tokens: %w", err)
 	}
@@ -345,16 +537,107 @@ func (d *PostgresDB) RevokeAllUserTokens(userID string) error {
 	return nil
 }
 
+// ListUserTokens returns the active refresh tokens of a user, newest first
+func (d *PostgresDB) ListUserTokens(userID string) ([]*models.RefreshToken, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	query := `SELECT id, user_id, token, expires_at, created_at, revoked
+			  FROM refresh_tokens
+			  WHERE user_id = $1 AND revoked = false AND expires_at > $2
+			  ORDER BY created_at DESC`
+
+	rows, err := d.conn.QueryContext(ctx, query, userID, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list user tokens: %w", err)
+	}
+	defer rows.Close()
+
+	tokens := make([]*models.RefreshToken, 0)
+	for rows.Next() {
+		token := &models.RefreshToken{}
+		err := rows.Scan(&token.ID, &token.UserID, &token.Token,
+			&token.ExpiresAt, &token.CreatedAt, &token.Revoked)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan refresh token: %w", err)
+		}
+		tokens = append(tokens, token)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	return tokens, nil
+}
+
 // CleanupExpiredTokens removes expired tokens from the database
 func (d *PostgresDB) CleanupExpiredTokens() error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	query := `DELETE FROM refresh_tokens WHERE expires_at < $1`
-	_, err := d.db.ExecContext(ctx, query, time.Now())
+	_, err := d.conn.ExecContext(ctx, query, time.Now())
 	if err != nil {
 		return fmt.Errorf("failed to cleanup expired tokens: %w", err)
 	}
 
 	return nil
 }
+
+// CreateUserToken stores a single-use token for purpose
+func (d *PostgresDB) CreateUserToken(userID, purpose, token string, expiresAt time.Time) (*models.UserToken, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	userToken := &models.UserToken{
+		UserID:    userID,
+		Purpose:   purpose,
+		Token:     token,
+		ExpiresAt: expiresAt,
+		CreatedAt: time.Now(),
+	}
+
+	query := `INSERT INTO user_tokens (user_id, purpose, token, expires_at, created_at)
+			  VALUES ($1, $2, $3, $4, $5)
+			  RETURNING id`
+
+	err := d.conn.QueryRowContext(ctx, query, userToken.UserID, userToken.Purpose, userToken.Token,
+		userToken.ExpiresAt, userToken.CreatedAt).Scan(&userToken.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create user token: %w", err)
+	}
+
+	return userToken, nil
+}
+
+// ConsumeUserToken marks a token for purpose as used and returns it
+func (d *PostgresDB) ConsumeUserToken(purpose, token string) (*models.UserToken, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Marking the token used in the lookup means concurrent requests can't
+	// both consume it
+	userToken := &models.UserToken{}
+	query := `UPDATE user_tokens SET used = true
+			  WHERE token = $1 AND purpose = $2 AND used = false
+			  RETURNING id, user_id, purpose, token, expires_at, created_at, used`
+
+	err := d.conn.QueryRowContext(ctx, query, token, purpose).Scan(
+		&userToken.ID, &userToken.UserID, &userToken.Purpose, &userToken.Token,
+		&userToken.ExpiresAt, &userToken.CreatedAt, &userToken.Used,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, ErrUserTokenInvalid
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to consume user token: %w", err)
+	}
+
+	if time.Now().After(userToken.ExpiresAt) {
+		return nil, ErrUserTokenExpired
+	}
+
+	return userToken, nil
+}
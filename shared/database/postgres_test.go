@@ -0,0 +1,356 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dayanch951/marimo/shared/models"
+	"github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// newTestPostgresDB returns a PostgresDB backed by an in-memory SQLite
+// database with the tables of the migrations
+func newTestPostgresDB(t *testing.T) *PostgresDB {
+	t.Helper()
+
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	if _, err := db.Exec(`CREATE TABLE users (
+		id TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(16)))),
+		email TEXT UNIQUE NOT NULL,
+		name TEXT NOT NULL,
+		password TEXT NOT NULL,
+		role TEXT NOT NULL,
+		email_verified BOOLEAN NOT NULL DEFAULT FALSE,
+		created_at TIMESTAMP NOT NULL,
+		updated_at TIMESTAMP NOT NULL,
+		deleted_at TIMESTAMP,
+		tenant_id TEXT)`); err != nil {
+		t.Fatalf("failed to create schema: %v", err)
+	}
+	if _, err := db.Exec(`CREATE TABLE refresh_tokens (
+		id TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(16)))),
+		user_id TEXT NOT NULL,
+		token TEXT UNIQUE NOT NULL,
+		expires_at TIMESTAMP NOT NULL,
+		created_at TIMESTAMP NOT NULL,
+		revoked BOOLEAN NOT NULL DEFAULT FALSE,
+		rotated BOOLEAN NOT NULL DEFAULT FALSE)`); err != nil {
+		t.Fatalf("failed to create schema: %v", err)
+	}
+	if _, err := db.Exec(`CREATE TABLE user_tokens (
+		id TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(16)))),
+		user_id TEXT NOT NULL,
+		purpose TEXT NOT NULL,
+		token TEXT UNIQUE NOT NULL,
+		expires_at TIMESTAMP NOT NULL,
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		used BOOLEAN NOT NULL DEFAULT FALSE)`); err != nil {
+		t.Fatalf("failed to create schema: %v", err)
+	}
+
+	return newPostgresDB(db, nil)
+}
+
+func TestPostgresDB_DeleteUser(t *testing.T) {
+	db := newTestPostgresDB(t)
+
+	user, err := db.CreateUser("deleted@example.com", "password123", "Deleted User", "user")
+	if err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+	db.CreateUser("kept@example.com", "password123", "Kept User", "user")
+
+	if err := db.DeleteUser(user.ID); err != nil {
+		t.Fatalf("DeleteUser() error = %v", err)
+	}
+
+	if _, err := db.GetUserByEmail("deleted@example.com"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("GetUserByEmail() of a deleted user error = %v, want %v", err, ErrUserNotFound)
+	}
+	if _, err := db.GetUserByID(user.ID); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("GetUserByID() of a deleted user error = %v, want %v", err, ErrUserNotFound)
+	}
+	if _, err := db.ValidatePassword("deleted@example.com", "password123"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("ValidatePassword() of a deleted user error = %v, want %v", err, ErrUserNotFound)
+	}
+
+	users, total, err := db.ListUsers(1, 10)
+	if err != nil {
+		t.Fatalf("ListUsers() error = %v", err)
+	}
+	if total != 1 || len(users) != 1 || users[0].Email != "kept@example.com" {
+		t.Errorf("ListUsers() = %v (total %d), want only kept@example.com", users, total)
+	}
+
+	if err := db.DeleteUser(user.ID); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("DeleteUser() of a deleted user error = %v, want %v", err, ErrUserNotFound)
+	}
+
+	// The email stays taken
+	if _, err := db.CreateUser("deleted@example.com", "password123", "New User", "user"); !errors.Is(err, ErrUserAlreadyExists) {
+		t.Errorf("CreateUser() with a deleted user's email error = %v, want %v", err, ErrUserAlreadyExists)
+	}
+}
+
+func TestPostgresDB_UpdateUser_EmailChange(t *testing.T) {
+	db := newTestPostgresDB(t)
+
+	user, _ := db.CreateUser("old@example.com", "password123", "Test User", "user")
+	db.MarkEmailVerified(user.ID)
+	db.CreateUserToken(user.ID, models.TokenPurposeEmailVerification, "stale", time.Now().Add(time.Hour))
+
+	// Keeping the email keeps it verified
+	if err := db.UpdateUser(user.ID, "New Name", "old@example.com"); err != nil {
+		t.Fatalf("UpdateUser() error = %v", err)
+	}
+	if got, _ := db.GetUserByID(user.ID); !got.EmailVerified {
+		t.Error("UpdateUser() with the same email cleared email_verified")
+	}
+
+	if err := db.UpdateUser(user.ID, "New Name", "new@example.com"); err != nil {
+		t.Fatalf("UpdateUser() error = %v", err)
+	}
+	got, _ := db.GetUserByID(user.ID)
+	if got.Email != "new@example.com" || got.EmailVerified {
+		t.Errorf("UpdateUser() = %+v, want an unverified new@example.com", got)
+	}
+
+	if _, err := db.ConsumeUserToken(models.TokenPurposeEmailVerification, "stale"); !errors.Is(err, ErrUserTokenInvalid) {
+		t.Errorf("ConsumeUserToken() of a link sent to the old email error = %v, want %v", err, ErrUserTokenInvalid)
+	}
+}
+
+func TestPostgresDB_CountUsersByTenant(t *testing.T) {
+	db := newTestPostgresDB(t)
+
+	first, _ := db.CreateUser("first@example.com", "password123", "First User", "user")
+	second, _ := db.CreateUser("second@example.com", "password123", "Second User", "user")
+	other, _ := db.CreateUser("other@example.com", "password123", "Other User", "user")
+	db.CreateUser("none@example.com", "password123", "No Tenant", "user")
+
+	for _, user := range []*models.User{first, second} {
+		if err := db.AssignTenant(user.ID, "tenant-a"); err != nil {
+			t.Fatalf("AssignTenant() error = %v", err)
+		}
+	}
+	db.AssignTenant(other.ID, "tenant-b")
+
+	if count, err := db.CountUsersByTenant("tenant-a"); err != nil || count != 2 {
+		t.Errorf("CountUsersByTenant() = %d, %v, want 2", count, err)
+	}
+
+	// Deleted users free up their seat
+	db.DeleteUser(second.ID)
+	if count, err := db.CountUsersByTenant("tenant-a"); err != nil || count != 1 {
+		t.Errorf("CountUsersByTenant() after a delete = %d, %v, want 1", count, err)
+	}
+
+	if err := db.AssignTenant("missing", "tenant-a"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("AssignTenant() of a missing user error = %v, want %v", err, ErrUserNotFound)
+	}
+}
+
+// duplicateEmailConn fails writes to users the way PostgreSQL does when
+// the email belongs to another user
+type duplicateEmailConn struct {
+	queryer
+}
+
+func (c duplicateEmailConn) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	if strings.HasPrefix(query, "UPDATE users") {
+		return nil, &pq.Error{Code: "23505", Constraint: "users_email_key"}
+	}
+	return c.queryer.ExecContext(ctx, query, args...)
+}
+
+func TestPostgresDB_UpdateUser_DuplicateEmail(t *testing.T) {
+	db := newTestPostgresDB(t)
+
+	user, _ := db.CreateUser("user@example.com", "password123", "Test User", "user")
+	db.conn = duplicateEmailConn{db.conn}
+
+	if err := db.UpdateUser(user.ID, "Test User", "taken@example.com"); !errors.Is(err, ErrUserAlreadyExists) {
+		t.Errorf("UpdateUser() to a taken email error = %v, want %v", err, ErrUserAlreadyExists)
+	}
+}
+
+func TestPostgresDB_RefreshToken_Create(t *testing.T) {
+	db := newTestPostgresDB(t)
+
+	expiresAt := time.Now().Add(1 * time.Hour)
+	token, err := db.CreateRefreshToken("test-user", "test-token", expiresAt)
+	if err != nil {
+		t.Fatalf("CreateRefreshToken() error = %v", err)
+	}
+
+	if token.ID == "" {
+		t.Error("Token ID is empty")
+	}
+	if token.UserID != "test-user" || token.Token != "test-token" || token.Revoked {
+		t.Errorf("CreateRefreshToken() = %+v, want an active token of test-user", token)
+	}
+
+	if _, err := db.CreateRefreshToken("test-user", "test-token", expiresAt); err == nil {
+		t.Error("CreateRefreshToken() with a duplicate token error = nil")
+	}
+}
+
+func TestPostgresDB_RefreshToken_GetAndValidate(t *testing.T) {
+	db := newTestPostgresDB(t)
+
+	created, _ := db.CreateRefreshToken("test-user", "test-token", time.Now().Add(1*time.Hour))
+
+	token, err := db.GetRefreshToken("test-token")
+	if err != nil {
+		t.Fatalf("GetRefreshToken() error = %v", err)
+	}
+	if token.ID != created.ID || token.UserID != "test-user" {
+		t.Errorf("GetRefreshToken() = %+v, want %+v", token, created)
+	}
+
+	if _, err := db.GetRefreshToken("nonexistent"); !errors.Is(err, ErrTokenNotFound) {
+		t.Errorf("GetRefreshToken() of an unknown token error = %v, want %v", err, ErrTokenNotFound)
+	}
+}
+
+func TestPostgresDB_RefreshToken_Expired(t *testing.T) {
+	db := newTestPostgresDB(t)
+
+	db.CreateRefreshToken("test-user", "expired-token", time.Now().Add(-1*time.Hour))
+
+	if _, err := db.GetRefreshToken("expired-token"); !errors.Is(err, ErrTokenExpired) {
+		t.Errorf("GetRefreshToken() error = %v, want %v", err, ErrTokenExpired)
+	}
+}
+
+func TestPostgresDB_RefreshToken_Revoke(t *testing.T) {
+	db := newTestPostgresDB(t)
+
+	db.CreateRefreshToken("test-user", "test-token", time.Now().Add(1*time.Hour))
+
+	if err := db.RevokeRefreshToken("test-token"); err != nil {
+		t.Fatalf("RevokeRefreshToken() error = %v", err)
+	}
+
+	// The owner of a revoked token is still reported
+	token, err := db.GetRefreshToken("test-token")
+	if !errors.Is(err, ErrTokenRevoked) || token == nil || token.UserID != "test-user" {
+		t.Errorf("GetRefreshToken() = %+v, %v, want the token of test-user and %v", token, err, ErrTokenRevoked)
+	}
+
+	// Only the first revocation succeeds
+	if err := db.RevokeRefreshToken("test-token"); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("RevokeRefreshToken() of a revoked token error = %v, want %v", err, ErrTokenRevoked)
+	}
+
+	if err := db.RevokeRefreshToken("nonexistent"); !errors.Is(err, ErrTokenNotFound) {
+		t.Errorf("RevokeRefreshToken() of an unknown token error = %v, want %v", err, ErrTokenNotFound)
+	}
+}
+
+func TestPostgresDB_RefreshToken_Rotate(t *testing.T) {
+	db := newTestPostgresDB(t)
+
+	expiresAt := time.Now().Add(1 * time.Hour)
+	db.CreateRefreshToken("test-user", "rotated", expiresAt)
+	db.CreateRefreshToken("test-user", "revoked", expiresAt)
+
+	if err := db.RotateRefreshToken("rotated"); err != nil {
+		t.Fatalf("RotateRefreshToken() error = %v", err)
+	}
+	db.RevokeRefreshToken("revoked")
+
+	token, err := db.GetRefreshToken("rotated")
+	if !errors.Is(err, ErrTokenRevoked) || token == nil || !token.Rotated {
+		t.Errorf("GetRefreshToken() of a rotated token = %+v, %v, want it rotated and %v", token, err, ErrTokenRevoked)
+	}
+	if token, _ := db.GetRefreshToken("revoked"); token == nil || token.Rotated {
+		t.Errorf("GetRefreshToken() of a revoked token = %+v, want it not rotated", token)
+	}
+
+	// A token can't be rotated once revoked, by either means
+	for _, token := range []string{"rotated", "revoked"} {
+		if err := db.RotateRefreshToken(token); !errors.Is(err, ErrTokenRevoked) {
+			t.Errorf("RotateRefreshToken(%q) error = %v, want %v", token, err, ErrTokenRevoked)
+		}
+	}
+	if token, _ := db.GetRefreshToken("revoked"); token == nil || token.Rotated {
+		t.Errorf("GetRefreshToken() after a failed rotation = %+v, want it not rotated", token)
+	}
+}
+
+func TestPostgresDB_RefreshToken_RevokeAll(t *testing.T) {
+	db := newTestPostgresDB(t)
+
+	expiresAt := time.Now().Add(1 * time.Hour)
+	db.CreateRefreshToken("test-user", "token1", expiresAt)
+	db.CreateRefreshToken("test-user", "token2", expiresAt)
+	db.CreateRefreshToken("other-user", "token3", expiresAt)
+
+	if err := db.RevokeAllUserTokens("test-user"); err != nil {
+		t.Fatalf("RevokeAllUserTokens() error = %v", err)
+	}
+
+	for _, token := range []string{"token1", "token2"} {
+		if _, err := db.GetRefreshToken(token); !errors.Is(err, ErrTokenRevoked) {
+			t.Errorf("GetRefreshToken(%q) error = %v, want %v", token, err, ErrTokenRevoked)
+		}
+	}
+	if _, err := db.GetRefreshToken("token3"); err != nil {
+		t.Errorf("token3 should not be revoked, error = %v", err)
+	}
+}
+
+func TestPostgresDB_RefreshToken_ListUserTokens(t *testing.T) {
+	db := newTestPostgresDB(t)
+
+	expiresAt := time.Now().Add(1 * time.Hour)
+	db.CreateRefreshToken("test-user", "token1", expiresAt)
+	db.CreateRefreshToken("test-user", "token2", expiresAt)
+	db.CreateRefreshToken("test-user", "revoked", expiresAt)
+	db.RevokeRefreshToken("revoked")
+	db.CreateRefreshToken("test-user", "expired", time.Now().Add(-1*time.Hour))
+	db.CreateRefreshToken("other-user", "token3", expiresAt)
+
+	tokens, err := db.ListUserTokens("test-user")
+	if err != nil {
+		t.Fatalf("ListUserTokens() error = %v", err)
+	}
+
+	// Only active tokens are listed, newest first
+	if len(tokens) != 2 || tokens[0].Token != "token2" || tokens[1].Token != "token1" {
+		t.Errorf("ListUserTokens() = %v, want token2 and token1", tokens)
+	}
+}
+
+func TestPostgresDB_RefreshToken_Cleanup(t *testing.T) {
+	db := newTestPostgresDB(t)
+
+	db.CreateRefreshToken("test-user", "expired1", time.Now().Add(-1*time.Hour))
+	db.CreateRefreshToken("test-user", "expired2", time.Now().Add(-2*time.Hour))
+	db.CreateRefreshToken("test-user", "valid", time.Now().Add(1*time.Hour))
+
+	if err := db.CleanupExpiredTokens(); err != nil {
+		t.Fatalf("CleanupExpiredTokens() error = %v", err)
+	}
+
+	for _, token := range []string{"expired1", "expired2"} {
+		if _, err := db.GetRefreshToken(token); !errors.Is(err, ErrTokenNotFound) {
+			t.Errorf("GetRefreshToken(%q) after cleanup error = %v, want %v", token, err, ErrTokenNotFound)
+		}
+	}
+	if _, err := db.GetRefreshToken("valid"); err != nil {
+		t.Errorf("valid token should remain after cleanup, error = %v", err)
+	}
+}
@@ -0,0 +1,167 @@
+package email
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"sync"
+	"time"
+)
+
+// dialTimeout bounds connecting to the SMTP server, up to and including
+// authentication, so an unresponsive server can't hang a send. It is a
+// variable so tests can shorten it.
+var dialTimeout = 10 * time.Second
+
+// smtpClient sends messages over a single SMTP connection that it keeps
+// open between sends. The connection is opened on first use and opened
+// again if the server has closed it.
+type smtpClient struct {
+	config EmailConfig
+
+	mu     sync.Mutex
+	client *smtp.Client
+}
+
+func newSMTPClient(config EmailConfig) *smtpClient {
+	return &smtpClient{config: config}
+}
+
+// connect dials the server, upgrades the connection with STARTTLS when the
+// server offers it and authenticates if credentials are configured
+func (c *smtpClient) connect() error {
+	addr := net.JoinHostPort(c.config.SMTPHost, c.config.SMTPPort)
+	conn, err := net.DialTimeout("tcp", addr, dialTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to connect to SMTP server: %w", err)
+	}
+
+	// A server may accept the connection and never greet, so the rest of
+	// the handshake is bounded too
+	conn.SetDeadline(time.Now().Add(dialTimeout))
+	client, err := smtp.NewClient(conn, c.config.SMTPHost)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to connect to SMTP server: %w", err)
+	}
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		err := client.StartTLS(&tls.Config{
+			ServerName:         c.config.SMTPHost,
+			InsecureSkipVerify: c.config.InsecureSkipVerify,
+		})
+		if err != nil {
+			client.Close()
+			return fmt.Errorf("failed to start TLS: %w", err)
+		}
+	}
+
+	if c.config.SMTPUsername != "" {
+		// PlainAuth refuses to send credentials over an unencrypted
+		// connection to anything but localhost
+		auth := smtp.PlainAuth("", c.config.SMTPUsername, c.config.SMTPPassword, c.config.SMTPHost)
+		if err := client.Auth(auth); err != nil {
+			client.Close()
+			return fmt.Errorf("failed to authenticate: %w", err)
+		}
+	}
+
+	conn.SetDeadline(time.Time{})
+	c.client = client
+	return nil
+}
+
+// send delivers body from from to every address in to
+func (c *smtpClient) send(from string, to []string, body []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.client == nil {
+		if err := c.connect(); err != nil {
+			return err
+		}
+	}
+
+	err := c.client.Mail(from)
+	if err != nil && connectionLost(err) {
+		// The server closed the idle connection; nothing was sent on it,
+		// so start over on a new one
+		c.closeClient()
+		if err := c.connect(); err != nil {
+			return err
+		}
+		err = c.client.Mail(from)
+	}
+	if err == nil {
+		err = c.deliver(to, body)
+	}
+
+	if err != nil {
+		if connectionLost(err) {
+			c.closeClient()
+		} else if c.client.Reset() != nil {
+			// Clear the failed transaction so the connection can be reused
+			c.closeClient()
+		}
+		return err
+	}
+
+	return nil
+}
+
+// deliver sends the recipients and data of a transaction started with MAIL
+func (c *smtpClient) deliver(to []string, body []byte) error {
+	for _, recipient := range to {
+		if err := c.client.Rcpt(recipient); err != nil {
+			return fmt.Errorf("recipient %s rejected: %w", recipient, err)
+		}
+	}
+
+	w, err := c.client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(body); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// connectionLost reports whether err means the connection can't be used
+// anymore, rather than that the server refused a command
+func connectionLost(err error) bool {
+	var reply *textproto.Error
+	if errors.As(err, &reply) {
+		// 421: the server is closing the connection
+		return reply.Code == 421
+	}
+	return true
+}
+
+func (c *smtpClient) closeClient() {
+	if c.client != nil {
+		c.client.Close()
+		c.client = nil
+	}
+}
+
+// Close ends the session and closes the connection
+func (c *smtpClient) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.client == nil {
+		return nil
+	}
+
+	err := c.client.Quit()
+	if err != nil {
+		c.client.Close()
+	}
+	c.client = nil
+	return err
+}
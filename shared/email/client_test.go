@@ -0,0 +1,256 @@
+package email
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"math/big"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// stubSMTPServer is a minimal SMTP server that accepts every message and
+// offers STARTTLS with a self-signed certificate
+type stubSMTPServer struct {
+	listener  net.Listener
+	tlsConfig *tls.Config
+
+	mu       sync.Mutex
+	conns    []net.Conn
+	messages []string
+	tls      int // Connections upgraded with STARTTLS
+}
+
+func newStubSMTPServer(t *testing.T) *stubSMTPServer {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+
+	s := &stubSMTPServer{
+		listener:  listener,
+		tlsConfig: &tls.Config{Certificates: []tls.Certificate{selfSignedCert(t)}},
+	}
+	go s.serve()
+	t.Cleanup(func() {
+		listener.Close()
+		s.dropConnections()
+	})
+
+	return s
+}
+
+func selfSignedCert(t *testing.T) tls.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func (s *stubSMTPServer) addr() (string, string) {
+	host, port, _ := net.SplitHostPort(s.listener.Addr().String())
+	return host, port
+}
+
+func (s *stubSMTPServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		s.conns = append(s.conns, conn)
+		s.mu.Unlock()
+
+		go s.handle(conn)
+	}
+}
+
+func (s *stubSMTPServer) handle(conn net.Conn) {
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	reply := func(line string) {
+		conn.Write([]byte(line + "\r\n"))
+	}
+
+	reply("220 stub ESMTP")
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		command := strings.ToUpper(strings.Fields(line + " x")[0])
+
+		switch command {
+		case "EHLO":
+			if _, ok := conn.(*tls.Conn); ok {
+				reply("250 stub")
+			} else {
+				reply("250-stub")
+				reply("250 STARTTLS")
+			}
+		case "STARTTLS":
+			reply("220 ready")
+			tlsConn := tls.Server(conn, s.tlsConfig)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			conn, reader = tlsConn, bufio.NewReader(tlsConn)
+
+			s.mu.Lock()
+			s.tls++
+			s.mu.Unlock()
+		case "DATA":
+			reply("354 go ahead")
+			var data strings.Builder
+			for {
+				line, err := reader.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				data.WriteString(line)
+			}
+
+			s.mu.Lock()
+			s.messages = append(s.messages, data.String())
+			s.mu.Unlock()
+			reply("250 queued")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 ok")
+		}
+	}
+}
+
+// dropConnections closes every open connection, as a server restart would
+func (s *stubSMTPServer) dropConnections() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, conn := range s.conns {
+		conn.Close()
+	}
+}
+
+func (s *stubSMTPServer) stats() (conns, tls, messages int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.conns), s.tls, len(s.messages)
+}
+
+func TestEmailService_SendBatch(t *testing.T) {
+	server := newStubSMTPServer(t)
+	host, port := server.addr()
+
+	service := NewEmailServiceWithConfig(EmailConfig{
+		SMTPHost:           host,
+		SMTPPort:           port,
+		FromEmail:          "noreply@example.com",
+		FromName:           "Marimo",
+		InsecureSkipVerify: true, // The stub's certificate is self-signed
+	})
+	defer service.Close()
+
+	batch := []EmailMessage{
+		{To: []string{"a@example.com"}, Subject: "First", Body: "1"},
+		{To: []string{"b@example.com"}, Subject: "Second", Body: "2"},
+		{To: []string{"c@example.com"}, Subject: "Third", Body: "3"},
+	}
+	for i, err := range service.SendBatch(batch) {
+		if err != nil {
+			t.Errorf("SendBatch() error for message %d = %v", i, err)
+		}
+	}
+
+	if conns, tls, messages := server.stats(); conns != 1 || tls != 1 || messages != 3 {
+		t.Errorf("server saw %d connections (%d with TLS) and %d messages, want 1, 1 and 3", conns, tls, messages)
+	}
+
+	// A dropped connection is replaced on the next send
+	server.dropConnections()
+	if err := service.SendEmail(batch[0]); err != nil {
+		t.Fatalf("SendEmail() after a disconnect error = %v", err)
+	}
+	if conns, _, messages := server.stats(); conns != 2 || messages != 4 {
+		t.Errorf("server saw %d connections and %d messages, want 2 and 4", conns, messages)
+	}
+}
+
+func TestEmailService_VerifiesCertificate(t *testing.T) {
+	server := newStubSMTPServer(t)
+	host, port := server.addr()
+
+	service := NewEmailServiceWithConfig(EmailConfig{SMTPHost: host, SMTPPort: port, FromEmail: "noreply@example.com"})
+	defer service.Close()
+
+	if err := service.SendEmail(EmailMessage{To: []string{"a@example.com"}, Body: "hi"}); err == nil {
+		t.Error("SendEmail() to a server with an untrusted certificate error = nil")
+	}
+}
+
+func TestEmailService_DialTimeout(t *testing.T) {
+	defer func(timeout time.Duration) { dialTimeout = timeout }(dialTimeout)
+	dialTimeout = 50 * time.Millisecond
+
+	// Accept connections but never greet
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	service := NewEmailServiceWithConfig(EmailConfig{SMTPHost: host, SMTPPort: port, FromEmail: "noreply@example.com"})
+	defer service.Close()
+
+	sent := make(chan error, 1)
+	go func() {
+		sent <- service.SendEmail(EmailMessage{To: []string{"a@example.com"}, Body: "hi"})
+	}()
+
+	select {
+	case err := <-sent:
+		if err == nil {
+			t.Error("SendEmail() to a server that never greets error = nil")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("SendEmail() to a server that never greets didn't time out")
+	}
+}
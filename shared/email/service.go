@@ -2,11 +2,19 @@ package email
 
 import (
 	"bytes"
+	"encoding/base64"
 	"fmt"
 	"html/template"
+	"io"
 	"log"
-	"net/smtp"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"net/textproto"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 )
 
 // EmailConfig holds SMTP configuration
@@ -17,30 +25,49 @@ type EmailConfig struct {
 	SMTPPassword string
 	FromEmail    string
 	FromName     string
+
+	// InsecureSkipVerify accepts any certificate during STARTTLS. Only use
+	// it in development, e.g. with a local mail catcher.
+	InsecureSkipVerify bool
 }
 
-// EmailService handles email sending
+// EmailService handles email sending. It keeps one connection to the SMTP
+// server open between emails; call Close when done with it.
 type EmailService struct {
 	config EmailConfig
+	client *smtpClient
 }
 
 // NewEmailService creates a new email service
 func NewEmailService() *EmailService {
+	insecureSkipVerify, _ := strconv.ParseBool(getEnv("SMTP_INSECURE_SKIP_VERIFY", "false"))
+
+	return NewEmailServiceWithConfig(EmailConfig{
+		SMTPHost:           getEnv("SMTP_HOST", "smtp.gmail.com"),
+		SMTPPort:           getEnv("SMTP_PORT", "587"),
+		SMTPUsername:       getEnv("SMTP_USERNAME", ""),
+		SMTPPassword:       getEnv("SMTP_PASSWORD", ""),
+		FromEmail:          getEnv("FROM_EMAIL", "noreply@marimo.dev"),
+		FromName:           getEnv("FROM_NAME", "Marimo ERP"),
+		InsecureSkipVerify: insecureSkipVerify,
+	})
+}
+
+// NewEmailServiceWithConfig creates an email service with explicit settings
+func NewEmailServiceWithConfig(config EmailConfig) *EmailService {
 	return &EmailService{
-		config: EmailConfig{
-			SMTPHost:     getEnv("SMTP_HOST", "smtp.gmail.com"),
-			SMTPPort:     getEnv("SMTP_PORT", "587"),
-			SMTPUsername: getEnv("SMTP_USERNAME", ""),
-			SMTPPassword: getEnv("SMTP_PASSWORD", ""),
-			FromEmail:    getEnv("FROM_EMAIL", "noreply@marimo.dev"),
-			FromName:     getEnv("FROM_NAME", "Marimo ERP"),
-		},
+		config: config,
+		client: newSMTPClient(config),
 	}
 }
 
-// EmailMessage represents an email to send
+// EmailMessage represents an email to send. If both Body and HTMLBody are
+// set, clients choose which one to show. Addresses may include a display
+// name, e.g. "Jane Doe <jane@example.com>".
 type EmailMessage struct {
 	To          []string
+	CC          []string
+	BCC         []string // Not listed in the headers
 	Subject     string
 	Body        string
 	HTMLBody    string
@@ -49,43 +76,228 @@ type EmailMessage struct {
 
 // Attachment represents an email attachment
 type Attachment struct {
-	Filename string
-	Content  []byte
+	Filename    string
+	Content     []byte
+	ContentType string // Guessed from Filename if empty
 }
 
 // SendEmail sends an email using SMTP
 func (es *EmailService) SendEmail(msg EmailMessage) error {
-	// Build email headers
-	from := fmt.Sprintf("%s <%s>", es.config.FromName, es.config.FromEmail)
+	recipients, err := msg.envelope()
+	if err != nil {
+		return err
+	}
 
-	// Create message
-	var body bytes.Buffer
-	body.WriteString(fmt.Sprintf("From: %s\r\n", from))
-	body.WriteString(fmt.Sprintf("To: %s\r\n", msg.To[0]))
-	body.WriteString(fmt.Sprintf("Subject: %s\r\n", msg.Subject))
-	body.WriteString("MIME-Version: 1.0\r\n")
-
-	if msg.HTMLBody != "" {
-		body.WriteString("Content-Type: text/html; charset=UTF-8\r\n")
-		body.WriteString("\r\n")
-		body.WriteString(msg.HTMLBody)
-	} else {
-		body.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
-		body.WriteString("\r\n")
-		body.WriteString(msg.Body)
-	}
-
-	// SMTP authentication
-	auth := smtp.PlainAuth("", es.config.SMTPUsername, es.config.SMTPPassword, es.config.SMTPHost)
-
-	// Send email
-	addr := fmt.Sprintf("%s:%s", es.config.SMTPHost, es.config.SMTPPort)
-	err := smtp.SendMail(addr, auth, es.config.FromEmail, msg.To, body.Bytes())
+	body, err := es.buildMessage(msg)
 	if err != nil {
+		return fmt.Errorf("failed to build email: %w", err)
+	}
+
+	if err := es.client.send(es.config.FromEmail, recipients, body); err != nil {
 		return fmt.Errorf("failed to send email: %w", err)
 	}
 
-	log.Printf("Email sent successfully to %v", msg.To)
+	log.Printf("Email sent successfully to %v", recipients)
+	return nil
+}
+
+// SendBatch sends several emails over the same connection. The returned
+// slice holds the error for each message, nil if it was sent.
+func (es *EmailService) SendBatch(msgs []EmailMessage) []error {
+	errs := make([]error, len(msgs))
+	for i, msg := range msgs {
+		errs[i] = es.SendEmail(msg)
+	}
+	return errs
+}
+
+// Close closes the connection to the SMTP server
+func (es *EmailService) Close() error {
+	return es.client.Close()
+}
+
+// envelope returns the addresses to deliver msg to: every To, CC and BCC
+// recipient, without display names
+func (msg EmailMessage) envelope() ([]string, error) {
+	var recipients []string
+	for _, list := range [][]string{msg.To, msg.CC, msg.BCC} {
+		addresses, err := parseAddresses(list)
+		if err != nil {
+			return nil, err
+		}
+		for _, address := range addresses {
+			recipients = append(recipients, address.Address)
+		}
+	}
+
+	if len(recipients) == 0 {
+		return nil, fmt.Errorf("email has no recipients")
+	}
+	return recipients, nil
+}
+
+func parseAddresses(list []string) ([]*mail.Address, error) {
+	addresses := make([]*mail.Address, 0, len(list))
+	for _, s := range list {
+		address, err := mail.ParseAddress(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid email address %q: %w", s, err)
+		}
+		addresses = append(addresses, address)
+	}
+	return addresses, nil
+}
+
+// addressHeader formats addresses for a To or Cc header
+func addressHeader(list []string) (string, error) {
+	addresses, err := parseAddresses(list)
+	if err != nil {
+		return "", err
+	}
+
+	formatted := make([]string, len(addresses))
+	for i, address := range addresses {
+		formatted[i] = address.String()
+	}
+	return strings.Join(formatted, ", "), nil
+}
+
+// buildMessage renders msg with its headers. Messages with attachments are
+// sent as multipart/mixed, with the body as the first part. A message
+// with only BCC recipients has no To header.
+func (es *EmailService) buildMessage(msg EmailMessage) ([]byte, error) {
+	from := fmt.Sprintf("%s <%s>", es.config.FromName, es.config.FromEmail)
+
+	var buf bytes.Buffer
+	buf.WriteString(fmt.Sprintf("From: %s\r\n", from))
+
+	// BCC recipients are only part of the envelope
+	for _, header := range []struct {
+		name string
+		list []string
+	}{{"To", msg.To}, {"Cc", msg.CC}} {
+		if len(header.list) == 0 {
+			continue
+		}
+		value, err := addressHeader(header.list)
+		if err != nil {
+			return nil, err
+		}
+		buf.WriteString(fmt.Sprintf("%s: %s\r\n", header.name, value))
+	}
+
+	buf.WriteString(fmt.Sprintf("Subject: %s\r\n", msg.Subject))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+
+	contentType, content, err := renderBody(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(msg.Attachments) == 0 {
+		buf.WriteString(fmt.Sprintf("Content-Type: %s\r\n", contentType))
+		buf.WriteString("\r\n")
+		buf.Write(content)
+		return buf.Bytes(), nil
+	}
+
+	mixed := multipart.NewWriter(&buf)
+	buf.WriteString(fmt.Sprintf("Content-Type: %s\r\n",
+		mime.FormatMediaType("multipart/mixed", map[string]string{"boundary": mixed.Boundary()})))
+	buf.WriteString("\r\n")
+
+	part, err := mixed.CreatePart(textproto.MIMEHeader{"Content-Type": {contentType}})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := part.Write(content); err != nil {
+		return nil, err
+	}
+
+	for _, attachment := range msg.Attachments {
+		part, err := mixed.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {attachmentType(attachment)},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition": {mime.FormatMediaType("attachment",
+				map[string]string{"filename": attachment.Filename})},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := writeBase64(part, attachment.Content); err != nil {
+			return nil, fmt.Errorf("failed to encode attachment %s: %w", attachment.Filename, err)
+		}
+	}
+
+	if err := mixed.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// renderBody returns the Content-Type and content of msg's body: plain
+// text, HTML, or both as multipart/alternative
+func renderBody(msg EmailMessage) (string, []byte, error) {
+	const (
+		textType = "text/plain; charset=UTF-8"
+		htmlType = "text/html; charset=UTF-8"
+	)
+
+	switch {
+	case msg.HTMLBody == "":
+		return textType, []byte(msg.Body), nil
+	case msg.Body == "":
+		return htmlType, []byte(msg.HTMLBody), nil
+	}
+
+	// Parts go from least to most preferred
+	var buf bytes.Buffer
+	alternative := multipart.NewWriter(&buf)
+	for _, body := range []struct{ contentType, content string }{
+		{textType, msg.Body},
+		{htmlType, msg.HTMLBody},
+	} {
+		part, err := alternative.CreatePart(textproto.MIMEHeader{"Content-Type": {body.contentType}})
+		if err != nil {
+			return "", nil, err
+		}
+		if _, err := io.WriteString(part, body.content); err != nil {
+			return "", nil, err
+		}
+	}
+	if err := alternative.Close(); err != nil {
+		return "", nil, err
+	}
+
+	contentType := mime.FormatMediaType("multipart/alternative", map[string]string{"boundary": alternative.Boundary()})
+	return contentType, buf.Bytes(), nil
+}
+
+// attachmentType returns an attachment's Content-Type, guessing it from
+// the file extension if it isn't set
+func attachmentType(attachment Attachment) string {
+	if attachment.ContentType != "" {
+		return attachment.ContentType
+	}
+	if contentType := mime.TypeByExtension(filepath.Ext(attachment.Filename)); contentType != "" {
+		return contentType
+	}
+	return "application/octet-stream"
+}
+
+// writeBase64 writes data base64 encoded in lines of 76 characters, the
+// most MIME allows
+func writeBase64(w io.Writer, data []byte) error {
+	const lineLength = 76
+
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 0 {
+		n := min(lineLength, len(encoded))
+		if _, err := io.WriteString(w, encoded[:n]+"\r\n"); err != nil {
+			return err
+		}
+		encoded = encoded[n:]
+	}
 	return nil
 }
 
@@ -108,6 +320,27 @@ func (es *EmailService) SendWelcomeEmail(to, name string) error {
 	})
 }
 
+// SendVerificationEmail sends the link that confirms a new user's email
+// address
+func (es *EmailService) SendVerificationEmail(to, name, verifyLink string) error {
+	tmpl := template.Must(template.New("verify").Parse(verificationTemplate))
+
+	var body bytes.Buffer
+	err := tmpl.Execute(&body, map[string]string{
+		"Name":       name,
+		"VerifyLink": verifyLink,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to execute template: %w", err)
+	}
+
+	return es.SendEmail(EmailMessage{
+		To:       []string{to},
+		Subject:  "Verify your email address",
+		HTMLBody: body.String(),
+	})
+}
+
 // SendPasswordResetEmail sends a password reset email
 func (es *EmailService) SendPasswordResetEmail(to, resetLink string) error {
 	tmpl := template.Must(template.New("reset").Parse(passwordResetTemplate))
@@ -184,6 +417,40 @@ const welcomeTemplate = `
 </html>
 `
 
+const verificationTemplate = `
+<!DOCTYPE html>
+<html>
+<head>
+    <style>
+        body { font-family: Arial, sans-serif; line-height: 1.6; color: #333; }
+        .container { max-width: 600px; margin: 0 auto; padding: 20px; }
+        .header { background: linear-gradient(135deg, #667eea 0%, #764ba2 100%); color: white; padding: 30px; text-align: center; border-radius: 10px 10px 0 0; }
+        .content { background: #f9f9f9; padding: 30px; border-radius: 0 0 10px 10px; }
+        .button { display: inline-block; padding: 12px 30px; background: #667eea; color: white; text-decoration: none; border-radius: 5px; margin-top: 20px; }
+        .footer { text-align: center; margin-top: 30px; color: #666; font-size: 12px; }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <div class="header">
+            <h1>Verify Your Email</h1>
+        </div>
+        <div class="content">
+            <h2>Hello {{.Name}}!</h2>
+            <p>Please confirm that this is your email address by clicking the button below:</p>
+            <a href="{{.VerifyLink}}" class="button">Verify Email</a>
+            <p>This link will expire in 24 hours. If you didn't create a Marimo ERP account, you can ignore this email.</p>
+            <p>If the button doesn't work, copy and paste this link into your browser:</p>
+            <p style="word-break: break-all; color: #667eea;">{{.VerifyLink}}</p>
+        </div>
+        <div class="footer">
+            <p>© 2024 Marimo ERP. All rights reserved.</p>
+        </div>
+    </div>
+</body>
+</html>
+`
+
 const passwordResetTemplate = `
 <!DOCTYPE html>
 <html>
@@ -0,0 +1,190 @@
+package email
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+func newTestService() *EmailService {
+	return NewEmailServiceWithConfig(EmailConfig{
+		SMTPHost:  "localhost",
+		SMTPPort:  "25",
+		FromEmail: "noreply@example.com",
+		FromName:  "Marimo",
+	})
+}
+
+type mimePart struct {
+	header  textproto.MIMEHeader
+	content []byte
+}
+
+// readParts parses a multipart body of the given Content-Type
+func readParts(t *testing.T, contentType string, body io.Reader) []mimePart {
+	t.Helper()
+
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		t.Fatalf("ParseMediaType(%q) error = %v", contentType, err)
+	}
+
+	var parts []mimePart
+	reader := multipart.NewReader(body, params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return parts
+		}
+		if err != nil {
+			t.Fatalf("NextPart() error = %v", err)
+		}
+
+		content, err := io.ReadAll(part)
+		if err != nil {
+			t.Fatalf("failed to read part: %v", err)
+		}
+		parts = append(parts, mimePart{header: part.Header, content: content})
+	}
+}
+
+func TestEmailService_BuildMessageWithAttachments(t *testing.T) {
+	pdf := []byte("%PDF-1.4\x00\x01\x02\xff binary report content that spans more than one base64 line")
+
+	raw, err := newTestService().buildMessage(EmailMessage{
+		To:       []string{"user@example.com"},
+		Subject:  "Monthly report",
+		Body:     "Your report is attached.",
+		HTMLBody: "<p>Your report is attached.</p>",
+		Attachments: []Attachment{
+			{Filename: "report 2024.pdf", Content: pdf},
+			{Filename: "data.bin", Content: []byte{0, 1, 2}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("buildMessage() error = %v", err)
+	}
+
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("ReadMessage() error = %v", err)
+	}
+	if subject := msg.Header.Get("Subject"); subject != "Monthly report" {
+		t.Errorf("Subject = %q, want Monthly report", subject)
+	}
+
+	parts := readParts(t, msg.Header.Get("Content-Type"), msg.Body)
+	if len(parts) != 3 {
+		t.Fatalf("message has %d parts, want the body and 2 attachments", len(parts))
+	}
+
+	// The body offers both text and HTML
+	bodies := readParts(t, parts[0].header.Get("Content-Type"), bytes.NewReader(parts[0].content))
+	if len(bodies) != 2 ||
+		string(bodies[0].content) != "Your report is attached." ||
+		string(bodies[1].content) != "<p>Your report is attached.</p>" {
+		t.Errorf("body parts = %+v, want text then HTML", bodies)
+	}
+
+	tests := []struct {
+		part        mimePart
+		filename    string
+		contentType string
+		content     []byte
+	}{
+		{parts[1], "report 2024.pdf", "application/pdf", pdf},
+		{parts[2], "data.bin", "application/octet-stream", []byte{0, 1, 2}},
+	}
+	for _, tt := range tests {
+		_, params, err := mime.ParseMediaType(tt.part.header.Get("Content-Disposition"))
+		if err != nil || params["filename"] != tt.filename {
+			t.Errorf("Content-Disposition = %q, want filename %q", tt.part.header.Get("Content-Disposition"), tt.filename)
+		}
+		if got := tt.part.header.Get("Content-Type"); got != tt.contentType {
+			t.Errorf("%s Content-Type = %q, want %q", tt.filename, got, tt.contentType)
+		}
+
+		content, err := io.ReadAll(base64.NewDecoder(base64.StdEncoding, bytes.NewReader(tt.part.content)))
+		if err != nil {
+			t.Errorf("failed to decode %s: %v", tt.filename, err)
+		}
+		if !bytes.Equal(content, tt.content) {
+			t.Errorf("%s content = %q, want %q", tt.filename, content, tt.content)
+		}
+	}
+}
+
+func TestEmailService_BuildMessageWithoutAttachments(t *testing.T) {
+	raw, err := newTestService().buildMessage(EmailMessage{
+		To:      []string{"user@example.com"},
+		Subject: "Hello",
+		Body:    "Plain text only",
+	})
+	if err != nil {
+		t.Fatalf("buildMessage() error = %v", err)
+	}
+
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("ReadMessage() error = %v", err)
+	}
+	if contentType := msg.Header.Get("Content-Type"); contentType != "text/plain; charset=UTF-8" {
+		t.Errorf("Content-Type = %q, want text/plain", contentType)
+	}
+	if body, _ := io.ReadAll(msg.Body); string(body) != "Plain text only" {
+		t.Errorf("body = %q, want Plain text only", body)
+	}
+}
+
+func TestEmailService_Recipients(t *testing.T) {
+	msg := EmailMessage{
+		To:      []string{"Jane Doe <jane@example.com>", "john@example.com"},
+		CC:      []string{"team@example.com"},
+		BCC:     []string{"audit@example.com", "Archive <archive@example.com>"},
+		Subject: "Quarterly results",
+		Body:    "See attached.",
+	}
+
+	envelope, err := msg.envelope()
+	if err != nil {
+		t.Fatalf("envelope() error = %v", err)
+	}
+	want := []string{"jane@example.com", "john@example.com", "team@example.com", "audit@example.com", "archive@example.com"}
+	if strings.Join(envelope, ",") != strings.Join(want, ",") {
+		t.Errorf("envelope() = %v, want %v", envelope, want)
+	}
+
+	raw, err := newTestService().buildMessage(msg)
+	if err != nil {
+		t.Fatalf("buildMessage() error = %v", err)
+	}
+	parsed, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("ReadMessage() error = %v", err)
+	}
+
+	to, err := parsed.Header.AddressList("To")
+	if err != nil || len(to) != 2 || to[0].Name != "Jane Doe" || to[0].Address != "jane@example.com" || to[1].Address != "john@example.com" {
+		t.Errorf("To = %v (error %v), want both To recipients", to, err)
+	}
+	cc, err := parsed.Header.AddressList("Cc")
+	if err != nil || len(cc) != 1 || cc[0].Address != "team@example.com" {
+		t.Errorf("Cc = %v (error %v), want team@example.com", cc, err)
+	}
+	if bcc := parsed.Header.Get("Bcc"); bcc != "" || bytes.Contains(raw, []byte("audit@example.com")) {
+		t.Errorf("message reveals BCC recipients: %q", raw)
+	}
+
+	if _, err := (EmailMessage{To: []string{"not an address"}}).envelope(); err == nil {
+		t.Error("envelope() with an invalid address error = nil")
+	}
+	if _, err := (EmailMessage{}).envelope(); err == nil {
+		t.Error("envelope() without recipients error = nil")
+	}
+}
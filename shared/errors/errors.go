@@ -30,10 +30,13 @@ const (
 	ErrInvalidCredentials  ErrorCode = "INVALID_CREDENTIALS"
 	ErrTokenExpired        ErrorCode = "TOKEN_EXPIRED"
 	ErrTokenInvalid        ErrorCode = "TOKEN_INVALID"
+	ErrTokenReuse          ErrorCode = "POSSIBLE_TOKEN_THEFT"
+	ErrEmailNotVerified    ErrorCode = "EMAIL_NOT_VERIFIED"
 	ErrDuplicateResource   ErrorCode = "DUPLICATE_RESOURCE"
 	ErrTenantNotFound      ErrorCode = "TENANT_NOT_FOUND"
 	ErrSubscriptionExpired ErrorCode = "SUBSCRIPTION_EXPIRED"
 	ErrFeatureNotAvailable ErrorCode = "FEATURE_NOT_AVAILABLE"
+	ErrQuotaExceeded       ErrorCode = "QUOTA_EXCEEDED"
 	ErrInsufficientPermissions ErrorCode = "INSUFFICIENT_PERMISSIONS"
 )
 
@@ -100,7 +103,7 @@ func getStatusCode(code ErrorCode) int {
 		return http.StatusBadRequest
 	case ErrUnauthorized, ErrInvalidCredentials, ErrTokenExpired, ErrTokenInvalid:
 		return http.StatusUnauthorized
-	case ErrForbidden, ErrInsufficientPermissions, ErrFeatureNotAvailable:
+	case ErrForbidden, ErrInsufficientPermissions, ErrFeatureNotAvailable, ErrQuotaExceeded:
 		return http.StatusForbidden
 	case ErrNotFound, ErrTenantNotFound:
 		return http.StatusNotFound
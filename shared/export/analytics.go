@@ -0,0 +1,103 @@
+package export
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/dayanch951/marimo/shared/analytics"
+)
+
+// ErrNoQuery is returned when an analytics result has no query to derive
+// columns from
+var ErrNoQuery = errors.New("analytics result has no query")
+
+// ResultToExportData converts an analytics result into export data. There
+// is a column per dimension followed by one per metric, in query order,
+// and the query name becomes the title. Metric columns are typed as
+// numbers.
+func ResultToExportData(r *analytics.Result) (ExportData, error) {
+	if r == nil || r.Query == nil {
+		return ExportData{}, ErrNoQuery
+	}
+
+	var (
+		headers     []string
+		columns     []string
+		columnTypes []ColumnType
+	)
+	for _, dim := range r.Query.Dimensions {
+		headers = append(headers, dim.Name)
+		columns = append(columns, dim.Name)
+		columnTypes = append(columnTypes, ColumnString)
+	}
+	for _, metric := range r.Query.Metrics {
+		header := metric.Label
+		if header == "" {
+			header = metric.Name
+		}
+		headers = append(headers, header)
+		columns = append(columns, metric.Name)
+		columnTypes = append(columnTypes, ColumnNumber)
+	}
+
+	rows := make([][]string, 0, len(r.Data))
+	for _, record := range r.Data {
+		row := make([]string, len(columns))
+		for i, column := range columns {
+			row[i] = formatValue(record[column])
+		}
+		rows = append(rows, row)
+	}
+
+	return ExportData{
+		Headers:     headers,
+		Rows:        rows,
+		Title:       r.Query.Name,
+		ColumnTypes: columnTypes,
+	}, nil
+}
+
+// ExportResult exports an analytics result in the specified format
+func (es *ExportService) ExportResult(r *analytics.Result, format ExportFormat) ([]byte, string, error) {
+	data, err := ResultToExportData(r)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return es.Export(data, format)
+}
+
+// formatValue renders a database value as a cell. Dates without a time of
+// day are written as dates and fractional numbers are rounded to two
+// decimal places.
+func formatValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case time.Time:
+		if v.Hour() == 0 && v.Minute() == 0 && v.Second() == 0 && v.Nanosecond() == 0 {
+			return v.Format("2006-01-02")
+		}
+		return v.Format("2006-01-02 15:04:05")
+	case float64:
+		return formatFloat(v)
+	case float32:
+		return formatFloat(float64(v))
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func formatFloat(v float64) string {
+	if v == math.Trunc(v) {
+		return strconv.FormatFloat(v, 'f', 0, 64)
+	}
+	return strconv.FormatFloat(v, 'f', 2, 64)
+}
@@ -0,0 +1,69 @@
+package export
+
+import (
+	"bytes"
+	"encoding/csv"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/dayanch951/marimo/shared/analytics"
+)
+
+func TestExportResult_CSV(t *testing.T) {
+	result := &analytics.Result{
+		Query: &analytics.Query{
+			Name: "Revenue",
+			Dimensions: []analytics.Dimension{
+				{Name: "date", Field: "DATE(created_at)"},
+				{Name: "payment_method", Field: "payment_method"},
+			},
+			Metrics: []analytics.Metric{
+				{Name: "total_revenue", Type: analytics.MetricTypeSum, Field: "amount", Label: "Total Revenue"},
+				{Name: "transactions", Type: analytics.MetricTypeCount, Field: "*"},
+			},
+		},
+		Data: []map[string]interface{}{
+			{
+				"transactions":   int64(3),
+				"total_revenue":  1200.5,
+				"payment_method": "card",
+				"date":           time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+			},
+			{
+				"transactions":   int64(1),
+				"total_revenue":  float64(300),
+				"payment_method": nil,
+				"date":           time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC),
+			},
+		},
+	}
+
+	content, contentType, err := NewExportService().ExportResult(result, FormatCSV)
+	if err != nil {
+		t.Fatalf("ExportResult() error = %v", err)
+	}
+	if contentType != "text/csv" {
+		t.Errorf("content type = %q, want text/csv", contentType)
+	}
+
+	records, err := csv.NewReader(bytes.NewReader(content)).ReadAll()
+	if err != nil {
+		t.Fatalf("failed to read CSV: %v", err)
+	}
+
+	want := [][]string{
+		{"date", "payment_method", "Total Revenue", "transactions"},
+		{"2024-03-01", "card", "1200.50", "3"},
+		{"2024-03-02", "", "300", "1"},
+	}
+	if !reflect.DeepEqual(records, want) {
+		t.Errorf("CSV = %v, want %v", records, want)
+	}
+}
+
+func TestExportResult_NoQuery(t *testing.T) {
+	if _, _, err := NewExportService().ExportResult(&analytics.Result{}, FormatCSV); err != ErrNoQuery {
+		t.Errorf("ExportResult() error = %v, want ErrNoQuery", err)
+	}
+}
@@ -3,7 +3,10 @@ package export
 import (
 	"bytes"
 	"encoding/csv"
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/jung-kurt/gofpdf"
@@ -18,11 +21,34 @@ func NewExportService() *ExportService {
 	return &ExportService{}
 }
 
+// ColumnType is the kind of value in an export column
+type ColumnType string
+
+const (
+	ColumnString   ColumnType = "string"
+	ColumnNumber   ColumnType = "number"
+	ColumnDate     ColumnType = "date"     // "2006-01-02", optionally with " 15:04:05", or RFC 3339
+	ColumnCurrency ColumnType = "currency" // A number shown with two decimal places
+)
+
 // ExportData represents data to be exported
 type ExportData struct {
 	Headers []string
 	Rows    [][]string
 	Title   string
+
+	// ColumnTypes optionally gives the type of each column. Excel exports
+	// store numbers and dates as such so they can be sorted and used in
+	// formulas. Missing types and cells that don't parse are strings.
+	ColumnTypes []ColumnType
+}
+
+// columnType returns the type of column i
+func (d ExportData) columnType(i int) ColumnType {
+	if i < len(d.ColumnTypes) && d.ColumnTypes[i] != "" {
+		return d.ColumnTypes[i]
+	}
+	return ColumnString
 }
 
 // ExportToCSV exports data to CSV format
@@ -52,6 +78,10 @@ func (es *ExportService) ExportToCSV(data ExportData) ([]byte, error) {
 
 // ExportToExcel exports data to Excel format
 func (es *ExportService) ExportToExcel(data ExportData) ([]byte, error) {
+	return es.exportExcel(data, ExportOptions{})
+}
+
+func (es *ExportService) exportExcel(data ExportData, opts ExportOptions) ([]byte, error) {
 	f := excelize.NewFile()
 	defer f.Close()
 
@@ -66,8 +96,11 @@ func (es *ExportService) ExportToExcel(data ExportData) ([]byte, error) {
 		f.SetCellValue(sheetName, "A1", data.Title)
 
 		// Merge cells for title
-		endCol := string(rune('A' + len(data.Headers) - 1))
-		f.MergeCell(sheetName, "A1", fmt.Sprintf("%s1", endCol))
+		endCell, err := excelize.CoordinatesToCellName(max(len(data.Headers), 1), 1)
+		if err != nil {
+			return nil, fmt.Errorf("failed to merge title cells: %w", err)
+		}
+		f.MergeCell(sheetName, "A1", endCell)
 
 		// Style title
 		titleStyle, _ := f.NewStyle(&excelize.Style{
@@ -80,7 +113,7 @@ func (es *ExportService) ExportToExcel(data ExportData) ([]byte, error) {
 				Vertical:   "center",
 			},
 		})
-		f.SetCellStyle(sheetName, "A1", fmt.Sprintf("%s1", endCol), titleStyle)
+		f.SetCellStyle(sheetName, "A1", endCell, titleStyle)
 		f.SetRowHeight(sheetName, 1, 30)
 	}
 
@@ -113,50 +146,151 @@ func (es *ExportService) ExportToExcel(data ExportData) ([]byte, error) {
 	}
 
 	for i, header := range data.Headers {
-		cell := fmt.Sprintf("%s%d", string(rune('A'+i)), startRow)
+		cell, err := excelize.CoordinatesToCellName(i+1, startRow)
+		if err != nil {
+			return nil, fmt.Errorf("failed to write header %q: %w", header, err)
+		}
 		f.SetCellValue(sheetName, cell, header)
 		f.SetCellStyle(sheetName, cell, cell, headerStyle)
 	}
 
-	// Data style
-	dataStyle, _ := f.NewStyle(&excelize.Style{
-		Border: []excelize.Border{
-			{Type: "left", Color: "CCCCCC", Style: 1},
-			{Type: "top", Color: "CCCCCC", Style: 1},
-			{Type: "bottom", Color: "CCCCCC", Style: 1},
-			{Type: "right", Color: "CCCCCC", Style: 1},
-		},
-	})
+	// Data styles, by the kind of value in the cell
+	dataBorder := []excelize.Border{
+		{Type: "left", Color: "CCCCCC", Style: 1},
+		{Type: "top", Color: "CCCCCC", Style: 1},
+		{Type: "bottom", Color: "CCCCCC", Style: 1},
+		{Type: "right", Color: "CCCCCC", Style: 1},
+	}
+	rightAligned := &excelize.Alignment{Horizontal: "right"}
+	dateFormat, dateTimeFormat := "yyyy-mm-dd", "yyyy-mm-dd hh:mm:ss"
+
+	dataStyle, _ := f.NewStyle(&excelize.Style{Border: dataBorder})
+	numberStyle, _ := f.NewStyle(&excelize.Style{Border: dataBorder, Alignment: rightAligned})
+	currencyStyle, _ := f.NewStyle(&excelize.Style{Border: dataBorder, Alignment: rightAligned, NumFmt: 4}) // #,##0.00
+	dateStyle, _ := f.NewStyle(&excelize.Style{Border: dataBorder, Alignment: rightAligned, CustomNumFmt: &dateFormat})
+	dateTimeStyle, _ := f.NewStyle(&excelize.Style{Border: dataBorder, Alignment: rightAligned, CustomNumFmt: &dateTimeFormat})
 
 	// Write rows
 	for rowIdx, row := range data.Rows {
 		for colIdx, cell := range row {
-			cellRef := fmt.Sprintf("%s%d", string(rune('A'+colIdx)), startRow+rowIdx+1)
-			f.SetCellValue(sheetName, cellRef, cell)
-			f.SetCellStyle(sheetName, cellRef, cellRef, dataStyle)
+			cellRef, err := excelize.CoordinatesToCellName(colIdx+1, startRow+rowIdx+1)
+			if err != nil {
+				return nil, fmt.Errorf("failed to write row %d: %w", rowIdx+1, err)
+			}
+
+			value, style := interface{}(cell), dataStyle
+			switch columnType := data.columnType(colIdx); columnType {
+			case ColumnNumber, ColumnCurrency:
+				if n, err := strconv.ParseFloat(strings.ReplaceAll(cell, ",", ""), 64); err == nil {
+					value, style = n, numberStyle
+					if columnType == ColumnCurrency {
+						style = currencyStyle
+					}
+				}
+			case ColumnDate:
+				if t, hasTime, ok := parseDate(cell); ok {
+					value, style = t, dateStyle
+					if hasTime {
+						style = dateTimeStyle
+					}
+				}
+			}
+
+			f.SetCellValue(sheetName, cellRef, value)
+			f.SetCellStyle(sheetName, cellRef, cellRef, style)
 		}
 	}
 
 	// Auto-fit columns
 	for i := range data.Headers {
-		col := string(rune('A' + i))
+		col, err := excelize.ColumnNumberToName(i + 1)
+		if err != nil {
+			return nil, fmt.Errorf("failed to size column %d: %w", i+1, err)
+		}
 		f.SetColWidth(sheetName, col, col, 15)
 	}
 
 	f.SetActiveSheet(index)
 
-	// Save to buffer
-	buf, err := f.WriteToBuffer()
-	if err != nil {
+	var saveOptions []excelize.Options
+	if opts.Password != "" {
+		err := f.ProtectWorkbook(&excelize.WorkbookProtectionOptions{
+			Password:      opts.Password,
+			LockStructure: true,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to protect workbook: %w", err)
+		}
+		saveOptions = append(saveOptions, excelize.Options{Password: opts.Password})
+	}
+
+	// Save to buffer, encrypted if there is a password
+	var buf bytes.Buffer
+	if err := f.Write(&buf, saveOptions...); err != nil {
 		return nil, fmt.Errorf("failed to write Excel file: %w", err)
 	}
 
 	return buf.Bytes(), nil
 }
 
-// ExportToPDF exports data to PDF format
+// parseDate parses a date column cell, reporting whether it has a time of
+// day
+func parseDate(cell string) (time.Time, bool, bool) {
+	if t, err := time.Parse("2006-01-02", cell); err == nil {
+		return t, false, true
+	}
+	for _, layout := range []string{"2006-01-02 15:04:05", time.RFC3339} {
+		if t, err := time.Parse(layout, cell); err == nil {
+			return t, true, true
+		}
+	}
+	return time.Time{}, false, false
+}
+
+// PDF table layout, in mm
+const (
+	pdfHeaderLineHeight = 8
+	pdfRowLineHeight    = 7
+)
+
+// ExportToPDF exports data to PDF format. Rows that don't fit on a page
+// start a new one with the column headers repeated, and long cell text is
+// wrapped.
 func (es *ExportService) ExportToPDF(data ExportData) ([]byte, error) {
+	return es.exportPDF(data, ExportOptions{})
+}
+
+func (es *ExportService) exportPDF(data ExportData, opts ExportOptions) ([]byte, error) {
+	pdf := es.buildPDF(data)
+
+	if opts.Password != "" {
+		// An empty owner password is replaced with a random one, so the
+		// permissions can't be lifted
+		pdf.SetProtection(gofpdf.CnProtectPrint|gofpdf.CnProtectCopy, opts.Password, "")
+	}
+
+	// Output to buffer
+	var buf bytes.Buffer
+	err := pdf.Output(&buf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate PDF: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// buildPDF lays out data as a table
+func (es *ExportService) buildPDF(data ExportData) *gofpdf.Fpdf {
 	pdf := gofpdf.New("P", "mm", "A4", "")
+
+	// Rows are placed by hand so that a row is never split across pages
+	pdf.SetAutoPageBreak(false, 0)
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-15)
+		pdf.SetFont("Arial", "I", 8)
+		pdf.SetTextColor(128, 128, 128)
+		pdf.CellFormat(0, 10, fmt.Sprintf("Page %d", pdf.PageNo()), "", 0, "C", false, 0, "")
+	})
 	pdf.AddPage()
 
 	// Title
@@ -171,50 +305,76 @@ func (es *ExportService) ExportToPDF(data ExportData) ([]byte, error) {
 	pdf.CellFormat(0, 5, fmt.Sprintf("Generated: %s", time.Now().Format("2006-01-02 15:04:05")), "", 1, "L", false, 0, "")
 	pdf.Ln(5)
 
+	if len(data.Headers) == 0 {
+		return pdf
+	}
+
 	// Calculate column widths
-	pageWidth, _ := pdf.GetPageSize()
-	margins := pdf.GetMargins()
-	usableWidth := pageWidth - margins["left"] - margins["right"]
+	pageWidth, pageHeight := pdf.GetPageSize()
+	left, _, right, _ := pdf.GetMargins()
+	usableWidth := pageWidth - left - right
 	colWidth := usableWidth / float64(len(data.Headers))
 
-	// Headers
-	pdf.SetFont("Arial", "B", 11)
-	pdf.SetFillColor(79, 70, 229) // Primary color
-	pdf.SetTextColor(255, 255, 255)
+	// Leave room for the footer
+	bottom := pageHeight - 20
 
-	for _, header := range data.Headers {
-		pdf.CellFormat(colWidth, 8, header, "1", 0, "C", true, 0, "")
+	drawHeaders := func() {
+		pdf.SetFont("Arial", "B", 11)
+		pdf.SetFillColor(79, 70, 229) // Primary color
+		pdf.SetTextColor(255, 255, 255)
+		drawPDFRow(pdf, data.Headers, colWidth, pdfHeaderLineHeight, "C", true)
+
+		pdf.SetFont("Arial", "", 10)
+		pdf.SetFillColor(245, 245, 245)
+		pdf.SetTextColor(0, 0, 0)
 	}
-	pdf.Ln(-1)
+	drawHeaders()
 
 	// Rows
-	pdf.SetFont("Arial", "", 10)
-	pdf.SetFillColor(245, 245, 245)
-	pdf.SetTextColor(0, 0, 0)
-
 	fill := false
 	for _, row := range data.Rows {
-		for _, cell := range row {
-			pdf.CellFormat(colWidth, 7, cell, "1", 0, "L", fill, 0, "")
+		if pdf.GetY()+pdfRowHeight(pdf, row, colWidth, pdfRowLineHeight) > bottom {
+			pdf.AddPage()
+			drawHeaders()
 		}
-		pdf.Ln(-1)
+
+		drawPDFRow(pdf, row, colWidth, pdfRowLineHeight, "L", fill)
 		fill = !fill // Alternate row colors
 	}
 
-	// Footer
-	pdf.SetY(-15)
-	pdf.SetFont("Arial", "I", 8)
-	pdf.SetTextColor(128, 128, 128)
-	pdf.CellFormat(0, 10, fmt.Sprintf("Page %d", pdf.PageNo()), "", 0, "C", false, 0, "")
+	return pdf
+}
 
-	// Output to buffer
-	var buf bytes.Buffer
-	err := pdf.Output(&buf)
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate PDF: %w", err)
+// pdfRowHeight returns the height of a table row whose cells are wrapped
+// to colWidth in the current font
+func pdfRowHeight(pdf *gofpdf.Fpdf, cells []string, colWidth, lineHeight float64) float64 {
+	lines := 1
+	for _, cell := range cells {
+		lines = max(lines, len(pdf.SplitLines([]byte(cell), colWidth)))
 	}
+	return float64(lines) * lineHeight
+}
 
-	return buf.Bytes(), nil
+// drawPDFRow draws a table row at the current position, wrapping each
+// cell's text within its column, and moves to the start of the next row
+func drawPDFRow(pdf *gofpdf.Fpdf, cells []string, colWidth, lineHeight float64, align string, fill bool) {
+	height := pdfRowHeight(pdf, cells, colWidth, lineHeight)
+	x, y := pdf.GetXY()
+
+	style := "D"
+	if fill {
+		style = "FD"
+	}
+
+	for i, cell := range cells {
+		cellX := x + float64(i)*colWidth
+		pdf.Rect(cellX, y, colWidth, height, style)
+
+		pdf.SetXY(cellX, y)
+		pdf.MultiCell(colWidth, lineHeight, cell, "", align, false)
+	}
+
+	pdf.SetXY(x, y+height)
 }
 
 // ExportFormat represents export format
@@ -226,17 +386,37 @@ const (
 	FormatPDF   ExportFormat = "pdf"
 )
 
+// ErrProtectionUnsupported is returned when a password is given for a
+// format that can't be protected
+var ErrProtectionUnsupported = errors.New("export format can't be password protected")
+
+// ExportOptions changes how data is exported
+type ExportOptions struct {
+	// Password protects PDF and Excel exports: it is needed to open the
+	// file, and Excel workbooks have their structure locked
+	Password string
+}
+
 // Export exports data in the specified format
 func (es *ExportService) Export(data ExportData, format ExportFormat) ([]byte, string, error) {
+	return es.ExportWithOptions(data, format, ExportOptions{})
+}
+
+// ExportWithOptions exports data in the specified format with options such
+// as a password
+func (es *ExportService) ExportWithOptions(data ExportData, format ExportFormat, opts ExportOptions) ([]byte, string, error) {
 	switch format {
 	case FormatCSV:
+		if opts.Password != "" {
+			return nil, "", fmt.Errorf("%w: %s", ErrProtectionUnsupported, format)
+		}
 		content, err := es.ExportToCSV(data)
 		return content, "text/csv", err
 	case FormatExcel:
-		content, err := es.ExportToExcel(data)
+		content, err := es.exportExcel(data, opts)
 		return content, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", err
 	case FormatPDF:
-		content, err := es.ExportToPDF(data)
+		content, err := es.exportPDF(data, opts)
 		return content, "application/pdf", err
 	default:
 		return nil, "", fmt.Errorf("unsupported export format: %s", format)
@@ -0,0 +1,185 @@
+package export
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+func TestExportToPDF_PageBreaks(t *testing.T) {
+	data := ExportData{
+		Title:   "Orders",
+		Headers: []string{"ID", "Customer", "Notes"},
+	}
+	for i := 1; i <= 200; i++ {
+		notes := ""
+		if i%50 == 0 {
+			notes = strings.Repeat("a long note that has to wrap ", 6)
+		}
+		data.Rows = append(data.Rows, []string{fmt.Sprint(i), fmt.Sprintf("Customer %d", i), notes})
+	}
+
+	pdf := NewExportService().buildPDF(data)
+	pages := pdf.PageCount()
+	if pages < 2 {
+		t.Fatalf("PageCount() = %d, want 200 rows to span several pages", pages)
+	}
+
+	pdf.SetCompression(false)
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		t.Fatalf("Output() error = %v", err)
+	}
+
+	// Every page starts with the headers and has a page number
+	if n := bytes.Count(buf.Bytes(), []byte("(Customer)Tj")); n != pages {
+		t.Errorf("headers drawn %d times, want once on each of %d pages", n, pages)
+	}
+	if !bytes.Contains(buf.Bytes(), []byte(fmt.Sprintf("(Page %d)Tj", pages))) {
+		t.Errorf("last page has no page number %d", pages)
+	}
+	for _, id := range []string{"(1)Tj", "(200)Tj"} {
+		if !bytes.Contains(buf.Bytes(), []byte(id)) {
+			t.Errorf("PDF is missing row %s", id)
+		}
+	}
+}
+
+func TestExportToExcel_ColumnTypes(t *testing.T) {
+	content, err := NewExportService().ExportToExcel(ExportData{
+		Headers:     []string{"Customer", "Orders", "Revenue", "First order", "Notes"},
+		ColumnTypes: []ColumnType{ColumnString, ColumnNumber, ColumnCurrency, ColumnDate},
+		Rows: [][]string{
+			{"Acme", "12", "1,200.50", "2024-03-01", "42"},
+			{"Globex", "n/a", "", "2024-03-02 09:30:00", ""},
+		},
+	})
+	if err != nil {
+		t.Fatalf("ExportToExcel() error = %v", err)
+	}
+
+	f, err := excelize.OpenReader(bytes.NewReader(content))
+	if err != nil {
+		t.Fatalf("OpenReader() error = %v", err)
+	}
+	defer f.Close()
+
+	// Without a title, the headers are on row 2
+	raw := excelize.Options{RawCellValue: true}
+	tests := []struct {
+		cell      string
+		wantValue string
+		isString  bool
+	}{
+		{"A3", "Acme", true},
+		{"B3", "12", false},
+		{"C3", "1200.5", false},
+		{"D3", "45352", false}, // Excel serial date
+		{"E3", "42", true},     // Untyped columns stay strings
+		{"B4", "n/a", true},    // Unparseable numbers stay strings
+		{"D4", "45353.395833333336", false},
+	}
+	for _, tt := range tests {
+		value, err := f.GetCellValue("Sheet1", tt.cell, raw)
+		if err != nil || value != tt.wantValue {
+			t.Errorf("%s = %q (error %v), want %q", tt.cell, value, err, tt.wantValue)
+		}
+
+		cellType, err := f.GetCellType("Sheet1", tt.cell)
+		if err != nil {
+			t.Fatalf("GetCellType(%s) error = %v", tt.cell, err)
+		}
+		if isString := cellType == excelize.CellTypeSharedString || cellType == excelize.CellTypeInlineString; isString != tt.isString {
+			t.Errorf("%s type = %v, want string = %v", tt.cell, cellType, tt.isString)
+		}
+	}
+
+	styleID, _ := f.GetCellStyle("Sheet1", "C3")
+	style, err := f.GetStyle(styleID)
+	if err != nil {
+		t.Fatalf("GetStyle() error = %v", err)
+	}
+	if style.NumFmt != 4 || style.Alignment == nil || style.Alignment.Horizontal != "right" {
+		t.Errorf("currency style = %+v, want right-aligned #,##0.00", style)
+	}
+}
+
+func TestExportToExcel_WideSheet(t *testing.T) {
+	data := ExportData{Title: "Wide"}
+	row := make([]string, 30)
+	for i := range row {
+		data.Headers = append(data.Headers, fmt.Sprintf("Column %d", i+1))
+		row[i] = fmt.Sprint(i + 1)
+	}
+	data.Rows = [][]string{row}
+
+	content, err := NewExportService().ExportToExcel(data)
+	if err != nil {
+		t.Fatalf("ExportToExcel() error = %v", err)
+	}
+
+	f, err := excelize.OpenReader(bytes.NewReader(content))
+	if err != nil {
+		t.Fatalf("OpenReader() error = %v", err)
+	}
+	defer f.Close()
+
+	// With a title, the headers are on row 3
+	for cell, want := range map[string]string{"Z3": "Column 26", "AA3": "Column 27", "AD3": "Column 30", "AD4": "30"} {
+		if got, _ := f.GetCellValue("Sheet1", cell); got != want {
+			t.Errorf("%s = %q, want %q", cell, got, want)
+		}
+	}
+
+	merged, err := f.GetMergeCells("Sheet1")
+	if err != nil || len(merged) != 1 || merged[0].GetStartAxis() != "A1" || merged[0].GetEndAxis() != "AD1" {
+		t.Errorf("merged cells = %v (error %v), want the title across A1:AD1", merged, err)
+	}
+}
+
+func TestExportWithOptions_Password(t *testing.T) {
+	data := ExportData{
+		Title:   "Payroll",
+		Headers: []string{"Employee", "Salary"},
+		Rows:    [][]string{{"Jane", "85000"}},
+	}
+	es := NewExportService()
+	opts := ExportOptions{Password: "s3cret"}
+
+	pdf, _, err := es.ExportWithOptions(data, FormatPDF, opts)
+	if err != nil {
+		t.Fatalf("ExportWithOptions(pdf) error = %v", err)
+	}
+	if !bytes.Contains(pdf, []byte("/Encrypt")) {
+		t.Error("protected PDF has no /Encrypt dictionary")
+	}
+	plain, _, _ := es.Export(data, FormatPDF)
+	if bytes.Contains(plain, []byte("/Encrypt")) {
+		t.Error("PDF without a password is encrypted")
+	}
+
+	xlsx, _, err := es.ExportWithOptions(data, FormatExcel, opts)
+	if err != nil {
+		t.Fatalf("ExportWithOptions(xlsx) error = %v", err)
+	}
+	if f, err := excelize.OpenReader(bytes.NewReader(xlsx)); err == nil {
+		f.Close()
+		t.Error("protected workbook opened without a password")
+	}
+	f, err := excelize.OpenReader(bytes.NewReader(xlsx), excelize.Options{Password: "s3cret"})
+	if err != nil {
+		t.Fatalf("OpenReader() with the password error = %v", err)
+	}
+	defer f.Close()
+	if got, _ := f.GetCellValue("Sheet1", "A4"); got != "Jane" {
+		t.Errorf("A4 = %q, want Jane", got)
+	}
+
+	if _, _, err := es.ExportWithOptions(data, FormatCSV, opts); !errors.Is(err, ErrProtectionUnsupported) {
+		t.Errorf("ExportWithOptions(csv) error = %v, want ErrProtectionUnsupported", err)
+	}
+}
@@ -2,6 +2,7 @@ package images
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"image"
 	"image/jpeg"
@@ -9,10 +10,12 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
 
 	"golang.org/x/image/draw"
-	"golang.org/x/image/webp"
+	_ "golang.org/x/image/webp" // Register WebP decoder
 )
 
 // ImageFormat represents supported image formats
@@ -24,12 +27,42 @@ const (
 	FormatWebP ImageFormat = "webp"
 )
 
+// ErrWebPUnsupported is returned when WebP output is requested but the
+// binary was built without the webp build tag
+var ErrWebPUnsupported = errors.New("webp encoding not supported: build with -tags webp")
+
+// SupportsWebPEncoding reports whether WebP output is available
+func SupportsWebPEncoding() bool {
+	return webpSupported
+}
+
+// defaultFormat returns WebP when it can be encoded, JPEG otherwise
+func defaultFormat() ImageFormat {
+	if webpSupported {
+		return FormatWebP
+	}
+	return FormatJPEG
+}
+
+// formatExtension returns the file extension for an output format
+func formatExtension(format ImageFormat) string {
+	switch format {
+	case FormatPNG:
+		return ".png"
+	case FormatWebP:
+		return ".webp"
+	default:
+		return ".jpg"
+	}
+}
+
 // ImageOptimizer provides image optimization capabilities
 type ImageOptimizer struct {
 	maxWidth       int
 	maxHeight      int
 	quality        int
 	preferredFormat ImageFormat
+	autoOrient     bool
 }
 
 // NewImageOptimizer creates a new image optimizer
@@ -38,42 +71,64 @@ func NewImageOptimizer() *ImageOptimizer {
 		maxWidth:       2048,
 		maxHeight:      2048,
 		quality:        85,
-		preferredFormat: FormatWebP,
+		preferredFormat: defaultFormat(),
+		autoOrient:     true,
 	}
 }
 
+// SetAutoOrient toggles EXIF auto-orientation for GenerateThumbnails and
+// LazyLoadPlaceholder
+func (io *ImageOptimizer) SetAutoOrient(enabled bool) {
+	io.autoOrient = enabled
+}
+
 // OptimizeOptions defines image optimization options
 type OptimizeOptions struct {
 	MaxWidth   int         // Maximum width (0 = no limit)
 	MaxHeight  int         // Maximum height (0 = no limit)
 	Quality    int         // Quality (1-100)
 	Format     ImageFormat // Output format
-	StripMeta  bool        // Remove metadata
+	StripMeta  bool        // Remove metadata; when false, EXIF orientation is applied to the pixels
+	AutoOrient bool        // Rotate/flip according to EXIF orientation before resizing
 }
 
 // DefaultOptimizeOptions returns default optimization settings
 func DefaultOptimizeOptions() *OptimizeOptions {
 	return &OptimizeOptions{
-		MaxWidth:  1920,
-		MaxHeight: 1080,
-		Quality:   85,
-		Format:    FormatWebP,
-		StripMeta: true,
+		MaxWidth:   1920,
+		MaxHeight:  1080,
+		Quality:    85,
+		Format:     defaultFormat(),
+		StripMeta:  true,
+		AutoOrient: true,
 	}
 }
 
-// Optimize optimizes an image
+// Optimize optimizes an image.
+// Output is always re-encoded, so EXIF, ICC profiles and other ancillary
+// chunks never carry over. With AutoOrient or with StripMeta disabled the
+// EXIF orientation is baked into the pixels first so the image still
+// displays upright.
 func (io *ImageOptimizer) Optimize(input io.Reader, output io.Writer, opts *OptimizeOptions) error {
 	if opts == nil {
 		opts = DefaultOptimizeOptions()
 	}
 
+	data, err := readAll(input)
+	if err != nil {
+		return fmt.Errorf("failed to read image: %w", err)
+	}
+
 	// Decode image
-	img, format, err := image.Decode(input)
+	img, format, err := image.Decode(bytes.NewReader(data))
 	if err != nil {
 		return fmt.Errorf("failed to decode image: %w", err)
 	}
 
+	if opts.AutoOrient || !opts.StripMeta {
+		img = applyOrientation(img, readOrientation(data))
+	}
+
 	// Resize if needed
 	if opts.MaxWidth > 0 || opts.MaxHeight > 0 {
 		img = io.resize(img, opts.MaxWidth, opts.MaxHeight)
@@ -83,6 +138,15 @@ func (io *ImageOptimizer) Optimize(input io.Reader, output io.Writer, opts *Opti
 	return io.encode(output, img, opts.Format, opts.Quality, format)
 }
 
+// readAll reads the whole input; the optimizer's receiver shadows package io
+func readAll(r io.Reader) ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := buf.ReadFrom(r); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
 // resize resizes image maintaining aspect ratio
 func (io *ImageOptimizer) resize(img image.Image, maxWidth, maxHeight int) image.Image {
 	bounds := img.Bounds()
@@ -146,10 +210,10 @@ func (io *ImageOptimizer) encode(w io.Writer, img image.Image, format ImageForma
 		return encoder.Encode(w, img)
 
 	case FormatWebP:
-		// WebP encoding requires external library
-		// For now, fall back to JPEG
-		// In production, use github.com/chai2010/webp
-		return jpeg.Encode(w, img, &jpeg.Options{Quality: quality})
+		if err := encodeWebP(w, img, quality); err != nil {
+			return fmt.Errorf("failed to encode webp: %w", err)
+		}
+		return nil
 
 	default:
 		// Use original format
@@ -204,13 +268,7 @@ func (io *ImageOptimizer) GenerateThumbnails(inputPath, outputDir string, sizes
 	}
 
 	// Load original image
-	input, err := os.Open(inputPath)
-	if err != nil {
-		return nil, err
-	}
-	defer input.Close()
-
-	img, _, err := image.Decode(input)
+	img, err := io.loadImage(inputPath)
 	if err != nil {
 		return nil, err
 	}
@@ -218,13 +276,14 @@ func (io *ImageOptimizer) GenerateThumbnails(inputPath, outputDir string, sizes
 	// Generate each size
 	ext := filepath.Ext(inputPath)
 	baseName := strings.TrimSuffix(filepath.Base(inputPath), ext)
+	format := defaultFormat()
 
 	for _, size := range sizes {
 		// Resize image
 		resized := io.resize(img, size.Width, size.Height)
 
 		// Generate output path
-		outputPath := filepath.Join(outputDir, fmt.Sprintf("%s_%s.webp", baseName, size.Name))
+		outputPath := filepath.Join(outputDir, fmt.Sprintf("%s_%s%s", baseName, size.Name, formatExtension(format)))
 
 		// Save thumbnail
 		output, err := os.Create(outputPath)
@@ -232,7 +291,7 @@ func (io *ImageOptimizer) GenerateThumbnails(inputPath, outputDir string, sizes
 			return nil, err
 		}
 
-		err = io.encode(output, resized, FormatWebP, 85, "")
+		err = io.encode(output, resized, format, 85, "")
 		output.Close()
 
 		if err != nil {
@@ -247,13 +306,7 @@ func (io *ImageOptimizer) GenerateThumbnails(inputPath, outputDir string, sizes
 
 // LazyLoadPlaceholder generates a tiny placeholder for lazy loading
 func (io *ImageOptimizer) LazyLoadPlaceholder(inputPath string) ([]byte, error) {
-	input, err := os.Open(inputPath)
-	if err != nil {
-		return nil, err
-	}
-	defer input.Close()
-
-	img, _, err := image.Decode(input)
+	img, err := io.loadImage(inputPath)
 	if err != nil {
 		return nil, err
 	}
@@ -270,6 +323,25 @@ func (io *ImageOptimizer) LazyLoadPlaceholder(inputPath string) ([]byte, error)
 	return buf.Bytes(), nil
 }
 
+// loadImage decodes an image file, applying EXIF orientation if enabled
+func (io *ImageOptimizer) loadImage(path string) (image.Image, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	if io.autoOrient {
+		img = applyOrientation(img, readOrientation(data))
+	}
+
+	return img, nil
+}
+
 // ImageMetadata contains image metadata
 type ImageMetadata struct {
 	Width      int
@@ -344,6 +416,41 @@ func CalculateStats(originalSize, compressedSize int64) *CompressionStats {
 	}
 }
 
+// Estimate runs the optimization without producing output and returns the
+// projected compression statistics. Encoded bytes are only counted.
+func (io *ImageOptimizer) Estimate(input io.Reader, opts *OptimizeOptions) (*CompressionStats, error) {
+	reader := &countingReader{r: input}
+	writer := &countingWriter{}
+
+	if err := io.Optimize(reader, writer, opts); err != nil {
+		return nil, err
+	}
+
+	return CalculateStats(reader.n, writer.n), nil
+}
+
+// countingReader counts bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
+
+// countingWriter discards data while counting bytes written
+type countingWriter struct {
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	cw.n += int64(len(p))
+	return len(p), nil
+}
+
 // BatchOptimizer optimizes multiple images in parallel
 type BatchOptimizer struct {
 	optimizer *ImageOptimizer
@@ -362,17 +469,47 @@ func NewBatchOptimizer(workers int) *BatchOptimizer {
 	}
 }
 
-// OptimizeDirectory optimizes all images in a directory
-func (bo *BatchOptimizer) OptimizeDirectory(inputDir, outputDir string, opts *OptimizeOptions) error {
+// BatchSummary summarizes a batch optimization run
+type BatchSummary struct {
+	Succeeded  int
+	Failed     int
+	BytesSaved int64
+	Errors     map[string]error // input path -> error
+}
+
+// Err returns an aggregate error for failed files, or nil if all succeeded
+func (s *BatchSummary) Err() error {
+	if len(s.Errors) == 0 {
+		return nil
+	}
+
+	paths := make([]string, 0, len(s.Errors))
+	for path := range s.Errors {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	errs := make([]error, 0, len(paths))
+	for _, path := range paths {
+		errs = append(errs, fmt.Errorf("%s: %w", filepath.Base(path), s.Errors[path]))
+	}
+
+	return fmt.Errorf("failed to optimize %d of %d images: %w", s.Failed, s.Succeeded+s.Failed, errors.Join(errs...))
+}
+
+// OptimizeDirectory optimizes all images in a directory using the
+// configured number of workers. A failing file doesn't abort the batch;
+// per-file errors are collected in the returned summary.
+func (bo *BatchOptimizer) OptimizeDirectory(inputDir, outputDir string, opts *OptimizeOptions) (*BatchSummary, error) {
 	// Create output directory
 	if err := os.MkdirAll(outputDir, 0755); err != nil {
-		return err
+		return nil, err
 	}
 
 	// Find all images
 	images, err := filepath.Glob(filepath.Join(inputDir, "*"))
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Filter image files
@@ -383,25 +520,59 @@ func (bo *BatchOptimizer) OptimizeDirectory(inputDir, outputDir string, opts *Op
 		}
 	}
 
-	// Process each image
+	summary := &BatchSummary{Errors: make(map[string]error)}
+	var mu sync.Mutex
+
+	paths := make(chan string)
+	var wg sync.WaitGroup
+
+	for i := 0; i < bo.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for inputPath := range paths {
+				saved, err := bo.optimizeOne(inputPath, outputDir, opts)
+
+				mu.Lock()
+				if err != nil {
+					summary.Failed++
+					summary.Errors[inputPath] = err
+				} else {
+					summary.Succeeded++
+					summary.BytesSaved += saved
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
 	for _, inputPath := range imageFiles {
-		baseName := filepath.Base(inputPath)
-		outputPath := filepath.Join(outputDir, baseName)
+		paths <- inputPath
+	}
+	close(paths)
+	wg.Wait()
 
-		if err := bo.optimizer.OptimizeFile(inputPath, outputPath, opts); err != nil {
-			fmt.Printf("Failed to optimize %s: %v\n", baseName, err)
-			continue
-		}
+	return summary, nil
+}
 
-		// Print stats
-		originalStat, _ := os.Stat(inputPath)
-		optimizedStat, _ := os.Stat(outputPath)
-		stats := CalculateStats(originalStat.Size(), optimizedStat.Size())
+// optimizeOne optimizes a single file and returns the bytes saved
+func (bo *BatchOptimizer) optimizeOne(inputPath, outputDir string, opts *OptimizeOptions) (int64, error) {
+	outputPath := filepath.Join(outputDir, filepath.Base(inputPath))
 
-		fmt.Printf("Optimized %s: %.1f%% smaller\n", baseName, stats.SavingsPercent)
+	if err := bo.optimizer.OptimizeFile(inputPath, outputPath, opts); err != nil {
+		return 0, err
+	}
+
+	originalStat, err := os.Stat(inputPath)
+	if err != nil {
+		return 0, err
+	}
+	optimizedStat, err := os.Stat(outputPath)
+	if err != nil {
+		return 0, err
 	}
 
-	return nil
+	return CalculateStats(originalStat.Size(), optimizedStat.Size()).SavingsBytes, nil
 }
 
 // isImageFile checks if file is an image
@@ -439,15 +610,17 @@ func (rig *ResponsiveImageGenerator) Generate(inputPath, outputDir string, width
 	baseName := strings.TrimSuffix(filepath.Base(inputPath), filepath.Ext(inputPath))
 	sizes := make(map[int]string)
 	var srcSetParts []string
+	format := defaultFormat()
 
 	// Generate each width
 	for _, width := range widths {
-		outputPath := filepath.Join(outputDir, fmt.Sprintf("%s_%dw.webp", baseName, width))
+		outputPath := filepath.Join(outputDir, fmt.Sprintf("%s_%dw%s", baseName, width, formatExtension(format)))
 
 		opts := &OptimizeOptions{
-			MaxWidth: width,
-			Quality:  85,
-			Format:   FormatWebP,
+			MaxWidth:   width,
+			Quality:    85,
+			Format:     format,
+			AutoOrient: true,
 		}
 
 		if err := rig.optimizer.OptimizeFile(inputPath, outputPath, opts); err != nil {
@@ -0,0 +1,429 @@
+package images
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func testImage(width, height int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x * 255 / width), G: uint8(y * 255 / height), B: 128, A: 255})
+		}
+	}
+	return img
+}
+
+func encodePNG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("failed to encode fixture: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestOptimize_WebP(t *testing.T) {
+	optimizer := NewImageOptimizer()
+	input := encodePNG(t, testImage(64, 48))
+
+	var output bytes.Buffer
+	err := optimizer.Optimize(bytes.NewReader(input), &output, &OptimizeOptions{
+		Quality: 80,
+		Format:  FormatWebP,
+	})
+
+	if !SupportsWebPEncoding() {
+		if !errors.Is(err, ErrWebPUnsupported) {
+			t.Fatalf("expected ErrWebPUnsupported, got %v", err)
+		}
+		if output.Len() != 0 {
+			t.Errorf("expected no output when WebP is unsupported, got %d bytes", output.Len())
+		}
+		return
+	}
+
+	if err != nil {
+		t.Fatalf("Optimize failed: %v", err)
+	}
+
+	decoded, format, err := image.Decode(&output)
+	if err != nil {
+		t.Fatalf("failed to decode output: %v", err)
+	}
+	if format != "webp" {
+		t.Errorf("expected webp output, got %s", format)
+	}
+	if bounds := decoded.Bounds(); bounds.Dx() != 64 || bounds.Dy() != 48 {
+		t.Errorf("unexpected output size %dx%d", bounds.Dx(), bounds.Dy())
+	}
+}
+
+func encodeJPEG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 95}); err != nil {
+		t.Fatalf("failed to encode fixture: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// withEXIF inserts an EXIF APP1 segment with the given orientation and,
+// optionally, a GPS IFD right after the JPEG SOI marker
+func withEXIF(t *testing.T, jpegData []byte, orientation int, gps bool) []byte {
+	t.Helper()
+
+	order := binary.LittleEndian
+	var tiff bytes.Buffer
+	tiff.WriteString("II")
+	binary.Write(&tiff, order, uint16(42))
+	binary.Write(&tiff, order, uint32(8))
+
+	entries := uint16(1)
+	if gps {
+		entries = 2
+	}
+	binary.Write(&tiff, order, entries)
+
+	// Orientation: SHORT, count 1, value left-aligned
+	binary.Write(&tiff, order, uint16(0x0112))
+	binary.Write(&tiff, order, uint16(3))
+	binary.Write(&tiff, order, uint32(1))
+	binary.Write(&tiff, order, uint16(orientation))
+	binary.Write(&tiff, order, uint16(0))
+
+	if gps {
+		gpsOffset := uint32(8 + 2 + int(entries)*12 + 4)
+		binary.Write(&tiff, order, uint16(0x8825))
+		binary.Write(&tiff, order, uint16(4))
+		binary.Write(&tiff, order, uint32(1))
+		binary.Write(&tiff, order, gpsOffset)
+	}
+	binary.Write(&tiff, order, uint32(0)) // No next IFD
+
+	if gps {
+		// GPSLatitudeRef = "N"
+		binary.Write(&tiff, order, uint16(1))
+		binary.Write(&tiff, order, uint16(0x0001))
+		binary.Write(&tiff, order, uint16(2))
+		binary.Write(&tiff, order, uint32(2))
+		tiff.Write([]byte{'N', 0, 0, 0})
+		binary.Write(&tiff, order, uint32(0))
+	}
+
+	payload := append([]byte("Exif\x00\x00"), tiff.Bytes()...)
+
+	var out bytes.Buffer
+	out.Write(jpegData[:2])
+	out.Write([]byte{0xFF, 0xE1})
+	binary.Write(&out, binary.BigEndian, uint16(len(payload)+2))
+	out.Write(payload)
+	out.Write(jpegData[2:])
+	return out.Bytes()
+}
+
+func TestOptimize_StripMetaRemovesEXIF(t *testing.T) {
+	input := withEXIF(t, encodeJPEG(t, testImage(40, 30)), OrientationNormal, true)
+	if findEXIF(input) == nil {
+		t.Fatal("fixture should contain EXIF")
+	}
+
+	optimizer := NewImageOptimizer()
+
+	var output bytes.Buffer
+	err := optimizer.Optimize(bytes.NewReader(input), &output, &OptimizeOptions{
+		Quality:   85,
+		Format:    FormatJPEG,
+		StripMeta: true,
+	})
+	if err != nil {
+		t.Fatalf("Optimize failed: %v", err)
+	}
+
+	if findEXIF(output.Bytes()) != nil {
+		t.Error("output should not contain EXIF data")
+	}
+	if bytes.Contains(output.Bytes(), []byte("Exif")) {
+		t.Error("output should not contain an Exif header")
+	}
+}
+
+func TestOptimize_KeepMetaAppliesOrientation(t *testing.T) {
+	input := withEXIF(t, encodeJPEG(t, testImage(40, 30)), OrientationRotate90, false)
+
+	optimizer := NewImageOptimizer()
+
+	var output bytes.Buffer
+	err := optimizer.Optimize(bytes.NewReader(input), &output, &OptimizeOptions{
+		Quality:   85,
+		Format:    FormatPNG,
+		StripMeta: false,
+	})
+	if err != nil {
+		t.Fatalf("Optimize failed: %v", err)
+	}
+
+	decoded, _, err := image.Decode(&output)
+	if err != nil {
+		t.Fatalf("failed to decode output: %v", err)
+	}
+	if bounds := decoded.Bounds(); bounds.Dx() != 30 || bounds.Dy() != 40 {
+		t.Errorf("expected rotated 30x40 output, got %dx%d", bounds.Dx(), bounds.Dy())
+	}
+}
+
+func writeFixtures(tb testing.TB, dir string, count int) {
+	tb.Helper()
+	for i := 0; i < count; i++ {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, testImage(256, 256)); err != nil {
+			tb.Fatalf("failed to encode fixture: %v", err)
+		}
+		path := filepath.Join(dir, fmt.Sprintf("fixture_%02d.png", i))
+		if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+			tb.Fatalf("failed to write fixture: %v", err)
+		}
+	}
+}
+
+func TestBatchOptimizer_OptimizeDirectory(t *testing.T) {
+	inputDir := t.TempDir()
+	outputDir := t.TempDir()
+
+	writeFixtures(t, inputDir, 5)
+	if err := os.WriteFile(filepath.Join(inputDir, "broken.png"), []byte("not an image"), 0644); err != nil {
+		t.Fatalf("failed to write broken fixture: %v", err)
+	}
+
+	bo := NewBatchOptimizer(3)
+	summary, err := bo.OptimizeDirectory(inputDir, outputDir, &OptimizeOptions{Quality: 80, Format: FormatJPEG})
+	if err != nil {
+		t.Fatalf("OptimizeDirectory failed: %v", err)
+	}
+
+	if summary.Succeeded != 5 {
+		t.Errorf("expected 5 succeeded, got %d", summary.Succeeded)
+	}
+	if summary.Failed != 1 {
+		t.Errorf("expected 1 failed, got %d", summary.Failed)
+	}
+	if _, ok := summary.Errors[filepath.Join(inputDir, "broken.png")]; !ok {
+		t.Error("expected broken.png to be reported as failed")
+	}
+
+	var expectedSaved int64
+	for i := 0; i < 5; i++ {
+		name := fmt.Sprintf("fixture_%02d.png", i)
+		in, _ := os.Stat(filepath.Join(inputDir, name))
+		out, err := os.Stat(filepath.Join(outputDir, name))
+		if err != nil {
+			t.Fatalf("missing output for %s: %v", name, err)
+		}
+		expectedSaved += in.Size() - out.Size()
+	}
+	if summary.BytesSaved != expectedSaved {
+		t.Errorf("expected %d bytes saved, got %d", expectedSaved, summary.BytesSaved)
+	}
+	if summary.Err() == nil {
+		t.Error("expected aggregate error")
+	}
+}
+
+func benchmarkOptimizeDirectory(b *testing.B, workers int) {
+	inputDir := b.TempDir()
+	writeFixtures(b, inputDir, 16)
+	opts := &OptimizeOptions{Quality: 80, Format: FormatJPEG}
+	bo := NewBatchOptimizer(workers)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := bo.OptimizeDirectory(inputDir, b.TempDir(), opts); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkOptimizeDirectory_Serial(b *testing.B) {
+	benchmarkOptimizeDirectory(b, 1)
+}
+
+func BenchmarkOptimizeDirectory_Pooled(b *testing.B) {
+	benchmarkOptimizeDirectory(b, 4)
+}
+
+var (
+	red   = color.RGBA{R: 255, A: 255}
+	green = color.RGBA{G: 255, A: 255}
+	blue  = color.RGBA{B: 255, A: 255}
+	white = color.RGBA{R: 255, G: 255, B: 255, A: 255}
+)
+
+// quadrantImage builds an image with a solid color in each quadrant
+func quadrantImage(width, height int, tl, tr, bl, br color.Color) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			switch {
+			case x < width/2 && y < height/2:
+				img.Set(x, y, tl)
+			case y < height/2:
+				img.Set(x, y, tr)
+			case x < width/2:
+				img.Set(x, y, bl)
+			default:
+				img.Set(x, y, br)
+			}
+		}
+	}
+	return img
+}
+
+func colorClose(a, b color.Color) bool {
+	ar, ag, ab, _ := a.RGBA()
+	br, bg, bb, _ := b.RGBA()
+	near := func(x, y uint32) bool {
+		d := int(x>>8) - int(y>>8)
+		return d > -40 && d < 40
+	}
+	return near(ar, br) && near(ag, bg) && near(ab, bb)
+}
+
+func TestGenerateThumbnails_AutoOrient(t *testing.T) {
+	// Each fixture is stored so that, once its EXIF orientation is applied,
+	// it displays as a 40x20 image with red, green, blue and white quadrants
+	fixtures := []struct {
+		orientation    int
+		width, height  int
+		tl, tr, bl, br color.Color
+	}{
+		{OrientationNormal, 40, 20, red, green, blue, white},
+		{OrientationFlipH, 40, 20, green, red, white, blue},
+		{OrientationRotate180, 40, 20, white, blue, green, red},
+		{OrientationFlipV, 40, 20, blue, white, red, green},
+		{OrientationTranspose, 20, 40, red, blue, green, white},
+		{OrientationRotate90, 20, 40, green, white, red, blue},
+		{OrientationTransverse, 20, 40, white, green, blue, red},
+		{OrientationRotate270, 20, 40, blue, red, white, green},
+	}
+
+	optimizer := NewImageOptimizer()
+
+	for _, f := range fixtures {
+		t.Run(fmt.Sprintf("orientation_%d", f.orientation), func(t *testing.T) {
+			dir := t.TempDir()
+			inputPath := filepath.Join(dir, "photo.jpg")
+			stored := quadrantImage(f.width, f.height, f.tl, f.tr, f.bl, f.br)
+			if err := os.WriteFile(inputPath, withEXIF(t, encodeJPEG(t, stored), f.orientation, false), 0644); err != nil {
+				t.Fatalf("failed to write fixture: %v", err)
+			}
+
+			results, err := optimizer.GenerateThumbnails(inputPath, filepath.Join(dir, "thumbs"), []ThumbnailSize{
+				{Name: "full", Width: 100, Height: 100},
+			})
+			if err != nil {
+				if errors.Is(err, ErrWebPUnsupported) {
+					t.Skip("WebP unsupported")
+				}
+				t.Fatalf("GenerateThumbnails failed: %v", err)
+			}
+
+			file, err := os.Open(results["full"])
+			if err != nil {
+				t.Fatalf("failed to open thumbnail: %v", err)
+			}
+			defer file.Close()
+
+			thumb, _, err := image.Decode(file)
+			if err != nil {
+				t.Fatalf("failed to decode thumbnail: %v", err)
+			}
+
+			bounds := thumb.Bounds()
+			if bounds.Dx() != 40 || bounds.Dy() != 20 {
+				t.Fatalf("expected 40x20 thumbnail, got %dx%d", bounds.Dx(), bounds.Dy())
+			}
+
+			checks := []struct {
+				name string
+				x, y int
+				want color.Color
+			}{
+				{"top-left", 10, 5, red},
+				{"top-right", 30, 5, green},
+				{"bottom-left", 10, 15, blue},
+				{"bottom-right", 30, 15, white},
+			}
+			for _, c := range checks {
+				if got := thumb.At(c.x, c.y); !colorClose(got, c.want) {
+					t.Errorf("%s: got %v, want %v", c.name, got, c.want)
+				}
+			}
+		})
+	}
+}
+
+func TestLazyLoadPlaceholder_AutoOrientToggle(t *testing.T) {
+	dir := t.TempDir()
+	inputPath := filepath.Join(dir, "photo.jpg")
+	stored := quadrantImage(40, 80, green, white, red, blue)
+	if err := os.WriteFile(inputPath, withEXIF(t, encodeJPEG(t, stored), OrientationRotate90, false), 0644); err != nil {
+		t.Fatalf("failed to write fixture: %v", err)
+	}
+
+	optimizer := NewImageOptimizer()
+
+	placeholderSize := func() (int, int) {
+		data, err := optimizer.LazyLoadPlaceholder(inputPath)
+		if err != nil {
+			t.Fatalf("LazyLoadPlaceholder failed: %v", err)
+		}
+		cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("failed to decode placeholder: %v", err)
+		}
+		return cfg.Width, cfg.Height
+	}
+
+	if w, h := placeholderSize(); w != 20 || h != 10 {
+		t.Errorf("expected oriented 20x10 placeholder, got %dx%d", w, h)
+	}
+
+	optimizer.SetAutoOrient(false)
+	if w, h := placeholderSize(); w != 20 || h != 40 {
+		t.Errorf("expected unoriented 20x40 placeholder, got %dx%d", w, h)
+	}
+}
+
+func TestEstimate_MatchesOptimize(t *testing.T) {
+	input := encodePNG(t, testImage(200, 150))
+	opts := &OptimizeOptions{MaxWidth: 100, Quality: 70, Format: FormatJPEG}
+	optimizer := NewImageOptimizer()
+
+	stats, err := optimizer.Estimate(bytes.NewReader(input), opts)
+	if err != nil {
+		t.Fatalf("Estimate failed: %v", err)
+	}
+
+	var output bytes.Buffer
+	if err := optimizer.Optimize(bytes.NewReader(input), &output, opts); err != nil {
+		t.Fatalf("Optimize failed: %v", err)
+	}
+
+	expected := CalculateStats(int64(len(input)), int64(output.Len()))
+	if stats.OriginalSize != expected.OriginalSize {
+		t.Errorf("original size: got %d, want %d", stats.OriginalSize, expected.OriginalSize)
+	}
+	if diff := stats.CompressedSize - expected.CompressedSize; diff < -1 || diff > 1 {
+		t.Errorf("compressed size: got %d, want %d", stats.CompressedSize, expected.CompressedSize)
+	}
+}
@@ -0,0 +1,19 @@
+//go:build webp
+
+package images
+
+import (
+	"image"
+	"io"
+
+	"github.com/chai2010/webp"
+)
+
+// webpSupported is true when built with the webp tag, which links libwebp
+// through github.com/chai2010/webp (requires cgo)
+const webpSupported = true
+
+// encodeWebP encodes img as lossy WebP at the given quality
+func encodeWebP(w io.Writer, img image.Image, quality int) error {
+	return webp.Encode(w, img, &webp.Options{Quality: float32(quality)})
+}
@@ -0,0 +1,16 @@
+//go:build !webp
+
+package images
+
+import (
+	"image"
+	"io"
+)
+
+// webpSupported is false without the webp build tag
+const webpSupported = false
+
+// encodeWebP refuses to encode rather than writing mislabeled bytes
+func encodeWebP(w io.Writer, img image.Image, quality int) error {
+	return ErrWebPUnsupported
+}
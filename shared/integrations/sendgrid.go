@@ -2,6 +2,11 @@ package integrations
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"time"
@@ -10,9 +15,22 @@ import (
 )
 
 var (
-	ErrSendGridNotConfigured = errors.New("SendGrid is not configured")
-	ErrInvalidEmail          = errors.New("invalid email address")
-	ErrEmailSendFailed       = errors.New("failed to send email")
+	ErrSendGridNotConfigured   = errors.New("SendGrid is not configured")
+	ErrInvalidEmail            = errors.New("invalid email address")
+	ErrEmailSendFailed         = errors.New("failed to send email")
+	ErrInvalidWebhookKey       = errors.New("invalid SendGrid webhook public key")
+	ErrInvalidWebhookSignature = errors.New("invalid SendGrid webhook signature")
+	ErrInvalidSendAt           = errors.New("invalid scheduled send time")
+
+	// ErrEmailSendTransient marks send failures that may succeed on retry,
+	// such as network errors or SendGrid rate limiting
+	ErrEmailSendTransient = errors.New("temporary email send failure")
+)
+
+// Headers set by SendGrid on signed event webhook requests
+const (
+	SendGridSignatureHeader = "X-Twilio-Email-Event-Webhook-Signature"
+	SendGridTimestampHeader = "X-Twilio-Email-Event-Webhook-Timestamp"
 )
 
 // SendGridConfig holds SendGrid API configuration
@@ -22,16 +40,40 @@ type SendGridConfig struct {
 	FromName        string
 	ReplyTo         string
 	UnsubscribeURL  string
+
+	// WebhookPublicKey is the base64 verification key shown in the
+	// SendGrid signed event webhook settings
+	WebhookPublicKey string
 }
 
+// Retry policy for SendBulkEmail
+const (
+	bulkSendAttempts     = 3
+	defaultBulkRetryWait = 500 * time.Millisecond
+)
+
 // SendGridClient wraps SendGrid API operations
 type SendGridClient struct {
-	config SendGridConfig
+	config    SendGridConfig
+	transport Transport
+	retryWait time.Duration // initial backoff between bulk send attempts
 }
 
-// NewSendGridClient creates a new SendGrid client
+// NewSendGridClient creates a new SendGrid client. Email is sent through the
+// SendGrid API when config.APIKey is set; otherwise sending returns
+// ErrSendGridNotConfigured.
 func NewSendGridClient(config SendGridConfig) *SendGridClient {
-	return &SendGridClient{config: config}
+	client := &SendGridClient{config: config, retryWait: defaultBulkRetryWait}
+	if config.APIKey != "" {
+		client.transport = newSendGridTransport(config)
+	}
+	return client
+}
+
+// NewSendGridClientWithTransport creates a SendGrid client that sends email
+// through the given transport
+func NewSendGridClientWithTransport(config SendGridConfig, transport Transport) *SendGridClient {
+	return &SendGridClient{config: config, transport: transport, retryWait: defaultBulkRetryWait}
 }
 
 // EmailAddress represents an email address with name
@@ -73,47 +115,119 @@ type TrackingSettings struct {
 
 // EmailResponse represents the response after sending an email
 type EmailResponse struct {
-	MessageID string    `json:"message_id"`
-	Status    string    `json:"status"`
-	SentAt    time.Time `json:"sent_at"`
+	MessageID   string     `json:"message_id"`
+	Status      string     `json:"status"` // sent or scheduled
+	SentAt      time.Time  `json:"sent_at"`
+	ScheduledAt *time.Time `json:"scheduled_at,omitempty"`
 }
 
+// MaxScheduleAhead is how far in the future SendGrid accepts a send_at time
+const MaxScheduleAhead = 72 * time.Hour
+
 // SendEmail sends a single email
 func (sg *SendGridClient) SendEmail(ctx context.Context, message *EmailMessage) (*EmailResponse, error) {
 	if len(message.To) == 0 {
 		return nil, ErrInvalidEmail
 	}
 
-	// In real implementation, use SendGrid SDK:
-	// from := mail.NewEmail(sg.config.FromName, sg.config.FromEmail)
-	// to := mail.NewEmail(message.To[0].Name, message.To[0].Email)
-	// msg := mail.NewSingleEmail(from, message.Subject, to, message.TextContent, message.HTMLContent)
-	// client := sendgrid.NewSendClient(sg.config.APIKey)
-	// response, err := client.Send(msg)
+	if message.SendAt != nil {
+		if err := validateSendAt(*message.SendAt, time.Now()); err != nil {
+			return nil, err
+		}
+	}
 
-	// Mock implementation
-	response := &EmailResponse{
-		MessageID: fmt.Sprintf("msg_%s", uuid.New().String()[:8]),
-		Status:    "sent",
-		SentAt:    time.Now(),
+	if sg.transport == nil {
+		return nil, ErrSendGridNotConfigured
+	}
+
+	response, err := sg.transport.Send(ctx, message)
+	if err != nil {
+		return nil, err
+	}
+
+	if message.SendAt != nil {
+		scheduledAt := *message.SendAt
+		response.Status = "scheduled"
+		response.ScheduledAt = &scheduledAt
 	}
 
 	return response, nil
 }
 
-// SendBulkEmail sends emails to multiple recipients
-func (sg *SendGridClient) SendBulkEmail(ctx context.Context, messages []*EmailMessage) ([]*EmailResponse, error) {
-	var responses []*EmailResponse
+// validateSendAt checks that a scheduled send time is one SendGrid accepts
+func validateSendAt(sendAt, now time.Time) error {
+	if !sendAt.After(now) {
+		return fmt.Errorf("%w: send_at %s is not in the future", ErrInvalidSendAt, sendAt.Format(time.RFC3339))
+	}
 
-	for _, message := range messages {
-		response, err := sg.SendEmail(ctx, message)
+	if sendAt.Sub(now) > MaxScheduleAhead {
+		return fmt.Errorf("%w: send_at %s is more than %s ahead", ErrInvalidSendAt, sendAt.Format(time.RFC3339), MaxScheduleAhead)
+	}
+
+	return nil
+}
+
+// BulkResult reports the outcome of SendBulkEmail
+type BulkResult struct {
+	Sent   []*EmailResponse `json:"sent"`
+	Failed []BulkFailure    `json:"failed"`
+}
+
+// BulkFailure describes a message that could not be sent
+type BulkFailure struct {
+	Index    int           `json:"index"` // position in the input slice
+	Message  *EmailMessage `json:"message"`
+	Attempts int           `json:"attempts"`
+	Err      error         `json:"-"`
+}
+
+// SendBulkEmail sends emails to multiple recipients. A failed message does
+// not stop the batch; transient failures are retried with exponential
+// backoff, and messages that still fail are returned in BulkResult.Failed
+// so callers can retry just those. The error is non-nil only if ctx ends
+// before the batch completes.
+func (sg *SendGridClient) SendBulkEmail(ctx context.Context, messages []*EmailMessage) (*BulkResult, error) {
+	result := &BulkResult{}
+
+	for i, message := range messages {
+		if err := ctx.Err(); err != nil {
+			for j := i; j < len(messages); j++ {
+				result.Failed = append(result.Failed, BulkFailure{Index: j, Message: messages[j], Err: err})
+			}
+			return result, err
+		}
+
+		response, attempts, err := sg.sendWithRetry(ctx, message)
 		if err != nil {
-			return nil, fmt.Errorf("failed to send email to %s: %w", message.To[0].Email, err)
+			result.Failed = append(result.Failed, BulkFailure{Index: i, Message: message, Attempts: attempts, Err: err})
+			continue
 		}
-		responses = append(responses, response)
+		result.Sent = append(result.Sent, response)
 	}
 
-	return responses, nil
+	return result, nil
+}
+
+// sendWithRetry sends a message, retrying transient failures
+func (sg *SendGridClient) sendWithRetry(ctx context.Context, message *EmailMessage) (*EmailResponse, int, error) {
+	wait := sg.retryWait
+
+	for attempt := 1; ; attempt++ {
+		response, err := sg.SendEmail(ctx, message)
+		if err == nil {
+			return response, attempt, nil
+		}
+		if attempt == bulkSendAttempts || !errors.Is(err, ErrEmailSendTransient) {
+			return nil, attempt, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, attempt, err
+		case <-time.After(wait):
+		}
+		wait *= 2
+	}
 }
 
 // Template represents a SendGrid template
@@ -260,8 +374,8 @@ func (sg *SendGridClient) CreateUnsubscribeGroup(ctx context.Context, name, desc
 	return group, nil
 }
 
-// WebhookEvent represents a SendGrid webhook event
-type WebhookEvent struct {
+// SendGridEvent represents a SendGrid webhook event
+type SendGridEvent struct {
 	Email     string            `json:"email"`
 	Event     string            `json:"event"` // delivered, open, click, bounce, etc.
 	Timestamp int64             `json:"timestamp"`
@@ -269,8 +383,60 @@ type WebhookEvent struct {
 	CustomArgs map[string]string `json:"custom_args,omitempty"`
 }
 
-// HandleWebhook processes SendGrid webhook events
-func (sg *SendGridClient) HandleWebhook(ctx context.Context, events []WebhookEvent) error {
+// VerifyInboundSignature checks a SendGrid signed event webhook request.
+// publicKey is the base64-encoded ECDSA key from the SendGrid settings,
+// payload is the raw request body, and signature and timestamp are the
+// values of the SendGridSignatureHeader and SendGridTimestampHeader headers.
+func VerifyInboundSignature(publicKey, payload []byte, signature, timestamp string) error {
+	der, err := base64.StdEncoding.DecodeString(string(publicKey))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidWebhookKey, err)
+	}
+
+	parsed, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidWebhookKey, err)
+	}
+
+	key, ok := parsed.(*ecdsa.PublicKey)
+	if !ok {
+		return fmt.Errorf("%w: not an ECDSA key", ErrInvalidWebhookKey)
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return ErrInvalidWebhookSignature
+	}
+
+	// SendGrid signs the timestamp followed by the raw body
+	hash := sha256.New()
+	hash.Write([]byte(timestamp))
+	hash.Write(payload)
+
+	if !ecdsa.VerifyASN1(key, hash.Sum(nil), sig) {
+		return ErrInvalidWebhookSignature
+	}
+
+	return nil
+}
+
+// HandleWebhook verifies and processes a batch of SendGrid webhook events.
+// payload is the raw request body; batches that fail signature
+// verification are rejected without being processed.
+func (sg *SendGridClient) HandleWebhook(ctx context.Context, payload []byte, signature, timestamp string) error {
+	if sg.config.WebhookPublicKey == "" {
+		return ErrSendGridNotConfigured
+	}
+
+	if err := VerifyInboundSignature([]byte(sg.config.WebhookPublicKey), payload, signature, timestamp); err != nil {
+		return err
+	}
+
+	var events []SendGridEvent
+	if err := json.Unmarshal(payload, &events); err != nil {
+		return fmt.Errorf("failed to decode webhook events: %w", err)
+	}
+
 	for _, event := range events {
 		switch event.Event {
 		case "delivered":
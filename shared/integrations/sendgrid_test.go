@@ -0,0 +1,277 @@
+package integrations
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// Signed event fixture published with SendGrid's event webhook helpers
+const (
+	testSendGridPublicKey = "MFkwEwYHKoZIzj0CAQYIKoZIzj0DAQcDQgAE83T4O/n84iotIvIW4mdBgQ/7dAfSmpqIM8kF9mN1flpVKS3GRqe62gw+2fNNRaINXvVpiglSI8eNEc6wEA3F+g=="
+	testSendGridSignature = "MEUCIGHQVtGj+Y3LkG9fLcxf3qfI10QysgDWmMOVmxG0u6ZUAiEAyBiXDWzM+uOe5W0JuG+luQAbPIqHh89M15TluLtEZtM="
+	testSendGridTimestamp = "1600112502"
+	testSendGridPayload   = `[{"email":"hello@world.com","event":"dropped","reason":"Bounced Address","sg_event_id":"ZHJvcC0xMDk5NDkxOS1MUnpYbF9OSFN0T0doUTRrb2ZTbV9BLTA","sg_message_id":"LRzXl_NHStOGhQ4kofSm_A.filterdrecv-p3mdw1-756b745b58-kmzbl-18-5F5FC76C-9.0","smtp-id":"<LRzXl_NHStOGhQ4kofSm_A@ismtpd0039p1iad1.sendgrid.net>","timestamp":1600112492}]` + "\r\n"
+)
+
+func TestVerifyInboundSignature(t *testing.T) {
+	tests := []struct {
+		name      string
+		publicKey string
+		payload   string
+		signature string
+		timestamp string
+		wantErr   error
+	}{
+		{
+			name:      "valid signature",
+			publicKey: testSendGridPublicKey,
+			payload:   testSendGridPayload,
+			signature: testSendGridSignature,
+			timestamp: testSendGridTimestamp,
+		},
+		{
+			name:      "tampered payload",
+			publicKey: testSendGridPublicKey,
+			payload:   `[{"email":"hello@world.com","event":"delivered"}]`,
+			signature: testSendGridSignature,
+			timestamp: testSendGridTimestamp,
+			wantErr:   ErrInvalidWebhookSignature,
+		},
+		{
+			name:      "wrong timestamp",
+			publicKey: testSendGridPublicKey,
+			payload:   testSendGridPayload,
+			signature: testSendGridSignature,
+			timestamp: "1600112503",
+			wantErr:   ErrInvalidWebhookSignature,
+		},
+		{
+			name:      "malformed signature",
+			publicKey: testSendGridPublicKey,
+			payload:   testSendGridPayload,
+			signature: "not base64!",
+			timestamp: testSendGridTimestamp,
+			wantErr:   ErrInvalidWebhookSignature,
+		},
+		{
+			name:      "corrupt public key",
+			publicKey: testSendGridPublicKey[:40],
+			payload:   testSendGridPayload,
+			signature: testSendGridSignature,
+			timestamp: testSendGridTimestamp,
+			wantErr:   ErrInvalidWebhookKey,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := VerifyInboundSignature([]byte(tt.publicKey), []byte(tt.payload), tt.signature, tt.timestamp)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("VerifyInboundSignature() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSendGridHandleWebhook_RejectsUnverified(t *testing.T) {
+	client := NewSendGridClient(SendGridConfig{WebhookPublicKey: testSendGridPublicKey})
+	ctx := context.Background()
+
+	if err := client.HandleWebhook(ctx, []byte(testSendGridPayload), testSendGridSignature, testSendGridTimestamp); err != nil {
+		t.Fatalf("HandleWebhook() with valid signature error = %v", err)
+	}
+
+	forged := []byte(`[{"email":"victim@example.com","event":"unsubscribe","timestamp":1600112492}]`)
+	if err := client.HandleWebhook(ctx, forged, testSendGridSignature, testSendGridTimestamp); !errors.Is(err, ErrInvalidWebhookSignature) {
+		t.Errorf("HandleWebhook() with forged batch error = %v, want %v", err, ErrInvalidWebhookSignature)
+	}
+
+	unconfigured := NewSendGridClient(SendGridConfig{})
+	if err := unconfigured.HandleWebhook(ctx, []byte(testSendGridPayload), testSendGridSignature, testSendGridTimestamp); !errors.Is(err, ErrSendGridNotConfigured) {
+		t.Errorf("HandleWebhook() without key error = %v, want %v", err, ErrSendGridNotConfigured)
+	}
+}
+
+// recordingTransport captures sent messages instead of delivering them
+type recordingTransport struct {
+	sent []*EmailMessage
+}
+
+func (t *recordingTransport) Send(ctx context.Context, message *EmailMessage) (*EmailResponse, error) {
+	t.sent = append(t.sent, message)
+	return &EmailResponse{MessageID: fmt.Sprintf("msg_%d", len(t.sent)), Status: "sent", SentAt: time.Now()}, nil
+}
+
+func TestSendEmail_UsesTransport(t *testing.T) {
+	transport := &recordingTransport{}
+	config := SendGridConfig{FromEmail: "noreply@marimo.dev", FromName: "Marimo"}
+	client := NewSendGridClientWithTransport(config, transport)
+
+	message := &EmailMessage{
+		To:          []EmailAddress{{Email: "ada@example.com", Name: "Ada"}, {Email: "bob@example.com"}},
+		Subject:     "Your invoice",
+		TextContent: "See attached.",
+		Attachments: []EmailAttachment{
+			{Filename: "invoice.pdf", Content: []byte("%PDF-1.4"), Type: "application/pdf", Disposition: "attachment"},
+		},
+	}
+
+	response, err := client.SendEmail(context.Background(), message)
+	if err != nil {
+		t.Fatalf("SendEmail() error = %v", err)
+	}
+	if response.MessageID != "msg_1" {
+		t.Errorf("MessageID = %q, want %q", response.MessageID, "msg_1")
+	}
+	if len(transport.sent) != 1 || transport.sent[0] != message {
+		t.Fatalf("transport received %v, want the sent message", transport.sent)
+	}
+
+	// The SendGrid request built from the message
+	m := buildSendGridMail(config, message)
+
+	if m.From.Address != "noreply@marimo.dev" || m.From.Name != "Marimo" {
+		t.Errorf("From = %+v, want configured sender", m.From)
+	}
+	if m.Subject != "Your invoice" {
+		t.Errorf("Subject = %q, want %q", m.Subject, "Your invoice")
+	}
+	if len(m.Personalizations) != 1 || len(m.Personalizations[0].To) != 2 {
+		t.Fatalf("Personalizations = %+v, want one with two recipients", m.Personalizations)
+	}
+	to := m.Personalizations[0].To
+	if to[0].Address != "ada@example.com" || to[0].Name != "Ada" || to[1].Address != "bob@example.com" {
+		t.Errorf("To = %+v, %+v", to[0], to[1])
+	}
+	if len(m.Attachments) != 1 {
+		t.Fatalf("Attachments = %d, want 1", len(m.Attachments))
+	}
+	attachment := m.Attachments[0]
+	if attachment.Filename != "invoice.pdf" || attachment.Type != "application/pdf" || attachment.Disposition != "attachment" {
+		t.Errorf("attachment = %+v", attachment)
+	}
+	if attachment.Content != base64.StdEncoding.EncodeToString([]byte("%PDF-1.4")) {
+		t.Errorf("attachment content = %q, want base64 of the file", attachment.Content)
+	}
+}
+
+func TestSendEmail_NotConfigured(t *testing.T) {
+	client := NewSendGridClient(SendGridConfig{})
+
+	_, err := client.SendEmail(context.Background(), &EmailMessage{To: []EmailAddress{{Email: "ada@example.com"}}})
+	if !errors.Is(err, ErrSendGridNotConfigured) {
+		t.Errorf("SendEmail() error = %v, want %v", err, ErrSendGridNotConfigured)
+	}
+}
+
+func TestSendEmail_SendAt(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name    string
+		sendAt  time.Time
+		wantErr bool
+	}{
+		{name: "in the past", sendAt: now.Add(-time.Minute), wantErr: true},
+		{name: "beyond 72 hours", sendAt: now.Add(73 * time.Hour), wantErr: true},
+		{name: "valid schedule", sendAt: now.Add(24 * time.Hour)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport := &recordingTransport{}
+			client := NewSendGridClientWithTransport(SendGridConfig{}, transport)
+
+			sendAt := tt.sendAt
+			message := &EmailMessage{To: []EmailAddress{{Email: "ada@example.com"}}, Subject: "Reminder", SendAt: &sendAt}
+
+			response, err := client.SendEmail(context.Background(), message)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidSendAt) {
+					t.Errorf("SendEmail() error = %v, want %v", err, ErrInvalidSendAt)
+				}
+				if len(transport.sent) != 0 {
+					t.Error("invalid schedule should not reach the transport")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("SendEmail() error = %v", err)
+			}
+			if response.Status != "scheduled" {
+				t.Errorf("Status = %q, want %q", response.Status, "scheduled")
+			}
+			if response.ScheduledAt == nil || !response.ScheduledAt.Equal(sendAt) {
+				t.Errorf("ScheduledAt = %v, want %v", response.ScheduledAt, sendAt)
+			}
+			if m := buildSendGridMail(SendGridConfig{}, message); m.SendAt != int(sendAt.Unix()) {
+				t.Errorf("SendGrid send_at = %d, want %d", m.SendAt, sendAt.Unix())
+			}
+		})
+	}
+}
+
+// flakyTransport fails every send to the given recipient with a transient error
+type flakyTransport struct {
+	failTo string
+	calls  map[string]int
+}
+
+func (t *flakyTransport) Send(ctx context.Context, message *EmailMessage) (*EmailResponse, error) {
+	to := message.To[0].Email
+	t.calls[to]++
+	if to == t.failTo {
+		return nil, fmt.Errorf("%w: %w: HTTP 503", ErrEmailSendFailed, ErrEmailSendTransient)
+	}
+	return &EmailResponse{MessageID: "msg_" + to, Status: "sent", SentAt: time.Now()}, nil
+}
+
+func TestSendBulkEmail_PartialFailure(t *testing.T) {
+	transport := &flakyTransport{failTo: "user2@example.com", calls: make(map[string]int)}
+	client := NewSendGridClientWithTransport(SendGridConfig{}, transport)
+	client.retryWait = time.Millisecond
+
+	var messages []*EmailMessage
+	for i := 1; i <= 5; i++ {
+		messages = append(messages, &EmailMessage{
+			To:      []EmailAddress{{Email: fmt.Sprintf("user%d@example.com", i)}},
+			Subject: "Newsletter",
+		})
+	}
+
+	result, err := client.SendBulkEmail(context.Background(), messages)
+	if err != nil {
+		t.Fatalf("SendBulkEmail() error = %v", err)
+	}
+
+	if len(result.Sent) != 4 {
+		t.Errorf("Sent = %d, want 4", len(result.Sent))
+	}
+	for _, response := range result.Sent {
+		if response.MessageID == "msg_user2@example.com" {
+			t.Error("failed recipient reported as sent")
+		}
+	}
+
+	if len(result.Failed) != 1 {
+		t.Fatalf("Failed = %d, want 1", len(result.Failed))
+	}
+	failure := result.Failed[0]
+	if failure.Index != 1 || failure.Message != messages[1] {
+		t.Errorf("failure = %+v, want the second message", failure)
+	}
+	if failure.Attempts != bulkSendAttempts || transport.calls["user2@example.com"] != bulkSendAttempts {
+		t.Errorf("attempts = %d (transport saw %d), want %d", failure.Attempts, transport.calls["user2@example.com"], bulkSendAttempts)
+	}
+	if !errors.Is(failure.Err, ErrEmailSendTransient) {
+		t.Errorf("failure error = %v", failure.Err)
+	}
+	if transport.calls["user1@example.com"] != 1 {
+		t.Errorf("successful recipient sent %d times, want 1", transport.calls["user1@example.com"])
+	}
+}
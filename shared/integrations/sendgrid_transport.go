@@ -0,0 +1,126 @@
+package integrations
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/sendgrid/sendgrid-go"
+	"github.com/sendgrid/sendgrid-go/helpers/mail"
+)
+
+// Transport delivers email messages. The default transport sends through
+// the SendGrid API; tests can inject their own.
+type Transport interface {
+	Send(ctx context.Context, message *EmailMessage) (*EmailResponse, error)
+}
+
+// sendGridTransport sends email through the SendGrid v3 mail API
+type sendGridTransport struct {
+	client *sendgrid.Client
+	config SendGridConfig
+}
+
+func newSendGridTransport(config SendGridConfig) *sendGridTransport {
+	return &sendGridTransport{
+		client: sendgrid.NewSendClient(config.APIKey),
+		config: config,
+	}
+}
+
+// Send sends a message and returns the SendGrid message ID
+func (t *sendGridTransport) Send(ctx context.Context, message *EmailMessage) (*EmailResponse, error) {
+	resp, err := t.client.SendWithContext(ctx, buildSendGridMail(t.config, message))
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("%w: %w", ErrEmailSendFailed, ctx.Err())
+		}
+		// Network errors are worth retrying
+		return nil, fmt.Errorf("%w: %w: %v", ErrEmailSendFailed, ErrEmailSendTransient, err)
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		return nil, fmt.Errorf("%w: %w: HTTP %d: %s", ErrEmailSendFailed, ErrEmailSendTransient, resp.StatusCode, resp.Body)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("%w: HTTP %d: %s", ErrEmailSendFailed, resp.StatusCode, resp.Body)
+	}
+
+	var messageID string
+	if ids := http.Header(resp.Headers).Values("X-Message-Id"); len(ids) > 0 {
+		messageID = ids[0]
+	}
+
+	return &EmailResponse{
+		MessageID: messageID,
+		Status:    "sent",
+		SentAt:    time.Now(),
+	}, nil
+}
+
+// buildSendGridMail maps an EmailMessage onto the SendGrid v3 mail format
+func buildSendGridMail(config SendGridConfig, message *EmailMessage) *mail.SGMailV3 {
+	m := mail.NewV3Mail()
+	m.SetFrom(mail.NewEmail(config.FromName, config.FromEmail))
+	m.Subject = message.Subject
+
+	if config.ReplyTo != "" {
+		m.SetReplyTo(mail.NewEmail("", config.ReplyTo))
+	}
+
+	p := mail.NewPersonalization()
+	for _, to := range message.To {
+		p.AddTos(mail.NewEmail(to.Name, to.Email))
+	}
+	for _, cc := range message.CC {
+		p.AddCCs(mail.NewEmail(cc.Name, cc.Email))
+	}
+	for _, bcc := range message.BCC {
+		p.AddBCCs(mail.NewEmail(bcc.Name, bcc.Email))
+	}
+	m.AddPersonalizations(p)
+
+	// SendGrid requires text/plain before text/html
+	if message.TextContent != "" {
+		m.AddContent(mail.NewContent("text/plain", message.TextContent))
+	}
+	if message.HTMLContent != "" {
+		m.AddContent(mail.NewContent("text/html", message.HTMLContent))
+	}
+
+	for _, attachment := range message.Attachments {
+		a := mail.NewAttachment().
+			SetFilename(attachment.Filename).
+			SetContent(base64.StdEncoding.EncodeToString(attachment.Content)).
+			SetType(attachment.Type)
+		if attachment.Disposition != "" {
+			a.SetDisposition(attachment.Disposition)
+		}
+		m.AddAttachment(a)
+	}
+
+	for key, value := range message.Headers {
+		m.SetHeader(key, value)
+	}
+	if message.SendAt != nil {
+		m.SetSendAt(int(message.SendAt.Unix()))
+	}
+	if len(message.Categories) > 0 {
+		m.AddCategories(message.Categories...)
+	}
+	for key, value := range message.CustomArgs {
+		m.SetCustomArg(key, value)
+	}
+
+	tracking := message.TrackingSettings
+	m.SetTrackingSettings(&mail.TrackingSettings{
+		ClickTracking:        &mail.ClickTrackingSetting{Enable: &tracking.ClickTracking},
+		OpenTracking:         &mail.OpenTrackingSetting{Enable: &tracking.OpenTracking},
+		SubscriptionTracking: &mail.SubscriptionTrackingSetting{Enable: &tracking.SubscriptionTracking},
+	})
+
+	return m
+}
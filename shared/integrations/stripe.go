@@ -10,9 +10,12 @@ import (
 )
 
 var (
-	ErrStripeNotConfigured = errors.New("Stripe is not configured")
-	ErrPaymentFailed       = errors.New("payment failed")
-	ErrInvalidAmount       = errors.New("invalid amount")
+	ErrStripeNotConfigured   = errors.New("Stripe is not configured")
+	ErrPaymentFailed         = errors.New("payment failed")
+	ErrInvalidAmount         = errors.New("invalid amount")
+	ErrPaymentIntentNotFound = errors.New("payment intent not found")
+	ErrSubscriptionNotFound  = errors.New("subscription not found")
+	ErrPriceNotFound         = errors.New("price not found")
 )
 
 // StripeConfig holds Stripe API configuration
@@ -24,12 +27,18 @@ type StripeConfig struct {
 
 // StripeClient wraps Stripe API operations
 type StripeClient struct {
-	config StripeConfig
+	config  StripeConfig
+	backend stripeBackend
 }
 
-// NewStripeClient creates a new Stripe client
+// NewStripeClient creates a new Stripe client. Without config.APIKey, API
+// calls return ErrStripeNotConfigured.
 func NewStripeClient(config StripeConfig) *StripeClient {
-	return &StripeClient{config: config}
+	client := &StripeClient{config: config}
+	if config.APIKey != "" {
+		client.backend = newStripeAPIBackend(config.APIKey)
+	}
+	return client
 }
 
 // CustomerCreateParams parameters for creating a customer
@@ -38,6 +47,11 @@ type CustomerCreateParams struct {
 	Name        string
 	Description string
 	Metadata    map[string]string
+
+	// IdempotencyKey, if set, is sent as Stripe's Idempotency-Key header.
+	// Retrying with the same key returns the customer created by the
+	// first request instead of creating a duplicate.
+	IdempotencyKey string
 }
 
 // Customer represents a Stripe customer
@@ -52,25 +66,11 @@ type Customer struct {
 
 // CreateCustomer creates a new Stripe customer
 func (sc *StripeClient) CreateCustomer(ctx context.Context, params CustomerCreateParams) (*Customer, error) {
-	// In real implementation, use Stripe SDK:
-	// stripe.Key = sc.config.APIKey
-	// customer, err := customer.New(&stripe.CustomerParams{
-	//     Email: stripe.String(params.Email),
-	//     Name:  stripe.String(params.Name),
-	//     ...
-	// })
-
-	// Mock implementation
-	customer := &Customer{
-		ID:          fmt.Sprintf("cus_%s", uuid.New().String()[:8]),
-		Email:       params.Email,
-		Name:        params.Name,
-		Description: params.Description,
-		Metadata:    params.Metadata,
-		CreatedAt:   time.Now(),
+	if sc.backend == nil {
+		return nil, ErrStripeNotConfigured
 	}
 
-	return customer, nil
+	return sc.backend.CreateCustomer(ctx, params)
 }
 
 // PaymentIntentCreateParams parameters for creating a payment intent
@@ -80,6 +80,11 @@ type PaymentIntentCreateParams struct {
 	CustomerID  string
 	Description string
 	Metadata    map[string]string
+
+	// IdempotencyKey, if set, is sent as Stripe's Idempotency-Key header.
+	// Retrying with the same key returns the payment intent created by
+	// the first request instead of charging twice.
+	IdempotencyKey string
 }
 
 // PaymentIntent represents a Stripe payment intent
@@ -100,28 +105,21 @@ func (sc *StripeClient) CreatePaymentIntent(ctx context.Context, params PaymentI
 		return nil, ErrInvalidAmount
 	}
 
-	// In real implementation, use Stripe SDK:
-	// stripe.Key = sc.config.APIKey
-	// pi, err := paymentintent.New(&stripe.PaymentIntentParams{
-	//     Amount:   stripe.Int64(params.Amount),
-	//     Currency: stripe.String(params.Currency),
-	//     Customer: stripe.String(params.CustomerID),
-	//     ...
-	// })
+	if sc.backend == nil {
+		return nil, ErrStripeNotConfigured
+	}
 
-	// Mock implementation
-	intent := &PaymentIntent{
-		ID:           fmt.Sprintf("pi_%s", uuid.New().String()[:8]),
-		Amount:       params.Amount,
-		Currency:     params.Currency,
-		Status:       "requires_payment_method",
-		CustomerID:   params.CustomerID,
-		ClientSecret: fmt.Sprintf("pi_%s_secret_%s", uuid.New().String()[:8], uuid.New().String()[:8]),
-		Metadata:     params.Metadata,
-		CreatedAt:    time.Now(),
+	return sc.backend.CreatePaymentIntent(ctx, params)
+}
+
+// ConfirmPaymentIntent confirms a payment intent with the given payment
+// method, charging the customer
+func (sc *StripeClient) ConfirmPaymentIntent(ctx context.Context, intentID, paymentMethodID string) (*PaymentIntent, error) {
+	if sc.backend == nil {
+		return nil, ErrStripeNotConfigured
 	}
 
-	return intent, nil
+	return sc.backend.ConfirmPaymentIntent(ctx, intentID, paymentMethodID)
 }
 
 // SubscriptionCreateParams parameters for creating a subscription
@@ -137,62 +135,72 @@ type SubscriptionCreateParams struct {
 type Subscription struct {
 	ID                 string            `json:"id"`
 	CustomerID         string            `json:"customer_id"`
+	PriceID            string            `json:"price_id"`
+	Quantity           int64             `json:"quantity"`
 	Status             string            `json:"status"`
 	CurrentPeriodStart time.Time         `json:"current_period_start"`
 	CurrentPeriodEnd   time.Time         `json:"current_period_end"`
 	CancelAt           *time.Time        `json:"cancel_at,omitempty"`
+	CancelAtPeriodEnd  bool              `json:"cancel_at_period_end"`
 	Metadata           map[string]string `json:"metadata"`
 	CreatedAt          time.Time         `json:"created_at"`
 }
 
 // CreateSubscription creates a new subscription
 func (sc *StripeClient) CreateSubscription(ctx context.Context, params SubscriptionCreateParams) (*Subscription, error) {
-	// In real implementation, use Stripe SDK:
-	// stripe.Key = sc.config.APIKey
-	// sub, err := subscription.New(&stripe.SubscriptionParams{
-	//     Customer: stripe.String(params.CustomerID),
-	//     Items: []*stripe.SubscriptionItemsParams{
-	//         {Price: stripe.String(params.PriceID)},
-	//     },
-	//     TrialPeriodDays: stripe.Int64(params.TrialDays),
-	//     ...
-	// })
-
-	// Mock implementation
-	now := time.Now()
-	trialEnd := now.AddDate(0, 0, params.TrialDays)
-
-	subscription := &Subscription{
-		ID:                 fmt.Sprintf("sub_%s", uuid.New().String()[:8]),
-		CustomerID:         params.CustomerID,
-		Status:             "trialing",
-		CurrentPeriodStart: now,
-		CurrentPeriodEnd:   trialEnd,
-		Metadata:           params.Metadata,
-		CreatedAt:          now,
+	if sc.backend == nil {
+		return nil, ErrStripeNotConfigured
 	}
 
-	return subscription, nil
+	return sc.backend.CreateSubscription(ctx, params)
 }
 
-// CancelSubscription cancels a subscription
+// CancelSubscription cancels a subscription, either immediately or at the
+// end of the current billing period
 func (sc *StripeClient) CancelSubscription(ctx context.Context, subscriptionID string, cancelAtPeriodEnd bool) (*Subscription, error) {
-	// In real implementation:
-	// params := &stripe.SubscriptionCancelParams{
-	//     CancelAtPeriodEnd: stripe.Bool(cancelAtPeriodEnd),
-	// }
-	// sub, err := subscription.Cancel(subscriptionID, params)
+	if sc.backend == nil {
+		return nil, ErrStripeNotConfigured
+	}
 
-	// Mock implementation
-	now := time.Now()
-	sub := &Subscription{
-		ID:         subscriptionID,
-		Status:     "canceled",
-		CancelAt:   &now,
-		CreatedAt:  now,
+	return sc.backend.CancelSubscription(ctx, subscriptionID, cancelAtPeriodEnd)
+}
+
+// ProrationPreview shows what switching a subscription to another price
+// would cost. Amounts are in the smallest currency unit.
+type ProrationPreview struct {
+	SubscriptionID string `json:"subscription_id"`
+	NewPriceID     string `json:"new_price_id"`
+	Currency       string `json:"currency"`
+
+	// AmountDue is charged immediately for the rest of the current period
+	AmountDue int64 `json:"amount_due"`
+	// NextInvoiceAmount is the next regular invoice at the new price, less
+	// any credit left over when the change is a downgrade
+	NextInvoiceAmount int64 `json:"next_invoice_amount"`
+
+	ProrationDate time.Time `json:"proration_date"`
+	PeriodStart   time.Time `json:"period_start"`
+	PeriodEnd     time.Time `json:"period_end"`
+}
+
+// PreviewSubscriptionChange previews the prorated charges of moving a
+// subscription to newPriceID without changing it
+func (sc *StripeClient) PreviewSubscriptionChange(ctx context.Context, subscriptionID, newPriceID string) (*ProrationPreview, error) {
+	if sc.backend == nil {
+		return nil, ErrStripeNotConfigured
 	}
 
-	return sub, nil
+	return sc.backend.PreviewSubscriptionChange(ctx, subscriptionID, newPriceID)
+}
+
+// splitProration turns the net proration for the rest of a period into the
+// amount due now and the adjustment carried to the next invoice. Upgrades
+// are charged immediately; downgrade credit reduces the next invoice.
+func splitProration(net int64) (dueNow, nextInvoiceAdjustment int64) {
+	if net > 0 {
+		return net, 0
+	}
+	return 0, net
 }
 
 // Invoice represents a Stripe invoice
@@ -0,0 +1,253 @@
+package integrations
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/stripe/stripe-go/v76"
+	"github.com/stripe/stripe-go/v76/customer"
+	"github.com/stripe/stripe-go/v76/invoice"
+	"github.com/stripe/stripe-go/v76/paymentintent"
+	"github.com/stripe/stripe-go/v76/subscription"
+)
+
+// stripeBackend performs the Stripe API calls behind StripeClient. The
+// default backend talks to Stripe; memoryStripeBackend fakes it in memory.
+type stripeBackend interface {
+	CreateCustomer(ctx context.Context, params CustomerCreateParams) (*Customer, error)
+	CreatePaymentIntent(ctx context.Context, params PaymentIntentCreateParams) (*PaymentIntent, error)
+	ConfirmPaymentIntent(ctx context.Context, intentID, paymentMethodID string) (*PaymentIntent, error)
+	CreateSubscription(ctx context.Context, params SubscriptionCreateParams) (*Subscription, error)
+	CancelSubscription(ctx context.Context, subscriptionID string, cancelAtPeriodEnd bool) (*Subscription, error)
+	PreviewSubscriptionChange(ctx context.Context, subscriptionID, newPriceID string) (*ProrationPreview, error)
+}
+
+// stripeAPIBackend calls the Stripe API through stripe-go
+type stripeAPIBackend struct {
+	customers     customer.Client
+	intents       paymentintent.Client
+	subscriptions subscription.Client
+	invoices      invoice.Client
+}
+
+func newStripeAPIBackend(apiKey string) *stripeAPIBackend {
+	backend := stripe.GetBackend(stripe.APIBackend)
+	return &stripeAPIBackend{
+		customers:     customer.Client{B: backend, Key: apiKey},
+		intents:       paymentintent.Client{B: backend, Key: apiKey},
+		subscriptions: subscription.Client{B: backend, Key: apiKey},
+		invoices:      invoice.Client{B: backend, Key: apiKey},
+	}
+}
+
+func (b *stripeAPIBackend) CreateCustomer(ctx context.Context, params CustomerCreateParams) (*Customer, error) {
+	p := &stripe.CustomerParams{
+		Email:       stripe.String(params.Email),
+		Name:        stripe.String(params.Name),
+		Description: stripe.String(params.Description),
+	}
+	p.Context = ctx
+	if params.IdempotencyKey != "" {
+		p.SetIdempotencyKey(params.IdempotencyKey)
+	}
+	for key, value := range params.Metadata {
+		p.AddMetadata(key, value)
+	}
+
+	c, err := b.customers.New(p)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Customer{
+		ID:          c.ID,
+		Email:       c.Email,
+		Name:        c.Name,
+		Description: c.Description,
+		Metadata:    c.Metadata,
+		CreatedAt:   time.Unix(c.Created, 0),
+	}, nil
+}
+
+func (b *stripeAPIBackend) CreatePaymentIntent(ctx context.Context, params PaymentIntentCreateParams) (*PaymentIntent, error) {
+	p := &stripe.PaymentIntentParams{
+		Amount:      stripe.Int64(params.Amount),
+		Currency:    stripe.String(params.Currency),
+		Description: stripe.String(params.Description),
+	}
+	p.Context = ctx
+	if params.CustomerID != "" {
+		p.Customer = stripe.String(params.CustomerID)
+	}
+	if params.IdempotencyKey != "" {
+		p.SetIdempotencyKey(params.IdempotencyKey)
+	}
+	for key, value := range params.Metadata {
+		p.AddMetadata(key, value)
+	}
+
+	pi, err := b.intents.New(p)
+	if err != nil {
+		return nil, err
+	}
+
+	return fromStripePaymentIntent(pi), nil
+}
+
+func (b *stripeAPIBackend) ConfirmPaymentIntent(ctx context.Context, intentID, paymentMethodID string) (*PaymentIntent, error) {
+	p := &stripe.PaymentIntentConfirmParams{
+		PaymentMethod: stripe.String(paymentMethodID),
+	}
+	p.Context = ctx
+
+	pi, err := b.intents.Confirm(intentID, p)
+	if err != nil {
+		return nil, err
+	}
+
+	return fromStripePaymentIntent(pi), nil
+}
+
+func (b *stripeAPIBackend) CreateSubscription(ctx context.Context, params SubscriptionCreateParams) (*Subscription, error) {
+	item := &stripe.SubscriptionItemsParams{Price: stripe.String(params.PriceID)}
+	if params.Quantity > 0 {
+		item.Quantity = stripe.Int64(params.Quantity)
+	}
+
+	p := &stripe.SubscriptionParams{
+		Customer: stripe.String(params.CustomerID),
+		Items:    []*stripe.SubscriptionItemsParams{item},
+	}
+	p.Context = ctx
+	if params.TrialDays > 0 {
+		p.TrialPeriodDays = stripe.Int64(int64(params.TrialDays))
+	}
+	for key, value := range params.Metadata {
+		p.AddMetadata(key, value)
+	}
+
+	sub, err := b.subscriptions.New(p)
+	if err != nil {
+		return nil, err
+	}
+
+	return fromStripeSubscription(sub), nil
+}
+
+func (b *stripeAPIBackend) CancelSubscription(ctx context.Context, subscriptionID string, cancelAtPeriodEnd bool) (*Subscription, error) {
+	var (
+		sub *stripe.Subscription
+		err error
+	)
+
+	// Stripe cancels at period end through an update rather than a cancel
+	if cancelAtPeriodEnd {
+		p := &stripe.SubscriptionParams{CancelAtPeriodEnd: stripe.Bool(true)}
+		p.Context = ctx
+		sub, err = b.subscriptions.Update(subscriptionID, p)
+	} else {
+		p := &stripe.SubscriptionCancelParams{}
+		p.Context = ctx
+		sub, err = b.subscriptions.Cancel(subscriptionID, p)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return fromStripeSubscription(sub), nil
+}
+
+func (b *stripeAPIBackend) PreviewSubscriptionChange(ctx context.Context, subscriptionID, newPriceID string) (*ProrationPreview, error) {
+	getParams := &stripe.SubscriptionParams{}
+	getParams.Context = ctx
+
+	sub, err := b.subscriptions.Get(subscriptionID, getParams)
+	if err != nil {
+		return nil, err
+	}
+	if sub.Items == nil || len(sub.Items.Data) == 0 {
+		return nil, fmt.Errorf("subscription %s has no items", subscriptionID)
+	}
+
+	// Ask Stripe for the upcoming invoice as if the price had changed now
+	prorationDate := time.Now()
+	p := &stripe.InvoiceUpcomingParams{
+		Customer:     stripe.String(sub.Customer.ID),
+		Subscription: stripe.String(subscriptionID),
+		SubscriptionItems: []*stripe.SubscriptionItemsParams{
+			{ID: stripe.String(sub.Items.Data[0].ID), Price: stripe.String(newPriceID)},
+		},
+		SubscriptionProrationDate: stripe.Int64(prorationDate.Unix()),
+	}
+	p.Context = ctx
+
+	upcoming, err := b.invoices.Upcoming(p)
+	if err != nil {
+		return nil, err
+	}
+
+	var net int64
+	if upcoming.Lines != nil {
+		for _, line := range upcoming.Lines.Data {
+			if line.Proration {
+				net += line.Amount
+			}
+		}
+	}
+
+	dueNow, adjustment := splitProration(net)
+	return &ProrationPreview{
+		SubscriptionID:    subscriptionID,
+		NewPriceID:        newPriceID,
+		Currency:          string(upcoming.Currency),
+		AmountDue:         dueNow,
+		NextInvoiceAmount: upcoming.Total - net + adjustment,
+		ProrationDate:     prorationDate,
+		PeriodStart:       time.Unix(sub.CurrentPeriodStart, 0),
+		PeriodEnd:         time.Unix(sub.CurrentPeriodEnd, 0),
+	}, nil
+}
+
+func fromStripePaymentIntent(pi *stripe.PaymentIntent) *PaymentIntent {
+	intent := &PaymentIntent{
+		ID:           pi.ID,
+		Amount:       pi.Amount,
+		Currency:     string(pi.Currency),
+		Status:       string(pi.Status),
+		ClientSecret: pi.ClientSecret,
+		Metadata:     pi.Metadata,
+		CreatedAt:    time.Unix(pi.Created, 0),
+	}
+	if pi.Customer != nil {
+		intent.CustomerID = pi.Customer.ID
+	}
+	return intent
+}
+
+func fromStripeSubscription(sub *stripe.Subscription) *Subscription {
+	s := &Subscription{
+		ID:                 sub.ID,
+		Status:             string(sub.Status),
+		CurrentPeriodStart: time.Unix(sub.CurrentPeriodStart, 0),
+		CurrentPeriodEnd:   time.Unix(sub.CurrentPeriodEnd, 0),
+		CancelAtPeriodEnd:  sub.CancelAtPeriodEnd,
+		Metadata:           sub.Metadata,
+		CreatedAt:          time.Unix(sub.Created, 0),
+	}
+	if sub.Customer != nil {
+		s.CustomerID = sub.Customer.ID
+	}
+	if sub.CancelAt > 0 {
+		cancelAt := time.Unix(sub.CancelAt, 0)
+		s.CancelAt = &cancelAt
+	}
+	if sub.Items != nil && len(sub.Items.Data) > 0 {
+		item := sub.Items.Data[0]
+		s.Quantity = item.Quantity
+		if item.Price != nil {
+			s.PriceID = item.Price.ID
+		}
+	}
+	return s
+}
@@ -0,0 +1,262 @@
+package integrations
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Test payment methods understood by the in-memory backend, mirroring
+// Stripe's test mode
+const (
+	TestPaymentMethodVisa     = "pm_card_visa"
+	TestPaymentMethodDeclined = "pm_card_chargeDeclined"
+)
+
+// StripePrice is a recurring price known to the in-memory Stripe backend
+type StripePrice struct {
+	ID         string
+	UnitAmount int64 // per billing period, in the smallest currency unit
+	Currency   string
+}
+
+// memoryStripeBackend fakes the Stripe API in memory for local development
+// and tests
+type memoryStripeBackend struct {
+	mu            sync.Mutex
+	customers     map[string]*Customer
+	intents       map[string]*PaymentIntent
+	subscriptions map[string]*Subscription
+	prices        map[string]StripePrice
+	now           func() time.Time
+
+	// Objects created per idempotency key, like Stripe's replay of
+	// requests that reuse a key
+	customerKeys map[string]string
+	intentKeys   map[string]string
+}
+
+func newMemoryStripeBackend() *memoryStripeBackend {
+	return &memoryStripeBackend{
+		customers:     make(map[string]*Customer),
+		intents:       make(map[string]*PaymentIntent),
+		subscriptions: make(map[string]*Subscription),
+		prices:        make(map[string]StripePrice),
+		now:           time.Now,
+		customerKeys:  make(map[string]string),
+		intentKeys:    make(map[string]string),
+	}
+}
+
+// NewInMemoryStripeClient creates a Stripe client backed by an in-memory fake
+// of the Stripe API. No requests leave the process. prices are needed only
+// for proration previews.
+func NewInMemoryStripeClient(config StripeConfig, prices ...StripePrice) *StripeClient {
+	backend := newMemoryStripeBackend()
+	for _, price := range prices {
+		backend.prices[price.ID] = price
+	}
+	return &StripeClient{config: config, backend: backend}
+}
+
+func (b *memoryStripeBackend) CreateCustomer(ctx context.Context, params CustomerCreateParams) (*Customer, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if id, ok := b.customerKeys[params.IdempotencyKey]; ok && params.IdempotencyKey != "" {
+		c := *b.customers[id]
+		return &c, nil
+	}
+
+	customer := &Customer{
+		ID:          fmt.Sprintf("cus_%s", uuid.New().String()[:8]),
+		Email:       params.Email,
+		Name:        params.Name,
+		Description: params.Description,
+		Metadata:    params.Metadata,
+		CreatedAt:   b.now(),
+	}
+	b.customers[customer.ID] = customer
+	if params.IdempotencyKey != "" {
+		b.customerKeys[params.IdempotencyKey] = customer.ID
+	}
+
+	c := *customer
+	return &c, nil
+}
+
+func (b *memoryStripeBackend) CreatePaymentIntent(ctx context.Context, params PaymentIntentCreateParams) (*PaymentIntent, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if id, ok := b.intentKeys[params.IdempotencyKey]; ok && params.IdempotencyKey != "" {
+		pi := *b.intents[id]
+		return &pi, nil
+	}
+
+	if params.CustomerID != "" {
+		if _, ok := b.customers[params.CustomerID]; !ok {
+			return nil, fmt.Errorf("no such customer: %s", params.CustomerID)
+		}
+	}
+
+	id := fmt.Sprintf("pi_%s", uuid.New().String()[:8])
+	intent := &PaymentIntent{
+		ID:           id,
+		Amount:       params.Amount,
+		Currency:     params.Currency,
+		Status:       "requires_payment_method",
+		CustomerID:   params.CustomerID,
+		ClientSecret: fmt.Sprintf("%s_secret_%s", id, uuid.New().String()[:8]),
+		Metadata:     params.Metadata,
+		CreatedAt:    b.now(),
+	}
+	b.intents[intent.ID] = intent
+	if params.IdempotencyKey != "" {
+		b.intentKeys[params.IdempotencyKey] = intent.ID
+	}
+
+	pi := *intent
+	return &pi, nil
+}
+
+func (b *memoryStripeBackend) ConfirmPaymentIntent(ctx context.Context, intentID, paymentMethodID string) (*PaymentIntent, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	intent, ok := b.intents[intentID]
+	if !ok {
+		return nil, ErrPaymentIntentNotFound
+	}
+
+	if intent.Status != "requires_payment_method" && intent.Status != "requires_confirmation" {
+		return nil, fmt.Errorf("payment intent %s cannot be confirmed in status %s", intentID, intent.Status)
+	}
+
+	if paymentMethodID == TestPaymentMethodDeclined {
+		// A declined card leaves the intent waiting for a new payment method
+		intent.Status = "requires_payment_method"
+		return nil, fmt.Errorf("%w: card declined", ErrPaymentFailed)
+	}
+
+	intent.Status = "succeeded"
+
+	pi := *intent
+	return &pi, nil
+}
+
+func (b *memoryStripeBackend) CreateSubscription(ctx context.Context, params SubscriptionCreateParams) (*Subscription, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.customers[params.CustomerID]; !ok {
+		return nil, fmt.Errorf("no such customer: %s", params.CustomerID)
+	}
+
+	quantity := params.Quantity
+	if quantity <= 0 {
+		quantity = 1
+	}
+
+	now := b.now()
+	status := "active"
+	periodEnd := now.AddDate(0, 1, 0)
+	if params.TrialDays > 0 {
+		status = "trialing"
+		periodEnd = now.AddDate(0, 0, params.TrialDays)
+	}
+
+	sub := &Subscription{
+		ID:                 fmt.Sprintf("sub_%s", uuid.New().String()[:8]),
+		CustomerID:         params.CustomerID,
+		PriceID:            params.PriceID,
+		Quantity:           quantity,
+		Status:             status,
+		CurrentPeriodStart: now,
+		CurrentPeriodEnd:   periodEnd,
+		Metadata:           params.Metadata,
+		CreatedAt:          now,
+	}
+	b.subscriptions[sub.ID] = sub
+
+	s := *sub
+	return &s, nil
+}
+
+func (b *memoryStripeBackend) CancelSubscription(ctx context.Context, subscriptionID string, cancelAtPeriodEnd bool) (*Subscription, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	sub, ok := b.subscriptions[subscriptionID]
+	if !ok {
+		return nil, ErrSubscriptionNotFound
+	}
+
+	if cancelAtPeriodEnd {
+		cancelAt := sub.CurrentPeriodEnd
+		sub.CancelAt = &cancelAt
+		sub.CancelAtPeriodEnd = true
+	} else {
+		now := b.now()
+		sub.CancelAt = &now
+		sub.Status = "canceled"
+	}
+
+	s := *sub
+	return &s, nil
+}
+
+// PreviewSubscriptionChange prorates linearly over the current period: the
+// unused share of the old price is credited and the same share of the new
+// price is charged.
+func (b *memoryStripeBackend) PreviewSubscriptionChange(ctx context.Context, subscriptionID, newPriceID string) (*ProrationPreview, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	sub, ok := b.subscriptions[subscriptionID]
+	if !ok {
+		return nil, ErrSubscriptionNotFound
+	}
+	if sub.Status == "canceled" {
+		return nil, fmt.Errorf("subscription %s is canceled", subscriptionID)
+	}
+
+	oldPrice, ok := b.prices[sub.PriceID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrPriceNotFound, sub.PriceID)
+	}
+	newPrice, ok := b.prices[newPriceID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrPriceNotFound, newPriceID)
+	}
+
+	now := b.now()
+	period := sub.CurrentPeriodEnd.Sub(sub.CurrentPeriodStart)
+	remaining := sub.CurrentPeriodEnd.Sub(now)
+	if remaining < 0 {
+		remaining = 0
+	}
+	if remaining > period {
+		remaining = period
+	}
+	share := float64(remaining) / float64(period)
+
+	credit := int64(math.Round(float64(oldPrice.UnitAmount*sub.Quantity) * share))
+	charge := int64(math.Round(float64(newPrice.UnitAmount*sub.Quantity) * share))
+
+	dueNow, adjustment := splitProration(charge - credit)
+	return &ProrationPreview{
+		SubscriptionID:    subscriptionID,
+		NewPriceID:        newPriceID,
+		Currency:          newPrice.Currency,
+		AmountDue:         dueNow,
+		NextInvoiceAmount: newPrice.UnitAmount*sub.Quantity + adjustment,
+		ProrationDate:     now,
+		PeriodStart:       sub.CurrentPeriodStart,
+		PeriodEnd:         sub.CurrentPeriodEnd,
+	}, nil
+}
@@ -0,0 +1,228 @@
+package integrations
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestStripePaymentIntentLifecycle(t *testing.T) {
+	client := NewInMemoryStripeClient(StripeConfig{})
+	ctx := context.Background()
+
+	customer, err := client.CreateCustomer(ctx, CustomerCreateParams{Email: "ada@example.com", Name: "Ada"})
+	if err != nil {
+		t.Fatalf("CreateCustomer() error = %v", err)
+	}
+
+	intent, err := client.CreatePaymentIntent(ctx, PaymentIntentCreateParams{
+		Amount:     4200,
+		Currency:   "usd",
+		CustomerID: customer.ID,
+	})
+	if err != nil {
+		t.Fatalf("CreatePaymentIntent() error = %v", err)
+	}
+	if intent.Status != "requires_payment_method" {
+		t.Errorf("new intent status = %q, want requires_payment_method", intent.Status)
+	}
+	if intent.CustomerID != customer.ID || intent.Amount != 4200 || intent.ClientSecret == "" {
+		t.Errorf("intent = %+v", intent)
+	}
+
+	// A declined card leaves the intent open for another attempt
+	if _, err := client.ConfirmPaymentIntent(ctx, intent.ID, TestPaymentMethodDeclined); !errors.Is(err, ErrPaymentFailed) {
+		t.Fatalf("ConfirmPaymentIntent(declined) error = %v, want %v", err, ErrPaymentFailed)
+	}
+
+	confirmed, err := client.ConfirmPaymentIntent(ctx, intent.ID, TestPaymentMethodVisa)
+	if err != nil {
+		t.Fatalf("ConfirmPaymentIntent() error = %v", err)
+	}
+	if confirmed.Status != "succeeded" {
+		t.Errorf("confirmed status = %q, want succeeded", confirmed.Status)
+	}
+
+	// A succeeded intent cannot be charged again
+	if _, err := client.ConfirmPaymentIntent(ctx, intent.ID, TestPaymentMethodVisa); err == nil {
+		t.Error("confirming a succeeded intent should fail")
+	}
+
+	if _, err := client.ConfirmPaymentIntent(ctx, "pi_missing", TestPaymentMethodVisa); !errors.Is(err, ErrPaymentIntentNotFound) {
+		t.Errorf("ConfirmPaymentIntent(unknown) error = %v, want %v", err, ErrPaymentIntentNotFound)
+	}
+}
+
+func TestStripeSubscriptionLifecycle(t *testing.T) {
+	client := NewInMemoryStripeClient(StripeConfig{})
+	ctx := context.Background()
+
+	customer, err := client.CreateCustomer(ctx, CustomerCreateParams{Email: "ada@example.com"})
+	if err != nil {
+		t.Fatalf("CreateCustomer() error = %v", err)
+	}
+
+	sub, err := client.CreateSubscription(ctx, SubscriptionCreateParams{CustomerID: customer.ID, PriceID: "price_pro", TrialDays: 14})
+	if err != nil {
+		t.Fatalf("CreateSubscription() error = %v", err)
+	}
+	if sub.Status != "trialing" || sub.PriceID != "price_pro" {
+		t.Errorf("subscription = %+v", sub)
+	}
+
+	pending, err := client.CancelSubscription(ctx, sub.ID, true)
+	if err != nil {
+		t.Fatalf("CancelSubscription(at period end) error = %v", err)
+	}
+	if pending.Status != "trialing" || pending.CancelAt == nil || !pending.CancelAt.Equal(sub.CurrentPeriodEnd) {
+		t.Errorf("cancel at period end = %+v", pending)
+	}
+
+	canceled, err := client.CancelSubscription(ctx, sub.ID, false)
+	if err != nil {
+		t.Fatalf("CancelSubscription() error = %v", err)
+	}
+	if canceled.Status != "canceled" {
+		t.Errorf("status = %q, want canceled", canceled.Status)
+	}
+}
+
+func TestStripeClient_NotConfigured(t *testing.T) {
+	client := NewStripeClient(StripeConfig{})
+	ctx := context.Background()
+
+	calls := map[string]func() error{
+		"CreateCustomer": func() error {
+			_, err := client.CreateCustomer(ctx, CustomerCreateParams{Email: "ada@example.com"})
+			return err
+		},
+		"CreatePaymentIntent": func() error {
+			_, err := client.CreatePaymentIntent(ctx, PaymentIntentCreateParams{Amount: 100, Currency: "usd"})
+			return err
+		},
+		"ConfirmPaymentIntent": func() error {
+			_, err := client.ConfirmPaymentIntent(ctx, "pi_123", TestPaymentMethodVisa)
+			return err
+		},
+		"CreateSubscription": func() error {
+			_, err := client.CreateSubscription(ctx, SubscriptionCreateParams{CustomerID: "cus_123", PriceID: "price_pro"})
+			return err
+		},
+		"CancelSubscription": func() error {
+			_, err := client.CancelSubscription(ctx, "sub_123", false)
+			return err
+		},
+	}
+
+	for name, call := range calls {
+		if err := call(); !errors.Is(err, ErrStripeNotConfigured) {
+			t.Errorf("%s() error = %v, want %v", name, err, ErrStripeNotConfigured)
+		}
+	}
+}
+
+func TestStripeIdempotencyKey(t *testing.T) {
+	client := NewInMemoryStripeClient(StripeConfig{})
+	ctx := context.Background()
+
+	params := PaymentIntentCreateParams{Amount: 2500, Currency: "usd", IdempotencyKey: "order-1001"}
+
+	first, err := client.CreatePaymentIntent(ctx, params)
+	if err != nil {
+		t.Fatalf("CreatePaymentIntent() error = %v", err)
+	}
+	second, err := client.CreatePaymentIntent(ctx, params)
+	if err != nil {
+		t.Fatalf("CreatePaymentIntent() retry error = %v", err)
+	}
+	if first.ID != second.ID || first.ClientSecret != second.ClientSecret {
+		t.Errorf("retry returned %s, want original intent %s", second.ID, first.ID)
+	}
+
+	params.IdempotencyKey = "order-1002"
+	other, err := client.CreatePaymentIntent(ctx, params)
+	if err != nil {
+		t.Fatalf("CreatePaymentIntent() error = %v", err)
+	}
+	if other.ID == first.ID {
+		t.Error("a different idempotency key should create a new intent")
+	}
+
+	customerParams := CustomerCreateParams{Email: "ada@example.com", IdempotencyKey: "signup-ada"}
+	c1, err := client.CreateCustomer(ctx, customerParams)
+	if err != nil {
+		t.Fatalf("CreateCustomer() error = %v", err)
+	}
+	c2, err := client.CreateCustomer(ctx, customerParams)
+	if err != nil {
+		t.Fatalf("CreateCustomer() retry error = %v", err)
+	}
+	if c1.ID != c2.ID {
+		t.Errorf("retry returned customer %s, want %s", c2.ID, c1.ID)
+	}
+}
+
+func TestPreviewSubscriptionChange_MidPeriod(t *testing.T) {
+	client := NewInMemoryStripeClient(StripeConfig{},
+		StripePrice{ID: "price_basic", UnitAmount: 1000, Currency: "usd"},
+		StripePrice{ID: "price_pro", UnitAmount: 3000, Currency: "usd"},
+	)
+	backend := client.backend.(*memoryStripeBackend)
+	ctx := context.Background()
+
+	start := time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)
+	backend.now = func() time.Time { return start }
+
+	customer, err := client.CreateCustomer(ctx, CustomerCreateParams{Email: "ada@example.com"})
+	if err != nil {
+		t.Fatalf("CreateCustomer() error = %v", err)
+	}
+	sub, err := client.CreateSubscription(ctx, SubscriptionCreateParams{CustomerID: customer.ID, PriceID: "price_basic", Quantity: 2})
+	if err != nil {
+		t.Fatalf("CreateSubscription() error = %v", err)
+	}
+
+	// Halfway through April's 30 days
+	backend.now = func() time.Time { return start.Add(15 * 24 * time.Hour) }
+
+	tests := []struct {
+		name          string
+		fromPrice     string
+		toPrice       string
+		wantDue       int64
+		wantNextTotal int64
+	}{
+		// Credit 2*1000/2 = 1000, charge 2*3000/2 = 3000
+		{name: "upgrade", fromPrice: "price_basic", toPrice: "price_pro", wantDue: 2000, wantNextTotal: 6000},
+		// Credit 3000, charge 1000: nothing due now, next invoice reduced by 2000
+		{name: "downgrade", fromPrice: "price_pro", toPrice: "price_basic", wantDue: 0, wantNextTotal: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend.subscriptions[sub.ID].PriceID = tt.fromPrice
+
+			preview, err := client.PreviewSubscriptionChange(ctx, sub.ID, tt.toPrice)
+			if err != nil {
+				t.Fatalf("PreviewSubscriptionChange() error = %v", err)
+			}
+			if preview.AmountDue != tt.wantDue {
+				t.Errorf("AmountDue = %d, want %d", preview.AmountDue, tt.wantDue)
+			}
+			if preview.NextInvoiceAmount != tt.wantNextTotal {
+				t.Errorf("NextInvoiceAmount = %d, want %d", preview.NextInvoiceAmount, tt.wantNextTotal)
+			}
+			if !preview.PeriodStart.Equal(start) || !preview.PeriodEnd.Equal(start.AddDate(0, 1, 0)) {
+				t.Errorf("period = %v - %v", preview.PeriodStart, preview.PeriodEnd)
+			}
+		})
+	}
+
+	if _, err := client.PreviewSubscriptionChange(ctx, sub.ID, "price_missing"); !errors.Is(err, ErrPriceNotFound) {
+		t.Errorf("unknown price error = %v, want %v", err, ErrPriceNotFound)
+	}
+	if _, err := client.PreviewSubscriptionChange(ctx, "sub_missing", "price_pro"); !errors.Is(err, ErrSubscriptionNotFound) {
+		t.Errorf("unknown subscription error = %v, want %v", err, ErrSubscriptionNotFound)
+	}
+}
@@ -0,0 +1,37 @@
+// Package jwtconfig reads the JWT settings shared by the service that
+// issues tokens and the services that verify them. It has no dependencies,
+// so verifying tokens doesn't pull in the users service's database code.
+package jwtconfig
+
+import "os"
+
+// Defaults used when JWT_SECRET, JWT_ISSUER and JWT_AUDIENCE are not set
+const (
+	DefaultSecret   = "your-secret-key-change-this-min-32-chars"
+	DefaultIssuer   = "marimo-erp"
+	DefaultAudience = "marimo-api"
+)
+
+// Secret returns the key that signs and verifies tokens from JWT_SECRET
+func Secret() []byte {
+	if secret := os.Getenv("JWT_SECRET"); secret != "" {
+		return []byte(secret)
+	}
+	return []byte(DefaultSecret)
+}
+
+// Issuer returns the iss claim of tokens from JWT_ISSUER
+func Issuer() string {
+	if issuer := os.Getenv("JWT_ISSUER"); issuer != "" {
+		return issuer
+	}
+	return DefaultIssuer
+}
+
+// Audience returns the aud claim of tokens from JWT_AUDIENCE
+func Audience() string {
+	if audience := os.Getenv("JWT_AUDIENCE"); audience != "" {
+		return audience
+	}
+	return DefaultAudience
+}
@@ -0,0 +1,34 @@
+package jwtconfig
+
+import "testing"
+
+func TestSettings(t *testing.T) {
+	t.Setenv("JWT_SECRET", "")
+	t.Setenv("JWT_ISSUER", "")
+	t.Setenv("JWT_AUDIENCE", "")
+
+	if got := string(Secret()); got != DefaultSecret {
+		t.Errorf("Secret() = %q, want %q", got, DefaultSecret)
+	}
+	if got := Issuer(); got != DefaultIssuer {
+		t.Errorf("Issuer() = %q, want %q", got, DefaultIssuer)
+	}
+	if got := Audience(); got != DefaultAudience {
+		t.Errorf("Audience() = %q, want %q", got, DefaultAudience)
+	}
+
+	// Settings are read on every call, not once at startup
+	t.Setenv("JWT_SECRET", "rotated-secret")
+	t.Setenv("JWT_ISSUER", "issuer")
+	t.Setenv("JWT_AUDIENCE", "audience")
+
+	if got := string(Secret()); got != "rotated-secret" {
+		t.Errorf("Secret() = %q, want rotated-secret", got)
+	}
+	if got := Issuer(); got != "issuer" {
+		t.Errorf("Issuer() = %q, want issuer", got)
+	}
+	if got := Audience(); got != "audience" {
+		t.Errorf("Audience() = %q, want audience", got)
+	}
+}
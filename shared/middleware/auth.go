@@ -7,14 +7,14 @@ import (
 	"strings"
 	"time"
 
+	"github.com/dayanch951/marimo/shared/jwtconfig"
 	"github.com/golang-jwt/jwt/v5"
 )
 
 var (
-	JWTSecret        = []byte("your-secret-key-change-this-in-production")
-	ErrInvalidToken  = errors.New("invalid token")
-	ErrExpiredToken  = errors.New("token has expired")
-	ErrUnauthorized  = errors.New("unauthorized")
+	ErrInvalidToken = errors.New("invalid token")
+	ErrExpiredToken = errors.New("token has expired")
+	ErrUnauthorized = errors.New("unauthorized")
 )
 
 type contextKey string
@@ -26,10 +26,13 @@ type Claims struct {
 	UserID string `json:"user_id"`
 	Email  string `json:"email"`
 	Role   string `json:"role"`
+	// TenantID is set for tenant-scoped tokens
+	TenantID string `json:"tenant_id,omitempty"`
 	jwt.RegisteredClaims
 }
 
-// GenerateToken generates a new JWT token
+// GenerateToken generates a new JWT token. Tokens are signed with
+// JWT_SECRET, like those issued by the users service.
 func GenerateToken(userID, email, role string) (string, error) {
 	claims := Claims{
 		UserID: userID,
@@ -39,21 +42,24 @@ func GenerateToken(userID, email, role string) (string, error) {
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			NotBefore: jwt.NewNumericDate(time.Now()),
+			Issuer:    jwtconfig.Issuer(),
+			Audience:  jwt.ClaimStrings{jwtconfig.Audience()},
 		},
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(JWTSecret)
+	return token.SignedString(jwtconfig.Secret())
 }
 
-// ValidateToken validates a JWT token
+// ValidateToken validates a JWT token, including that its iss and aud
+// claims match JWT_ISSUER and JWT_AUDIENCE
 func ValidateToken(tokenString string) (*Claims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, ErrInvalidToken
 		}
-		return JWTSecret, nil
-	})
+		return jwtconfig.Secret(), nil
+	}, jwt.WithIssuer(jwtconfig.Issuer()), jwt.WithAudience(jwtconfig.Audience()))
 
 	if err != nil {
 		return nil, err
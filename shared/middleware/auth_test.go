@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dayanch951/marimo/shared/models"
+	"github.com/dayanch951/marimo/shared/utils"
+)
+
+func TestAuthMiddleware_ValidatesAudience(t *testing.T) {
+	handler := AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims := r.Context().Value(UserContextKey).(*Claims)
+		w.Write([]byte(claims.UserID))
+	}))
+
+	user := &models.User{ID: "user-1", Email: "user@example.com", Role: models.RoleUser}
+	request := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Tokens from the users service are accepted
+	token, err := utils.GenerateAccessToken(user)
+	if err != nil {
+		t.Fatalf("GenerateAccessToken() error = %v", err)
+	}
+	if rec := request(token); rec.Code != http.StatusOK || rec.Body.String() != "user-1" {
+		t.Errorf("request with a valid token = %d %q, want 200 user-1", rec.Code, rec.Body.String())
+	}
+
+	t.Setenv("JWT_AUDIENCE", "another-api")
+	token, err = utils.GenerateAccessToken(user)
+	if err != nil {
+		t.Fatalf("GenerateAccessToken() error = %v", err)
+	}
+	t.Setenv("JWT_AUDIENCE", "")
+
+	if rec := request(token); rec.Code != http.StatusUnauthorized {
+		t.Errorf("request with a token for another audience = %d, want 401", rec.Code)
+	}
+}
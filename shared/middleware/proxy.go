@@ -1,27 +1,49 @@
 package middleware
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/dayanch951/marimo/shared/cache"
-	"github.com/dayanch951/marimo/shared/discovery"
+	"github.com/dayanch951/marimo/shared/monitoring"
 	"github.com/dayanch951/marimo/shared/resilience"
 )
 
+const (
+	// DefaultMaxProxyBodySize is the largest request body proxied by default
+	DefaultMaxProxyBodySize = 10 << 20 // 10 MB
+
+	// DefaultStreamThreshold is the response size above which responses
+	// are streamed to the client rather than buffered
+	DefaultStreamThreshold = 1 << 20 // 1 MB
+)
+
+// ServiceDiscoverer resolves a service name to a base URL.
+// *discovery.ServiceRegistry implements it.
+type ServiceDiscoverer interface {
+	DiscoverService(serviceName string) (string, error)
+}
+
 // ProxyConfig holds configuration for the reverse proxy
 type ProxyConfig struct {
-	ServiceRegistry *discovery.ServiceRegistry
+	ServiceRegistry ServiceDiscoverer
 	Cache           *cache.RedisCache
 	CircuitBreakers map[string]*resilience.CircuitBreaker
 	RetryPolicy     resilience.RetryPolicy
 	CacheTTL        time.Duration
+	MaxBodySize     int64               // Request bodies are buffered in memory for retries
+	StreamThreshold int64               // Larger responses are streamed, not buffered or cached
+	Metrics         *monitoring.Metrics // Optional
 }
 
 // ResilientProxy is a reverse proxy with circuit breaker, retry, and caching
@@ -41,11 +63,23 @@ func NewResilientProxy(config ProxyConfig) *ResilientProxy {
 		config.CacheTTL = 5 * time.Minute
 	}
 
+	if config.MaxBodySize == 0 {
+		config.MaxBodySize = DefaultMaxProxyBodySize
+	}
+
+	if config.StreamThreshold == 0 {
+		config.StreamThreshold = DefaultStreamThreshold
+	}
+
+	if config.CircuitBreakers == nil {
+		config.CircuitBreakers = make(map[string]*resilience.CircuitBreaker)
+	}
+
 	return &ResilientProxy{
 		config: config,
-		client: &http.Client{
-			Timeout: 30 * time.Second,
-		},
+		// No client timeout: executeRequest bounds requests through their
+		// context so streamed responses aren't cut off
+		client: &http.Client{},
 	}
 }
 
@@ -57,7 +91,7 @@ func (rp *ResilientProxy) ProxyRequest(serviceName string) http.HandlerFunc {
 
 		// Try to get from cache first (for GET requests only)
 		if r.Method == http.MethodGet && rp.config.Cache != nil {
-			cacheKey := fmt.Sprintf("proxy:%s:%s", serviceName, r.URL.Path)
+			cacheKey := proxyCacheKey(serviceName, r.URL)
 			var cachedResponse CachedResponse
 
 			err := rp.config.Cache.Get(r.Context(), cacheKey, &cachedResponse)
@@ -71,9 +105,21 @@ func (rp *ResilientProxy) ProxyRequest(serviceName string) http.HandlerFunc {
 			}
 		}
 
+		// Buffer the body so every retry attempt can resend it
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, rp.config.MaxBodySize))
+		if err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+			http.Error(w, "Failed to read request body", http.StatusBadRequest)
+			return
+		}
+
 		// Execute request with circuit breaker
-		err := cb.Execute(func() error {
-			return rp.executeRequest(w, r, serviceName)
+		err = cb.Execute(func() error {
+			return rp.executeRequest(w, r, serviceName, body)
 		})
 
 		if err != nil {
@@ -90,10 +136,15 @@ func (rp *ResilientProxy) ProxyRequest(serviceName string) http.HandlerFunc {
 }
 
 // executeRequest executes the actual HTTP request with retry logic
-func (rp *ResilientProxy) executeRequest(w http.ResponseWriter, r *http.Request, serviceName string) error {
-	ctx, cancel := context.WithTimeout(r.Context(), 25*time.Second)
+func (rp *ResilientProxy) executeRequest(w http.ResponseWriter, r *http.Request, serviceName string, body []byte) error {
+	ctx, cancel := context.WithCancel(r.Context())
 	defer cancel()
 
+	// Buffered responses must complete within the timeout; streamed ones
+	// only need their headers to
+	timeout := time.AfterFunc(25*time.Second, cancel)
+	defer timeout.Stop()
+
 	var lastResp *http.Response
 
 	// Retry logic
@@ -110,8 +161,12 @@ func (rp *ResilientProxy) executeRequest(w http.ResponseWriter, r *http.Request,
 			targetURL += "?" + r.URL.RawQuery
 		}
 
-		// Create new request
-		proxyReq, err := http.NewRequestWithContext(ctx, r.Method, targetURL, r.Body)
+		// Create new request with a fresh reader over the buffered body
+		var reqBody io.Reader
+		if len(body) > 0 {
+			reqBody = bytes.NewReader(body)
+		}
+		proxyReq, err := http.NewRequestWithContext(ctx, r.Method, targetURL, reqBody)
 		if err != nil {
 			return fmt.Errorf("failed to create request: %w", err)
 		}
@@ -151,23 +206,30 @@ func (rp *ResilientProxy) executeRequest(w http.ResponseWriter, r *http.Request,
 
 	defer lastResp.Body.Close()
 
+	if isStreamingResponse(lastResp, rp.config.StreamThreshold) {
+		timeout.Stop()
+		rp.streamResponse(w, lastResp)
+		return nil
+	}
+
 	// Read response body
-	body, err := io.ReadAll(lastResp.Body)
+	respBody, err := io.ReadAll(lastResp.Body)
 	if err != nil {
 		return fmt.Errorf("failed to read response body: %w", err)
 	}
 
-	// Cache successful GET responses
+	// Cache successful GET responses the backend allows to be cached
 	if r.Method == http.MethodGet && lastResp.StatusCode == http.StatusOK && rp.config.Cache != nil {
-		cacheKey := fmt.Sprintf("proxy:%s:%s", serviceName, r.URL.Path)
-		cached := CachedResponse{
-			StatusCode:  lastResp.StatusCode,
-			Body:        body,
-			ContentType: lastResp.Header.Get("Content-Type"),
-		}
+		if ttl, ok := responseCacheTTL(lastResp.Header, rp.config.CacheTTL); ok {
+			cached := CachedResponse{
+				StatusCode:  lastResp.StatusCode,
+				Body:        respBody,
+				ContentType: lastResp.Header.Get("Content-Type"),
+			}
 
-		if err := rp.config.Cache.Set(r.Context(), cacheKey, cached, rp.config.CacheTTL); err != nil {
-			log.Printf("Failed to cache response: %v", err)
+			if err := rp.config.Cache.Set(r.Context(), proxyCacheKey(serviceName, r.URL), cached, ttl); err != nil {
+				log.Printf("Failed to cache response: %v", err)
+			}
 		}
 	}
 
@@ -180,11 +242,97 @@ func (rp *ResilientProxy) executeRequest(w http.ResponseWriter, r *http.Request,
 
 	w.Header().Set("X-Cache", "MISS")
 	w.WriteHeader(lastResp.StatusCode)
-	w.Write(body)
+	w.Write(respBody)
 
 	return nil
 }
 
+// isStreamingResponse reports whether a response should be passed through
+// as it arrives: server-sent events, chunked bodies of unknown length and
+// bodies larger than threshold
+func isStreamingResponse(resp *http.Response, threshold int64) bool {
+	mediaType, _, _ := strings.Cut(resp.Header.Get("Content-Type"), ";")
+	if strings.EqualFold(strings.TrimSpace(mediaType), "text/event-stream") {
+		return true
+	}
+
+	return resp.ContentLength < 0 || resp.ContentLength > threshold
+}
+
+// streamResponse copies a response to the client, flushing after every
+// read so events reach it as soon as the backend sends them
+func (rp *ResilientProxy) streamResponse(w http.ResponseWriter, resp *http.Response) {
+	for key, values := range resp.Header {
+		for _, value := range values {
+			w.Header().Add(key, value)
+		}
+	}
+
+	w.Header().Set("X-Cache", "BYPASS")
+	w.WriteHeader(resp.StatusCode)
+
+	rc := http.NewResponseController(w)
+	rc.Flush()
+
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := resp.Body.Read(buf)
+		if n > 0 {
+			if _, writeErr := w.Write(buf[:n]); writeErr != nil {
+				return // Client went away
+			}
+			rc.Flush()
+		}
+		if err != nil {
+			if err != io.EOF {
+				log.Printf("Error streaming response: %v", err)
+			}
+			return
+		}
+	}
+}
+
+// proxyCacheKey returns the cache key for a response, which varies by
+// query string so different pages aren't served from the same entry
+func proxyCacheKey(serviceName string, u *url.URL) string {
+	key := fmt.Sprintf("proxy:%s:%s", serviceName, u.Path)
+	if u.RawQuery != "" {
+		key += "?" + u.RawQuery
+	}
+	return key
+}
+
+// responseCacheTTL returns how long a response may be cached according to
+// its Cache-Control header, or false if it must not be cached. Responses
+// without max-age or s-maxage are cached for fallback.
+func responseCacheTTL(header http.Header, fallback time.Duration) (time.Duration, bool) {
+	maxAge := ""
+	for _, directive := range strings.Split(header.Get("Cache-Control"), ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		switch strings.ToLower(name) {
+		case "no-store", "no-cache", "private":
+			return 0, false
+		case "max-age":
+			if maxAge == "" {
+				maxAge = value
+			}
+		case "s-maxage":
+			// Applies to shared caches like this one and wins over max-age
+			maxAge = value
+		}
+	}
+
+	if maxAge == "" {
+		return fallback, true
+	}
+
+	seconds, err := strconv.Atoi(strings.Trim(maxAge, `"`))
+	if err != nil || seconds <= 0 {
+		return 0, false
+	}
+	return time.Duration(seconds) * time.Second, true
+}
+
 // getCircuitBreaker gets or creates a circuit breaker for a service
 func (rp *ResilientProxy) getCircuitBreaker(serviceName string) *resilience.CircuitBreaker {
 	rp.mu.RLock()
@@ -203,7 +351,7 @@ func (rp *ResilientProxy) getCircuitBreaker(serviceName string) *resilience.Circ
 	}
 
 	// Create new circuit breaker
-	cb := resilience.NewCircuitBreaker(resilience.Settings{
+	settings := resilience.Settings{
 		Name:        serviceName,
 		MaxRequests: 3,
 		Interval:    60 * time.Second,
@@ -213,7 +361,12 @@ func (rp *ResilientProxy) getCircuitBreaker(serviceName string) *resilience.Circ
 		OnStateChange: func(name string, from, to resilience.State) {
 			log.Printf("Circuit breaker %s changed state: %s -> %s", name, from, to)
 		},
-	})
+	}
+	if rp.config.Metrics != nil {
+		settings.Metrics = rp.config.Metrics
+	}
+
+	cb := resilience.NewCircuitBreaker(settings)
 
 	rp.config.CircuitBreakers[serviceName] = cb
 	return cb
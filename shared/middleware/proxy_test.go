@@ -0,0 +1,248 @@
+package middleware
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/dayanch951/marimo/shared/cache"
+	"github.com/dayanch951/marimo/shared/resilience"
+)
+
+// staticDiscoverer resolves every service to one backend URL
+type staticDiscoverer string
+
+func (s staticDiscoverer) DiscoverService(serviceName string) (string, error) {
+	return string(s), nil
+}
+
+func newTestProxy(backendURL string) *ResilientProxy {
+	return NewResilientProxy(ProxyConfig{
+		ServiceRegistry: staticDiscoverer(backendURL),
+		RetryPolicy: resilience.RetryPolicy{
+			MaxAttempts:  3,
+			InitialDelay: time.Millisecond,
+			MaxDelay:     time.Millisecond,
+			Multiplier:   2,
+		},
+		MaxBodySize: 64,
+	})
+}
+
+func TestResilientProxy_RetriesResendBody(t *testing.T) {
+	var mu sync.Mutex
+	var bodies []string
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		mu.Lock()
+		bodies = append(bodies, string(body))
+		attempt := len(bodies)
+		mu.Unlock()
+
+		if attempt == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write(body)
+	}))
+	defer backend.Close()
+
+	proxy := newTestProxy(backend.URL)
+
+	payload := `{"name":"widget","quantity":3}`
+	req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(payload))
+	rec := httptest.NewRecorder()
+	proxy.ProxyRequest("orders")(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if len(bodies) != 2 {
+		t.Fatalf("backend saw %d attempts, want 2", len(bodies))
+	}
+	for i, body := range bodies {
+		if body != payload {
+			t.Errorf("attempt %d body = %q, want %q", i+1, body, payload)
+		}
+	}
+	if rec.Body.String() != payload {
+		t.Errorf("response body = %q, want %q", rec.Body.String(), payload)
+	}
+}
+
+func TestResilientProxy_RejectsLargeBody(t *testing.T) {
+	called := false
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer backend.Close()
+
+	proxy := newTestProxy(backend.URL)
+
+	req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(strings.Repeat("x", 65)))
+	rec := httptest.NewRecorder()
+	proxy.ProxyRequest("orders")(rec, req)
+
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusRequestEntityTooLarge)
+	}
+	if called {
+		t.Error("backend was called for an oversized body")
+	}
+}
+
+func newCachingTestProxy(t *testing.T, backendURL string) (*ResilientProxy, *miniredis.Miniredis) {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+	redisCache, err := cache.NewRedisCache(server.Addr(), "", 0, "")
+	if err != nil {
+		t.Fatalf("NewRedisCache() error = %v", err)
+	}
+
+	proxy := newTestProxy(backendURL)
+	proxy.config.Cache = redisCache
+	return proxy, server
+}
+
+func TestResilientProxy_CacheVariesByQuery(t *testing.T) {
+	calls := 0
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		fmt.Fprintf(w, "page %s", r.URL.Query().Get("page"))
+	}))
+	defer backend.Close()
+
+	proxy, _ := newCachingTestProxy(t, backend.URL)
+
+	get := func(target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		proxy.ProxyRequest("products")(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		return rec
+	}
+
+	for _, tt := range []struct {
+		target, body, cache string
+	}{
+		{"/products?page=1", "page 1", "MISS"},
+		{"/products?page=2", "page 2", "MISS"},
+		{"/products?page=1", "page 1", "HIT"},
+	} {
+		rec := get(tt.target)
+		if rec.Body.String() != tt.body || rec.Header().Get("X-Cache") != tt.cache {
+			t.Errorf("GET %s = %q (X-Cache %s), want %q (%s)",
+				tt.target, rec.Body.String(), rec.Header().Get("X-Cache"), tt.body, tt.cache)
+		}
+	}
+	if calls != 2 {
+		t.Errorf("backend calls = %d, want 2", calls)
+	}
+}
+
+func TestResilientProxy_CacheControl(t *testing.T) {
+	tests := []struct {
+		cacheControl string
+		wantCached   bool
+		wantTTL      time.Duration
+	}{
+		{cacheControl: "", wantCached: true, wantTTL: 5 * time.Minute},
+		{cacheControl: "public, max-age=60", wantCached: true, wantTTL: time.Minute},
+		{cacheControl: "max-age=60, s-maxage=120", wantCached: true, wantTTL: 2 * time.Minute},
+		{cacheControl: "no-store"},
+		{cacheControl: "private, max-age=60"},
+		{cacheControl: "max-age=0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cacheControl, func(t *testing.T) {
+			backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.cacheControl != "" {
+					w.Header().Set("Cache-Control", tt.cacheControl)
+				}
+				w.Write([]byte("ok"))
+			}))
+			defer backend.Close()
+
+			proxy, server := newCachingTestProxy(t, backend.URL)
+
+			rec := httptest.NewRecorder()
+			proxy.ProxyRequest("products")(rec, httptest.NewRequest(http.MethodGet, "/products", nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+			}
+
+			key := "proxy:products:/products"
+			if cached := server.Exists(key); cached != tt.wantCached {
+				t.Fatalf("cached = %v, want %v", cached, tt.wantCached)
+			}
+			if tt.wantCached && server.TTL(key) != tt.wantTTL {
+				t.Errorf("TTL = %v, want %v", server.TTL(key), tt.wantTTL)
+			}
+		})
+	}
+}
+
+func TestResilientProxy_StreamsServerSentEvents(t *testing.T) {
+	ack := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for i := 1; i <= 3; i++ {
+			fmt.Fprintf(w, "data: event %d\n\n", i)
+			w.(http.Flusher).Flush()
+
+			// Only send the next event once the client has seen this one,
+			// which deadlocks if the proxy buffers
+			select {
+			case <-ack:
+			case <-time.After(5 * time.Second):
+				return
+			}
+		}
+	}))
+	defer backend.Close()
+
+	proxy := httptest.NewServer(newTestProxy(backend.URL).ProxyRequest("events"))
+	defer proxy.Close()
+
+	resp, err := http.Get(proxy.URL + "/events")
+	if err != nil {
+		t.Fatalf("GET error = %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.Header.Get("X-Cache") != "BYPASS" {
+		t.Errorf("X-Cache = %q, want BYPASS", resp.Header.Get("X-Cache"))
+	}
+
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			if line := scanner.Text(); line != "" {
+				lines <- line
+			}
+		}
+	}()
+
+	for i := 1; i <= 3; i++ {
+		select {
+		case line := <-lines:
+			if want := fmt.Sprintf("data: event %d", i); line != want {
+				t.Fatalf("event %d = %q, want %q", i, line, want)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("event %d didn't arrive before the next was sent", i)
+		}
+		ack <- struct{}{}
+	}
+}
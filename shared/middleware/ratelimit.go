@@ -2,6 +2,7 @@ package middleware
 
 import (
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 )
@@ -87,17 +88,22 @@ func (rl *RateLimiter) cleanupVisitors() {
 	ticker := time.NewTicker(rl.cleanup)
 	defer ticker.Stop()
 
-	for range ticker.C {
-		rl.mu.Lock()
-		now := time.Now()
-		for key, v := range rl.visitors {
-			v.mu.Lock()
-			if now.Sub(v.lastSeen) > rl.cleanup {
-				delete(rl.visitors, key)
-			}
-			v.mu.Unlock()
+	for now := range ticker.C {
+		rl.evictIdle(now)
+	}
+}
+
+// evictIdle removes visitors not seen for longer than the cleanup interval
+func (rl *RateLimiter) evictIdle(now time.Time) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	for key, v := range rl.visitors {
+		v.mu.Lock()
+		if now.Sub(v.lastSeen) > rl.cleanup {
+			delete(rl.visitors, key)
 		}
-		rl.mu.Unlock()
+		v.mu.Unlock()
 	}
 }
 
@@ -129,16 +135,19 @@ func RateLimitMiddleware(limiter *RateLimiter) func(http.Handler) http.Handler {
 
 // EndpointRateLimiter allows different limits for different endpoints
 type EndpointRateLimiter struct {
-	limiters       map[string]*RateLimiter
-	mu             sync.RWMutex
-	defaultLimiter *RateLimiter
+	limiters        map[string]*RateLimiter
+	tenantOverrides map[string]*RateLimiter
+	mu              sync.RWMutex
+	defaultLimiter  *RateLimiter
+	keyByTenant     bool
 }
 
 // NewEndpointRateLimiter creates a rate limiter with per-endpoint limits
 func NewEndpointRateLimiter(defaultRate, defaultBurst int) *EndpointRateLimiter {
 	return &EndpointRateLimiter{
-		limiters:       make(map[string]*RateLimiter),
-		defaultLimiter: NewRateLimiter(defaultRate, defaultBurst),
+		limiters:        make(map[string]*RateLimiter),
+		tenantOverrides: make(map[string]*RateLimiter),
+		defaultLimiter:  NewRateLimiter(defaultRate, defaultBurst),
 	}
 }
 
@@ -149,30 +158,109 @@ func (erl *EndpointRateLimiter) AddEndpoint(path string, rate, burst int) {
 	erl.limiters[path] = NewRateLimiter(rate, burst)
 }
 
+// EnableTenantKeys makes authenticated requests share a bucket per tenant
+// (or per user for tokens without a tenant) and endpoint instead of per IP
+func (erl *EndpointRateLimiter) EnableTenantKeys() {
+	erl.mu.Lock()
+	defer erl.mu.Unlock()
+	erl.keyByTenant = true
+}
+
+// AddTenantOverride sets a dedicated limit for a tenant, replacing the
+// endpoint limits for its requests. It implies EnableTenantKeys.
+func (erl *EndpointRateLimiter) AddTenantOverride(tenantID string, rate, burst int) {
+	erl.mu.Lock()
+	defer erl.mu.Unlock()
+	erl.tenantOverrides[tenantID] = NewRateLimiter(rate, burst)
+	erl.keyByTenant = true
+}
+
 // GetLimiter returns the limiter for a given path
 func (erl *EndpointRateLimiter) GetLimiter(path string) *RateLimiter {
+	limiter, _ := erl.endpointFor(path)
+	return limiter
+}
+
+// endpointFor returns the limiter for a path and the endpoint it counts
+// against: the configured path, or "default" for every other path. Bucket
+// keys use the endpoint rather than the raw path, so clients can't mint
+// fresh buckets by varying the URL.
+func (erl *EndpointRateLimiter) endpointFor(path string) (*RateLimiter, string) {
 	erl.mu.RLock()
 	defer erl.mu.RUnlock()
 
 	if limiter, exists := erl.limiters[path]; exists {
-		return limiter
+		return limiter, path
+	}
+	return erl.defaultLimiter, "default"
+}
+
+// limiterFor returns the limiter and bucket key for a request
+func (erl *EndpointRateLimiter) limiterFor(r *http.Request) (*RateLimiter, string) {
+	erl.mu.RLock()
+	keyByTenant := erl.keyByTenant
+	erl.mu.RUnlock()
+
+	limiter, endpoint := erl.endpointFor(r.URL.Path)
+
+	if keyByTenant {
+		if tenant := requestTenant(r); tenant != "" {
+			erl.mu.RLock()
+			override, exists := erl.tenantOverrides[tenant]
+			erl.mu.RUnlock()
+
+			key := "tenant:" + tenant + ":" + endpoint
+			if exists {
+				return override, key
+			}
+			return limiter, key
+		}
+	}
+
+	return limiter, clientIP(r)
+}
+
+// requestTenant returns the tenant (or user, for tokens without a tenant)
+// the request is authenticated as, or "" for anonymous requests
+func requestTenant(r *http.Request) string {
+	claims, ok := r.Context().Value(UserContextKey).(*Claims)
+	if !ok {
+		// Rate limiting usually runs before AuthMiddleware, so fall back
+		// to reading the bearer token directly
+		parts := strings.Split(r.Header.Get("Authorization"), " ")
+		if len(parts) != 2 || parts[0] != "Bearer" {
+			return ""
+		}
+
+		var err error
+		claims, err = ValidateToken(parts[1])
+		if err != nil {
+			return ""
+		}
+	}
+
+	if claims.TenantID != "" {
+		return claims.TenantID
 	}
-	return erl.defaultLimiter
+	return claims.UserID
+}
+
+// clientIP returns the IP-based rate limit key for a request
+func clientIP(r *http.Request) string {
+	key := r.RemoteAddr
+	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+		key = xff
+	} else if xri := r.Header.Get("X-Real-IP"); xri != "" {
+		key = xri
+	}
+	return key
 }
 
 // Middleware creates middleware for endpoint-specific rate limiting
 func (erl *EndpointRateLimiter) Middleware() func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			limiter := erl.GetLimiter(r.URL.Path)
-
-			// Use IP address as the key
-			key := r.RemoteAddr
-			if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
-				key = xff
-			} else if xri := r.Header.Get("X-Real-IP"); xri != "" {
-				key = xri
-			}
+			limiter, key := erl.limiterFor(r)
 
 			if !limiter.Allow(key) {
 				w.Header().Set("Content-Type", "application/json")
@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
 	"sync"
@@ -234,3 +235,149 @@ func BenchmarkRateLimiter_MultipleClients(b *testing.B) {
 		limiter.Allow(key)
 	}
 }
+
+func TestEndpointRateLimiter_TenantBuckets(t *testing.T) {
+	erl := NewEndpointRateLimiter(60, 2)
+	erl.AddTenantOverride("tenant-big", 600, 5)
+
+	handler := erl.Middleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	send := func(tenantID string) int {
+		req := httptest.NewRequest("GET", "/api/shop/orders", nil)
+		req.RemoteAddr = "192.168.1.1:1234" // Same IP for every tenant
+		claims := &Claims{UserID: "user-" + tenantID, TenantID: tenantID}
+		req = req.WithContext(context.WithValue(req.Context(), UserContextKey, claims))
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// Exhaust tenant-a's burst
+	for i := 0; i < 2; i++ {
+		if code := send("tenant-a"); code != http.StatusOK {
+			t.Errorf("tenant-a request %d status = %d, want %d", i+1, code, http.StatusOK)
+		}
+	}
+	if code := send("tenant-a"); code != http.StatusTooManyRequests {
+		t.Errorf("tenant-a should be rate limited, got %d", code)
+	}
+
+	// tenant-b shares the IP but has its own bucket
+	if code := send("tenant-b"); code != http.StatusOK {
+		t.Errorf("tenant-b status = %d, want %d", code, http.StatusOK)
+	}
+
+	// tenant-big uses its override burst
+	for i := 0; i < 5; i++ {
+		if code := send("tenant-big"); code != http.StatusOK {
+			t.Errorf("tenant-big request %d status = %d, want %d", i+1, code, http.StatusOK)
+		}
+	}
+	if code := send("tenant-big"); code != http.StatusTooManyRequests {
+		t.Errorf("tenant-big should be rate limited after override burst, got %d", code)
+	}
+}
+
+func TestEndpointRateLimiter_TenantKeyFromBearerToken(t *testing.T) {
+	erl := NewEndpointRateLimiter(60, 1)
+	erl.EnableTenantKeys()
+
+	handler := erl.Middleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tokenA, _ := GenerateToken("user-a", "a@example.com", "user")
+	tokenB, _ := GenerateToken("user-b", "b@example.com", "user")
+
+	send := func(token string) int {
+		req := httptest.NewRequest("GET", "/api/main/stats", nil)
+		req.RemoteAddr = "192.168.1.1:1234"
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := send(tokenA); code != http.StatusOK {
+		t.Errorf("user-a status = %d, want %d", code, http.StatusOK)
+	}
+	if code := send(tokenB); code != http.StatusOK {
+		t.Errorf("user-b status = %d, want %d", code, http.StatusOK)
+	}
+	if code := send(tokenA); code != http.StatusTooManyRequests {
+		t.Errorf("user-a should be rate limited, got %d", code)
+	}
+
+	// Anonymous requests fall back to the IP bucket
+	if code := send(""); code != http.StatusOK {
+		t.Errorf("anonymous status = %d, want %d", code, http.StatusOK)
+	}
+	if code := send(""); code != http.StatusTooManyRequests {
+		t.Errorf("anonymous request should be rate limited by IP, got %d", code)
+	}
+}
+
+func TestEndpointRateLimiter_TenantBucketPerEndpoint(t *testing.T) {
+	erl := NewEndpointRateLimiter(60, 2)
+	erl.AddEndpoint("/api/users/login", 60, 1)
+	erl.EnableTenantKeys()
+
+	handler := erl.Middleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	send := func(path string) int {
+		req := httptest.NewRequest("GET", path, nil)
+		claims := &Claims{UserID: "user-a", TenantID: "tenant-a"}
+		req = req.WithContext(context.WithValue(req.Context(), UserContextKey, claims))
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// Unconfigured paths share one bucket, however the URL varies
+	for i, path := range []string{"/api/shop/orders/1", "/api/shop/orders/2"} {
+		if code := send(path); code != http.StatusOK {
+			t.Errorf("request %d status = %d, want %d", i+1, code, http.StatusOK)
+		}
+	}
+	if code := send("/api/shop/orders/3"); code != http.StatusTooManyRequests {
+		t.Errorf("new path should share the exhausted bucket, got %d", code)
+	}
+
+	// Configured endpoints keep their own
+	if code := send("/api/users/login"); code != http.StatusOK {
+		t.Errorf("configured endpoint status = %d, want %d", code, http.StatusOK)
+	}
+
+	erl.defaultLimiter.mu.RLock()
+	buckets := len(erl.defaultLimiter.visitors)
+	erl.defaultLimiter.mu.RUnlock()
+	if buckets != 1 {
+		t.Errorf("default limiter has %d buckets, want 1", buckets)
+	}
+}
+
+func TestRateLimiter_EvictIdle(t *testing.T) {
+	rl := NewRateLimiter(60, 1)
+	rl.Allow("idle")
+	rl.Allow("active")
+
+	rl.getVisitor("active").lastSeen = time.Now().Add(rl.cleanup)
+	rl.evictIdle(time.Now().Add(rl.cleanup + time.Second))
+
+	rl.mu.RLock()
+	defer rl.mu.RUnlock()
+	if _, exists := rl.visitors["idle"]; exists {
+		t.Error("idle visitor was not evicted")
+	}
+	if _, exists := rl.visitors["active"]; !exists {
+		t.Error("active visitor was evicted")
+	}
+}
@@ -4,13 +4,14 @@ import "time"
 
 // User represents a user in the system
 type User struct {
-	ID        string    `json:"id"`
-	Email     string    `json:"email"`
-	Name      string    `json:"name"`
-	Password  string    `json:"-"`
-	Role      string    `json:"role"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID            string    `json:"id"`
+	Email         string    `json:"email"`
+	Name          string    `json:"name"`
+	Password      string    `json:"-"`
+	Role          string    `json:"role"`
+	EmailVerified bool      `json:"email_verified"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
 }
 
 // RefreshToken represents a refresh token in the system
@@ -21,8 +22,27 @@ type RefreshToken struct {
 	ExpiresAt time.Time `json:"expires_at"`
 	CreatedAt time.Time `json:"created_at"`
 	Revoked   bool      `json:"revoked"`
+	Rotated   bool      `json:"rotated"` // Revoked by exchanging it for a new token
+}
+
+// UserToken is a single-use token emailed to a user, such as the link to
+// verify their email address
+type UserToken struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"user_id"`
+	Purpose   string    `json:"purpose"`
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+	Used      bool      `json:"used"`
 }
 
+// User token purposes
+const (
+	TokenPurposeEmailVerification = "email_verification"
+	TokenPurposePasswordReset     = "password_reset"
+)
+
 // Role types
 const (
 	RoleAdmin     = "admin"
@@ -0,0 +1,125 @@
+package monitoring
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// RouteFunc returns the route template a request matched, such as
+// "/api/users/{id}", or "" if it doesn't know. With gorilla/mux, use the
+// middleware via router.Use and return mux.CurrentRoute(r).GetPathTemplate().
+type RouteFunc func(r *http.Request) string
+
+// HTTPMiddleware records request counts, durations and response sizes.
+// Requests are labeled with the http.ServeMux pattern they matched, or a
+// normalized path if there is none.
+func HTTPMiddleware(m *Metrics) func(http.Handler) http.Handler {
+	return HTTPMiddlewareWithRoutes(m, nil)
+}
+
+// HTTPMiddlewareWithRoutes is HTTPMiddleware with a custom route extractor,
+// for routers other than http.ServeMux
+func HTTPMiddlewareWithRoutes(m *Metrics, route RouteFunc) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			recorder := &statusRecorder{ResponseWriter: w, statusCode: http.StatusOK}
+
+			next.ServeHTTP(recorder, r)
+
+			// Routes are only known once the router has run
+			endpoint := ""
+			if route != nil {
+				endpoint = route(r)
+			}
+			if endpoint == "" {
+				endpoint = routePattern(r)
+			}
+
+			m.HTTPRequestsTotal.WithLabelValues(r.Method, endpoint, strconv.Itoa(recorder.statusCode)).Inc()
+			m.HTTPRequestDuration.WithLabelValues(r.Method, endpoint).Observe(time.Since(start).Seconds())
+			m.HTTPResponseSize.WithLabelValues(r.Method, endpoint).Observe(float64(recorder.size))
+		})
+	}
+}
+
+// routePattern returns the path of the http.ServeMux pattern r matched,
+// or its path with IDs replaced so label values stay bounded
+func routePattern(r *http.Request) string {
+	if r.Pattern != "" {
+		// Patterns may start with a method and host, e.g. "GET /users/{id}"
+		if i := strings.Index(r.Pattern, "/"); i >= 0 {
+			return r.Pattern[i:]
+		}
+		return r.Pattern
+	}
+	return normalizePath(r.URL.Path)
+}
+
+// normalizePath replaces path segments that look like IDs (numbers, UUIDs
+// and long hex or mixed alphanumeric tokens) with ":id"
+func normalizePath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if isIDSegment(segment) {
+			segments[i] = ":id"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+func isIDSegment(segment string) bool {
+	if segment == "" {
+		return false
+	}
+
+	digits, hex := 0, true
+	for _, c := range segment {
+		switch {
+		case unicode.IsDigit(c):
+			digits++
+		case c == '-' || ('a' <= c && c <= 'f') || ('A' <= c && c <= 'F'):
+		default:
+			hex = false
+		}
+	}
+
+	// Plain numbers, UUIDs and hashes
+	if digits == len(segment) || (hex && digits > 0 && len(segment) >= 16) {
+		return true
+	}
+	// Random tokens mix letters and digits
+	return digits > 0 && len(segment) >= 16
+}
+
+// statusRecorder captures the status code and body size of a response
+type statusRecorder struct {
+	http.ResponseWriter
+	statusCode  int
+	size        int
+	wroteHeader bool
+}
+
+func (sr *statusRecorder) WriteHeader(code int) {
+	if !sr.wroteHeader {
+		sr.statusCode = code
+		sr.wroteHeader = true
+	}
+	sr.ResponseWriter.WriteHeader(code)
+}
+
+func (sr *statusRecorder) Write(b []byte) (int, error) {
+	sr.wroteHeader = true
+	n, err := sr.ResponseWriter.Write(b)
+	sr.size += n
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, e.g.
+// to flush streamed responses
+func (sr *statusRecorder) Unwrap() http.ResponseWriter {
+	return sr.ResponseWriter
+}
@@ -0,0 +1,78 @@
+package monitoring
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// histogram returns the sample count and sum observed for labels
+func histogram(t *testing.T, vec *prometheus.HistogramVec, labels ...string) (uint64, float64) {
+	t.Helper()
+
+	var metric dto.Metric
+	if err := vec.WithLabelValues(labels...).(prometheus.Metric).Write(&metric); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	return metric.GetHistogram().GetSampleCount(), metric.GetHistogram().GetSampleSum()
+}
+
+func TestHTTPMiddleware(t *testing.T) {
+	metrics := NewMetrics(nil)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("hello"))
+	})
+	handler := HTTPMiddleware(metrics)(mux)
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/42", nil))
+
+	if got := testutil.ToFloat64(metrics.HTTPRequestsTotal.WithLabelValues("GET", "/users/{id}", "201")); got != 1 {
+		t.Errorf("http_requests_total = %v, want 1", got)
+	}
+	if count, _ := histogram(t, metrics.HTTPRequestDuration, "GET", "/users/{id}"); count != 1 {
+		t.Errorf("duration sample count = %d, want 1", count)
+	}
+	if count, sum := histogram(t, metrics.HTTPResponseSize, "GET", "/users/{id}"); count != 1 || sum != 5 {
+		t.Errorf("response size = %d samples summing to %v, want 1 and 5", count, sum)
+	}
+	if n := testutil.CollectAndCount(metrics.HTTPRequestsTotal); n != 1 {
+		t.Errorf("http_requests_total has %d series, want 1", n)
+	}
+}
+
+func TestHTTPMiddlewareWithRoutes(t *testing.T) {
+	metrics := NewMetrics(nil)
+
+	handler := HTTPMiddlewareWithRoutes(metrics, func(r *http.Request) string {
+		return "/orders/{order}"
+	})(http.NotFoundHandler())
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodDelete, "/orders/7", nil))
+
+	if got := testutil.ToFloat64(metrics.HTTPRequestsTotal.WithLabelValues("DELETE", "/orders/{order}", "404")); got != 1 {
+		t.Errorf("http_requests_total = %v, want 1", got)
+	}
+}
+
+func TestNormalizePath(t *testing.T) {
+	tests := map[string]string{
+		"/api/users":    "/api/users",
+		"/api/users/42": "/api/users/:id",
+		"/api/users/550e8400-e29b-41d4-a716-446655440000/roles": "/api/users/:id/roles",
+		"/files/d41d8cd98f00b204e9800998ecf8427e":               "/files/:id",
+		"/invites/a1B2c3D4e5F6g7H8i9":                           "/invites/:id",
+		"/api/v1/health":                                        "/api/v1/health",
+	}
+
+	for path, want := range tests {
+		if got := normalizePath(path); got != want {
+			t.Errorf("normalizePath(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
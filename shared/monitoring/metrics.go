@@ -1,8 +1,14 @@
 package monitoring
 
 import (
+	"net/http"
+	"sync"
+
+	"github.com/dayanch951/marimo/shared/resilience"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 // Metrics holds all Prometheus metrics
@@ -45,24 +51,55 @@ type Metrics struct {
 	// API Gateway metrics
 	APIRateLimitExceeded     *prometheus.CounterVec
 	APICircuitBreakerOpen    *prometheus.GaugeVec
+	APICircuitBreakerTrips   *prometheus.CounterVec
 
 	// WebSocket metrics
 	WebSocketConnectionsActive prometheus.Gauge
 	WebSocketMessagesTotal     *prometheus.CounterVec
+
+	registry *prometheus.Registry
 }
 
-// NewMetrics creates and registers all Prometheus metrics
-func NewMetrics() *Metrics {
+var (
+	defaultMetrics     *Metrics
+	defaultMetricsOnce sync.Once
+)
+
+// Default returns the process-wide metrics, created on first use along
+// with Go runtime and process collectors
+func Default() *Metrics {
+	defaultMetricsOnce.Do(func() {
+		reg := prometheus.NewRegistry()
+		reg.MustRegister(
+			collectors.NewGoCollector(),
+			collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		)
+		defaultMetrics = NewMetrics(reg)
+	})
+	return defaultMetrics
+}
+
+// NewMetrics creates all Prometheus metrics and registers them with reg,
+// or with a new registry if reg is nil. Each registry can only hold one
+// set of metrics.
+func NewMetrics(reg *prometheus.Registry) *Metrics {
+	if reg == nil {
+		reg = prometheus.NewRegistry()
+	}
+	factory := promauto.With(reg)
+
 	return &Metrics{
+		registry: reg,
+
 		// HTTP metrics
-		HTTPRequestsTotal: promauto.NewCounterVec(
+		HTTPRequestsTotal: factory.NewCounterVec(
 			prometheus.CounterOpts{
 				Name: "http_requests_total",
 				Help: "Total number of HTTP requests",
 			},
 			[]string{"method", "endpoint", "status"},
 		),
-		HTTPRequestDuration: promauto.NewHistogramVec(
+		HTTPRequestDuration: factory.NewHistogramVec(
 			prometheus.HistogramOpts{
 				Name:    "http_request_duration_seconds",
 				Help:    "HTTP request duration in seconds",
@@ -70,7 +107,7 @@ func NewMetrics() *Metrics {
 			},
 			[]string{"method", "endpoint"},
 		),
-		HTTPResponseSize: promauto.NewHistogramVec(
+		HTTPResponseSize: factory.NewHistogramVec(
 			prometheus.HistogramOpts{
 				Name:    "http_response_size_bytes",
 				Help:    "HTTP response size in bytes",
@@ -80,14 +117,14 @@ func NewMetrics() *Metrics {
 		),
 
 		// Database metrics
-		DBQueriesTotal: promauto.NewCounterVec(
+		DBQueriesTotal: factory.NewCounterVec(
 			prometheus.CounterOpts{
 				Name: "db_queries_total",
 				Help: "Total number of database queries",
 			},
 			[]string{"operation", "table", "status"},
 		),
-		DBQueryDuration: promauto.NewHistogramVec(
+		DBQueryDuration: factory.NewHistogramVec(
 			prometheus.HistogramOpts{
 				Name:    "db_query_duration_seconds",
 				Help:    "Database query duration in seconds",
@@ -95,13 +132,13 @@ func NewMetrics() *Metrics {
 			},
 			[]string{"operation", "table"},
 		),
-		DBConnectionsOpen: promauto.NewGauge(
+		DBConnectionsOpen: factory.NewGauge(
 			prometheus.GaugeOpts{
 				Name: "db_connections_open",
 				Help: "Number of open database connections",
 			},
 		),
-		DBConnectionsIdle: promauto.NewGauge(
+		DBConnectionsIdle: factory.NewGauge(
 			prometheus.GaugeOpts{
 				Name: "db_connections_idle",
 				Help: "Number of idle database connections",
@@ -109,14 +146,14 @@ func NewMetrics() *Metrics {
 		),
 
 		// Analytics metrics
-		AnalyticsQueriesTotal: promauto.NewCounterVec(
+		AnalyticsQueriesTotal: factory.NewCounterVec(
 			prometheus.CounterOpts{
 				Name: "analytics_queries_total",
 				Help: "Total number of analytics queries executed",
 			},
 			[]string{"tenant_id", "query_type", "status"},
 		),
-		AnalyticsQueryDuration: promauto.NewHistogramVec(
+		AnalyticsQueryDuration: factory.NewHistogramVec(
 			prometheus.HistogramOpts{
 				Name:    "analytics_query_duration_seconds",
 				Help:    "Analytics query execution duration in seconds",
@@ -124,7 +161,7 @@ func NewMetrics() *Metrics {
 			},
 			[]string{"tenant_id", "query_type"},
 		),
-		AnalyticsResultSize: promauto.NewHistogramVec(
+		AnalyticsResultSize: factory.NewHistogramVec(
 			prometheus.HistogramOpts{
 				Name:    "analytics_result_size_rows",
 				Help:    "Number of rows in analytics query result",
@@ -132,14 +169,14 @@ func NewMetrics() *Metrics {
 			},
 			[]string{"tenant_id", "query_type"},
 		),
-		AnalyticsCacheHits: promauto.NewCounterVec(
+		AnalyticsCacheHits: factory.NewCounterVec(
 			prometheus.CounterOpts{
 				Name: "analytics_cache_hits_total",
 				Help: "Total number of analytics cache hits",
 			},
 			[]string{"tenant_id"},
 		),
-		AnalyticsCacheMisses: promauto.NewCounterVec(
+		AnalyticsCacheMisses: factory.NewCounterVec(
 			prometheus.CounterOpts{
 				Name: "analytics_cache_misses_total",
 				Help: "Total number of analytics cache misses",
@@ -148,21 +185,21 @@ func NewMetrics() *Metrics {
 		),
 
 		// Webhook metrics
-		WebhooksDispatched: promauto.NewCounterVec(
+		WebhooksDispatched: factory.NewCounterVec(
 			prometheus.CounterOpts{
 				Name: "webhooks_dispatched_total",
 				Help: "Total number of webhooks dispatched",
 			},
 			[]string{"tenant_id", "event_type"},
 		),
-		WebhookDeliveriesTotal: promauto.NewCounterVec(
+		WebhookDeliveriesTotal: factory.NewCounterVec(
 			prometheus.CounterOpts{
 				Name: "webhook_deliveries_total",
 				Help: "Total number of webhook delivery attempts",
 			},
 			[]string{"tenant_id", "webhook_id", "status"},
 		),
-		WebhookDeliveryDuration: promauto.NewHistogramVec(
+		WebhookDeliveryDuration: factory.NewHistogramVec(
 			prometheus.HistogramOpts{
 				Name:    "webhook_delivery_duration_seconds",
 				Help:    "Webhook delivery duration in seconds",
@@ -170,14 +207,14 @@ func NewMetrics() *Metrics {
 			},
 			[]string{"tenant_id", "webhook_id"},
 		),
-		WebhookRetries: promauto.NewCounterVec(
+		WebhookRetries: factory.NewCounterVec(
 			prometheus.CounterOpts{
 				Name: "webhook_retries_total",
 				Help: "Total number of webhook retry attempts",
 			},
 			[]string{"tenant_id", "webhook_id", "attempt"},
 		),
-		WebhookFailures: promauto.NewCounterVec(
+		WebhookFailures: factory.NewCounterVec(
 			prometheus.CounterOpts{
 				Name: "webhook_failures_total",
 				Help: "Total number of webhook failures",
@@ -186,14 +223,14 @@ func NewMetrics() *Metrics {
 		),
 
 		// Integration metrics
-		IntegrationCallsTotal: promauto.NewCounterVec(
+		IntegrationCallsTotal: factory.NewCounterVec(
 			prometheus.CounterOpts{
 				Name: "integration_calls_total",
 				Help: "Total number of third-party integration API calls",
 			},
 			[]string{"tenant_id", "provider", "action", "status"},
 		),
-		IntegrationCallDuration: promauto.NewHistogramVec(
+		IntegrationCallDuration: factory.NewHistogramVec(
 			prometheus.HistogramOpts{
 				Name:    "integration_call_duration_seconds",
 				Help:    "Integration API call duration in seconds",
@@ -201,7 +238,7 @@ func NewMetrics() *Metrics {
 			},
 			[]string{"tenant_id", "provider", "action"},
 		),
-		IntegrationErrors: promauto.NewCounterVec(
+		IntegrationErrors: factory.NewCounterVec(
 			prometheus.CounterOpts{
 				Name: "integration_errors_total",
 				Help: "Total number of integration errors",
@@ -210,19 +247,19 @@ func NewMetrics() *Metrics {
 		),
 
 		// Tenant metrics
-		TenantsTotal: promauto.NewGauge(
+		TenantsTotal: factory.NewGauge(
 			prometheus.GaugeOpts{
 				Name: "tenants_total",
 				Help: "Total number of tenants",
 			},
 		),
-		TenantsActive: promauto.NewGauge(
+		TenantsActive: factory.NewGauge(
 			prometheus.GaugeOpts{
 				Name: "tenants_active",
 				Help: "Number of active tenants",
 			},
 		),
-		TenantUsageMetrics: promauto.NewGaugeVec(
+		TenantUsageMetrics: factory.NewGaugeVec(
 			prometheus.GaugeOpts{
 				Name: "tenant_usage",
 				Help: "Tenant usage metrics",
@@ -231,29 +268,36 @@ func NewMetrics() *Metrics {
 		),
 
 		// API Gateway metrics
-		APIRateLimitExceeded: promauto.NewCounterVec(
+		APIRateLimitExceeded: factory.NewCounterVec(
 			prometheus.CounterOpts{
 				Name: "api_rate_limit_exceeded_total",
 				Help: "Total number of rate limit exceeded events",
 			},
 			[]string{"tenant_id", "endpoint"},
 		),
-		APICircuitBreakerOpen: promauto.NewGaugeVec(
+		APICircuitBreakerOpen: factory.NewGaugeVec(
 			prometheus.GaugeOpts{
 				Name: "api_circuit_breaker_open",
 				Help: "Circuit breaker state (1=open, 0=closed)",
 			},
 			[]string{"service"},
 		),
+		APICircuitBreakerTrips: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "api_circuit_breaker_trips_total",
+				Help: "Total number of times a circuit breaker opened",
+			},
+			[]string{"service"},
+		),
 
 		// WebSocket metrics
-		WebSocketConnectionsActive: promauto.NewGauge(
+		WebSocketConnectionsActive: factory.NewGauge(
 			prometheus.GaugeOpts{
 				Name: "websocket_connections_active",
 				Help: "Number of active WebSocket connections",
 			},
 		),
-		WebSocketMessagesTotal: promauto.NewCounterVec(
+		WebSocketMessagesTotal: factory.NewCounterVec(
 			prometheus.CounterOpts{
 				Name: "websocket_messages_total",
 				Help: "Total number of WebSocket messages",
@@ -262,3 +306,20 @@ func NewMetrics() *Metrics {
 		),
 	}
 }
+
+// Handler serves the metrics in the Prometheus text format, e.g. on /metrics
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+// ObserveCircuitBreakerState implements resilience.MetricsObserver. The
+// open gauge stays at 1 while the breaker is half-open.
+func (m *Metrics) ObserveCircuitBreakerState(name string, from, to resilience.State) {
+	switch to {
+	case resilience.StateOpen:
+		m.APICircuitBreakerOpen.WithLabelValues(name).Set(1)
+		m.APICircuitBreakerTrips.WithLabelValues(name).Inc()
+	case resilience.StateClosed:
+		m.APICircuitBreakerOpen.WithLabelValues(name).Set(0)
+	}
+}
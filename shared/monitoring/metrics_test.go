@@ -0,0 +1,74 @@
+package monitoring
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dayanch951/marimo/shared/resilience"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestNewMetrics_SeparateRegistries(t *testing.T) {
+	first := NewMetrics(prometheus.NewRegistry())
+	second := NewMetrics(prometheus.NewRegistry())
+
+	first.HTTPRequestsTotal.WithLabelValues("GET", "/users", "200").Inc()
+
+	rec := httptest.NewRecorder()
+	first.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if !strings.Contains(rec.Body.String(), `http_requests_total{endpoint="/users",method="GET",status="200"} 1`) {
+		t.Errorf("first registry is missing the request counter:\n%s", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	second.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if strings.Contains(rec.Body.String(), "http_requests_total{") {
+		t.Errorf("second registry shares the first one's counter:\n%s", rec.Body.String())
+	}
+
+	if Default() != Default() {
+		t.Error("Default() returned different instances")
+	}
+}
+
+func TestMetrics_ObserveCircuitBreakerState(t *testing.T) {
+	metrics := NewMetrics(nil)
+
+	cb := resilience.NewCircuitBreaker(resilience.Settings{
+		Name:      "orders",
+		Threshold: 1,
+		Timeout:   10 * time.Millisecond,
+		Metrics:   metrics,
+	})
+	open := func() float64 {
+		return testutil.ToFloat64(metrics.APICircuitBreakerOpen.WithLabelValues("orders"))
+	}
+	trips := func() float64 {
+		return testutil.ToFloat64(metrics.APICircuitBreakerTrips.WithLabelValues("orders"))
+	}
+
+	cb.Execute(func() error { return errors.New("unavailable") })
+	if cb.State() != resilience.StateOpen {
+		t.Fatalf("state = %s, want open", cb.State())
+	}
+	if open() != 1 || trips() != 1 {
+		t.Errorf("open = %v, trips = %v, want 1 and 1", open(), trips())
+	}
+
+	// Half-open still reports open; a successful probe closes it
+	time.Sleep(20 * time.Millisecond)
+	if err := cb.Execute(func() error { return nil }); err != nil {
+		t.Fatalf("probe Execute() error = %v", err)
+	}
+	if cb.State() != resilience.StateClosed {
+		t.Fatalf("state = %s, want closed", cb.State())
+	}
+	if open() != 0 || trips() != 1 {
+		t.Errorf("open = %v, trips = %v, want 0 and 1", open(), trips())
+	}
+}
@@ -0,0 +1,170 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+var (
+	// ErrUnroutable is returned when the broker has no queue to route a
+	// published message to
+	ErrUnroutable = errors.New("message could not be routed to a queue")
+	// ErrPublishNacked is returned when the broker refuses a published message
+	ErrPublishNacked = errors.New("message was rejected by the broker")
+	// ErrPublishTimeout is returned when the broker doesn't confirm a
+	// published message in time
+	ErrPublishTimeout = errors.New("timed out waiting for publish confirmation")
+)
+
+// DefaultPublishTimeout is how long publishes wait for the broker's
+// confirmation
+const DefaultPublishTimeout = 5 * time.Second
+
+// confirmer publishes on a channel in confirm mode and waits for the
+// broker to acknowledge each message. Publishes are mandatory, so messages
+// no queue accepts are reported instead of dropped.
+type confirmer struct {
+	ch      amqpChannel
+	timeout time.Duration
+
+	// mu serializes publishes so delivery tags match sequence numbers
+	mu       sync.Mutex
+	pending  map[uint64]pendingPublish
+	returned map[string]amqp.Return // By message ID
+}
+
+type pendingPublish struct {
+	messageID string
+	done      chan error
+}
+
+// newConfirmer puts ch in confirm mode and starts matching confirmations
+// to publishes until the channel closes
+func newConfirmer(ch amqpChannel, timeout time.Duration) (*confirmer, error) {
+	if err := ch.Confirm(false); err != nil {
+		return nil, fmt.Errorf("failed to enable publisher confirms: %w", err)
+	}
+
+	c := &confirmer{
+		ch:       ch,
+		timeout:  timeout,
+		pending:  make(map[uint64]pendingPublish),
+		returned: make(map[string]amqp.Return),
+	}
+
+	confirms := ch.NotifyPublish(make(chan amqp.Confirmation, 64))
+	returns := ch.NotifyReturn(make(chan amqp.Return, 64))
+	go c.dispatch(confirms, returns)
+
+	return c, nil
+}
+
+// publish sends msg and waits until the broker confirms it
+func (c *confirmer) publish(exchange, key string, msg amqp.Publishing) error {
+	if msg.MessageId == "" {
+		msg.MessageId = uuid.New().String()
+	}
+	done := make(chan error, 1)
+
+	c.mu.Lock()
+	tag := c.ch.GetNextPublishSeqNo()
+	c.pending[tag] = pendingPublish{messageID: msg.MessageId, done: done}
+	if err := c.ch.Publish(exchange, key, true, false, msg); err != nil {
+		delete(c.pending, tag)
+		c.mu.Unlock()
+		return err
+	}
+	c.mu.Unlock()
+
+	timer := time.NewTimer(c.timeout)
+	defer timer.Stop()
+
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+		c.mu.Lock()
+		delete(c.pending, tag)
+		c.mu.Unlock()
+		return ErrPublishTimeout
+	}
+}
+
+// dispatch resolves pending publishes as confirmations arrive. The broker
+// sends a message's return before its confirmation, so a confirmed
+// message has been returned if and only if its return was seen first.
+func (c *confirmer) dispatch(confirms <-chan amqp.Confirmation, returns <-chan amqp.Return) {
+	for {
+		select {
+		case ret, ok := <-returns:
+			if !ok {
+				returns = nil
+				continue
+			}
+			c.mu.Lock()
+			c.returned[ret.MessageId] = ret
+			c.mu.Unlock()
+
+		case confirm, ok := <-confirms:
+			if !ok {
+				c.failPending()
+				return
+			}
+			c.resolve(confirm, returns)
+		}
+	}
+}
+
+func (c *confirmer) resolve(confirm amqp.Confirmation, returns <-chan amqp.Return) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Collect returns that were queued alongside this confirmation
+	for drained := false; !drained && returns != nil; {
+		select {
+		case ret, ok := <-returns:
+			if !ok {
+				drained = true
+				continue
+			}
+			c.returned[ret.MessageId] = ret
+		default:
+			drained = true
+		}
+	}
+
+	pending, ok := c.pending[confirm.DeliveryTag]
+	if !ok {
+		return // Timed out
+	}
+	delete(c.pending, confirm.DeliveryTag)
+
+	ret, returned := c.returned[pending.messageID]
+	delete(c.returned, pending.messageID)
+
+	switch {
+	case !confirm.Ack:
+		pending.done <- ErrPublishNacked
+	case returned:
+		pending.done <- fmt.Errorf("%w: %s (exchange %q, routing key %q)",
+			ErrUnroutable, ret.ReplyText, ret.Exchange, ret.RoutingKey)
+	default:
+		pending.done <- nil
+	}
+}
+
+// failPending fails every publish still waiting when the channel closes
+func (c *confirmer) failPending() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for tag, pending := range c.pending {
+		pending.done <- ErrNotConnected
+		delete(c.pending, tag)
+	}
+}
@@ -0,0 +1,132 @@
+package queue
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/dayanch951/marimo/shared/resilience"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// amqpConnection is the subset of *amqp.Connection the queue uses
+type amqpConnection interface {
+	Channel() (amqpChannel, error)
+	NotifyClose(c chan *amqp.Error) chan *amqp.Error
+	Close() error
+}
+
+// amqpConn adapts *amqp.Connection to amqpConnection
+type amqpConn struct {
+	*amqp.Connection
+}
+
+func (c amqpConn) Channel() (amqpChannel, error) {
+	ch, err := c.Connection.Channel()
+	if err != nil {
+		return nil, err
+	}
+	return ch, nil
+}
+
+func dialAMQP(url string) (amqpConnection, error) {
+	conn, err := amqp.Dial(url)
+	if err != nil {
+		return nil, err
+	}
+	return amqpConn{conn}, nil
+}
+
+// connect dials RabbitMQ, replays the recorded setup on the new channel
+// and watches the connection so it can be re-established if it drops
+func (mq *MessageQueue) connect() error {
+	conn, err := mq.dial(mq.url)
+	if err != nil {
+		return fmt.Errorf("failed to connect to RabbitMQ: %w", err)
+	}
+
+	channel, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to open channel: %w", err)
+	}
+
+	connClosed := conn.NotifyClose(make(chan *amqp.Error, 1))
+	channelClosed := channel.NotifyClose(make(chan *amqp.Error, 1))
+
+	confirms, err := newConfirmer(channel, mq.publishTimeout)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	mq.mu.RLock()
+	setup := mq.setup
+	mq.mu.RUnlock()
+
+	for _, fn := range setup {
+		if err := fn(channel); err != nil {
+			conn.Close()
+			return fmt.Errorf("failed to restore queue setup: %w", err)
+		}
+	}
+
+	mq.mu.Lock()
+	if mq.closed {
+		mq.mu.Unlock()
+		conn.Close()
+		return ErrNotConnected
+	}
+	mq.conn, mq.channel, mq.confirms = conn, channel, confirms
+	mq.mu.Unlock()
+
+	go mq.watch(conn, connClosed, channelClosed)
+	return nil
+}
+
+// watch waits for the connection or channel to close and reconnects unless
+// the queue itself was closed
+func (mq *MessageQueue) watch(conn amqpConnection, connClosed, channelClosed chan *amqp.Error) {
+	var reason *amqp.Error
+	select {
+	case reason = <-connClosed:
+	case reason = <-channelClosed:
+	}
+
+	mq.mu.Lock()
+	if mq.closed {
+		mq.mu.Unlock()
+		return
+	}
+	mq.channel, mq.confirms = nil, nil
+	mq.mu.Unlock()
+
+	// The connection may still be open if only the channel failed
+	conn.Close()
+
+	log.Printf("RabbitMQ connection lost: %v, reconnecting", reason)
+	mq.reconnect()
+}
+
+// reconnect dials until it succeeds or the queue is closed, backing off
+// exponentially between attempts
+func (mq *MessageQueue) reconnect() {
+	for attempt := 1; ; attempt++ {
+		err := mq.connect()
+		if err == nil {
+			log.Printf("Reconnected to RabbitMQ after %d attempt(s)", attempt)
+			return
+		}
+
+		mq.mu.RLock()
+		closed := mq.closed
+		mq.mu.RUnlock()
+		if closed {
+			return
+		}
+
+		delay := resilience.ExponentialBackoff(attempt, mq.reconnectDelay, mq.maxReconnectDelay)
+		log.Printf("Failed to reconnect to RabbitMQ: %v, retrying in %v", err, delay)
+		time.Sleep(delay)
+	}
+}
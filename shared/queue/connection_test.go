@@ -0,0 +1,134 @@
+package queue
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// fakeConnection is an amqpConnection with a single fakeChannel
+type fakeConnection struct {
+	channel *fakeChannel
+
+	mu       sync.Mutex
+	notifies []chan *amqp.Error
+}
+
+func (f *fakeConnection) Channel() (amqpChannel, error) {
+	return f.channel, nil
+}
+
+func (f *fakeConnection) NotifyClose(c chan *amqp.Error) chan *amqp.Error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.notifies = append(f.notifies, c)
+	return c
+}
+
+func (f *fakeConnection) Close() error {
+	return nil
+}
+
+// drop simulates the broker closing the connection
+func (f *fakeConnection) drop() {
+	f.channel.shutdown()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, c := range f.notifies {
+		c <- &amqp.Error{Code: amqp.ConnectionForced, Reason: "broker restarted"}
+		close(c)
+	}
+	f.notifies = nil
+}
+
+// fakeBroker hands out fake connections. Once paused, dials fail until it
+// is resumed.
+type fakeBroker struct {
+	mu     sync.Mutex
+	conns  []*fakeConnection
+	paused bool
+}
+
+func (b *fakeBroker) dial(url string) (amqpConnection, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.paused {
+		return nil, errors.New("connection refused")
+	}
+
+	conn := &fakeConnection{channel: newFakeChannel()}
+	b.conns = append(b.conns, conn)
+	return conn, nil
+}
+
+func (b *fakeBroker) setPaused(paused bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.paused = paused
+}
+
+func (b *fakeBroker) latest() *fakeConnection {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.conns[len(b.conns)-1]
+}
+
+func TestMessageQueue_Reconnects(t *testing.T) {
+	broker := &fakeBroker{}
+	mq := newMessageQueue("amqp://test", broker.dial)
+	mq.reconnectDelay = time.Millisecond
+	mq.maxReconnectDelay = 5 * time.Millisecond
+	if err := mq.connect(); err != nil {
+		t.Fatalf("connect() error = %v", err)
+	}
+	defer mq.Close()
+
+	handled := make(chan string, 1)
+	if err := mq.DeclareQueue("orders"); err != nil {
+		t.Fatalf("DeclareQueue() error = %v", err)
+	}
+	if err := mq.Consume("orders", func(msg Message) error {
+		handled <- msg.ID
+		return nil
+	}); err != nil {
+		t.Fatalf("Consume() error = %v", err)
+	}
+
+	broker.setPaused(true)
+	broker.latest().drop()
+
+	waitFor(t, func() bool {
+		return errors.Is(mq.Publish("orders", Message{ID: "lost"}), ErrNotConnected)
+	})
+
+	broker.setPaused(false)
+	waitFor(t, func() bool {
+		return mq.Publish("orders", Message{ID: "msg-1"}) == nil
+	})
+
+	select {
+	case id := <-handled:
+		if id != "msg-1" {
+			t.Errorf("handled message %q, want msg-1", id)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("consumer wasn't restarted after reconnecting")
+	}
+
+	channel := broker.latest().channel
+	channel.mu.Lock()
+	defer channel.mu.Unlock()
+	for _, queue := range []string{"orders", "orders.dlq"} {
+		if !channel.declared[queue] {
+			t.Errorf("queue %s wasn't declared again after reconnecting", queue)
+		}
+	}
+	if len(broker.conns) != 2 {
+		t.Errorf("dialed %d connections, want 2", len(broker.conns))
+	}
+}
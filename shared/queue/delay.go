@@ -0,0 +1,77 @@
+package queue
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// DefaultRetryDelays are the waits before each redelivery of a failing
+// message consumed with ConsumeWithBackoff
+var DefaultRetryDelays = []time.Duration{10 * time.Second, time.Minute, 5 * time.Minute}
+
+// RetryQueueName returns the name of the queue that holds messages from
+// queueName for delay before they are redelivered
+func RetryQueueName(queueName string, delay time.Duration) string {
+	return fmt.Sprintf("%s.retry.%dms", queueName, delay.Milliseconds())
+}
+
+// ConsumeWithBackoff is like Consume, but waits delays[n] before the
+// (n+1)th redelivery of a failing message instead of redelivering it
+// immediately. Once every delay has been used the message is moved to the
+// dead-letter queue.
+//
+// Each delay gets a queue whose messages expire after that delay and are
+// then dead-lettered back to queueName by the broker, so waiting messages
+// survive restarts and don't hold up the consumer.
+func (mq *MessageQueue) ConsumeWithBackoff(queueName string, delays []time.Duration, handler func(Message) error) error {
+	if len(delays) == 0 {
+		return fmt.Errorf("no retry delays given for queue %s", queueName)
+	}
+
+	if err := mq.DeclareQueue(DeadLetterQueueName(queueName)); err != nil {
+		return fmt.Errorf("failed to declare dead letter queue: %w", err)
+	}
+
+	for _, delay := range delays {
+		if err := mq.apply(func(ch amqpChannel) error {
+			return declareRetryQueue(ch, queueName, delay)
+		}); err != nil {
+			return err
+		}
+	}
+
+	return mq.apply(func(ch amqpChannel) error {
+		return mq.startConsumer(ch, queueName, delays, handler)
+	})
+}
+
+// declareRetryQueue declares the queue holding messages from queueName
+// for delay
+func declareRetryQueue(ch amqpChannel, queueName string, delay time.Duration) error {
+	if delay < time.Millisecond {
+		return fmt.Errorf("retry delay %v is shorter than a millisecond", delay)
+	}
+
+	name := RetryQueueName(queueName, delay)
+	_, err := ch.QueueDeclare(
+		name,  // name
+		true,  // durable
+		false, // auto-delete
+		false, // exclusive
+		false, // no-wait
+		amqp.Table{
+			"x-message-ttl":             delay.Milliseconds(),
+			"x-dead-letter-exchange":    "", // The default exchange routes by queue name
+			"x-dead-letter-routing-key": queueName,
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to declare retry queue %s: %w", name, err)
+	}
+
+	log.Printf("Retry queue %s declared", name)
+	return nil
+}
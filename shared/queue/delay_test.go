@@ -0,0 +1,67 @@
+package queue
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMessageQueue_ConsumeWithBackoff(t *testing.T) {
+	channel := newFakeChannel()
+	mq := newTestQueue(t, channel)
+
+	delays := []time.Duration{50 * time.Millisecond, 100 * time.Millisecond}
+
+	var mu sync.Mutex
+	var attempts []time.Time
+	handled := make(chan struct{})
+	err := mq.ConsumeWithBackoff("orders", delays, func(msg Message) error {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts = append(attempts, time.Now())
+		if len(attempts) <= len(delays) {
+			return errors.New("payment service unavailable")
+		}
+		close(handled)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ConsumeWithBackoff() error = %v", err)
+	}
+
+	for _, delay := range delays {
+		name := RetryQueueName("orders", delay)
+		args := channel.args[name]
+		if args["x-message-ttl"] != delay.Milliseconds() || args["x-dead-letter-routing-key"] != "orders" {
+			t.Errorf("%s declared with %v, want a %v TTL dead-lettering to orders", name, args, delay)
+		}
+	}
+
+	if err := mq.Publish("orders", Message{ID: "msg-1"}); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+
+	select {
+	case <-handled:
+	case <-time.After(time.Second):
+		t.Fatal("message was never handled successfully")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for i, delay := range delays {
+		if waited := attempts[i+1].Sub(attempts[i]); waited < delay {
+			t.Errorf("retry %d ran after %v, want at least %v", i+1, waited, delay)
+		}
+	}
+
+	for _, delay := range delays {
+		if n := len(channel.publishedTo(RetryQueueName("orders", delay))); n != 1 {
+			t.Errorf("published %d messages to the %v retry queue, want 1", n, delay)
+		}
+	}
+	if n := len(channel.publishedTo("orders")); n != 1 {
+		t.Errorf("published %d messages to orders, want only the original", n)
+	}
+}
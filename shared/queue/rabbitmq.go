@@ -2,18 +2,62 @@ package queue
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
+	"sync"
 	"time"
 
 	amqp "github.com/rabbitmq/amqp091-go"
 )
 
-// MessageQueue handles RabbitMQ operations
+// MaxRetries is how many times a failing message is redelivered before it
+// is moved to its queue's dead-letter queue
+const MaxRetries = 3
+
+// amqpChannel is the subset of *amqp.Channel the queue uses. It keeps the
+// queue testable without a running broker.
+type amqpChannel interface {
+	QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error)
+	QueueInspect(name string) (amqp.Queue, error)
+	QueueBind(name, key, exchange string, noWait bool, args amqp.Table) error
+	QueuePurge(name string, noWait bool) (int, error)
+	QueueDelete(name string, ifUnused, ifEmpty, noWait bool) (int, error)
+	ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error
+	Qos(prefetchCount, prefetchSize int, global bool) error
+	Consume(queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args amqp.Table) (<-chan amqp.Delivery, error)
+	Publish(exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error
+	Confirm(noWait bool) error
+	GetNextPublishSeqNo() uint64
+	NotifyPublish(confirm chan amqp.Confirmation) chan amqp.Confirmation
+	NotifyReturn(c chan amqp.Return) chan amqp.Return
+	NotifyClose(c chan *amqp.Error) chan *amqp.Error
+	Close() error
+}
+
+// ErrNotConnected is returned while the connection to RabbitMQ is being
+// re-established
+var ErrNotConnected = errors.New("not connected to RabbitMQ")
+
+// MessageQueue handles RabbitMQ operations. It reconnects when the
+// connection drops, declaring its queues, exchanges and bindings again
+// and restarting its consumers.
 type MessageQueue struct {
-	conn    *amqp.Connection
-	channel *amqp.Channel
+	url  string
+	dial func(url string) (amqpConnection, error)
+
+	// Delays between reconnection attempts, doubling up to the maximum
+	reconnectDelay    time.Duration
+	maxReconnectDelay time.Duration
+	publishTimeout    time.Duration
+
+	mu       sync.RWMutex
+	conn     amqpConnection
+	channel  amqpChannel // nil while reconnecting
+	confirms *confirmer
+	setup    []func(ch amqpChannel) error
+	closed   bool
 }
 
 // Message represents a message in the queue
@@ -25,6 +69,20 @@ type Message struct {
 	Retry     int                    `json:"retry"`
 }
 
+// DeadLetter is a message that failed MaxRetries times, as stored in a
+// dead-letter queue
+type DeadLetter struct {
+	Message  Message   `json:"message"`
+	Queue    string    `json:"queue"` // Queue the message failed in
+	Error    string    `json:"error"` // Last handler error
+	FailedAt time.Time `json:"failed_at"`
+}
+
+// DeadLetterQueueName returns the name of a queue's dead-letter queue
+func DeadLetterQueueName(queueName string) string {
+	return queueName + ".dlq"
+}
+
 // NewMessageQueue creates a new RabbitMQ client
 func NewMessageQueue(url string) (*MessageQueue, error) {
 	if url == "" {
@@ -34,28 +92,76 @@ func NewMessageQueue(url string) (*MessageQueue, error) {
 		}
 	}
 
-	conn, err := amqp.Dial(url)
-	if err != nil {
-		return nil, fmt.Errorf("failed to connect to RabbitMQ: %w", err)
-	}
-
-	channel, err := conn.Channel()
-	if err != nil {
-		conn.Close()
-		return nil, fmt.Errorf("failed to open channel: %w", err)
+	mq := newMessageQueue(url, dialAMQP)
+	if err := mq.connect(); err != nil {
+		return nil, err
 	}
 
 	log.Println("Connected to RabbitMQ")
+	return mq, nil
+}
 
+func newMessageQueue(url string, dial func(url string) (amqpConnection, error)) *MessageQueue {
 	return &MessageQueue{
-		conn:    conn,
-		channel: channel,
-	}, nil
+		url:               url,
+		dial:              dial,
+		reconnectDelay:    time.Second,
+		maxReconnectDelay: 30 * time.Second,
+		publishTimeout:    DefaultPublishTimeout,
+	}
+}
+
+// currentChannel returns the open channel, or ErrNotConnected while
+// reconnecting
+func (mq *MessageQueue) currentChannel() (amqpChannel, error) {
+	mq.mu.RLock()
+	defer mq.mu.RUnlock()
+
+	if mq.channel == nil {
+		return nil, ErrNotConnected
+	}
+	return mq.channel, nil
+}
+
+// publish sends msg on the current channel and waits for the broker to
+// confirm it
+func (mq *MessageQueue) publish(exchange, key string, msg amqp.Publishing) error {
+	mq.mu.RLock()
+	confirms := mq.confirms
+	mq.mu.RUnlock()
+
+	if confirms == nil {
+		return ErrNotConnected
+	}
+	return confirms.publish(exchange, key, msg)
+}
+
+// apply runs fn on the current channel and, if it succeeds, again on
+// every channel opened after a reconnect
+func (mq *MessageQueue) apply(fn func(ch amqpChannel) error) error {
+	ch, err := mq.currentChannel()
+	if err != nil {
+		return err
+	}
+	if err := fn(ch); err != nil {
+		return err
+	}
+
+	mq.mu.Lock()
+	mq.setup = append(mq.setup, fn)
+	mq.mu.Unlock()
+	return nil
 }
 
 // DeclareQueue declares a queue with durability
 func (mq *MessageQueue) DeclareQueue(queueName string) error {
-	_, err := mq.channel.QueueDeclare(
+	return mq.apply(func(ch amqpChannel) error {
+		return declareQueue(ch, queueName)
+	})
+}
+
+func declareQueue(ch amqpChannel, queueName string) error {
+	_, err := ch.QueueDeclare(
 		queueName, // name
 		true,      // durable
 		false,     // auto-delete
@@ -74,7 +180,13 @@ func (mq *MessageQueue) DeclareQueue(queueName string) error {
 
 // DeclareExchange declares an exchange
 func (mq *MessageQueue) DeclareExchange(exchangeName, exchangeType string) error {
-	err := mq.channel.ExchangeDeclare(
+	return mq.apply(func(ch amqpChannel) error {
+		return declareExchange(ch, exchangeName, exchangeType)
+	})
+}
+
+func declareExchange(ch amqpChannel, exchangeName, exchangeType string) error {
+	err := ch.ExchangeDeclare(
 		exchangeName, // name
 		exchangeType, // type (fanout, direct, topic, headers)
 		true,         // durable
@@ -94,7 +206,13 @@ func (mq *MessageQueue) DeclareExchange(exchangeName, exchangeType string) error
 
 // BindQueue binds a queue to an exchange with a routing key
 func (mq *MessageQueue) BindQueue(queueName, exchangeName, routingKey string) error {
-	err := mq.channel.QueueBind(
+	return mq.apply(func(ch amqpChannel) error {
+		return bindQueue(ch, queueName, exchangeName, routingKey)
+	})
+}
+
+func bindQueue(ch amqpChannel, queueName, exchangeName, routingKey string) error {
+	err := ch.QueueBind(
 		queueName,    // queue name
 		routingKey,   // routing key
 		exchangeName, // exchange
@@ -110,7 +228,8 @@ func (mq *MessageQueue) BindQueue(queueName, exchangeName, routingKey string) er
 	return nil
 }
 
-// Publish sends a message to a queue
+// Publish sends a message to a queue and waits for the broker to confirm
+// it. ErrUnroutable is returned if the queue doesn't exist.
 func (mq *MessageQueue) Publish(queueName string, message Message) error {
 	message.Timestamp = time.Now()
 
@@ -119,11 +238,9 @@ func (mq *MessageQueue) Publish(queueName string, message Message) error {
 		return fmt.Errorf("failed to marshal message: %w", err)
 	}
 
-	err = mq.channel.Publish(
+	err = mq.publish(
 		"",        // exchange
 		queueName, // routing key (queue name for direct send)
-		false,     // mandatory
-		false,     // immediate
 		amqp.Publishing{
 			DeliveryMode: amqp.Persistent,
 			ContentType:  "application/json",
@@ -139,7 +256,9 @@ func (mq *MessageQueue) Publish(queueName string, message Message) error {
 	return nil
 }
 
-// PublishToExchange sends a message to an exchange with a routing key
+// PublishToExchange sends a message to an exchange with a routing key and
+// waits for the broker to confirm it. ErrUnroutable is returned if no
+// queue is bound for the routing key.
 func (mq *MessageQueue) PublishToExchange(exchangeName, routingKey string, message Message) error {
 	message.Timestamp = time.Now()
 
@@ -148,11 +267,9 @@ func (mq *MessageQueue) PublishToExchange(exchangeName, routingKey string, messa
 		return fmt.Errorf("failed to marshal message: %w", err)
 	}
 
-	err = mq.channel.Publish(
+	err = mq.publish(
 		exchangeName, // exchange
 		routingKey,   // routing key
-		false,        // mandatory
-		false,        // immediate
 		amqp.Publishing{
 			DeliveryMode: amqp.Persistent,
 			ContentType:  "application/json",
@@ -168,10 +285,25 @@ func (mq *MessageQueue) PublishToExchange(exchangeName, routingKey string, messa
 	return nil
 }
 
-// Consume starts consuming messages from a queue
+// Consume starts consuming messages from a queue. A message whose handler
+// fails is redelivered up to MaxRetries times and then moved to the
+// queue's dead-letter queue, which Consume declares.
 func (mq *MessageQueue) Consume(queueName string, handler func(Message) error) error {
+	if err := mq.DeclareQueue(DeadLetterQueueName(queueName)); err != nil {
+		return fmt.Errorf("failed to declare dead letter queue: %w", err)
+	}
+
+	return mq.apply(func(ch amqpChannel) error {
+		return mq.startConsumer(ch, queueName, nil, handler)
+	})
+}
+
+// startConsumer consumes queueName on ch until the channel closes. Failing
+// messages wait in retry queues for delays, or are redelivered immediately
+// if delays is nil.
+func (mq *MessageQueue) startConsumer(ch amqpChannel, queueName string, delays []time.Duration, handler func(Message) error) error {
 	// Set QoS to process one message at a time
-	err := mq.channel.Qos(
+	err := ch.Qos(
 		1,     // prefetch count
 		0,     // prefetch size
 		false, // global
@@ -180,7 +312,7 @@ func (mq *MessageQueue) Consume(queueName string, handler func(Message) error) e
 		return fmt.Errorf("failed to set QoS: %w", err)
 	}
 
-	msgs, err := mq.channel.Consume(
+	msgs, err := ch.Consume(
 		queueName, // queue
 		"",        // consumer
 		false,     // auto-ack (manual ack for reliability)
@@ -198,48 +330,185 @@ func (mq *MessageQueue) Consume(queueName string, handler func(Message) error) e
 	// Process messages
 	go func() {
 		for msg := range msgs {
-			var message Message
-			err := json.Unmarshal(msg.Body, &message)
-			if err != nil {
-				log.Printf("Failed to unmarshal message: %v", err)
-				msg.Nack(false, false) // Don't requeue malformed messages
-				continue
-			}
-
-			// Handle the message
-			err = handler(message)
-			if err != nil {
-				log.Printf("Failed to handle message: %v", err)
-
-				// Retry logic - requeue up to 3 times
-				if message.Retry < 3 {
-					message.Retry++
-					log.Printf("Requeuing message (retry %d/3)", message.Retry)
-					msg.Nack(false, true) // Requeue
-				} else {
-					log.Printf("Max retries reached, sending to dead letter queue")
-					msg.Nack(false, false) // Don't requeue
-					// In production, send to dead letter queue
-				}
-			} else {
-				msg.Ack(false) // Acknowledge successful processing
-			}
+			mq.handleDelivery(queueName, msg, delays, handler)
+		}
+	}()
+
+	return nil
+}
+
+// handleDelivery runs handler for one delivery and settles it
+func (mq *MessageQueue) handleDelivery(queueName string, msg amqp.Delivery, delays []time.Duration, handler func(Message) error) {
+	var message Message
+	if err := json.Unmarshal(msg.Body, &message); err != nil {
+		log.Printf("Failed to unmarshal message: %v", err)
+		// Keep the raw body so the message can still be inspected
+		message = Message{Type: "malformed", Payload: map[string]interface{}{"body": string(msg.Body)}}
+		mq.deadLetter(queueName, msg, message, fmt.Errorf("malformed message: %w", err))
+		return
+	}
+
+	err := handler(message)
+	if err == nil {
+		msg.Ack(false) // Acknowledge successful processing
+		return
+	}
+	log.Printf("Failed to handle message: %v", err)
+
+	maxRetries, target := MaxRetries, queueName
+	if delays != nil {
+		maxRetries = len(delays)
+	}
+
+	if message.Retry >= maxRetries {
+		log.Printf("Max retries reached, sending to dead letter queue")
+		mq.deadLetter(queueName, msg, message, err)
+		return
+	}
+
+	// Requeuing would redeliver the same body, so publish a copy that
+	// carries the retry count instead
+	if delays != nil {
+		target = RetryQueueName(queueName, delays[message.Retry])
+	}
+	message.Retry++
+	log.Printf("Requeuing message to %s (retry %d/%d)", target, message.Retry, maxRetries)
+	if err := mq.republish(target, message); err != nil {
+		log.Printf("Failed to requeue message: %v", err)
+		msg.Nack(false, true)
+		return
+	}
+	msg.Ack(false)
+}
+
+// republish sends a message back to a queue, keeping its timestamp
+func (mq *MessageQueue) republish(queueName string, message Message) error {
+	body, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+
+	return mq.publish("", queueName, amqp.Publishing{
+		DeliveryMode: amqp.Persistent,
+		ContentType:  "application/json",
+		Body:         body,
+		Timestamp:    message.Timestamp,
+	})
+}
+
+// deadLetter moves a delivery to its queue's dead-letter queue. If that
+// fails, the delivery is requeued rather than lost.
+func (mq *MessageQueue) deadLetter(queueName string, msg amqp.Delivery, message Message, cause error) {
+	body, err := json.Marshal(DeadLetter{
+		Message:  message,
+		Queue:    queueName,
+		Error:    cause.Error(),
+		FailedAt: time.Now(),
+	})
+	if err == nil {
+		err = mq.publish("", DeadLetterQueueName(queueName), amqp.Publishing{
+			DeliveryMode: amqp.Persistent,
+			ContentType:  "application/json",
+			Body:         body,
+			Timestamp:    time.Now(),
+		})
+	}
+	if err != nil {
+		log.Printf("Failed to dead-letter message %s: %v", message.ID, err)
+		msg.Nack(false, true)
+		return
+	}
+
+	msg.Nack(false, false)
+}
+
+// ConsumeDLQ consumes the dead-letter queue of queueName, e.g. to inspect
+// or replay failed messages. Dead letters whose handler fails are requeued
+// after a delay; malformed ones are dropped.
+func (mq *MessageQueue) ConsumeDLQ(queueName string, handler func(DeadLetter) error) error {
+	return mq.apply(func(ch amqpChannel) error {
+		return startDLQConsumer(ch, queueName, handler)
+	})
+}
+
+func startDLQConsumer(ch amqpChannel, queueName string, handler func(DeadLetter) error) error {
+	dlqName := DeadLetterQueueName(queueName)
+
+	msgs, err := ch.Consume(
+		dlqName, // queue
+		"",      // consumer
+		false,   // auto-ack
+		false,   // exclusive
+		false,   // no-local
+		false,   // no-wait
+		nil,     // args
+	)
+	if err != nil {
+		return fmt.Errorf("failed to register dead letter consumer: %w", err)
+	}
+
+	log.Printf("Started consuming from dead letter queue %s", dlqName)
+
+	go func() {
+		for msg := range msgs {
+			handleDeadLetter(msg, handler)
 		}
 	}()
 
 	return nil
 }
 
+// deadLetterRequeueDelay is how long a dead letter whose handler failed
+// waits before it is requeued, so a failing handler doesn't spin
+var deadLetterRequeueDelay = 5 * time.Second
+
+// handleDeadLetter runs handler for one dead letter and settles it
+func handleDeadLetter(msg amqp.Delivery, handler func(DeadLetter) error) {
+	var deadLetter DeadLetter
+	if err := json.Unmarshal(msg.Body, &deadLetter); err != nil {
+		// No handler can process it, so requeuing would redeliver it forever
+		log.Printf("Dropping malformed dead letter: %v", err)
+		msg.Nack(false, false)
+		return
+	}
+
+	if err := handler(deadLetter); err != nil {
+		log.Printf("Failed to handle dead letter, requeuing in %s: %v", deadLetterRequeueDelay, err)
+		time.Sleep(deadLetterRequeueDelay)
+		msg.Nack(false, true)
+		return
+	}
+	msg.Ack(false)
+}
+
+// Replay publishes a dead letter's message back to the queue it failed in
+// with its retry count reset
+func (mq *MessageQueue) Replay(deadLetter DeadLetter) error {
+	message := deadLetter.Message
+	message.Retry = 0
+
+	if err := mq.republish(deadLetter.Queue, message); err != nil {
+		return fmt.Errorf("failed to replay message: %w", err)
+	}
+	return nil
+}
+
 // Close closes the RabbitMQ connection
 func (mq *MessageQueue) Close() error {
-	if mq.channel != nil {
-		if err := mq.channel.Close(); err != nil {
+	mq.mu.Lock()
+	mq.closed = true
+	channel, conn := mq.channel, mq.conn
+	mq.channel, mq.confirms = nil, nil
+	mq.mu.Unlock()
+
+	if channel != nil {
+		if err := channel.Close(); err != nil {
 			return fmt.Errorf("failed to close channel: %w", err)
 		}
 	}
 
-	if mq.conn != nil {
-		if err := mq.conn.Close(); err != nil {
+	if conn != nil {
+		if err := conn.Close(); err != nil {
 			return fmt.Errorf("failed to close connection: %w", err)
 		}
 	}
@@ -250,7 +519,12 @@ func (mq *MessageQueue) Close() error {
 
 // GetQueueInfo returns information about a queue
 func (mq *MessageQueue) GetQueueInfo(queueName string) (int, int, error) {
-	queue, err := mq.channel.QueueInspect(queueName)
+	ch, err := mq.currentChannel()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	queue, err := ch.QueueInspect(queueName)
 	if err != nil {
 		return 0, 0, fmt.Errorf("failed to inspect queue: %w", err)
 	}
@@ -260,7 +534,12 @@ func (mq *MessageQueue) GetQueueInfo(queueName string) (int, int, error) {
 
 // PurgeQueue removes all messages from a queue
 func (mq *MessageQueue) PurgeQueue(queueName string) error {
-	_, err := mq.channel.QueuePurge(queueName, false)
+	ch, err := mq.currentChannel()
+	if err != nil {
+		return err
+	}
+
+	_, err = ch.QueuePurge(queueName, false)
 	if err != nil {
 		return fmt.Errorf("failed to purge queue: %w", err)
 	}
@@ -271,7 +550,12 @@ func (mq *MessageQueue) PurgeQueue(queueName string) error {
 
 // DeleteQueue deletes a queue
 func (mq *MessageQueue) DeleteQueue(queueName string) error {
-	_, err := mq.channel.QueueDelete(queueName, false, false, false)
+	ch, err := mq.currentChannel()
+	if err != nil {
+		return err
+	}
+
+	_, err = ch.QueueDelete(queueName, false, false, false)
 	if err != nil {
 		return fmt.Errorf("failed to delete queue: %w", err)
 	}
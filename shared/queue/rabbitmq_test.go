@@ -0,0 +1,438 @@
+package queue
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+type publishing struct {
+	exchange string
+	key      string
+	msg      amqp.Publishing
+}
+
+// fakeChannel is an in-memory amqpChannel. Publishing to a queue with a
+// consumer delivers the message to it, and publishing to a queue that
+// doesn't exist returns the message like the broker would. Messages in a
+// queue with a TTL are dead-lettered to its dead-letter routing key once
+// they expire.
+type fakeChannel struct {
+	mu        sync.Mutex
+	declared  map[string]bool
+	args      map[string]amqp.Table
+	bindings  map[string]bool // exchange + " " + routing key
+	consumers map[string]chan amqp.Delivery
+	published []publishing
+	nextTag   uint64
+	confirms  []chan amqp.Confirmation
+	returns   []chan amqp.Return
+	acks      *fakeAcknowledger
+	closed    bool
+}
+
+func newFakeChannel() *fakeChannel {
+	return &fakeChannel{
+		declared:  make(map[string]bool),
+		args:      make(map[string]amqp.Table),
+		bindings:  make(map[string]bool),
+		consumers: make(map[string]chan amqp.Delivery),
+		nextTag:   1,
+		acks:      &fakeAcknowledger{},
+	}
+}
+
+// newTestQueue returns a MessageQueue connected to channel
+func newTestQueue(t *testing.T, channel *fakeChannel) *MessageQueue {
+	t.Helper()
+
+	confirms, err := newConfirmer(channel, time.Second)
+	if err != nil {
+		t.Fatalf("newConfirmer() error = %v", err)
+	}
+
+	mq := newMessageQueue("amqp://test", nil)
+	mq.channel, mq.confirms = channel, confirms
+	return mq
+}
+
+func (f *fakeChannel) QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.declared[name] = true
+	f.args[name] = args
+	return amqp.Queue{Name: name}, nil
+}
+
+func (f *fakeChannel) QueueInspect(name string) (amqp.Queue, error) {
+	return amqp.Queue{Name: name}, nil
+}
+
+func (f *fakeChannel) QueueBind(name, key, exchange string, noWait bool, args amqp.Table) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.bindings[exchange+" "+key] = true
+	return nil
+}
+
+func (f *fakeChannel) QueuePurge(name string, noWait bool) (int, error) {
+	return 0, nil
+}
+
+func (f *fakeChannel) QueueDelete(name string, ifUnused, ifEmpty, noWait bool) (int, error) {
+	return 0, nil
+}
+
+func (f *fakeChannel) ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error {
+	return nil
+}
+
+func (f *fakeChannel) Qos(prefetchCount, prefetchSize int, global bool) error {
+	return nil
+}
+
+func (f *fakeChannel) Consume(queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args amqp.Table) (<-chan amqp.Delivery, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	deliveries := make(chan amqp.Delivery, 16)
+	f.consumers[queue] = deliveries
+	return deliveries, nil
+}
+
+func (f *fakeChannel) Publish(exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return amqp.ErrClosed
+	}
+
+	tag := f.nextTag
+	f.nextTag++
+	f.published = append(f.published, publishing{exchange: exchange, key: key, msg: msg})
+
+	deliveries, consumed := f.consumers[key]
+	routable := f.bindings[exchange+" "+key] || (exchange == "" && (f.declared[key] || consumed))
+
+	switch {
+	case !routable && mandatory:
+		for _, c := range f.returns {
+			c <- amqp.Return{
+				ReplyCode:  amqp.NoRoute,
+				ReplyText:  "NO_ROUTE",
+				Exchange:   exchange,
+				RoutingKey: key,
+				MessageId:  msg.MessageId,
+			}
+		}
+	case consumed && exchange == "":
+		deliveries <- amqp.Delivery{
+			Acknowledger: f.acks,
+			DeliveryTag:  tag,
+			Body:         msg.Body,
+		}
+	case exchange == "" && f.args[key]["x-message-ttl"] != nil:
+		ttl := time.Duration(f.args[key]["x-message-ttl"].(int64)) * time.Millisecond
+		target, _ := f.args[key]["x-dead-letter-routing-key"].(string)
+		time.AfterFunc(ttl, func() { f.expire(target, tag, msg.Body) })
+	}
+
+	for _, c := range f.confirms {
+		c <- amqp.Confirmation{DeliveryTag: tag, Ack: true}
+	}
+	return nil
+}
+
+func (f *fakeChannel) Confirm(noWait bool) error {
+	return nil
+}
+
+func (f *fakeChannel) GetNextPublishSeqNo() uint64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.nextTag
+}
+
+func (f *fakeChannel) NotifyPublish(c chan amqp.Confirmation) chan amqp.Confirmation {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.confirms = append(f.confirms, c)
+	return c
+}
+
+func (f *fakeChannel) NotifyReturn(c chan amqp.Return) chan amqp.Return {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.returns = append(f.returns, c)
+	return c
+}
+
+func (f *fakeChannel) NotifyClose(c chan *amqp.Error) chan *amqp.Error {
+	return c
+}
+
+func (f *fakeChannel) Close() error {
+	return nil
+}
+
+// expire dead-letters an expired message to the consumer of target
+func (f *fakeChannel) expire(target string, tag uint64, body []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if deliveries, ok := f.consumers[target]; ok {
+		deliveries <- amqp.Delivery{Acknowledger: f.acks, DeliveryTag: tag, Body: body}
+	}
+}
+
+// shutdown ends every consumer and notification, as a dropped connection
+// does
+func (f *fakeChannel) shutdown() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for queue, deliveries := range f.consumers {
+		close(deliveries)
+		delete(f.consumers, queue)
+	}
+	for _, c := range f.confirms {
+		close(c)
+	}
+	for _, c := range f.returns {
+		close(c)
+	}
+	f.confirms, f.returns = nil, nil
+	f.closed = true
+}
+
+// publishedTo returns the bodies published to a queue
+func (f *fakeChannel) publishedTo(queue string) [][]byte {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var bodies [][]byte
+	for _, p := range f.published {
+		if p.key == queue {
+			bodies = append(bodies, p.msg.Body)
+		}
+	}
+	return bodies
+}
+
+type fakeAcknowledger struct {
+	mu       sync.Mutex
+	acked    int
+	nacked   int
+	requeued int
+}
+
+func (f *fakeAcknowledger) Ack(tag uint64, multiple bool) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.acked++
+	return nil
+}
+
+func (f *fakeAcknowledger) Nack(tag uint64, multiple, requeue bool) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if requeue {
+		f.requeued++
+	} else {
+		f.nacked++
+	}
+	return nil
+}
+
+func (f *fakeAcknowledger) Reject(tag uint64, requeue bool) error {
+	return f.Nack(tag, false, requeue)
+}
+
+// waitFor polls cond until it holds or a second has passed
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met before the deadline")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestMessageQueue_DeadLettersFailingMessage(t *testing.T) {
+	channel := newFakeChannel()
+	mq := newTestQueue(t, channel)
+
+	var mu sync.Mutex
+	attempts := 0
+	err := mq.Consume("orders", func(msg Message) error {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts++
+		return errors.New("payment service unavailable")
+	})
+	if err != nil {
+		t.Fatalf("Consume() error = %v", err)
+	}
+	if !channel.declared["orders.dlq"] {
+		t.Error("Consume() didn't declare orders.dlq")
+	}
+
+	deadLetters := make(chan DeadLetter, 1)
+	if err := mq.ConsumeDLQ("orders", func(dl DeadLetter) error {
+		deadLetters <- dl
+		return nil
+	}); err != nil {
+		t.Fatalf("ConsumeDLQ() error = %v", err)
+	}
+
+	if err := mq.Publish("orders", Message{ID: "msg-1", Type: "order.created"}); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+
+	var deadLetter DeadLetter
+	select {
+	case deadLetter = <-deadLetters:
+	case <-time.After(time.Second):
+		t.Fatal("message never reached the dead letter queue")
+	}
+
+	if deadLetter.Message.ID != "msg-1" || deadLetter.Queue != "orders" ||
+		deadLetter.Error != "payment service unavailable" || deadLetter.Message.Retry != MaxRetries {
+		t.Errorf("dead letter = %+v, want msg-1 from orders after %d retries", deadLetter, MaxRetries)
+	}
+
+	mu.Lock()
+	if attempts != MaxRetries+1 {
+		t.Errorf("handler ran %d times, want %d", attempts, MaxRetries+1)
+	}
+	mu.Unlock()
+
+	// Each retry and the dead letter are acked; the last delivery is rejected
+	waitFor(t, func() bool {
+		channel.acks.mu.Lock()
+		defer channel.acks.mu.Unlock()
+		return channel.acks.acked == MaxRetries+1 && channel.acks.nacked == 1
+	})
+	if channel.acks.requeued != 0 {
+		t.Errorf("requeued %d deliveries, want 0", channel.acks.requeued)
+	}
+}
+
+func TestMessageQueue_Replay(t *testing.T) {
+	channel := newFakeChannel()
+	mq := newTestQueue(t, channel)
+
+	if err := mq.DeclareQueue("orders"); err != nil {
+		t.Fatalf("DeclareQueue() error = %v", err)
+	}
+
+	err := mq.Replay(DeadLetter{
+		Message: Message{ID: "msg-1", Retry: MaxRetries},
+		Queue:   "orders",
+		Error:   "payment service unavailable",
+	})
+	if err != nil {
+		t.Fatalf("Replay() error = %v", err)
+	}
+
+	bodies := channel.publishedTo("orders")
+	if len(bodies) != 1 {
+		t.Fatalf("published %d messages to orders, want 1", len(bodies))
+	}
+
+	var message Message
+	if err := json.Unmarshal(bodies[0], &message); err != nil {
+		t.Fatalf("failed to decode replayed message: %v", err)
+	}
+	if message.ID != "msg-1" || message.Retry != 0 {
+		t.Errorf("replayed message = %+v, want msg-1 with no retries", message)
+	}
+}
+
+func TestMessageQueue_PublishConfirms(t *testing.T) {
+	channel := newFakeChannel()
+	mq := newTestQueue(t, channel)
+
+	if err := mq.DeclareQueue("orders"); err != nil {
+		t.Fatalf("DeclareQueue() error = %v", err)
+	}
+	if err := mq.Publish("orders", Message{ID: "msg-1"}); err != nil {
+		t.Errorf("Publish() to a declared queue error = %v", err)
+	}
+
+	err := mq.Publish("ordrs", Message{ID: "msg-2"})
+	if !errors.Is(err, ErrUnroutable) {
+		t.Errorf("Publish() to a missing queue error = %v, want ErrUnroutable", err)
+	}
+
+	if err := mq.DeclareExchange("events", "topic"); err != nil {
+		t.Fatalf("DeclareExchange() error = %v", err)
+	}
+	if err := mq.BindQueue("orders", "events", "order.created"); err != nil {
+		t.Fatalf("BindQueue() error = %v", err)
+	}
+	if err := mq.PublishToExchange("events", "order.created", Message{ID: "msg-3"}); err != nil {
+		t.Errorf("PublishToExchange() with a binding error = %v", err)
+	}
+	if err := mq.PublishToExchange("events", "order.deleted", Message{ID: "msg-4"}); !errors.Is(err, ErrUnroutable) {
+		t.Errorf("PublishToExchange() without a binding error = %v, want ErrUnroutable", err)
+	}
+}
+
+func TestMessageQueue_ConsumeDLQ_Settles(t *testing.T) {
+	defer func(delay time.Duration) { deadLetterRequeueDelay = delay }(deadLetterRequeueDelay)
+	deadLetterRequeueDelay = 0
+
+	channel := newFakeChannel()
+	mq := newTestQueue(t, channel)
+
+	var mu sync.Mutex
+	handled := 0
+	if err := mq.ConsumeDLQ("orders", func(dl DeadLetter) error {
+		mu.Lock()
+		defer mu.Unlock()
+		handled++
+		if dl.Message.ID == "failing" {
+			return errors.New("replay target unavailable")
+		}
+		return nil
+	}); err != nil {
+		t.Fatalf("ConsumeDLQ() error = %v", err)
+	}
+
+	publish := func(body []byte) {
+		t.Helper()
+		if err := channel.Publish("", "orders.dlq", false, false, amqp.Publishing{Body: body}); err != nil {
+			t.Fatalf("Publish() error = %v", err)
+		}
+	}
+	encode := func(id string) []byte {
+		body, _ := json.Marshal(DeadLetter{Message: Message{ID: id}, Queue: "orders"})
+		return body
+	}
+
+	// A malformed dead letter is dropped without reaching the handler
+	publish([]byte("not json"))
+	publish(encode("ok"))
+	publish(encode("failing"))
+
+	waitFor(t, func() bool {
+		channel.acks.mu.Lock()
+		defer channel.acks.mu.Unlock()
+		return channel.acks.acked == 1 && channel.acks.nacked == 1 && channel.acks.requeued == 1
+	})
+
+	mu.Lock()
+	defer mu.Unlock()
+	if handled != 2 {
+		t.Errorf("handler ran %d times, want 2", handled)
+	}
+}
@@ -1,6 +1,7 @@
 package resilience
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"sync"
@@ -36,6 +37,12 @@ var (
 	ErrTooManyRequests = errors.New("too many requests")
 )
 
+// MetricsObserver is notified of every circuit breaker state change, e.g.
+// to export it to Prometheus. *monitoring.Metrics implements it.
+type MetricsObserver interface {
+	ObserveCircuitBreakerState(name string, from, to State)
+}
+
 // CircuitBreaker implements the circuit breaker pattern
 type CircuitBreaker struct {
 	name           string
@@ -44,9 +51,13 @@ type CircuitBreaker struct {
 	timeout        time.Duration // Time to wait before transitioning from open to half-open
 	threshold      uint32        // Minimum number of requests before checking error rate
 	failureRate    float64       // Maximum acceptable failure rate (0.0 to 1.0)
+	callTimeout    time.Duration // Deadline applied to each protected call, if non-zero
+	window         *slidingWindow // Set in sliding window mode
 	onStateChange  func(from, to State)
+	now            func() time.Time
 	mu             sync.Mutex
 	state          State
+	generation     uint64 // Incremented whenever counts are reset
 	counts         *counts
 	expiry         time.Time
 }
@@ -67,7 +78,15 @@ type Settings struct {
 	Timeout       time.Duration // Default: 60s
 	Threshold     uint32        // Default: 5
 	FailureRate   float64       // Default: 0.5 (50%)
+	CallTimeout   time.Duration // Default: none
+
+	// SlidingWindow computes the failure rate continuously over the
+	// trailing Interval instead of resetting counts every Interval
+	SlidingWindow bool
+	WindowBuckets int // Buckets the window is split into. Default: 10
+
 	OnStateChange func(name string, from State, to State)
+	Metrics       MetricsObserver
 }
 
 // NewCircuitBreaker creates a new circuit breaker
@@ -95,35 +114,98 @@ func NewCircuitBreaker(settings Settings) *CircuitBreaker {
 		timeout:     settings.Timeout,
 		threshold:   settings.Threshold,
 		failureRate: settings.FailureRate,
+		callTimeout: settings.CallTimeout,
+		now:         time.Now,
+	}
+
+	if settings.SlidingWindow {
+		if settings.WindowBuckets <= 0 {
+			settings.WindowBuckets = 10
+		}
+		cb.window = newSlidingWindow(settings.Interval, settings.WindowBuckets)
 	}
 
-	if settings.OnStateChange != nil {
+	if settings.OnStateChange != nil || settings.Metrics != nil {
 		cb.onStateChange = func(from, to State) {
-			settings.OnStateChange(settings.Name, from, to)
+			if settings.Metrics != nil {
+				settings.Metrics.ObserveCircuitBreakerState(settings.Name, from, to)
+			}
+			if settings.OnStateChange != nil {
+				settings.OnStateChange(settings.Name, from, to)
+			}
 		}
 	}
 
-	cb.toNewGeneration(time.Now())
+	cb.toNewGeneration(cb.now())
 	return cb
 }
 
 // Execute runs the given function if the circuit breaker is closed or half-open
 func (cb *CircuitBreaker) Execute(fn func() error) error {
+	return cb.ExecuteContext(context.Background(), func(context.Context) error {
+		return fn()
+	})
+}
+
+// ExecuteContext runs fn if the circuit breaker is closed or half-open and
+// returns as soon as ctx is done, even if fn hasn't returned. A call that
+// exceeds its deadline counts as a failure; one canceled by the caller
+// isn't counted at all.
+func (cb *CircuitBreaker) ExecuteContext(ctx context.Context, fn func(ctx context.Context) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	generation, err := cb.beforeRequest()
 	if err != nil {
 		return err
 	}
 
-	defer func() {
-		if r := recover(); r != nil {
+	if cb.callTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cb.callTimeout)
+		defer cancel()
+	}
+
+	type outcome struct {
+		err      error
+		panicked bool
+		value    interface{}
+	}
+
+	// Buffered so fn can finish after we've given up on it
+	done := make(chan outcome, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- outcome{panicked: true, value: r}
+			}
+		}()
+		done <- outcome{err: fn(ctx)}
+	}()
+
+	select {
+	case out := <-done:
+		if out.panicked {
 			cb.afterRequest(generation, false)
-			panic(r)
+			panic(out.value)
 		}
-	}()
+		cb.recordResult(ctx, generation, out.err)
+		return out.err
+	case <-ctx.Done():
+		err := ctx.Err()
+		cb.recordResult(ctx, generation, err)
+		return err
+	}
+}
 
-	err = fn()
+// recordResult counts the outcome of a call made in generation
+func (cb *CircuitBreaker) recordResult(ctx context.Context, generation uint64, err error) {
+	if errors.Is(err, context.Canceled) && errors.Is(ctx.Err(), context.Canceled) {
+		cb.releaseRequest(generation)
+		return
+	}
 	cb.afterRequest(generation, err == nil)
-	return err
 }
 
 // Call is a convenience wrapper for Execute
@@ -141,7 +223,7 @@ func (cb *CircuitBreaker) beforeRequest() (uint64, error) {
 	cb.mu.Lock()
 	defer cb.mu.Unlock()
 
-	now := time.Now()
+	now := cb.now()
 	state, generation := cb.currentState(now)
 
 	if state == StateOpen {
@@ -160,7 +242,7 @@ func (cb *CircuitBreaker) afterRequest(before uint64, success bool) {
 	cb.mu.Lock()
 	defer cb.mu.Unlock()
 
-	now := time.Now()
+	now := cb.now()
 	state, generation := cb.currentState(now)
 
 	if generation != before {
@@ -174,11 +256,27 @@ func (cb *CircuitBreaker) afterRequest(before uint64, success bool) {
 	}
 }
 
+// releaseRequest forgets a request that ended without an outcome, freeing
+// its half-open slot
+func (cb *CircuitBreaker) releaseRequest(before uint64) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	_, generation := cb.currentState(cb.now())
+	if generation == before && cb.counts.requests > 0 {
+		cb.counts.requests--
+	}
+}
+
 func (cb *CircuitBreaker) onSuccess(state State, now time.Time) {
 	cb.counts.totalSuccesses++
 	cb.counts.consecutiveSuccesses++
 	cb.counts.consecutiveFailures = 0
 
+	if state == StateClosed && cb.window != nil {
+		cb.window.record(now, true)
+	}
+
 	if state == StateHalfOpen {
 		// If we get enough consecutive successes in half-open, close the circuit
 		if cb.counts.consecutiveSuccesses >= cb.maxRequests {
@@ -194,8 +292,12 @@ func (cb *CircuitBreaker) onFailure(state State, now time.Time) {
 
 	switch state {
 	case StateClosed:
+		if cb.window != nil {
+			cb.window.record(now, false)
+		}
+
 		// Check if we should open the circuit
-		if cb.shouldOpen() {
+		if cb.shouldOpen(now) {
 			cb.setState(StateOpen, now)
 		}
 	case StateHalfOpen:
@@ -204,16 +306,20 @@ func (cb *CircuitBreaker) onFailure(state State, now time.Time) {
 	}
 }
 
-func (cb *CircuitBreaker) shouldOpen() bool {
-	counts := cb.counts
+func (cb *CircuitBreaker) shouldOpen(now time.Time) bool {
+	requests, failures := cb.counts.requests, cb.counts.totalFailures
+	if cb.window != nil {
+		successes, windowFailures := cb.window.totals(now)
+		requests, failures = successes+windowFailures, windowFailures
+	}
 
 	// Need minimum number of requests before opening
-	if counts.requests < cb.threshold {
+	if requests < cb.threshold {
 		return false
 	}
 
 	// Calculate failure rate
-	rate := float64(counts.totalFailures) / float64(counts.requests)
+	rate := float64(failures) / float64(requests)
 	return rate >= cb.failureRate
 }
 
@@ -229,7 +335,7 @@ func (cb *CircuitBreaker) currentState(now time.Time) (State, uint64) {
 		}
 	}
 
-	return cb.state, uint64(cb.counts.requests)
+	return cb.state, cb.generation
 }
 
 func (cb *CircuitBreaker) setState(state State, now time.Time) {
@@ -248,12 +354,17 @@ func (cb *CircuitBreaker) setState(state State, now time.Time) {
 }
 
 func (cb *CircuitBreaker) toNewGeneration(now time.Time) {
+	cb.generation++
 	cb.counts = &counts{}
+	if cb.window != nil {
+		cb.window.reset()
+	}
 
 	var zero time.Time
 	switch cb.state {
 	case StateClosed:
-		if cb.interval == 0 {
+		// The sliding window ages out outcomes on its own
+		if cb.interval == 0 || cb.window != nil {
 			cb.expiry = zero
 		} else {
 			cb.expiry = now.Add(cb.interval)
@@ -270,7 +381,7 @@ func (cb *CircuitBreaker) State() State {
 	cb.mu.Lock()
 	defer cb.mu.Unlock()
 
-	now := time.Now()
+	now := cb.now()
 	state, _ := cb.currentState(now)
 	return state
 }
@@ -293,7 +404,7 @@ func (cb *CircuitBreaker) Reset() {
 	cb.mu.Lock()
 	defer cb.mu.Unlock()
 
-	cb.toNewGeneration(time.Now())
+	cb.toNewGeneration(cb.now())
 	cb.state = StateClosed
 }
 
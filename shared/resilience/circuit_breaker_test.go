@@ -0,0 +1,184 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+var errBackend = errors.New("backend failed")
+
+func TestCircuitBreaker_IgnoresStaleGeneration(t *testing.T) {
+	cb := NewCircuitBreaker(Settings{
+		Name:      "test",
+		Threshold: 2,
+		Timeout:   20 * time.Millisecond,
+	})
+
+	// Start a request while the circuit is closed and hold it in flight
+	release := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- cb.Execute(func() error {
+			<-release
+			return nil
+		})
+	}()
+	waitFor(t, func() bool {
+		requests, _, _ := cb.Counts()
+		return requests == 1
+	})
+
+	for i := 0; i < 2; i++ {
+		cb.Execute(func() error { return errBackend })
+	}
+	if state := cb.State(); state != StateOpen {
+		t.Fatalf("state = %s, want open", state)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if state := cb.State(); state != StateHalfOpen {
+		t.Fatalf("state = %s, want half-open", state)
+	}
+
+	// The stale success must not count towards closing the circuit
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatalf("in-flight Execute() error = %v", err)
+	}
+	if state := cb.State(); state != StateHalfOpen {
+		t.Errorf("state after stale success = %s, want half-open", state)
+	}
+	if requests, successes, _ := cb.Counts(); requests != 0 || successes != 0 {
+		t.Errorf("half-open counts = %d requests, %d successes, want 0 and 0", requests, successes)
+	}
+
+	// A probe from the current generation still closes it
+	if err := cb.Execute(func() error { return nil }); err != nil {
+		t.Fatalf("probe Execute() error = %v", err)
+	}
+	if state := cb.State(); state != StateClosed {
+		t.Errorf("state after probe = %s, want closed", state)
+	}
+}
+
+// waitFor polls cond until it holds or a second has passed
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met before the deadline")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestCircuitBreaker_ExecuteContextDeadline(t *testing.T) {
+	cb := NewCircuitBreaker(Settings{Name: "test"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	hang := make(chan struct{})
+	defer close(hang)
+
+	start := time.Now()
+	err := cb.ExecuteContext(ctx, func(context.Context) error {
+		<-hang // Ignores its context
+		return nil
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("ExecuteContext() error = %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("ExecuteContext() returned after %v, want it to stop at the deadline", elapsed)
+	}
+
+	if requests, _, failures := cb.Counts(); requests != 1 || failures != 1 {
+		t.Errorf("counts = %d requests, %d failures, want 1 and 1", requests, failures)
+	}
+}
+
+func TestCircuitBreaker_CallTimeoutAndCancel(t *testing.T) {
+	cb := NewCircuitBreaker(Settings{Name: "test", CallTimeout: 10 * time.Millisecond})
+
+	err := cb.Execute(func() error {
+		time.Sleep(time.Second)
+		return nil
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Execute() error = %v, want context.DeadlineExceeded", err)
+	}
+
+	// Canceling the caller's context isn't held against the backend
+	ctx, cancel := context.WithCancel(context.Background())
+	err = cb.ExecuteContext(ctx, func(ctx context.Context) error {
+		cancel()
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("ExecuteContext() error = %v, want context.Canceled", err)
+	}
+
+	if requests, _, failures := cb.Counts(); requests != 1 || failures != 1 {
+		t.Errorf("counts = %d requests, %d failures, want 1 and 1", requests, failures)
+	}
+}
+
+func TestCircuitBreaker_SlidingWindow(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	now := start
+
+	newBreaker := func(sliding bool) *CircuitBreaker {
+		cb := NewCircuitBreaker(Settings{
+			Name:          "test",
+			Interval:      10 * time.Second,
+			Threshold:     4,
+			SlidingWindow: sliding,
+		})
+		cb.now = func() time.Time { return now }
+		cb.Reset()
+		return cb
+	}
+	generational, sliding := newBreaker(false), newBreaker(true)
+
+	fail := func() {
+		for _, cb := range []*CircuitBreaker{generational, sliding} {
+			cb.Execute(func() error { return errBackend })
+		}
+	}
+
+	// Two failures on each side of the generation boundary at 10s
+	now = start.Add(7 * time.Second)
+	fail()
+	fail()
+	now = start.Add(12 * time.Second)
+	fail()
+	if state := sliding.State(); state != StateClosed {
+		t.Fatalf("sliding state after 3 failures = %s, want closed", state)
+	}
+	fail()
+
+	if state := generational.State(); state != StateClosed {
+		t.Errorf("generational state = %s, want closed", state)
+	}
+	if state := sliding.State(); state != StateOpen {
+		t.Errorf("sliding state = %s, want open", state)
+	}
+
+	// Outcomes older than the interval no longer count
+	sliding.Reset()
+	now = start.Add(30 * time.Second)
+	for i := 0; i < 3; i++ {
+		sliding.Execute(func() error { return errBackend })
+	}
+	now = start.Add(41 * time.Second)
+	sliding.Execute(func() error { return errBackend })
+	if state := sliding.State(); state != StateClosed {
+		t.Errorf("sliding state after the failures aged out = %s, want closed", state)
+	}
+}
@@ -35,6 +35,11 @@ func Retry(ctx context.Context, policy RetryPolicy, fn func() error) error {
 	var lastErr error
 
 	for attempt := 1; attempt <= policy.MaxAttempts; attempt++ {
+		// Don't start another attempt once the caller has given up
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("retry cancelled: %w", err)
+		}
+
 		// Execute the function
 		err := fn()
 		if err == nil {
@@ -74,6 +79,11 @@ func RetryWithResult[T any](ctx context.Context, policy RetryPolicy, fn func() (
 	var lastErr error
 
 	for attempt := 1; attempt <= policy.MaxAttempts; attempt++ {
+		// Don't start another attempt once the caller has given up
+		if err := ctx.Err(); err != nil {
+			return result, fmt.Errorf("retry cancelled: %w", err)
+		}
+
 		// Execute the function
 		res, err := fn()
 		if err == nil {
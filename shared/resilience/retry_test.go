@@ -0,0 +1,142 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRetry_Attempts(t *testing.T) {
+	errPermanent := errors.New("permanent")
+	errTransient := errors.New("transient")
+
+	tests := []struct {
+		name         string
+		retryable    []error
+		failures     int
+		err          error
+		wantAttempts int
+		wantErr      bool
+	}{
+		{name: "succeeds first time", wantAttempts: 1},
+		{name: "succeeds after failures", failures: 2, err: errTransient, wantAttempts: 3},
+		{name: "gives up after max attempts", failures: 10, err: errTransient, wantAttempts: 3, wantErr: true},
+		{
+			name:         "stops on non-retryable error",
+			retryable:    []error{errTransient},
+			failures:     10,
+			err:          errPermanent,
+			wantAttempts: 1,
+			wantErr:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := RetryPolicy{
+				MaxAttempts:     3,
+				InitialDelay:    time.Millisecond,
+				MaxDelay:        time.Millisecond,
+				Multiplier:      2,
+				RetryableErrors: tt.retryable,
+			}
+
+			attempts := 0
+			err := Retry(context.Background(), policy, func() error {
+				attempts++
+				if attempts <= tt.failures {
+					return tt.err
+				}
+				return nil
+			})
+
+			if attempts != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", attempts, tt.wantAttempts)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Retry() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, tt.err) {
+				t.Errorf("Retry() error = %v, want it to wrap %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestCalculateDelay(t *testing.T) {
+	policy := RetryPolicy{
+		InitialDelay: 100 * time.Millisecond,
+		MaxDelay:     time.Second,
+		Multiplier:   2,
+	}
+
+	want := []time.Duration{
+		100 * time.Millisecond,
+		200 * time.Millisecond,
+		400 * time.Millisecond,
+		800 * time.Millisecond,
+		time.Second,
+		time.Second,
+	}
+	for i, delay := range want {
+		if got := calculateDelay(i+1, policy); got != delay {
+			t.Errorf("calculateDelay(%d) = %v, want %v", i+1, got, delay)
+		}
+	}
+
+	// Jitter stays within 5% either way
+	policy.Jitter = true
+	for i := 0; i < 100; i++ {
+		got := calculateDelay(2, policy)
+		if got < 190*time.Millisecond || got > 210*time.Millisecond {
+			t.Fatalf("calculateDelay(2) with jitter = %v, want 190ms to 210ms", got)
+		}
+	}
+}
+
+func TestRetry_ContextCancel(t *testing.T) {
+	policy := RetryPolicy{
+		MaxAttempts:  5,
+		InitialDelay: time.Hour,
+		MaxDelay:     time.Hour,
+		Multiplier:   2,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	attempts := 0
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	err := Retry(ctx, policy, func() error {
+		attempts++
+		return errors.New("unavailable")
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Retry() error = %v, want context.Canceled", err)
+	}
+	if attempts != 1 {
+		t.Errorf("attempts = %d, want 1", attempts)
+	}
+
+	// An already canceled context doesn't call fn at all
+	attempts = 0
+	if _, err := RetryWithResult(ctx, policy, func() (int, error) {
+		attempts++
+		return 0, nil
+	}); !errors.Is(err, context.Canceled) || attempts != 0 {
+		t.Errorf("RetryWithResult() error = %v after %d attempts, want context.Canceled after 0", err, attempts)
+	}
+}
+
+func TestIsRetryableHTTPStatus(t *testing.T) {
+	for _, code := range []int{429, 502, 503, 504} {
+		if !IsRetryableHTTPStatus(code) {
+			t.Errorf("IsRetryableHTTPStatus(%d) = false, want true", code)
+		}
+	}
+	for _, code := range []int{200, 400, 404, 501} {
+		if IsRetryableHTTPStatus(code) {
+			t.Errorf("IsRetryableHTTPStatus(%d) = true, want false", code)
+		}
+	}
+}
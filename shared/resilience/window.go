@@ -0,0 +1,71 @@
+package resilience
+
+import "time"
+
+// slidingWindow counts call outcomes over a trailing time window, split
+// into buckets so old outcomes age out continuously rather than all at once
+type slidingWindow struct {
+	bucketSize time.Duration
+	buckets    []windowBucket
+}
+
+type windowBucket struct {
+	start     time.Time
+	successes uint32
+	failures  uint32
+}
+
+// newSlidingWindow creates a window of the given length split into n buckets
+func newSlidingWindow(length time.Duration, n int) *slidingWindow {
+	if n < 1 {
+		n = 1
+	}
+	bucketSize := length / time.Duration(n)
+	if bucketSize <= 0 {
+		bucketSize = 1
+	}
+
+	return &slidingWindow{
+		bucketSize: bucketSize,
+		buckets:    make([]windowBucket, n),
+	}
+}
+
+// record counts an outcome at now
+func (w *slidingWindow) record(now time.Time, success bool) {
+	start := now.Truncate(w.bucketSize)
+	b := &w.buckets[int(start.UnixNano()/int64(w.bucketSize))%len(w.buckets)]
+
+	// The slot last held an older bucket
+	if !b.start.Equal(start) {
+		*b = windowBucket{start: start}
+	}
+
+	if success {
+		b.successes++
+	} else {
+		b.failures++
+	}
+}
+
+// totals sums the outcomes of the buckets still inside the window at now
+func (w *slidingWindow) totals(now time.Time) (successes, failures uint32) {
+	oldest := now.Truncate(w.bucketSize).Add(-time.Duration(len(w.buckets)-1) * w.bucketSize)
+
+	for _, b := range w.buckets {
+		if b.start.IsZero() || b.start.Before(oldest) || b.start.After(now) {
+			continue
+		}
+		successes += b.successes
+		failures += b.failures
+	}
+
+	return successes, failures
+}
+
+// reset clears every bucket
+func (w *slidingWindow) reset() {
+	for i := range w.buckets {
+		w.buckets[i] = windowBucket{}
+	}
+}
@@ -1,11 +1,20 @@
 package search
 
 import (
+	"errors"
 	"fmt"
+	"reflect"
 	"strings"
 	"time"
+
+	"github.com/dayanch951/marimo/shared/pagination"
 )
 
+// ErrInvalidField is returned for field names that aren't allowed: those
+// outside a QueryBuilder's allow-list, or that aren't plain, optionally
+// table-qualified, column names
+var ErrInvalidField = errors.New("invalid field name")
+
 // FilterOperator represents comparison operators
 type FilterOperator string
 
@@ -38,29 +47,92 @@ type FilterGroup struct {
 	Logic   string        `json:"logic"` // "AND" or "OR"
 }
 
-// SearchRequest represents a search request with filters
+// DefaultTextSearchConfig is the PostgreSQL text search configuration used
+// when a full-text SearchRequest doesn't name one
+const DefaultTextSearchConfig = "english"
+
+// OrderBy represents sorting by one field
+type OrderBy struct {
+	Field string `json:"field"`
+	Desc  bool   `json:"desc"`
+}
+
+// SearchRequest represents a search request with filters. Results are
+// paginated if Page or PageSize is set, using the pagination package's
+// defaults and limits.
+//
+// Query matches fields containing it with ILIKE unless FullText is set, in
+// which case PostgreSQL full-text search is used (see BuildTSQuery).
 type SearchRequest struct {
-	Query       string      `json:"query"`        // Full-text search query
-	Filters     FilterGroup `json:"filters"`      // Advanced filters
-	SearchFields []string   `json:"search_fields"` // Fields to search in
+	Query            string      `json:"query"`         // Full-text search query
+	Filters          FilterGroup `json:"filters"`       // Advanced filters
+	SearchFields     []string    `json:"search_fields"` // Fields to search in
+	FullText         bool        `json:"full_text"`
+	TextSearchConfig string      `json:"text_search_config"` // DefaultTextSearchConfig if empty
+	Sort             []OrderBy   `json:"sort"`
+	Page             int         `json:"page"` // 1-based
+	PageSize         int         `json:"page_size"`
 }
 
-// QueryBuilder builds SQL queries from filters
+// QueryBuilder builds SQL queries from filters. Field names are written
+// into the SQL as they are, so they are checked before use.
 type QueryBuilder struct {
-	params []interface{}
+	params    []interface{}
+	allowed   map[string]bool // nil allows any column name
+	unchecked bool            // Fields were validated by the caller
 }
 
-// NewQueryBuilder creates a new query builder
-func NewQueryBuilder() *QueryBuilder {
-	return &QueryBuilder{
+// NewQueryBuilder creates a new query builder that only accepts the given
+// fields, e.g. the columns of the table being searched. Without any, every
+// plain column name is accepted.
+func NewQueryBuilder(allowedFields ...string) *QueryBuilder {
+	qb := &QueryBuilder{
 		params: make([]interface{}, 0),
 	}
+
+	if len(allowedFields) > 0 {
+		qb.allowed = make(map[string]bool, len(allowedFields))
+		for _, field := range allowedFields {
+			qb.allowed[field] = true
+		}
+	}
+
+	return qb
 }
 
-// BuildWhereClause builds WHERE clause from filter group
-func (qb *QueryBuilder) BuildWhereClause(group FilterGroup) string {
+// NewQueryBuilderWithParams creates a query builder for a query that
+// already has params, so new placeholders are numbered after them. Fields
+// may be SQL expressions and are not checked, so callers must validate
+// them.
+func NewQueryBuilderWithParams(params []interface{}) *QueryBuilder {
+	return &QueryBuilder{
+		params:    append([]interface{}(nil), params...),
+		unchecked: true,
+	}
+}
+
+// checkField returns ErrInvalidField unless field may be used in the query
+func (qb *QueryBuilder) checkField(field string) error {
+	switch {
+	case qb.unchecked:
+		return nil
+	case qb.allowed != nil:
+		if !qb.allowed[field] {
+			return fmt.Errorf("%w: %q is not an allowed field", ErrInvalidField, field)
+		}
+		return nil
+	case !isIdentifier(field):
+		return fmt.Errorf("%w: %q", ErrInvalidField, field)
+	default:
+		return nil
+	}
+}
+
+// BuildWhereClause builds WHERE clause from filter group. ErrInvalidField
+// is returned if a filter's field isn't allowed.
+func (qb *QueryBuilder) BuildWhereClause(group FilterGroup) (string, error) {
 	if len(group.Filters) == 0 && len(group.Groups) == 0 {
-		return ""
+		return "", nil
 	}
 
 	logic := " AND "
@@ -72,7 +144,10 @@ func (qb *QueryBuilder) BuildWhereClause(group FilterGroup) string {
 
 	// Process filters
 	for _, filter := range group.Filters {
-		condition := qb.buildCondition(filter)
+		condition, err := qb.buildCondition(filter)
+		if err != nil {
+			return "", err
+		}
 		if condition != "" {
 			conditions = append(conditions, condition)
 		}
@@ -80,21 +155,33 @@ func (qb *QueryBuilder) BuildWhereClause(group FilterGroup) string {
 
 	// Process sub-groups
 	for _, subGroup := range group.Groups {
-		clause := qb.BuildWhereClause(subGroup)
+		clause, err := qb.BuildWhereClause(subGroup)
+		if err != nil {
+			return "", err
+		}
 		if clause != "" {
 			conditions = append(conditions, fmt.Sprintf("(%s)", clause))
 		}
 	}
 
 	if len(conditions) == 0 {
-		return ""
+		return "", nil
+	}
+
+	return strings.Join(conditions, logic), nil
+}
+
+// buildCondition builds a single filter condition. Filters with an unknown
+// operator or unusable value are skipped by returning "".
+func (qb *QueryBuilder) buildCondition(filter Filter) (string, error) {
+	if err := qb.checkField(filter.Field); err != nil {
+		return "", err
 	}
 
-	return strings.Join(conditions, logic)
+	return qb.buildCheckedCondition(filter), nil
 }
 
-// buildCondition builds a single filter condition
-func (qb *QueryBuilder) buildCondition(filter Filter) string {
+func (qb *QueryBuilder) buildCheckedCondition(filter Filter) string {
 	switch filter.Operator {
 	case OpEqual:
 		qb.params = append(qb.params, filter.Value)
@@ -125,31 +212,23 @@ func (qb *QueryBuilder) buildCondition(filter Filter) string {
 		return fmt.Sprintf("%s ILIKE $%d", filter.Field, len(qb.params))
 
 	case OpIn:
-		// Assuming filter.Value is a slice
-		if values, ok := filter.Value.([]interface{}); ok && len(values) > 0 {
-			placeholders := make([]string, len(values))
-			for i, v := range values {
-				qb.params = append(qb.params, v)
-				placeholders[i] = fmt.Sprintf("$%d", len(qb.params))
-			}
-			return fmt.Sprintf("%s IN (%s)", filter.Field, strings.Join(placeholders, ", "))
+		values := filterValues(filter.Value)
+		if len(values) == 0 {
+			// Nothing is in an empty list
+			return "FALSE"
 		}
-		return ""
+		return fmt.Sprintf("%s IN (%s)", filter.Field, qb.placeholders(values))
 
 	case OpNotIn:
-		if values, ok := filter.Value.([]interface{}); ok && len(values) > 0 {
-			placeholders := make([]string, len(values))
-			for i, v := range values {
-				qb.params = append(qb.params, v)
-				placeholders[i] = fmt.Sprintf("$%d", len(qb.params))
-			}
-			return fmt.Sprintf("%s NOT IN (%s)", filter.Field, strings.Join(placeholders, ", "))
+		values := filterValues(filter.Value)
+		if len(values) == 0 {
+			return "TRUE"
 		}
-		return ""
+		return fmt.Sprintf("%s NOT IN (%s)", filter.Field, qb.placeholders(values))
 
 	case OpBetween:
-		// Assuming filter.Value is [start, end]
-		if values, ok := filter.Value.([]interface{}); ok && len(values) == 2 {
+		// filter.Value is [start, end]
+		if values := filterValues(filter.Value); len(values) == 2 {
 			qb.params = append(qb.params, values[0], values[1])
 			return fmt.Sprintf("%s BETWEEN $%d AND $%d", filter.Field, len(qb.params)-1, len(qb.params))
 		}
@@ -166,10 +245,51 @@ func (qb *QueryBuilder) buildCondition(filter Filter) string {
 	}
 }
 
-// BuildFullTextSearch builds full-text search clause
-func (qb *QueryBuilder) BuildFullTextSearch(query string, fields []string) string {
+// placeholders adds values as params and returns their placeholders,
+// e.g. "$3, $4"
+func (qb *QueryBuilder) placeholders(values []interface{}) string {
+	placeholders := make([]string, len(values))
+	for i, v := range values {
+		qb.params = append(qb.params, v)
+		placeholders[i] = fmt.Sprintf("$%d", len(qb.params))
+	}
+	return strings.Join(placeholders, ", ")
+}
+
+// filterValues returns the elements of a slice or array of any type, e.g.
+// a []string decoded from a request, or a single value as the only
+// element. Byte slices are single values, and nil has no elements.
+func filterValues(value interface{}) []interface{} {
+	if value == nil {
+		return nil
+	}
+	if values, ok := value.([]interface{}); ok {
+		return values
+	}
+
+	v := reflect.ValueOf(value)
+	if (v.Kind() != reflect.Slice && v.Kind() != reflect.Array) || v.Type().Elem().Kind() == reflect.Uint8 {
+		return []interface{}{value}
+	}
+
+	values := make([]interface{}, v.Len())
+	for i := range values {
+		values[i] = v.Index(i).Interface()
+	}
+	return values
+}
+
+// BuildFullTextSearch builds full-text search clause. ErrInvalidField is
+// returned if a field isn't allowed.
+func (qb *QueryBuilder) BuildFullTextSearch(query string, fields []string) (string, error) {
 	if query == "" || len(fields) == 0 {
-		return ""
+		return "", nil
+	}
+
+	for _, field := range fields {
+		if err := qb.checkField(field); err != nil {
+			return "", err
+		}
 	}
 
 	var conditions []string
@@ -180,7 +300,41 @@ func (qb *QueryBuilder) BuildFullTextSearch(query string, fields []string) strin
 		conditions = append(conditions, fmt.Sprintf("%s ILIKE $%d", field, len(qb.params)))
 	}
 
-	return strings.Join(conditions, " OR ")
+	return strings.Join(conditions, " OR "), nil
+}
+
+// BuildTSQuery builds a PostgreSQL full-text search clause matching query
+// against fields, e.g.
+//
+//	to_tsvector('english', coalesce(title, '') || ' ' || coalesce(body, '')) @@ plainto_tsquery('english', $1)
+//
+// config names the text search configuration, such as "english" or
+// "simple". It is written into the SQL rather than passed as a parameter
+// so that an expression index built with the same to_tsvector call can be
+// used. ErrInvalidField is returned if a field isn't allowed.
+func (qb *QueryBuilder) BuildTSQuery(query, config string, fields []string) (string, error) {
+	if query == "" || len(fields) == 0 {
+		return "", nil
+	}
+
+	if config == "" {
+		config = DefaultTextSearchConfig
+	}
+	if !isIdentifier(config) {
+		return "", fmt.Errorf("invalid text search config %q", config)
+	}
+
+	documents := make([]string, len(fields))
+	for i, field := range fields {
+		if err := qb.checkField(field); err != nil {
+			return "", err
+		}
+		documents[i] = fmt.Sprintf("coalesce(%s, '')", field)
+	}
+
+	qb.params = append(qb.params, query)
+	return fmt.Sprintf("to_tsvector('%s', %s) @@ plainto_tsquery('%s', $%d)",
+		config, strings.Join(documents, " || ' ' || "), config, len(qb.params)), nil
 }
 
 // GetParams returns query parameters
@@ -224,20 +378,34 @@ func InFilter(field string, values []interface{}) Filter {
 	}
 }
 
-// BuildCompleteQuery builds a complete SQL query with search and filters
-func BuildCompleteQuery(baseQuery string, searchReq SearchRequest, qb *QueryBuilder) string {
+// BuildCompleteQuery builds a complete SQL query with search, filters,
+// sorting and pagination. ErrInvalidField is returned if a search, filter
+// or sort field isn't allowed by qb.
+func BuildCompleteQuery(baseQuery string, searchReq SearchRequest, qb *QueryBuilder) (string, error) {
 	var whereClauses []string
 
 	// Add full-text search
 	if searchReq.Query != "" && len(searchReq.SearchFields) > 0 {
-		searchClause := qb.BuildFullTextSearch(searchReq.Query, searchReq.SearchFields)
+		var searchClause string
+		var err error
+		if searchReq.FullText {
+			searchClause, err = qb.BuildTSQuery(searchReq.Query, searchReq.TextSearchConfig, searchReq.SearchFields)
+		} else {
+			searchClause, err = qb.BuildFullTextSearch(searchReq.Query, searchReq.SearchFields)
+		}
+		if err != nil {
+			return "", err
+		}
 		if searchClause != "" {
 			whereClauses = append(whereClauses, fmt.Sprintf("(%s)", searchClause))
 		}
 	}
 
 	// Add filters
-	filterClause := qb.BuildWhereClause(searchReq.Filters)
+	filterClause, err := qb.BuildWhereClause(searchReq.Filters)
+	if err != nil {
+		return "", err
+	}
 	if filterClause != "" {
 		whereClauses = append(whereClauses, fmt.Sprintf("(%s)", filterClause))
 	}
@@ -248,5 +416,63 @@ func BuildCompleteQuery(baseQuery string, searchReq SearchRequest, qb *QueryBuil
 		query += " WHERE " + strings.Join(whereClauses, " AND ")
 	}
 
-	return query
+	if len(searchReq.Sort) > 0 {
+		orderBy, err := qb.buildOrderBy(searchReq.Sort)
+		if err != nil {
+			return "", err
+		}
+		query += " " + orderBy
+	}
+
+	if searchReq.Page > 0 || searchReq.PageSize > 0 {
+		page := pagination.NewPageRequest(searchReq.Page, searchReq.PageSize, "", "")
+		query += " " + page.GetLimitOffset()
+	}
+
+	return query, nil
+}
+
+// buildOrderBy builds an ORDER BY clause, sorting by each field in turn.
+// Sort fields are always checked, since a sort direction or expression
+// could be smuggled into them.
+func (qb *QueryBuilder) buildOrderBy(sort []OrderBy) (string, error) {
+	parts := make([]string, len(sort))
+	for i, ob := range sort {
+		if !isIdentifier(ob.Field) {
+			return "", fmt.Errorf("%w: sort by %q", ErrInvalidField, ob.Field)
+		}
+		if err := qb.checkField(ob.Field); err != nil {
+			return "", fmt.Errorf("sort: %w", err)
+		}
+
+		direction := "ASC"
+		if ob.Desc {
+			direction = "DESC"
+		}
+		parts[i] = ob.Field + " " + direction
+	}
+
+	return "ORDER BY " + strings.Join(parts, ", "), nil
+}
+
+// isIdentifier reports whether name is a column name, optionally qualified
+// by a table name such as "users.created_at"
+func isIdentifier(name string) bool {
+	parts := strings.Split(name, ".")
+	if len(parts) > 2 {
+		return false
+	}
+
+	for _, part := range parts {
+		if part == "" || (part[0] >= '0' && part[0] <= '9') {
+			return false
+		}
+		for i := 0; i < len(part); i++ {
+			c := part[i]
+			if c != '_' && !(c >= '0' && c <= '9') && !(c >= 'a' && c <= 'z') && !(c >= 'A' && c <= 'Z') {
+				return false
+			}
+		}
+	}
+	return true
 }
@@ -0,0 +1,213 @@
+package search
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestQueryBuilder_ListOperators(t *testing.T) {
+	tests := []struct {
+		name       string
+		filter     Filter
+		wantClause string
+		wantParams []interface{}
+	}{
+		{
+			name:       "in strings",
+			filter:     Filter{Field: "status", Operator: OpIn, Value: []string{"active", "pending"}},
+			wantClause: "status IN ($1, $2)",
+			wantParams: []interface{}{"active", "pending"},
+		},
+		{
+			name:       "in ints",
+			filter:     Filter{Field: "id", Operator: OpIn, Value: []int{1, 2, 3}},
+			wantClause: "id IN ($1, $2, $3)",
+			wantParams: []interface{}{1, 2, 3},
+		},
+		{
+			name:       "in single value",
+			filter:     Filter{Field: "status", Operator: OpIn, Value: "active"},
+			wantClause: "status IN ($1)",
+			wantParams: []interface{}{"active"},
+		},
+		{
+			name:       "in empty slice matches nothing",
+			filter:     Filter{Field: "status", Operator: OpIn, Value: []string{}},
+			wantClause: "FALSE",
+		},
+		{
+			name:       "not in empty slice matches everything",
+			filter:     Filter{Field: "status", Operator: OpNotIn, Value: []interface{}{}},
+			wantClause: "TRUE",
+		},
+		{
+			name:       "not in ints",
+			filter:     Filter{Field: "id", Operator: OpNotIn, Value: []int64{7}},
+			wantClause: "id NOT IN ($1)",
+			wantParams: []interface{}{int64(7)},
+		},
+		{
+			name:       "between array of floats",
+			filter:     Filter{Field: "amount", Operator: OpBetween, Value: [2]float64{10, 20}},
+			wantClause: "amount BETWEEN $1 AND $2",
+			wantParams: []interface{}{float64(10), float64(20)},
+		},
+		{
+			name:       "between single value is skipped",
+			filter:     Filter{Field: "amount", Operator: OpBetween, Value: 10},
+			wantClause: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			qb := NewQueryBuilder()
+			clause, err := qb.BuildWhereClause(FilterGroup{Filters: []Filter{tt.filter}})
+			if err != nil {
+				t.Fatalf("BuildWhereClause() error = %v", err)
+			}
+
+			if clause != tt.wantClause {
+				t.Errorf("BuildWhereClause() = %q, want %q", clause, tt.wantClause)
+			}
+			if params := qb.GetParams(); len(params) != len(tt.wantParams) ||
+				(len(params) > 0 && !reflect.DeepEqual(params, tt.wantParams)) {
+				t.Errorf("GetParams() = %v, want %v", params, tt.wantParams)
+			}
+		})
+	}
+}
+
+func TestBuildCompleteQuery_SortAndPagination(t *testing.T) {
+	req := SearchRequest{
+		Filters:  FilterGroup{Filters: []Filter{EqualFilter("status", "active")}},
+		Sort:     []OrderBy{{Field: "users.created_at", Desc: true}, {Field: "name"}},
+		Page:     3,
+		PageSize: 25,
+	}
+
+	query, err := BuildCompleteQuery("SELECT * FROM users", req, NewQueryBuilder())
+	if err != nil {
+		t.Fatalf("BuildCompleteQuery() error = %v", err)
+	}
+	want := "SELECT * FROM users WHERE (status = $1) ORDER BY users.created_at DESC, name ASC LIMIT 25 OFFSET 50"
+	if query != want {
+		t.Errorf("BuildCompleteQuery() = %q, want %q", query, want)
+	}
+
+	pages := []struct {
+		page, pageSize int
+		want           string
+	}{
+		{1, 10, " LIMIT 10 OFFSET 0"},
+		{2, 0, " LIMIT 20 OFFSET 20"},   // Default page size
+		{0, 500, " LIMIT 100 OFFSET 0"}, // Capped page size, first page
+		{0, 0, ""},                      // Not paginated
+	}
+	for _, tt := range pages {
+		query, err := BuildCompleteQuery("SELECT 1", SearchRequest{Page: tt.page, PageSize: tt.pageSize}, NewQueryBuilder())
+		if err != nil || query != "SELECT 1"+tt.want {
+			t.Errorf("page %d of %d: BuildCompleteQuery() = %q, %v, want %q", tt.page, tt.pageSize, query, err, "SELECT 1"+tt.want)
+		}
+	}
+
+	for _, field := range []string{"name; DROP TABLE users", "created_at DESC", "a.b.c", "1col", ""} {
+		req := SearchRequest{Sort: []OrderBy{{Field: field}}}
+		if _, err := BuildCompleteQuery("SELECT 1", req, NewQueryBuilder()); !errors.Is(err, ErrInvalidField) {
+			t.Errorf("sort by %q: error = %v, want ErrInvalidField", field, err)
+		}
+	}
+}
+
+func TestQueryBuilder_AllowedFields(t *testing.T) {
+	injection := "amount); DROP TABLE orders;--"
+
+	// Without an allow-list, any plain column name passes
+	qb := NewQueryBuilder()
+	if _, err := qb.BuildWhereClause(FilterGroup{Filters: []Filter{EqualFilter("orders.amount", 10)}}); err != nil {
+		t.Errorf("BuildWhereClause() with a column name error = %v", err)
+	}
+	if _, err := qb.BuildWhereClause(FilterGroup{Filters: []Filter{EqualFilter(injection, 10)}}); !errors.Is(err, ErrInvalidField) {
+		t.Errorf("BuildWhereClause() with an injected field error = %v, want ErrInvalidField", err)
+	}
+
+	qb = NewQueryBuilder("name", "email", "status")
+
+	clause, err := qb.BuildWhereClause(FilterGroup{
+		Filters: []Filter{EqualFilter("status", "active")},
+		Groups: []FilterGroup{{
+			Logic:   "OR",
+			Filters: []Filter{TextSearchFilter("name", "ann"), TextSearchFilter("email", "ann")},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("BuildWhereClause() with allowed fields error = %v", err)
+	}
+	if want := "status = $1 AND (name ILIKE $2 OR email ILIKE $3)"; clause != want {
+		t.Errorf("BuildWhereClause() = %q, want %q", clause, want)
+	}
+
+	rejected := []SearchRequest{
+		{Filters: FilterGroup{Filters: []Filter{EqualFilter(injection, 1)}}},
+		{Filters: FilterGroup{Groups: []FilterGroup{{Filters: []Filter{EqualFilter("password_hash", "x")}}}}},
+		{Query: "ann", SearchFields: []string{"name", injection}},
+		{Sort: []OrderBy{{Field: "password_hash"}}},
+	}
+	for _, req := range rejected {
+		if _, err := BuildCompleteQuery("SELECT * FROM users", req, NewQueryBuilder("name", "email", "status")); !errors.Is(err, ErrInvalidField) {
+			t.Errorf("BuildCompleteQuery(%+v) error = %v, want ErrInvalidField", req, err)
+		}
+	}
+
+	query, err := BuildCompleteQuery("SELECT * FROM users", SearchRequest{
+		Query:        "ann",
+		SearchFields: []string{"name", "email"},
+		Sort:         []OrderBy{{Field: "name"}},
+	}, NewQueryBuilder("name", "email", "status"))
+	if err != nil {
+		t.Fatalf("BuildCompleteQuery() with allowed fields error = %v", err)
+	}
+	if want := "SELECT * FROM users WHERE (name ILIKE $1 OR email ILIKE $2) ORDER BY name ASC"; query != want {
+		t.Errorf("BuildCompleteQuery() = %q, want %q", query, want)
+	}
+}
+
+func TestQueryBuilder_BuildTSQuery(t *testing.T) {
+	qb := NewQueryBuilderWithParams([]interface{}{"tenant-1"})
+	clause, err := qb.BuildTSQuery("quarterly report", "simple", []string{"title", "body"})
+	if err != nil {
+		t.Fatalf("BuildTSQuery() error = %v", err)
+	}
+
+	want := "to_tsvector('simple', coalesce(title, '') || ' ' || coalesce(body, '')) @@ plainto_tsquery('simple', $2)"
+	if clause != want {
+		t.Errorf("BuildTSQuery() = %q, want %q", clause, want)
+	}
+	if params := qb.GetParams(); !reflect.DeepEqual(params, []interface{}{"tenant-1", "quarterly report"}) {
+		t.Errorf("GetParams() = %v, want the query after the existing param", params)
+	}
+
+	if _, err := NewQueryBuilder().BuildTSQuery("x", "english'); DROP TABLE docs;--", []string{"title"}); err == nil {
+		t.Error("BuildTSQuery() with an injected config error = nil")
+	}
+	if _, err := NewQueryBuilder("title").BuildTSQuery("x", "", []string{"secret"}); !errors.Is(err, ErrInvalidField) {
+		t.Errorf("BuildTSQuery() with a disallowed field error = %v, want ErrInvalidField", err)
+	}
+
+	// The request flag picks full-text search over ILIKE
+	req := SearchRequest{Query: "invoice", SearchFields: []string{"title"}, FullText: true}
+	query, err := BuildCompleteQuery("SELECT * FROM docs", req, NewQueryBuilder("title"))
+	if err != nil {
+		t.Fatalf("BuildCompleteQuery() error = %v", err)
+	}
+	want = "SELECT * FROM docs WHERE (to_tsvector('english', coalesce(title, '')) @@ plainto_tsquery('english', $1))"
+	if query != want {
+		t.Errorf("BuildCompleteQuery() = %q, want %q", query, want)
+	}
+
+	req.FullText = false
+	if query, _ := BuildCompleteQuery("SELECT * FROM docs", req, NewQueryBuilder("title")); query != "SELECT * FROM docs WHERE (title ILIKE $1)" {
+		t.Errorf("BuildCompleteQuery() without FullText = %q, want the ILIKE fallback", query)
+	}
+}
@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"net/url"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// objectStore is the subset of the S3 API the storage service uses. It
+// keeps the service testable without a running MinIO.
+type objectStore interface {
+	PutObject(ctx context.Context, name string, reader io.Reader, size int64, opts minio.PutObjectOptions) (minio.UploadInfo, error)
+	GetObject(ctx context.Context, name string) (io.ReadCloser, minio.ObjectInfo, error)
+	RemoveObject(ctx context.Context, name string) error
+	RemoveIncompleteUpload(ctx context.Context, name string) error
+	ListObjects(ctx context.Context, prefix string) ([]minio.ObjectInfo, error)
+	PresignedGetObject(ctx context.Context, name string, expires time.Duration) (*url.URL, error)
+}
+
+// minioStore implements objectStore for a single MinIO/S3 bucket
+type minioStore struct {
+	client     *minio.Client
+	bucketName string
+}
+
+func (m *minioStore) PutObject(ctx context.Context, name string, reader io.Reader, size int64, opts minio.PutObjectOptions) (minio.UploadInfo, error) {
+	return m.client.PutObject(ctx, m.bucketName, name, reader, size, opts)
+}
+
+func (m *minioStore) GetObject(ctx context.Context, name string) (io.ReadCloser, minio.ObjectInfo, error) {
+	object, err := m.client.GetObject(ctx, m.bucketName, name, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, minio.ObjectInfo{}, err
+	}
+
+	stat, err := object.Stat()
+	if err != nil {
+		object.Close()
+		return nil, minio.ObjectInfo{}, err
+	}
+
+	return object, stat, nil
+}
+
+func (m *minioStore) RemoveObject(ctx context.Context, name string) error {
+	return m.client.RemoveObject(ctx, m.bucketName, name, minio.RemoveObjectOptions{})
+}
+
+func (m *minioStore) RemoveIncompleteUpload(ctx context.Context, name string) error {
+	return m.client.RemoveIncompleteUpload(ctx, m.bucketName, name)
+}
+
+func (m *minioStore) ListObjects(ctx context.Context, prefix string) ([]minio.ObjectInfo, error) {
+	var objects []minio.ObjectInfo
+
+	objectCh := m.client.ListObjects(ctx, m.bucketName, minio.ListObjectsOptions{
+		Prefix:    prefix,
+		Recursive: true,
+	})
+
+	for object := range objectCh {
+		if object.Err != nil {
+			return nil, object.Err
+		}
+		objects = append(objects, object)
+	}
+
+	return objects, nil
+}
+
+func (m *minioStore) PresignedGetObject(ctx context.Context, name string, expires time.Duration) (*url.URL, error) {
+	return m.client.PresignedGetObject(ctx, m.bucketName, name, expires, nil)
+}
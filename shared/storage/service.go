@@ -2,24 +2,63 @@ package storage
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"hash"
 	"io"
+	"io/fs"
 	"log"
+	"mime"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/minio/minio-go/v7/pkg/encrypt"
+)
+
+const (
+	// checksumMetadataKey is the user metadata key holding an object's SHA-256
+	checksumMetadataKey = "sha256"
+
+	// DefaultPartSize is the multipart upload part size used by UploadStream
+	DefaultPartSize = 16 << 20
+
+	// MinPartSize is the smallest part size S3 accepts
+	MinPartSize = 5 << 20
+
+	// DefaultGCGracePeriod is how old an unreferenced file must be before
+	// GarbageCollect deletes it, so that files uploaded but not yet saved
+	// in a record survive
+	DefaultGCGracePeriod = time.Hour
+)
+
+var (
+	ErrFileTooLarge          = errors.New("file exceeds the maximum upload size")
+	ErrContentTypeNotAllowed = errors.New("content type not allowed")
+	ErrChecksumMismatch      = errors.New("file checksum mismatch")
 )
 
 // StorageService handles file storage operations
 type StorageService struct {
-	client     *minio.Client
-	bucketName string
-	useLocal   bool
-	localPath  string
+	store       objectStore
+	useSSE      bool
+	useLocal    bool
+	localPath   string
+	constraints *UploadConstraints
+	partSize    uint64
+	gcGrace     time.Duration
+}
+
+// UploadConstraints limits what UploadFile accepts
+type UploadConstraints struct {
+	MaxSize             int64    // Maximum size in bytes, 0 for no limit
+	AllowedContentTypes []string // Allowed MIME types such as "image/png" or "image/*"; empty allows all
 }
 
 // FileInfo represents uploaded file information
@@ -51,6 +90,7 @@ func NewStorageService() (*StorageService, error) {
 		return &StorageService{
 			useLocal:  true,
 			localPath: localPath,
+			gcGrace:   DefaultGCGracePeriod,
 		}, nil
 	}
 
@@ -59,6 +99,7 @@ func NewStorageService() (*StorageService, error) {
 	accessKey := getEnv("MINIO_ACCESS_KEY", "minioadmin")
 	secretKey := getEnv("MINIO_SECRET_KEY", "minioadmin")
 	useSSL := os.Getenv("MINIO_USE_SSL") == "true"
+	useSSE := os.Getenv("MINIO_USE_SSE") == "true"
 	bucketName := getEnv("MINIO_BUCKET", "marimo-files")
 
 	// Initialize MinIO client
@@ -86,17 +127,33 @@ func NewStorageService() (*StorageService, error) {
 	}
 
 	return &StorageService{
-		client:     client,
-		bucketName: bucketName,
-		useLocal:   false,
+		store:    &minioStore{client: client, bucketName: bucketName},
+		useSSE:   useSSE,
+		useLocal: false,
+		partSize: DefaultPartSize,
+		gcGrace:  DefaultGCGracePeriod,
 	}, nil
 }
 
-// UploadFile uploads a file to storage
+// WithUploadConstraints returns a copy of the service whose uploads are
+// checked against constraints
+func (s *StorageService) WithUploadConstraints(constraints UploadConstraints) *StorageService {
+	constrained := *s
+	constrained.constraints = &constraints
+	return &constrained
+}
+
+// UploadFile uploads a file to storage. Uploads that break the service's
+// UploadConstraints fail with ErrFileTooLarge or ErrContentTypeNotAllowed;
+// size may be -1 if unknown, in which case the limit is enforced while
+// reading.
 func (s *StorageService) UploadFile(ctx context.Context, reader io.Reader, originalFilename string, contentType string, size int64) (*FileInfo, error) {
-	// Generate unique filename
-	ext := filepath.Ext(originalFilename)
-	filename := fmt.Sprintf("%s%s", uuid.New().String(), ext)
+	reader, err := s.constrain(reader, contentType, size)
+	if err != nil {
+		return nil, err
+	}
+
+	filename := newFilename(originalFilename)
 
 	if s.useLocal {
 		return s.uploadLocal(reader, filename, originalFilename, contentType, size)
@@ -105,6 +162,102 @@ func (s *StorageService) UploadFile(ctx context.Context, reader io.Reader, origi
 	return s.uploadMinio(ctx, reader, filename, originalFilename, contentType, size)
 }
 
+// WithPartSize returns a copy of the service that uploads streams in parts
+// of partSize bytes. Sizes below MinPartSize are raised to it.
+func (s *StorageService) WithPartSize(partSize uint64) *StorageService {
+	if partSize < MinPartSize {
+		partSize = MinPartSize
+	}
+
+	sized := *s
+	sized.partSize = partSize
+	return &sized
+}
+
+// UploadStream uploads a file of unknown size without buffering it, using
+// a MinIO multipart upload. A failed upload leaves no parts behind.
+// Unlike UploadFile, streamed objects carry no stored checksum since it is
+// only known once the upload is complete.
+func (s *StorageService) UploadStream(ctx context.Context, reader io.Reader, originalFilename, contentType string) (*FileInfo, error) {
+	reader, err := s.constrain(reader, contentType, -1)
+	if err != nil {
+		return nil, err
+	}
+
+	filename := newFilename(originalFilename)
+
+	if s.useLocal {
+		// Local uploads are always streamed to disk
+		return s.uploadLocal(reader, filename, originalFilename, contentType, -1)
+	}
+
+	partSize := s.partSize
+	if partSize == 0 {
+		partSize = DefaultPartSize
+	}
+
+	opts := minio.PutObjectOptions{
+		ContentType: contentType,
+		PartSize:    partSize,
+		UserMetadata: map[string]string{
+			"original-filename": originalFilename,
+		},
+	}
+	if s.useSSE {
+		opts.ServerSideEncryption = encrypt.NewSSE()
+	}
+
+	info, err := s.store.PutObject(ctx, filename, reader, -1, opts)
+	if err != nil {
+		// The context may already be canceled, but the parts must still go
+		s.store.RemoveIncompleteUpload(context.WithoutCancel(ctx), filename)
+		return nil, fmt.Errorf("failed to upload file: %w", err)
+	}
+
+	url, err := s.store.PresignedGetObject(ctx, filename, 7*24*time.Hour)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate URL: %w", err)
+	}
+
+	return &FileInfo{
+		ID:           filename,
+		Filename:     filename,
+		OriginalName: originalFilename,
+		Size:         info.Size,
+		ContentType:  contentType,
+		URL:          url.String(),
+		UploadedAt:   time.Now(),
+	}, nil
+}
+
+// constrain checks an upload against the service's UploadConstraints and
+// wraps reader to enforce the size limit
+func (s *StorageService) constrain(reader io.Reader, contentType string, size int64) (io.Reader, error) {
+	c := s.constraints
+	if c == nil {
+		return reader, nil
+	}
+
+	if !c.allowsContentType(contentType) {
+		return nil, fmt.Errorf("%w: %s", ErrContentTypeNotAllowed, contentType)
+	}
+
+	if c.MaxSize > 0 {
+		if size > c.MaxSize {
+			return nil, ErrFileTooLarge
+		}
+		reader = &maxSizeReader{reader: io.LimitReader(reader, c.MaxSize+1), max: c.MaxSize}
+	}
+
+	return reader, nil
+}
+
+// newFilename generates a unique filename keeping the original extension
+func newFilename(originalFilename string) string {
+	ext := filepath.Ext(originalFilename)
+	return fmt.Sprintf("%s%s", uuid.New().String(), ext)
+}
+
 // uploadLocal saves file to local filesystem
 func (s *StorageService) uploadLocal(reader io.Reader, filename, originalFilename, contentType string, size int64) (*FileInfo, error) {
 	filePath := filepath.Join(s.localPath, filename)
@@ -117,6 +270,8 @@ func (s *StorageService) uploadLocal(reader io.Reader, filename, originalFilenam
 
 	written, err := io.Copy(file, reader)
 	if err != nil {
+		// Don't leave a partial file behind
+		os.Remove(filePath)
 		return nil, fmt.Errorf("failed to write file: %w", err)
 	}
 
@@ -131,20 +286,36 @@ func (s *StorageService) uploadLocal(reader io.Reader, filename, originalFilenam
 	}, nil
 }
 
-// uploadMinio uploads file to MinIO/S3
+// uploadMinio uploads file to MinIO/S3. The content is spooled to a temp
+// file first so its SHA-256 can be stored in the object metadata.
 func (s *StorageService) uploadMinio(ctx context.Context, reader io.Reader, filename, originalFilename, contentType string, size int64) (*FileInfo, error) {
-	info, err := s.client.PutObject(ctx, s.bucketName, filename, reader, size, minio.PutObjectOptions{
+	spool, size, checksum, err := spoolWithChecksum(reader)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		spool.Close()
+		os.Remove(spool.Name())
+	}()
+
+	opts := minio.PutObjectOptions{
 		ContentType: contentType,
 		UserMetadata: map[string]string{
 			"original-filename": originalFilename,
+			checksumMetadataKey: checksum,
 		},
-	})
+	}
+	if s.useSSE {
+		opts.ServerSideEncryption = encrypt.NewSSE()
+	}
+
+	info, err := s.store.PutObject(ctx, filename, spool, size, opts)
 	if err != nil {
 		return nil, fmt.Errorf("failed to upload file: %w", err)
 	}
 
 	// Generate presigned URL (valid for 7 days)
-	url, err := s.client.PresignedGetObject(ctx, s.bucketName, filename, 7*24*time.Hour, nil)
+	url, err := s.store.PresignedGetObject(ctx, filename, 7*24*time.Hour)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate URL: %w", err)
 	}
@@ -192,23 +363,24 @@ func (s *StorageService) downloadLocal(filename string) (io.ReadCloser, *FileInf
 	}, nil
 }
 
-// downloadMinio downloads file from MinIO/S3
+// downloadMinio downloads file from MinIO/S3. If the object has a stored
+// checksum, reading it to the end fails with ErrChecksumMismatch when the
+// content doesn't match.
 func (s *StorageService) downloadMinio(ctx context.Context, filename string) (io.ReadCloser, *FileInfo, error) {
-	object, err := s.client.GetObject(ctx, s.bucketName, filename, minio.GetObjectOptions{})
+	object, stat, err := s.store.GetObject(ctx, filename)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to get object: %w", err)
 	}
 
-	stat, err := object.Stat()
-	if err != nil {
-		object.Close()
-		return nil, nil, fmt.Errorf("failed to stat object: %w", err)
+	var body io.ReadCloser = object
+	if checksum := userMetadata(stat.UserMetadata, checksumMetadataKey); checksum != "" {
+		body = &checksumReader{ReadCloser: object, hash: sha256.New(), expected: checksum}
 	}
 
-	return object, &FileInfo{
+	return body, &FileInfo{
 		ID:           filename,
 		Filename:     filename,
-		OriginalName: stat.UserMetadata["original-filename"],
+		OriginalName: userMetadata(stat.UserMetadata, "original-filename"),
 		Size:         stat.Size,
 		ContentType:  stat.ContentType,
 		UploadedAt:   stat.LastModified,
@@ -222,7 +394,71 @@ func (s *StorageService) DeleteFile(ctx context.Context, filename string) error
 		return os.Remove(filePath)
 	}
 
-	return s.client.RemoveObject(ctx, s.bucketName, filename, minio.RemoveObjectOptions{})
+	return s.store.RemoveObject(ctx, filename)
+}
+
+// DeleteMany removes several files, carrying on past failures. Files that
+// are already gone count as deleted.
+func (s *StorageService) DeleteMany(ctx context.Context, filenames []string) (deleted int, errs []error) {
+	for _, filename := range filenames {
+		if err := ctx.Err(); err != nil {
+			errs = append(errs, err)
+			return deleted, errs
+		}
+
+		if err := s.DeleteFile(ctx, filename); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			errs = append(errs, fmt.Errorf("failed to delete %s: %w", filename, err))
+			continue
+		}
+		deleted++
+	}
+
+	return deleted, errs
+}
+
+// WithGCGracePeriod returns a copy of the service whose GarbageCollect
+// keeps unreferenced files younger than grace
+func (s *StorageService) WithGCGracePeriod(grace time.Duration) *StorageService {
+	graced := *s
+	graced.gcGrace = grace
+	return &graced
+}
+
+// GarbageCollect deletes every stored file not in referenced, such as the
+// files of deleted products or avatars, and returns the removed filenames.
+// Files uploaded within the grace period (DefaultGCGracePeriod unless set
+// with WithGCGracePeriod) are kept, as their record may not be saved yet.
+// With dryRun set nothing is deleted and the files that would be removed
+// are returned. Failed deletions are reported together in err.
+func (s *StorageService) GarbageCollect(ctx context.Context, referenced map[string]bool, dryRun bool) (removed []string, err error) {
+	files, err := s.ListFiles(ctx, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list files: %w", err)
+	}
+
+	cutoff := time.Now().Add(-s.gcGrace)
+
+	var orphaned []string
+	for _, file := range files {
+		if !referenced[file.Filename] && !file.UploadedAt.After(cutoff) {
+			orphaned = append(orphaned, file.Filename)
+		}
+	}
+
+	if dryRun {
+		return orphaned, nil
+	}
+
+	var errs []error
+	for _, filename := range orphaned {
+		if _, deleteErrs := s.DeleteMany(ctx, []string{filename}); len(deleteErrs) > 0 {
+			errs = append(errs, deleteErrs...)
+			continue
+		}
+		removed = append(removed, filename)
+	}
+
+	return removed, errors.Join(errs...)
 }
 
 // ListFiles lists all files in storage
@@ -254,16 +490,12 @@ func (s *StorageService) ListFiles(ctx context.Context, prefix string) ([]FileIn
 	}
 
 	// List objects from MinIO
-	objectCh := s.client.ListObjects(ctx, s.bucketName, minio.ListObjectsOptions{
-		Prefix:    prefix,
-		Recursive: true,
-	})
-
-	for object := range objectCh {
-		if object.Err != nil {
-			return nil, object.Err
-		}
+	objects, err := s.store.ListObjects(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
 
+	for _, object := range objects {
 		files = append(files, FileInfo{
 			ID:          object.Key,
 			Filename:    object.Key,
@@ -282,7 +514,7 @@ func (s *StorageService) GetFileURL(ctx context.Context, filename string, expire
 		return fmt.Sprintf("/files/%s", filename), nil
 	}
 
-	url, err := s.client.PresignedGetObject(ctx, s.bucketName, filename, expires, nil)
+	url, err := s.store.PresignedGetObject(ctx, filename, expires)
 	if err != nil {
 		return "", fmt.Errorf("failed to generate presigned URL: %w", err)
 	}
@@ -290,6 +522,98 @@ func (s *StorageService) GetFileURL(ctx context.Context, filename string, expire
 	return url.String(), nil
 }
 
+// allowsContentType reports whether contentType is in the allow-list,
+// ignoring parameters such as charset
+func (c *UploadConstraints) allowsContentType(contentType string) bool {
+	if len(c.AllowedContentTypes) == 0 {
+		return true
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	for _, allowed := range c.AllowedContentTypes {
+		allowed = strings.ToLower(allowed)
+		if allowed == mediaType {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(allowed, "/*"); ok && strings.HasPrefix(mediaType, prefix+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// spoolWithChecksum copies reader to a temp file, returning the file
+// rewound to the start along with the content's size and hex SHA-256
+func spoolWithChecksum(reader io.Reader) (*os.File, int64, string, error) {
+	spool, err := os.CreateTemp("", "upload-*")
+	if err != nil {
+		return nil, 0, "", fmt.Errorf("failed to create temp file: %w", err)
+	}
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(spool, hash), reader)
+	if err == nil {
+		_, err = spool.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		spool.Close()
+		os.Remove(spool.Name())
+		return nil, 0, "", fmt.Errorf("failed to buffer file: %w", err)
+	}
+
+	return spool, size, hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// userMetadata looks up a user metadata value. S3 returns keys in
+// canonical header form, so the lookup ignores case.
+func userMetadata(metadata map[string]string, key string) string {
+	for k, v := range metadata {
+		if strings.EqualFold(k, key) {
+			return v
+		}
+	}
+	return ""
+}
+
+// checksumReader hashes content as it is read and fails with
+// ErrChecksumMismatch at the end if it doesn't match the expected hash
+type checksumReader struct {
+	io.ReadCloser
+	hash     hash.Hash
+	expected string
+}
+
+func (r *checksumReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.hash.Write(p[:n])
+
+	if err == io.EOF && hex.EncodeToString(r.hash.Sum(nil)) != r.expected {
+		return n, ErrChecksumMismatch
+	}
+	return n, err
+}
+
+// maxSizeReader fails with ErrFileTooLarge once more than max bytes are read
+type maxSizeReader struct {
+	reader io.Reader
+	max    int64
+	read   int64
+}
+
+func (r *maxSizeReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.read += int64(n)
+	if r.read > r.max {
+		return n, ErrFileTooLarge
+	}
+	return n, err
+}
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
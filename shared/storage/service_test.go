@@ -0,0 +1,395 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+func newTestLocalStorage(t *testing.T) *StorageService {
+	t.Helper()
+	return &StorageService{useLocal: true, localPath: t.TempDir()}
+}
+
+// memoryObjectStore is an objectStore that keeps objects in a map
+type memoryObjectStore struct {
+	objects    map[string][]byte
+	info       map[string]minio.ObjectInfo
+	puts       []minio.PutObjectOptions
+	incomplete []string // names passed to RemoveIncompleteUpload
+}
+
+func newMemoryObjectStore() *memoryObjectStore {
+	return &memoryObjectStore{
+		objects: make(map[string][]byte),
+		info:    make(map[string]minio.ObjectInfo),
+	}
+}
+
+func (m *memoryObjectStore) PutObject(ctx context.Context, name string, reader io.Reader, size int64, opts minio.PutObjectOptions) (minio.UploadInfo, error) {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return minio.UploadInfo{}, err
+	}
+	if size >= 0 && int64(len(data)) != size {
+		return minio.UploadInfo{}, errors.New("size mismatch")
+	}
+
+	// S3 returns user metadata keys in canonical header form
+	metadata := make(map[string]string, len(opts.UserMetadata))
+	for k, v := range opts.UserMetadata {
+		metadata[http.CanonicalHeaderKey(k)] = v
+	}
+
+	m.objects[name] = data
+	m.info[name] = minio.ObjectInfo{
+		Key:          name,
+		Size:         int64(len(data)),
+		ContentType:  opts.ContentType,
+		UserMetadata: metadata,
+		LastModified: time.Now(),
+	}
+	m.puts = append(m.puts, opts)
+
+	return minio.UploadInfo{Key: name, Size: int64(len(data))}, nil
+}
+
+func (m *memoryObjectStore) GetObject(ctx context.Context, name string) (io.ReadCloser, minio.ObjectInfo, error) {
+	data, ok := m.objects[name]
+	if !ok {
+		return nil, minio.ObjectInfo{}, errors.New("object not found")
+	}
+	return io.NopCloser(bytes.NewReader(data)), m.info[name], nil
+}
+
+func (m *memoryObjectStore) RemoveObject(ctx context.Context, name string) error {
+	delete(m.objects, name)
+	delete(m.info, name)
+	return nil
+}
+
+func (m *memoryObjectStore) RemoveIncompleteUpload(ctx context.Context, name string) error {
+	m.incomplete = append(m.incomplete, name)
+	return nil
+}
+
+func (m *memoryObjectStore) ListObjects(ctx context.Context, prefix string) ([]minio.ObjectInfo, error) {
+	var objects []minio.ObjectInfo
+	for name, info := range m.info {
+		if strings.HasPrefix(name, prefix) {
+			objects = append(objects, info)
+		}
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+	return objects, nil
+}
+
+func (m *memoryObjectStore) PresignedGetObject(ctx context.Context, name string, expires time.Duration) (*url.URL, error) {
+	return url.Parse("https://minio.example.com/bucket/" + name)
+}
+
+func TestUploadFile_Constraints(t *testing.T) {
+	base := newTestLocalStorage(t)
+	s := base.WithUploadConstraints(UploadConstraints{
+		MaxSize:             1024,
+		AllowedContentTypes: []string{"image/*", "application/pdf"},
+	})
+	ctx := context.Background()
+
+	info, err := s.UploadFile(ctx, strings.NewReader("%PDF-1.7"), "invoice.pdf", "application/pdf", 8)
+	if err != nil {
+		t.Fatalf("UploadFile() within limits error = %v", err)
+	}
+	if info.Size != 8 {
+		t.Errorf("Size = %d, want 8", info.Size)
+	}
+
+	if _, err := s.UploadFile(ctx, strings.NewReader("png"), "avatar.png", "image/png; charset=binary", 3); err != nil {
+		t.Errorf("UploadFile() wildcard type error = %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        []byte
+		size        int64
+		wantErr     error
+	}{
+		{"declared size over limit", "application/pdf", make([]byte, 10), 4096, ErrFileTooLarge},
+		{"unknown size over limit", "application/pdf", make([]byte, 2048), -1, ErrFileTooLarge},
+		{"understated size", "image/jpeg", make([]byte, 1025), 100, ErrFileTooLarge},
+		{"executable", "application/x-msdownload", []byte("MZ"), 2, ErrContentTypeNotAllowed},
+		{"malformed type", "", []byte("data"), 4, ErrContentTypeNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.UploadFile(ctx, bytes.NewReader(tt.body), "upload.bin", tt.contentType, tt.size)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("UploadFile() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	entries, err := os.ReadDir(base.localPath)
+	if err != nil {
+		t.Fatalf("read storage dir: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("%d files stored, want only the 2 accepted uploads", len(entries))
+	}
+
+	// Constraints don't leak into the original service
+	if _, err := base.UploadFile(ctx, bytes.NewReader(make([]byte, 2048)), "big.bin", "application/octet-stream", -1); err != nil {
+		t.Errorf("unconstrained UploadFile() error = %v", err)
+	}
+}
+
+func TestMinioUpload_ChecksumAndEncryption(t *testing.T) {
+	store := newMemoryObjectStore()
+	s := &StorageService{store: store, useSSE: true}
+	ctx := context.Background()
+
+	content := "quarterly report"
+	info, err := s.UploadFile(ctx, strings.NewReader(content), "report.txt", "text/plain", -1)
+	if err != nil {
+		t.Fatalf("UploadFile() error = %v", err)
+	}
+
+	sum := sha256.Sum256([]byte(content))
+	if got := store.info[info.Filename].UserMetadata["Sha256"]; got != hex.EncodeToString(sum[:]) {
+		t.Errorf("stored checksum = %q, want %x", got, sum)
+	}
+	if store.puts[0].ServerSideEncryption == nil {
+		t.Error("upload did not request server-side encryption")
+	}
+
+	reader, fileInfo, err := s.DownloadFile(ctx, info.Filename)
+	if err != nil {
+		t.Fatalf("DownloadFile() error = %v", err)
+	}
+	data, err := io.ReadAll(reader)
+	reader.Close()
+	if err != nil || string(data) != content {
+		t.Fatalf("download = %q, %v; want %q", data, err, content)
+	}
+	if fileInfo.OriginalName != "report.txt" {
+		t.Errorf("OriginalName = %q, want report.txt", fileInfo.OriginalName)
+	}
+
+	// Corrupt the stored object
+	store.objects[info.Filename][0] = 'Q'
+
+	reader, _, err = s.DownloadFile(ctx, info.Filename)
+	if err != nil {
+		t.Fatalf("DownloadFile() error = %v", err)
+	}
+	defer reader.Close()
+	if _, err := io.ReadAll(reader); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("reading tampered object error = %v, want ErrChecksumMismatch", err)
+	}
+}
+
+// failingReader returns data and then fails, like a dropped connection
+type failingReader struct {
+	data io.Reader
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	n, err := r.data.Read(p)
+	if err == io.EOF {
+		return n, errors.New("connection reset")
+	}
+	return n, err
+}
+
+func TestUploadStream(t *testing.T) {
+	content := strings.Repeat("log line\n", 1000)
+	ctx := context.Background()
+
+	t.Run("minio", func(t *testing.T) {
+		store := newMemoryObjectStore()
+		s := (&StorageService{store: store}).WithPartSize(8 << 20)
+
+		// A plain io.Reader has no size, so the upload is sent with size -1
+		info, err := s.UploadStream(ctx, io.MultiReader(strings.NewReader(content)), "app.log", "text/plain")
+		if err != nil {
+			t.Fatalf("UploadStream() error = %v", err)
+		}
+		if info.Size != int64(len(content)) || string(store.objects[info.Filename]) != content {
+			t.Errorf("stored %d bytes, want %d", len(store.objects[info.Filename]), len(content))
+		}
+		if got := store.puts[0].PartSize; got != 8<<20 {
+			t.Errorf("PartSize = %d, want %d", got, 8<<20)
+		}
+
+		_, err = s.UploadStream(ctx, &failingReader{data: strings.NewReader(content)}, "broken.log", "text/plain")
+		if err == nil {
+			t.Fatal("UploadStream() error = nil for a failing reader")
+		}
+		if len(store.incomplete) != 1 || len(store.objects) != 1 {
+			t.Errorf("failed upload not cleaned up: incomplete = %v, objects = %d", store.incomplete, len(store.objects))
+		}
+	})
+
+	t.Run("local", func(t *testing.T) {
+		s := newTestLocalStorage(t)
+
+		info, err := s.UploadStream(ctx, io.MultiReader(strings.NewReader(content)), "app.log", "text/plain")
+		if err != nil {
+			t.Fatalf("UploadStream() error = %v", err)
+		}
+		if info.Size != int64(len(content)) {
+			t.Errorf("Size = %d, want %d", info.Size, len(content))
+		}
+
+		if _, err := s.UploadStream(ctx, &failingReader{data: strings.NewReader(content)}, "broken.log", "text/plain"); err == nil {
+			t.Fatal("UploadStream() error = nil for a failing reader")
+		}
+		entries, _ := os.ReadDir(s.localPath)
+		if len(entries) != 1 {
+			t.Errorf("%d files stored, want 1 after a failed upload", len(entries))
+		}
+	})
+}
+
+func TestGarbageCollect(t *testing.T) {
+	ctx := context.Background()
+
+	services := map[string]*StorageService{
+		"local": newTestLocalStorage(t),
+		"minio": {store: newMemoryObjectStore()},
+	}
+
+	for name, s := range services {
+		t.Run(name, func(t *testing.T) {
+			var filenames []string
+			for i := 0; i < 4; i++ {
+				info, err := s.UploadFile(ctx, strings.NewReader("image"), "photo.png", "image/png", 5)
+				if err != nil {
+					t.Fatalf("UploadFile() error = %v", err)
+				}
+				filenames = append(filenames, info.Filename)
+			}
+			referenced := map[string]bool{filenames[0]: true, filenames[2]: true}
+			orphaned := []string{filenames[1], filenames[3]}
+			sort.Strings(orphaned)
+
+			removed, err := s.GarbageCollect(ctx, referenced, true)
+			if err != nil {
+				t.Fatalf("GarbageCollect(dry run) error = %v", err)
+			}
+			sort.Strings(removed)
+			if !reflect.DeepEqual(removed, orphaned) {
+				t.Errorf("dry run removed = %v, want %v", removed, orphaned)
+			}
+			if files, _ := s.ListFiles(ctx, ""); len(files) != 4 {
+				t.Fatalf("dry run deleted files: %d left, want 4", len(files))
+			}
+
+			removed, err = s.GarbageCollect(ctx, referenced, false)
+			if err != nil {
+				t.Fatalf("GarbageCollect() error = %v", err)
+			}
+			sort.Strings(removed)
+			if !reflect.DeepEqual(removed, orphaned) {
+				t.Errorf("removed = %v, want %v", removed, orphaned)
+			}
+
+			files, err := s.ListFiles(ctx, "")
+			if err != nil {
+				t.Fatalf("ListFiles() error = %v", err)
+			}
+			if len(files) != 2 {
+				t.Errorf("%d files left, want the 2 referenced ones", len(files))
+			}
+			for _, file := range files {
+				if !referenced[file.Filename] {
+					t.Errorf("unreferenced file %s survived", file.Filename)
+				}
+			}
+		})
+	}
+}
+
+func TestGarbageCollect_GracePeriod(t *testing.T) {
+	ctx := context.Background()
+
+	local := newTestLocalStorage(t)
+	store := newMemoryObjectStore()
+	services := map[string]struct {
+		s   *StorageService
+		age func(filename string, by time.Duration)
+	}{
+		"local": {local, func(filename string, by time.Duration) {
+			past := time.Now().Add(-by)
+			os.Chtimes(filepath.Join(local.localPath, filename), past, past)
+		}},
+		"minio": {&StorageService{store: store}, func(filename string, by time.Duration) {
+			info := store.info[filename]
+			info.LastModified = info.LastModified.Add(-by)
+			store.info[filename] = info
+		}},
+	}
+
+	for name, tc := range services {
+		t.Run(name, func(t *testing.T) {
+			s := tc.s.WithGCGracePeriod(time.Hour)
+
+			old, _ := s.UploadFile(ctx, strings.NewReader("image"), "old.png", "image/png", 5)
+			fresh, _ := s.UploadFile(ctx, strings.NewReader("image"), "fresh.png", "image/png", 5)
+			tc.age(old.Filename, 2*time.Hour)
+
+			removed, err := s.GarbageCollect(ctx, nil, false)
+			if err != nil {
+				t.Fatalf("GarbageCollect() error = %v", err)
+			}
+			if !reflect.DeepEqual(removed, []string{old.Filename}) {
+				t.Errorf("removed = %v, want only the old file %s", removed, old.Filename)
+			}
+
+			// A just uploaded file may not be referenced yet
+			files, _ := s.ListFiles(ctx, "")
+			if len(files) != 1 || files[0].Filename != fresh.Filename {
+				t.Errorf("files left = %v, want only %s", files, fresh.Filename)
+			}
+		})
+	}
+}
+
+func TestDeleteMany(t *testing.T) {
+	ctx := context.Background()
+	s := newTestLocalStorage(t)
+
+	info, err := s.UploadFile(ctx, strings.NewReader("data"), "a.txt", "text/plain", 4)
+	if err != nil {
+		t.Fatalf("UploadFile() error = %v", err)
+	}
+
+	// A directory can't be removed with DeleteFile
+	if err := os.MkdirAll(s.localPath+"/nested/dir", 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	deleted, errs := s.DeleteMany(ctx, []string{info.Filename, "already-gone.txt", "nested"})
+	if deleted != 2 {
+		t.Errorf("deleted = %d, want 2", deleted)
+	}
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "nested") {
+		t.Errorf("errs = %v, want one error for nested", errs)
+	}
+}
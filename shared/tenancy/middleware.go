@@ -3,6 +3,7 @@ package tenancy
 import (
 	"context"
 	"errors"
+	"net"
 	"net/http"
 	"strings"
 
@@ -17,6 +18,16 @@ const (
 	TenantKey     contextKey = "tenant"
 )
 
+// BaseDomain is the domain tenant subdomains live under, as in
+// {slug}.marimo-erp.com
+const BaseDomain = "marimo-erp.com"
+
+// reservedSubdomains are subdomains of BaseDomain that aren't tenants
+var reservedSubdomains = map[string]bool{
+	"api": true,
+	"www": true,
+}
+
 // TenantResolver resolves tenant from various sources
 type TenantResolver struct {
 	repo *TenantRepository
@@ -44,32 +55,32 @@ func (r *TenantResolver) ResolveFromRequest(req *http.Request) (*Tenant, error)
 		return r.repo.GetBySlug(req.Context(), slug)
 	}
 
-	// 3. Try subdomain extraction from Host
-	host := req.Host
-	if strings.Contains(host, ":") {
-		// Remove port
-		host = strings.Split(host, ":")[0]
+	// 3. Try custom domain or subdomain from Host
+	return r.ResolveFromHost(req.Context(), req.Host)
+}
+
+// ResolveFromHost resolves a tenant from a Host header: a subdomain of
+// BaseDomain names the tenant's slug, any other host its custom domain
+func (r *TenantResolver) ResolveFromHost(ctx context.Context, host string) (*Tenant, error) {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
 	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
 
-	// Check for custom domain first
-	if !strings.HasSuffix(host, ".marimo-erp.com") && host != "marimo-erp.com" {
-		tenant, err := r.repo.GetByDomain(req.Context(), host)
-		if err == nil {
-			return tenant, nil
-		}
-		// If custom domain not found, fall through to subdomain check
+	if host == "" || host == BaseDomain {
+		return nil, ErrTenantNotFound
 	}
 
-	// Extract subdomain
-	if strings.HasSuffix(host, ".marimo-erp.com") {
-		slug := strings.TrimSuffix(host, ".marimo-erp.com")
-		// Avoid matching api.marimo-erp.com, www.marimo-erp.com, etc.
-		if slug != "" && slug != "api" && slug != "www" {
-			return r.repo.GetBySlug(req.Context(), slug)
+	if slug, ok := strings.CutSuffix(host, "."+BaseDomain); ok {
+		// Only direct subdomains that aren't reserved, such as
+		// api.marimo-erp.com, name tenants
+		if slug == "" || strings.Contains(slug, ".") || reservedSubdomains[slug] {
+			return nil, ErrTenantNotFound
 		}
+		return r.repo.GetBySlug(ctx, slug)
 	}
 
-	return nil, ErrTenantNotFound
+	return r.repo.GetByDomain(ctx, host)
 }
 
 // ResolveFromContext extracts tenant from context
@@ -81,6 +92,12 @@ func ResolveFromContext(ctx context.Context) (*Tenant, error) {
 	return tenant, nil
 }
 
+// TenantFromContext returns the tenant stored in context, if any
+func TenantFromContext(ctx context.Context) (*Tenant, bool) {
+	tenant, err := ResolveFromContext(ctx)
+	return tenant, err == nil
+}
+
 // GetTenantID extracts tenant ID from context
 func GetTenantID(ctx context.Context) (uuid.UUID, error) {
 	tenantID, ok := ctx.Value(TenantIDKey).(uuid.UUID)
@@ -142,6 +159,54 @@ func (m *TenantMiddleware) Middleware(next http.Handler) http.Handler {
 	})
 }
 
+// RequireFeature returns middleware that only lets requests through when
+// the tenant in context can access feature. It must run after Middleware.
+func RequireFeature(feature string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tenant, ok := TenantFromContext(r.Context())
+			if !ok {
+				http.Error(w, ErrNoTenantInContext.Error(), http.StatusBadRequest)
+				return
+			}
+
+			if !tenant.CanAccessFeature(feature) {
+				http.Error(w, ErrFeatureNotAvailable.Error(), http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ResolveTenantMiddleware returns middleware that resolves the tenant from
+// the request's subdomain or custom domain and stores it in the request
+// context. Unknown hosts get 404; inactive and suspended tenants get 403.
+func ResolveTenantMiddleware(repo *TenantRepository) func(http.Handler) http.Handler {
+	resolver := NewTenantResolver(repo)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tenant, err := resolver.ResolveFromHost(r.Context(), r.Host)
+			if err == nil {
+				err = tenant.CheckStatus()
+			}
+
+			switch {
+			case err == nil:
+				next.ServeHTTP(w, r.WithContext(WithTenant(r.Context(), tenant)))
+			case errors.Is(err, ErrTenantNotFound):
+				http.Error(w, err.Error(), http.StatusNotFound)
+			case errors.Is(err, ErrTenantSuspended), errors.Is(err, ErrTenantInactive):
+				http.Error(w, err.Error(), http.StatusForbidden)
+			default:
+				http.Error(w, "Failed to resolve tenant", http.StatusInternalServerError)
+			}
+		})
+	}
+}
+
 // OptionalMiddleware is like Middleware but doesn't fail if tenant is not found
 func (m *TenantMiddleware) OptionalMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
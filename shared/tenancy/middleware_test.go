@@ -0,0 +1,114 @@
+package tenancy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequireFeature(t *testing.T) {
+	handler := RequireFeature("analytics")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name       string
+		tenant     *Tenant
+		wantStatus int
+	}{
+		{
+			name:       "tenant with feature",
+			tenant:     &Tenant{ID: uuid.New(), Settings: Settings{AllowedFeatures: []string{"basic", "analytics"}}},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "tenant without feature",
+			tenant:     &Tenant{ID: uuid.New(), Settings: Settings{AllowedFeatures: []string{"basic"}}},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "no tenant",
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/reports", nil)
+			if tt.tenant != nil {
+				req = req.WithContext(WithTenant(req.Context(), tt.tenant))
+			}
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			if tt.wantStatus == http.StatusForbidden {
+				assert.Equal(t, ErrFeatureNotAvailable.Error(), strings.TrimSpace(rec.Body.String()))
+			}
+		})
+	}
+}
+
+func TestResolveTenantMiddleware(t *testing.T) {
+	repo, _ := newTestRepository(t)
+	ctx := context.Background()
+
+	domain := "erp.acme.com"
+	tenants := map[string]*Tenant{
+		"acme":      {ID: uuid.New(), Slug: "acme", Domain: &domain, Status: TenantStatusActive},
+		"trial":     {ID: uuid.New(), Slug: "trial", Status: TenantStatusTrial},
+		"suspended": {ID: uuid.New(), Slug: "suspended", Status: TenantStatusSuspended},
+		"inactive":  {ID: uuid.New(), Slug: "inactive", Status: TenantStatusInactive},
+	}
+	for _, tenant := range tenants {
+		require.NoError(t, repo.Create(ctx, tenant))
+	}
+
+	var resolved *Tenant
+	handler := ResolveTenantMiddleware(repo)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resolved, _ = TenantFromContext(r.Context())
+	}))
+
+	tests := []struct {
+		name       string
+		host       string
+		wantStatus int
+		wantTenant string
+	}{
+		{"subdomain", "acme.marimo-erp.com", http.StatusOK, "acme"},
+		{"subdomain with port", "trial.marimo-erp.com:8080", http.StatusOK, "trial"},
+		{"custom domain", "ERP.acme.com", http.StatusOK, "acme"},
+		{"unknown subdomain", "globex.marimo-erp.com", http.StatusNotFound, ""},
+		{"unknown host", "example.org", http.StatusNotFound, ""},
+		{"reserved subdomain", "www.marimo-erp.com", http.StatusNotFound, ""},
+		{"base domain", "marimo-erp.com", http.StatusNotFound, ""},
+		{"suspended tenant", "suspended.marimo-erp.com", http.StatusForbidden, ""},
+		{"inactive tenant", "inactive.marimo-erp.com", http.StatusForbidden, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolved = nil
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Host = tt.host
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			if tt.wantTenant == "" {
+				assert.Nil(t, resolved)
+				return
+			}
+			require.NotNil(t, resolved)
+			assert.Equal(t, tenants[tt.wantTenant].ID, resolved.ID)
+		})
+	}
+}
@@ -0,0 +1,190 @@
+package tenancy
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testSchema = `
+	CREATE TABLE tenants (
+		id TEXT PRIMARY KEY,
+		name TEXT NOT NULL,
+		slug TEXT NOT NULL UNIQUE,
+		domain TEXT UNIQUE,
+		status TEXT NOT NULL,
+		settings TEXT NOT NULL DEFAULT '{}',
+		subscription TEXT NOT NULL DEFAULT '{}',
+		created_at DATETIME,
+		updated_at DATETIME,
+		trial_ends_at DATETIME,
+		suspended_at DATETIME,
+		suspend_reason TEXT,
+		deleted_at DATETIME
+	)`
+
+// newTestRepository returns a repository over an in-memory SQLite database
+func newTestRepository(t *testing.T) (*TenantRepository, *sql.DB) {
+	t.Helper()
+
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	// Each connection to :memory: is a separate database
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	_, err = db.Exec(testSchema)
+	require.NoError(t, err)
+
+	return NewTenantRepository(db), db
+}
+
+func TestTenantRepository_SuspendExpiredTrials(t *testing.T) {
+	repo, db := newTestRepository(t)
+	now := time.Now()
+
+	tenants := []struct {
+		slug        string
+		status      TenantStatus
+		trialEndsAt *time.Time
+		deleted     bool
+	}{
+		{"active", TenantStatusActive, nil, false},
+		{"active-past-trial", TenantStatusActive, ptr(now.AddDate(0, 0, -30)), false},
+		{"trial", TenantStatusTrial, ptr(now.AddDate(0, 0, 7)), false},
+		{"expired", TenantStatusTrial, ptr(now.AddDate(0, 0, -1)), false},
+		{"expired-long-ago", TenantStatusTrial, ptr(now.AddDate(0, -2, 0)), false},
+		{"expired-deleted", TenantStatusTrial, ptr(now.AddDate(0, 0, -1)), true},
+	}
+	for _, tt := range tenants {
+		var deletedAt *time.Time
+		if tt.deleted {
+			deletedAt = &now
+		}
+		_, err := db.Exec(`INSERT INTO tenants (id, name, slug, status, trial_ends_at, deleted_at)
+			VALUES ($1, $2, $3, $4, $5, $6)`,
+			uuid.New(), tt.slug, tt.slug, tt.status, tt.trialEndsAt, deletedAt)
+		require.NoError(t, err)
+	}
+
+	suspended, err := repo.SuspendExpiredTrials(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2, suspended)
+
+	want := map[string]TenantStatus{
+		"active":            TenantStatusActive,
+		"active-past-trial": TenantStatusActive,
+		"trial":             TenantStatusTrial,
+		"expired":           TenantStatusSuspended,
+		"expired-long-ago":  TenantStatusSuspended,
+		"expired-deleted":   TenantStatusTrial,
+	}
+	for slug, status := range want {
+		var (
+			got         TenantStatus
+			reason      sql.NullString
+			suspendedAt sql.NullTime
+		)
+		err := db.QueryRow(`SELECT status, suspend_reason, suspended_at FROM tenants WHERE slug = $1`, slug).
+			Scan(&got, &reason, &suspendedAt)
+		require.NoError(t, err)
+
+		assert.Equal(t, status, got, slug)
+		if status == TenantStatusSuspended {
+			assert.Equal(t, TrialExpiredReason, reason.String, slug)
+			assert.True(t, suspendedAt.Valid, slug)
+		} else {
+			assert.False(t, reason.Valid, slug)
+		}
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestTenantRepository_RoundTrip(t *testing.T) {
+	repo, _ := newTestRepository(t)
+	ctx := context.Background()
+
+	domain := "erp.acme.com"
+	logo := "https://cdn.example.com/acme.png"
+	customerID := "cus_123"
+	now := time.Now().UTC().Truncate(time.Second)
+
+	tenant := &Tenant{
+		ID:     uuid.New(),
+		Name:   "Acme Corp",
+		Slug:   "acme",
+		Domain: &domain,
+		Status: TenantStatusTrial,
+		Settings: Settings{
+			MaxUsers:        10,
+			MaxStorage:      10 << 30,
+			AllowedFeatures: []string{"basic", "export"},
+			Timezone:        "Europe/Berlin",
+			Currency:        "EUR",
+			Logo:            &logo,
+		},
+		Subscription: Subscription{
+			Plan:               "trial",
+			Status:             "active",
+			CurrentPeriodStart: now,
+			CurrentPeriodEnd:   now.AddDate(0, 0, 14),
+			StripeCustomerID:   &customerID,
+		},
+		CreatedAt:   now,
+		UpdatedAt:   now,
+		TrialEndsAt: ptr(now.AddDate(0, 0, 14)),
+	}
+	require.NoError(t, repo.Create(ctx, tenant))
+
+	for name, get := range map[string]func() (*Tenant, error){
+		"GetByID":     func() (*Tenant, error) { return repo.GetByID(ctx, tenant.ID) },
+		"GetBySlug":   func() (*Tenant, error) { return repo.GetBySlug(ctx, "acme") },
+		"GetByDomain": func() (*Tenant, error) { return repo.GetByDomain(ctx, domain) },
+	} {
+		got, err := get()
+		require.NoError(t, err, name)
+		assert.Equal(t, tenant.Settings, got.Settings, name)
+		assert.True(t, got.Subscription.CurrentPeriodEnd.Equal(tenant.Subscription.CurrentPeriodEnd), name)
+		assert.Equal(t, customerID, *got.Subscription.StripeCustomerID, name)
+	}
+
+	_, err := repo.GetBySlug(ctx, "missing")
+	assert.Equal(t, ErrTenantNotFound, err)
+}
+
+func TestTenantRepository_UpdateStoresJSON(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	tenant := &Tenant{
+		ID:           uuid.New(),
+		Slug:         "acme",
+		Status:       TenantStatusActive,
+		Settings:     Settings{MaxUsers: 25, AllowedFeatures: []string{"basic", "export"}},
+		Subscription: Subscription{Plan: "starter", Status: "active"},
+	}
+	settings, err := json.Marshal(tenant.Settings)
+	require.NoError(t, err)
+	subscription, err := json.Marshal(tenant.Subscription)
+	require.NoError(t, err)
+
+	mock.ExpectExec("UPDATE tenants").
+		WithArgs(tenant.ID, tenant.Name, tenant.Slug, tenant.Domain, tenant.Status,
+			settings, subscription, sqlmock.AnyArg(), nil, nil, nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	require.NoError(t, NewTenantRepository(db).Update(context.Background(), tenant))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -3,18 +3,22 @@ package tenancy
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/google/uuid"
 )
 
 var (
-	ErrTenantNotFound     = errors.New("tenant not found")
-	ErrTenantInactive     = errors.New("tenant is inactive")
-	ErrTenantSuspended    = errors.New("tenant is suspended")
-	ErrInvalidTenantID    = errors.New("invalid tenant ID")
-	ErrNoTenantInContext  = errors.New("no tenant in context")
+	ErrTenantNotFound      = errors.New("tenant not found")
+	ErrTenantInactive      = errors.New("tenant is inactive")
+	ErrTenantSuspended     = errors.New("tenant is suspended")
+	ErrInvalidTenantID     = errors.New("invalid tenant ID")
+	ErrNoTenantInContext   = errors.New("no tenant in context")
+	ErrFeatureNotAvailable = errors.New("feature not available on the tenant's plan")
 )
 
 // TenantStatus represents the status of a tenant
@@ -67,6 +71,43 @@ type Subscription struct {
 	StripeSubscriptionID *string `json:"stripe_subscription_id,omitempty"`
 }
 
+// Value stores settings in a JSON column
+func (s Settings) Value() (driver.Value, error) {
+	return json.Marshal(s)
+}
+
+// Scan reads settings from a JSON column
+func (s *Settings) Scan(value interface{}) error {
+	return scanJSON(value, s)
+}
+
+// Value stores the subscription in a JSON column
+func (s Subscription) Value() (driver.Value, error) {
+	return json.Marshal(s)
+}
+
+// Scan reads the subscription from a JSON column
+func (s *Subscription) Scan(value interface{}) error {
+	return scanJSON(value, s)
+}
+
+// scanJSON decodes a JSON column value into dest. NULL leaves dest as is.
+func scanJSON(value interface{}, dest interface{}) error {
+	var data []byte
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("cannot scan %T into %T", value, dest)
+	}
+
+	return json.Unmarshal(data, dest)
+}
+
 // TenantRepository handles tenant data access
 type TenantRepository struct {
 	db *sql.DB
@@ -233,11 +274,51 @@ func (r *TenantRepository) Delete(ctx context.Context, tenantID uuid.UUID) error
 	return nil
 }
 
+// TrialExpiredReason is the suspend reason recorded for expired trials
+const TrialExpiredReason = "trial expired"
+
+// SuspendExpiredTrials suspends every trial tenant whose trial has ended
+// and returns how many were suspended. It is meant to be run daily.
+func (r *TenantRepository) SuspendExpiredTrials(ctx context.Context) (int, error) {
+	query := `
+		UPDATE tenants
+		SET status = $1, suspend_reason = $2, suspended_at = $3, updated_at = $3
+		WHERE status = $4 AND trial_ends_at < $3 AND deleted_at IS NULL
+	`
+
+	result, err := r.db.ExecContext(ctx, query,
+		TenantStatusSuspended, TrialExpiredReason, time.Now(), TenantStatusTrial,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(rows), nil
+}
+
 // IsActive checks if tenant is active and can be used
 func (t *Tenant) IsActive() bool {
 	return t.Status == TenantStatusActive || t.Status == TenantStatusTrial
 }
 
+// CheckStatus returns ErrTenantSuspended or ErrTenantInactive if the
+// tenant can't be used
+func (t *Tenant) CheckStatus() error {
+	switch {
+	case t.Status == TenantStatusSuspended:
+		return ErrTenantSuspended
+	case !t.IsActive():
+		return ErrTenantInactive
+	default:
+		return nil
+	}
+}
+
 // IsTrialExpired checks if trial period has expired
 func (t *Tenant) IsTrialExpired() bool {
 	if t.Status != TenantStatusTrial || t.TrialEndsAt == nil {
@@ -255,3 +336,53 @@ func (t *Tenant) CanAccessFeature(feature string) bool {
 	}
 	return false
 }
+
+// QuotaError reports that a tenant has reached a plan limit
+type QuotaError struct {
+	Resource string // "users" or "storage"
+	Limit    int64
+	Current  int64
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("%s quota exceeded: %d of %d used", e.Resource, e.Current, e.Limit)
+}
+
+// WithinUserQuota checks if current users fit the tenant's MaxUsers.
+// A negative limit means unlimited.
+func (t *Tenant) WithinUserQuota(current int) bool {
+	return t.Settings.MaxUsers < 0 || current <= t.Settings.MaxUsers
+}
+
+// WithinStorageQuota checks if usedBytes fit the tenant's MaxStorage.
+// A negative limit means unlimited.
+func (t *Tenant) WithinStorageQuota(usedBytes int64) bool {
+	return t.Settings.MaxStorage < 0 || usedBytes <= t.Settings.MaxStorage
+}
+
+// CheckUserQuota returns a *QuotaError if a tenant with current users
+// can't add another one. Call it before creating a user, with current
+// counting only the tenant's own users.
+func (t *Tenant) CheckUserQuota(current int) error {
+	if !t.WithinUserQuota(current + 1) {
+		return &QuotaError{
+			Resource: "users",
+			Limit:    int64(t.Settings.MaxUsers),
+			Current:  int64(current),
+		}
+	}
+	return nil
+}
+
+// CheckStorageQuota returns a *QuotaError if a tenant using usedBytes
+// can't store addBytes more. Call it before accepting an upload.
+func (t *Tenant) CheckStorageQuota(usedBytes, addBytes int64) error {
+	if !t.WithinStorageQuota(usedBytes + addBytes) {
+		return &QuotaError{
+			Resource: "storage",
+			Limit:    t.Settings.MaxStorage,
+			Current:  usedBytes,
+		}
+	}
+	return nil
+}
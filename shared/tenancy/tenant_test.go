@@ -123,6 +123,40 @@ func TestTenant_CanAccessFeature(t *testing.T) {
 	}
 }
 
+func TestTenant_Quotas(t *testing.T) {
+	tenant := &Tenant{Settings: Settings{MaxUsers: 10, MaxStorage: 1 << 30}}
+
+	assert.True(t, tenant.WithinUserQuota(9))
+	assert.True(t, tenant.WithinUserQuota(10))
+	assert.False(t, tenant.WithinUserQuota(11))
+
+	assert.True(t, tenant.WithinStorageQuota(1<<30))
+	assert.False(t, tenant.WithinStorageQuota(1<<30+1))
+
+	assert.NoError(t, tenant.CheckUserQuota(9))
+
+	err := tenant.CheckUserQuota(10)
+	var quotaErr *QuotaError
+	require.ErrorAs(t, err, &quotaErr)
+	assert.Equal(t, "users", quotaErr.Resource)
+	assert.Equal(t, int64(10), quotaErr.Limit)
+	assert.Equal(t, int64(10), quotaErr.Current)
+
+	assert.NoError(t, tenant.CheckStorageQuota(1<<29, 1<<29))
+
+	err = tenant.CheckStorageQuota(1<<30, 1)
+	require.ErrorAs(t, err, &quotaErr)
+	assert.Equal(t, "storage", quotaErr.Resource)
+	assert.Equal(t, int64(1<<30), quotaErr.Limit)
+	assert.Equal(t, int64(1<<30), quotaErr.Current)
+
+	unlimited := &Tenant{Settings: Settings{MaxUsers: -1, MaxStorage: -1}}
+	assert.True(t, unlimited.WithinUserQuota(1_000_000))
+	assert.True(t, unlimited.WithinStorageQuota(1<<50))
+	assert.NoError(t, unlimited.CheckUserQuota(1_000_000))
+	assert.NoError(t, unlimited.CheckStorageQuota(1<<50, 1<<50))
+}
+
 func TestWithTenant(t *testing.T) {
 	ctx := context.Background()
 	tenant := &Tenant{
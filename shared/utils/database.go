@@ -1,29 +1,37 @@
 package utils
 
 import (
-	"errors"
+	"sort"
 	"sync"
 	"time"
 
+	"github.com/dayanch951/marimo/shared/database"
 	"github.com/dayanch951/marimo/shared/models"
 	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
 )
 
+// The errors are shared with the database package so handlers can check
+// for them whichever backend is in use
 var (
-	ErrUserNotFound      = errors.New("user not found")
-	ErrUserAlreadyExists = errors.New("user already exists")
-	ErrInvalidPassword   = errors.New("invalid password")
-	ErrTokenNotFound     = errors.New("refresh token not found")
-	ErrTokenExpired      = errors.New("refresh token expired")
-	ErrTokenRevoked      = errors.New("refresh token revoked")
+	ErrUserNotFound      = database.ErrUserNotFound
+	ErrUserAlreadyExists = database.ErrUserAlreadyExists
+	ErrInvalidPassword   = database.ErrInvalidPassword
+	ErrTokenNotFound     = database.ErrTokenNotFound
+	ErrTokenExpired      = database.ErrTokenExpired
+	ErrTokenRevoked      = database.ErrTokenRevoked
+	ErrUserTokenInvalid  = database.ErrUserTokenInvalid
+	ErrUserTokenExpired  = database.ErrUserTokenExpired
 )
 
 // MemoryDB is a shared in-memory database
 type MemoryDB struct {
 	users         map[string]*models.User
 	emails        map[string]string
+	deleted       map[string]bool   // Soft-deleted user IDs
+	tenants       map[string]string // User ID to tenant ID
 	refreshTokens map[string]*models.RefreshToken
+	userTokens    map[string]*models.UserToken
 	mu            sync.RWMutex
 }
 
@@ -32,7 +40,10 @@ func NewMemoryDB() *MemoryDB {
 	return &MemoryDB{
 		users:         make(map[string]*models.User),
 		emails:        make(map[string]string),
+		deleted:       make(map[string]bool),
+		tenants:       make(map[string]string),
 		refreshTokens: make(map[string]*models.RefreshToken),
+		userTokens:    make(map[string]*models.UserToken),
 	}
 }
 
@@ -76,7 +87,7 @@ func (db *MemoryDB) GetUserByEmail(email string) (*models.User, error) {
 	defer db.mu.RUnlock()
 
 	userID, exists := db.emails[email]
-	if !exists {
+	if !exists || db.deleted[userID] {
 		return nil, ErrUserNotFound
 	}
 
@@ -94,14 +105,15 @@ func (db *MemoryDB) GetUserByID(id string) (*models.User, error) {
 	defer db.mu.RUnlock()
 
 	user, exists := db.users[id]
-	if !exists {
+	if !exists || db.deleted[id] {
 		return nil, ErrUserNotFound
 	}
 
 	return user, nil
 }
 
-// UpdateUser updates user information
+// UpdateUser updates user information. Changing the email clears
+// EmailVerified and invalidates outstanding verification links.
 func (db *MemoryDB) UpdateUser(id, name, email string) error {
 	db.mu.Lock()
 	defer db.mu.Unlock()
@@ -118,6 +130,14 @@ func (db *MemoryDB) UpdateUser(id, name, email string) error {
 		delete(db.emails, user.Email)
 		db.emails[email] = id
 		user.Email = email
+		user.EmailVerified = false
+
+		// Links sent to the old address must not verify the new one
+		for _, userToken := range db.userTokens {
+			if userToken.UserID == id && userToken.Purpose == models.TokenPurposeEmailVerification {
+				userToken.Used = true
+			}
+		}
 	}
 
 	user.Name = name
@@ -126,6 +146,38 @@ func (db *MemoryDB) UpdateUser(id, name, email string) error {
 	return nil
 }
 
+// UpdatePassword replaces a user's password hash
+func (db *MemoryDB) UpdatePassword(userID, passwordHash string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	user, exists := db.users[userID]
+	if !exists {
+		return ErrUserNotFound
+	}
+
+	user.Password = passwordHash
+	user.UpdatedAt = time.Now()
+
+	return nil
+}
+
+// MarkEmailVerified records that a user has verified their email address
+func (db *MemoryDB) MarkEmailVerified(userID string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	user, exists := db.users[userID]
+	if !exists {
+		return ErrUserNotFound
+	}
+
+	user.EmailVerified = true
+	user.UpdatedAt = time.Now()
+
+	return nil
+}
+
 // AssignRole assigns a role to a user
 func (db *MemoryDB) AssignRole(userID, role string) error {
 	db.mu.Lock()
@@ -142,6 +194,37 @@ func (db *MemoryDB) AssignRole(userID, role string) error {
 	return nil
 }
 
+// AssignTenant records which tenant a user belongs to
+func (db *MemoryDB) AssignTenant(userID, tenantID string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	user, exists := db.users[userID]
+	if !exists {
+		return ErrUserNotFound
+	}
+
+	db.tenants[userID] = tenantID
+	user.UpdatedAt = time.Now()
+
+	return nil
+}
+
+// CountUsersByTenant counts the tenant's users that are not deleted
+func (db *MemoryDB) CountUsersByTenant(tenantID string) (int, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	count := 0
+	for userID, userTenant := range db.tenants {
+		if userTenant == tenantID && !db.deleted[userID] {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
 // ValidatePassword validates a user's password
 func (db *MemoryDB) ValidatePassword(email, password string) (*models.User, error) {
 	user, err := db.GetUserByEmail(email)
@@ -164,7 +247,9 @@ func (db *MemoryDB) ListUsers(page, limit int) ([]*models.User, int, error) {
 
 	users := make([]*models.User, 0, len(db.users))
 	for _, user := range db.users {
-		users = append(users, user)
+		if !db.deleted[user.ID] {
+			users = append(users, user)
+		}
 	}
 
 	total := len(users)
@@ -182,6 +267,22 @@ func (db *MemoryDB) ListUsers(page, limit int) ([]*models.User, int, error) {
 	return users[start:end], total, nil
 }
 
+// DeleteUser soft-deletes a user
+func (db *MemoryDB) DeleteUser(userID string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	user, exists := db.users[userID]
+	if !exists || db.deleted[userID] {
+		return ErrUserNotFound
+	}
+
+	db.deleted[userID] = true
+	user.UpdatedAt = time.Now()
+
+	return nil
+}
+
 // CreateRefreshToken creates a new refresh token
 func (db *MemoryDB) CreateRefreshToken(userID, token string, expiresAt time.Time) (*models.RefreshToken, error) {
 	db.mu.Lock()
@@ -217,7 +318,7 @@ func (db *MemoryDB) GetRefreshToken(token string) (*models.RefreshToken, error)
 
 	// Check if token is revoked
 	if refreshToken.Revoked {
-		return nil, ErrTokenRevoked
+		return refreshToken, ErrTokenRevoked
 	}
 
 	return refreshToken, nil
@@ -232,8 +333,29 @@ func (db *MemoryDB) RevokeRefreshToken(token string) error {
 	if !exists {
 		return ErrTokenNotFound
 	}
+	if refreshToken.Revoked {
+		return ErrTokenRevoked
+	}
+
+	refreshToken.Revoked = true
+	return nil
+}
+
+// RotateRefreshToken revokes a refresh token that was exchanged for a new one
+func (db *MemoryDB) RotateRefreshToken(token string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	refreshToken, exists := db.refreshTokens[token]
+	if !exists {
+		return ErrTokenNotFound
+	}
+	if refreshToken.Revoked {
+		return ErrTokenRevoked
+	}
 
 	refreshToken.Revoked = true
+	refreshToken.Rotated = true
 	return nil
 }
 
@@ -251,6 +373,26 @@ func (db *MemoryDB) RevokeAllUserTokens(userID string) error {
 	return nil
 }
 
+// ListUserTokens returns the active refresh tokens of a user, newest first
+func (db *MemoryDB) ListUserTokens(userID string) ([]*models.RefreshToken, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	now := time.Now()
+	tokens := make([]*models.RefreshToken, 0)
+	for _, token := range db.refreshTokens {
+		if token.UserID == userID && !token.Revoked && now.Before(token.ExpiresAt) {
+			tokens = append(tokens, token)
+		}
+	}
+
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].CreatedAt.After(tokens[j].CreatedAt)
+	})
+
+	return tokens, nil
+}
+
 // CleanupExpiredTokens removes expired tokens from the database
 func (db *MemoryDB) CleanupExpiredTokens() error {
 	db.mu.Lock()
@@ -265,3 +407,40 @@ func (db *MemoryDB) CleanupExpiredTokens() error {
 
 	return nil
 }
+
+// CreateUserToken stores a single-use token for purpose
+func (db *MemoryDB) CreateUserToken(userID, purpose, token string, expiresAt time.Time) (*models.UserToken, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	userToken := &models.UserToken{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		Purpose:   purpose,
+		Token:     token,
+		ExpiresAt: expiresAt,
+		CreatedAt: time.Now(),
+	}
+
+	db.userTokens[token] = userToken
+	return userToken, nil
+}
+
+// ConsumeUserToken marks a token for purpose as used and returns it
+func (db *MemoryDB) ConsumeUserToken(purpose, token string) (*models.UserToken, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	userToken, exists := db.userTokens[token]
+	if !exists || userToken.Purpose != purpose || userToken.Used {
+		return nil, ErrUserTokenInvalid
+	}
+
+	userToken.Used = true
+
+	if time.Now().After(userToken.ExpiresAt) {
+		return nil, ErrUserTokenExpired
+	}
+
+	return userToken, nil
+}
@@ -3,6 +3,8 @@ package utils
 import (
 	"testing"
 	"time"
+
+	"github.com/dayanch951/marimo/shared/models"
 )
 
 func TestMemoryDB_CreateUser(t *testing.T) {
@@ -140,6 +142,31 @@ func TestMemoryDB_UpdateUser(t *testing.T) {
 	}
 }
 
+func TestMemoryDB_UpdateUser_EmailChange(t *testing.T) {
+	db := NewMemoryDB()
+
+	user, _ := db.CreateUser("old@example.com", "password123", "Test User", "user")
+	db.MarkEmailVerified(user.ID)
+	db.CreateUserToken(user.ID, models.TokenPurposeEmailVerification, "stale", time.Now().Add(time.Hour))
+
+	// Keeping the email keeps it verified
+	db.UpdateUser(user.ID, "New Name", "old@example.com")
+	if got, _ := db.GetUserByID(user.ID); !got.EmailVerified {
+		t.Error("UpdateUser() with the same email cleared EmailVerified")
+	}
+
+	if err := db.UpdateUser(user.ID, "New Name", "new@example.com"); err != nil {
+		t.Fatalf("UpdateUser() error = %v", err)
+	}
+	if got, _ := db.GetUserByID(user.ID); got.EmailVerified {
+		t.Error("UpdateUser() with a new email kept EmailVerified")
+	}
+
+	if _, err := db.ConsumeUserToken(models.TokenPurposeEmailVerification, "stale"); err != ErrUserTokenInvalid {
+		t.Errorf("ConsumeUserToken() of a link sent to the old email error = %v, want %v", err, ErrUserTokenInvalid)
+	}
+}
+
 func TestMemoryDB_AssignRole(t *testing.T) {
 	db := NewMemoryDB()
 
@@ -188,6 +215,36 @@ func TestMemoryDB_ListUsers(t *testing.T) {
 	}
 }
 
+func TestMemoryDB_CountUsersByTenant(t *testing.T) {
+	db := NewMemoryDB()
+
+	first, _ := db.CreateUser("first@example.com", "password123", "First User", "user")
+	second, _ := db.CreateUser("second@example.com", "password123", "Second User", "user")
+	other, _ := db.CreateUser("other@example.com", "password123", "Other User", "user")
+	db.CreateUser("none@example.com", "password123", "No Tenant", "user")
+
+	for _, user := range []*models.User{first, second} {
+		if err := db.AssignTenant(user.ID, "tenant-a"); err != nil {
+			t.Fatalf("AssignTenant() error = %v", err)
+		}
+	}
+	db.AssignTenant(other.ID, "tenant-b")
+
+	if count, err := db.CountUsersByTenant("tenant-a"); err != nil || count != 2 {
+		t.Errorf("CountUsersByTenant() = %d, %v, want 2", count, err)
+	}
+
+	// Deleted users free up their seat
+	db.DeleteUser(second.ID)
+	if count, err := db.CountUsersByTenant("tenant-a"); err != nil || count != 1 {
+		t.Errorf("CountUsersByTenant() after a delete = %d, %v, want 1", count, err)
+	}
+
+	if err := db.AssignTenant("missing", "tenant-a"); err != ErrUserNotFound {
+		t.Errorf("AssignTenant() of a missing user error = %v, want %v", err, ErrUserNotFound)
+	}
+}
+
 func TestMemoryDB_RefreshToken_Create(t *testing.T) {
 	db := NewMemoryDB()
 
@@ -268,6 +325,42 @@ func TestMemoryDB_RefreshToken_Revoke(t *testing.T) {
 	if err != ErrTokenRevoked {
 		t.Errorf("GetRefreshToken() error = %v, want %v", err, ErrTokenRevoked)
 	}
+
+	// Only the first revocation succeeds
+	if err := db.RevokeRefreshToken(token); err != ErrTokenRevoked {
+		t.Errorf("RevokeRefreshToken() of a revoked token error = %v, want %v", err, ErrTokenRevoked)
+	}
+}
+
+func TestMemoryDB_RefreshToken_Rotate(t *testing.T) {
+	db := NewMemoryDB()
+
+	expiresAt := time.Now().Add(1 * time.Hour)
+	db.CreateRefreshToken("test-user", "rotated", expiresAt)
+	db.CreateRefreshToken("test-user", "revoked", expiresAt)
+
+	if err := db.RotateRefreshToken("rotated"); err != nil {
+		t.Fatalf("RotateRefreshToken() error = %v", err)
+	}
+	db.RevokeRefreshToken("revoked")
+
+	token, err := db.GetRefreshToken("rotated")
+	if err != ErrTokenRevoked || token == nil || !token.Rotated {
+		t.Errorf("GetRefreshToken() of a rotated token = %+v, %v, want it rotated and %v", token, err, ErrTokenRevoked)
+	}
+	if token, _ := db.GetRefreshToken("revoked"); token == nil || token.Rotated {
+		t.Errorf("GetRefreshToken() of a revoked token = %+v, want it not rotated", token)
+	}
+
+	// A token can't be rotated once revoked, by either means
+	for _, token := range []string{"rotated", "revoked"} {
+		if err := db.RotateRefreshToken(token); err != ErrTokenRevoked {
+			t.Errorf("RotateRefreshToken(%q) error = %v, want %v", token, err, ErrTokenRevoked)
+		}
+	}
+	if token, _ := db.GetRefreshToken("revoked"); token == nil || token.Rotated {
+		t.Errorf("GetRefreshToken() after a failed rotation = %+v, want it not rotated", token)
+	}
 }
 
 func TestMemoryDB_RefreshToken_RevokeAll(t *testing.T) {
@@ -305,6 +398,31 @@ func TestMemoryDB_RefreshToken_RevokeAll(t *testing.T) {
 	}
 }
 
+func TestMemoryDB_RefreshToken_ListUserTokens(t *testing.T) {
+	db := NewMemoryDB()
+
+	userID := "test-user"
+	expiresAt := time.Now().Add(1 * time.Hour)
+
+	older, _ := db.CreateRefreshToken(userID, "token1", expiresAt)
+	older.CreatedAt = older.CreatedAt.Add(-time.Minute)
+	db.CreateRefreshToken(userID, "token2", expiresAt)
+	db.CreateRefreshToken(userID, "revoked", expiresAt)
+	db.RevokeRefreshToken("revoked")
+	db.CreateRefreshToken(userID, "expired", time.Now().Add(-1*time.Hour))
+	db.CreateRefreshToken("other-user", "token3", expiresAt)
+
+	tokens, err := db.ListUserTokens(userID)
+	if err != nil {
+		t.Fatalf("ListUserTokens() error = %v", err)
+	}
+
+	// Only active tokens are listed, newest first
+	if len(tokens) != 2 || tokens[0].Token != "token2" || tokens[1].Token != "token1" {
+		t.Errorf("ListUserTokens() = %v, want token2 and token1", tokens)
+	}
+}
+
 func TestMemoryDB_RefreshToken_Cleanup(t *testing.T) {
 	db := NewMemoryDB()
 
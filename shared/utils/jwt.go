@@ -4,9 +4,11 @@ import (
 	"crypto/rand"
 	"encoding/base64"
 	"errors"
+	"log"
 	"os"
 	"time"
 
+	"github.com/dayanch951/marimo/shared/jwtconfig"
 	"github.com/dayanch951/marimo/shared/models"
 	"github.com/golang-jwt/jwt/v5"
 )
@@ -21,6 +23,13 @@ const (
 	RefreshTokenDuration = 7 * 24 * time.Hour // Long-lived refresh token
 )
 
+// Default claims of access tokens, used when JWT_ISSUER and JWT_AUDIENCE
+// are not set
+const (
+	DefaultJWTIssuer   = jwtconfig.DefaultIssuer
+	DefaultJWTAudience = jwtconfig.DefaultAudience
+)
+
 // TokenPair represents access and refresh tokens
 type TokenPair struct {
 	AccessToken  string `json:"access_token"`
@@ -39,24 +48,48 @@ type Claims struct {
 
 // GetJWTSecret returns the JWT secret from environment
 func GetJWTSecret() []byte {
-	secret := os.Getenv("JWT_SECRET")
-	if secret == "" {
-		secret = "your-secret-key-change-this-min-32-chars"
+	return jwtconfig.Secret()
+}
+
+// GetAccessTokenTTL returns the lifetime of access tokens from
+// JWT_ACCESS_TTL (e.g. "30m"), or AccessTokenDuration if it isn't set
+func GetAccessTokenTTL() time.Duration {
+	value := os.Getenv("JWT_ACCESS_TTL")
+	if value == "" {
+		return AccessTokenDuration
 	}
-	return []byte(secret)
+
+	ttl, err := time.ParseDuration(value)
+	if err != nil || ttl <= 0 {
+		log.Printf("Invalid JWT_ACCESS_TTL %q, using %v", value, AccessTokenDuration)
+		return AccessTokenDuration
+	}
+	return ttl
+}
+
+// GetJWTIssuer returns the iss claim of access tokens from environment
+func GetJWTIssuer() string {
+	return jwtconfig.Issuer()
+}
+
+// GetJWTAudience returns the aud claim of access tokens from environment
+func GetJWTAudience() string {
+	return jwtconfig.Audience()
 }
 
 // GenerateAccessToken generates a short-lived JWT access token
 func GenerateAccessToken(user *models.User) (string, error) {
+	now := time.Now()
 	claims := Claims{
 		UserID: user.ID,
 		Email:  user.Email,
 		Role:   user.Role,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(AccessTokenDuration)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			NotBefore: jwt.NewNumericDate(time.Now()),
-			Issuer:    "marimo-erp",
+			ExpiresAt: jwt.NewNumericDate(now.Add(GetAccessTokenTTL())),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			Issuer:    GetJWTIssuer(),
+			Audience:  jwt.ClaimStrings{GetJWTAudience()},
 			Subject:   user.ID,
 		},
 	}
@@ -93,14 +126,15 @@ func GenerateTokenPair(user *models.User) (*TokenPair, string, time.Time, error)
 	pair := &TokenPair{
 		AccessToken:  accessToken,
 		RefreshToken: refreshToken,
-		ExpiresIn:    int64(AccessTokenDuration.Seconds()),
+		ExpiresIn:    int64(GetAccessTokenTTL().Seconds()),
 		TokenType:    "Bearer",
 	}
 
 	return pair, refreshToken, refreshExpiry, nil
 }
 
-// ValidateAccessToken validates and parses a JWT access token
+// ValidateAccessToken validates and parses a JWT access token. The token
+// must have been issued by and for this deployment.
 func ValidateAccessToken(tokenString string) (*Claims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
 		// Validate signing method
@@ -108,7 +142,7 @@ func ValidateAccessToken(tokenString string) (*Claims, error) {
 			return nil, ErrInvalidToken
 		}
 		return GetJWTSecret(), nil
-	})
+	}, jwt.WithIssuer(GetJWTIssuer()), jwt.WithAudience(GetJWTAudience()))
 
 	if err != nil {
 		return nil, err
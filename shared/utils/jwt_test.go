@@ -176,6 +176,51 @@ func TestAccessTokenExpiration(t *testing.T) {
 	}
 }
 
+func TestGenerateTokenPair_CustomClaims(t *testing.T) {
+	t.Setenv("JWT_ACCESS_TTL", "5m")
+	t.Setenv("JWT_ISSUER", "marimo-staging")
+	t.Setenv("JWT_AUDIENCE", "marimo-staging-api")
+
+	user := &models.User{ID: "test-user-id", Email: "test@example.com", Role: "user"}
+
+	pair, _, _, err := GenerateTokenPair(user)
+	if err != nil {
+		t.Fatalf("GenerateTokenPair() error = %v", err)
+	}
+	if pair.ExpiresIn != 300 {
+		t.Errorf("ExpiresIn = %v, want 300", pair.ExpiresIn)
+	}
+
+	claims, err := ValidateAccessToken(pair.AccessToken)
+	if err != nil {
+		t.Fatalf("ValidateAccessToken() error = %v", err)
+	}
+	if claims.Issuer != "marimo-staging" {
+		t.Errorf("Issuer = %v, want marimo-staging", claims.Issuer)
+	}
+	if len(claims.Audience) != 1 || claims.Audience[0] != "marimo-staging-api" {
+		t.Errorf("Audience = %v, want [marimo-staging-api]", claims.Audience)
+	}
+	if diff := claims.ExpiresAt.Sub(claims.IssuedAt.Time); diff != 5*time.Minute {
+		t.Errorf("token lives %v, want 5m", diff)
+	}
+
+	// Other deployments don't accept the token
+	t.Setenv("JWT_ISSUER", DefaultJWTIssuer)
+	if _, err := ValidateAccessToken(pair.AccessToken); err == nil {
+		t.Error("ValidateAccessToken() of a token from another issuer error = nil")
+	}
+}
+
+func TestGetAccessTokenTTL_Invalid(t *testing.T) {
+	for _, value := range []string{"soon", "-5m", "0s"} {
+		t.Setenv("JWT_ACCESS_TTL", value)
+		if ttl := GetAccessTokenTTL(); ttl != AccessTokenDuration {
+			t.Errorf("GetAccessTokenTTL() with JWT_ACCESS_TTL=%q = %v, want %v", value, ttl, AccessTokenDuration)
+		}
+	}
+}
+
 func BenchmarkGenerateAccessToken(b *testing.B) {
 	user := &models.User{
 		ID:    "test-user-id",
@@ -11,7 +11,9 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/google/uuid"
@@ -22,6 +24,9 @@ var (
 	ErrInvalidSignature    = errors.New("invalid webhook signature")
 	ErrDeliveryFailed      = errors.New("webhook delivery failed")
 	ErrMaxRetriesExceeded  = errors.New("max retries exceeded")
+	ErrEventNotFound       = errors.New("webhook event not found")
+	ErrInvalidTimestamp    = errors.New("invalid webhook timestamp")
+	ErrTimestampOutOfRange = errors.New("webhook timestamp outside tolerance")
 )
 
 // EventType defines the type of webhook event
@@ -37,6 +42,7 @@ const (
 	EventSubscriptionUpdated EventType = "subscription.updated"
 	EventSubscriptionCanceled EventType = "subscription.canceled"
 	EventCustom            EventType = "custom"
+	EventPing              EventType = "ping" // Sent by SendTestEvent
 )
 
 // Webhook represents a webhook endpoint configuration
@@ -226,12 +232,17 @@ func (r *Repository) Delete(ctx context.Context, id uuid.UUID) error {
 	return nil
 }
 
-// SaveDelivery saves a delivery attempt
+// SaveDelivery saves a delivery attempt, updating the row if the delivery
+// has been saved before
 func (r *Repository) SaveDelivery(ctx context.Context, delivery *Delivery) error {
 	query := `
 		INSERT INTO webhook_deliveries
 		(id, webhook_id, event_id, status, status_code, response, error, attempt, next_retry_at, created_at, delivered_at)
 		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		ON CONFLICT (id) DO UPDATE
+		SET status = EXCLUDED.status, status_code = EXCLUDED.status_code, response = EXCLUDED.response,
+		    error = EXCLUDED.error, attempt = EXCLUDED.attempt, next_retry_at = EXCLUDED.next_retry_at,
+		    delivered_at = EXCLUDED.delivered_at
 	`
 
 	_, err := r.db.ExecContext(ctx, query,
@@ -244,17 +255,25 @@ func (r *Repository) SaveDelivery(ctx context.Context, delivery *Delivery) error
 	return err
 }
 
-// GetPendingDeliveries retrieves deliveries that need to be retried
+// ClaimLease is how long a claimed delivery stays in flight before it is
+// considered abandoned, e.g. because the worker sending it died, and can be
+// claimed again. It must be longer than a delivery attempt takes.
+const ClaimLease = 5 * time.Minute
+
+// GetPendingDeliveries retrieves deliveries that need to be retried,
+// including in-flight deliveries whose claim has outlived ClaimLease
 func (r *Repository) GetPendingDeliveries(ctx context.Context) ([]*Delivery, error) {
 	query := `
 		SELECT id, webhook_id, event_id, status, status_code, response, error, attempt, next_retry_at, created_at, delivered_at
 		FROM webhook_deliveries
-		WHERE status = 'pending' AND next_retry_at <= $1
+		WHERE (status = 'pending' AND next_retry_at <= $1)
+		   OR (status = 'in_flight' AND claimed_at <= $2)
 		ORDER BY created_at ASC
 		LIMIT 100
 	`
 
-	rows, err := r.db.QueryContext(ctx, query, time.Now())
+	now := time.Now()
+	rows, err := r.db.QueryContext(ctx, query, now, now.Add(-ClaimLease))
 	if err != nil {
 		return nil, err
 	}
@@ -279,21 +298,115 @@ func (r *Repository) GetPendingDeliveries(ctx context.Context) ([]*Delivery, err
 	return deliveries, rows.Err()
 }
 
+// ClaimDelivery marks a pending or abandoned delivery as in flight. It
+// returns false if the delivery could not be claimed, e.g. because another
+// worker claimed it first.
+func (r *Repository) ClaimDelivery(ctx context.Context, id uuid.UUID) (bool, error) {
+	query := `
+		UPDATE webhook_deliveries SET status = 'in_flight', claimed_at = $1
+		WHERE id = $2 AND (status = 'pending' OR (status = 'in_flight' AND claimed_at <= $3))
+	`
+
+	now := time.Now()
+	result, err := r.db.ExecContext(ctx, query, now, id, now.Add(-ClaimLease))
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rows == 1, nil
+}
+
+// SaveEvent stores an event so failed deliveries can be retried later
+func (r *Repository) SaveEvent(ctx context.Context, event *Event) error {
+	query := `
+		INSERT INTO webhook_events (id, tenant_id, type, data, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (id) DO NOTHING
+	`
+
+	dataJSON, err := json.Marshal(event.Data)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.ExecContext(ctx, query,
+		event.ID, event.TenantID, event.Type, dataJSON, event.CreatedAt,
+	)
+
+	return err
+}
+
+// GetEvent retrieves an event by ID
+func (r *Repository) GetEvent(ctx context.Context, id uuid.UUID) (*Event, error) {
+	query := `
+		SELECT id, tenant_id, type, data, created_at
+		FROM webhook_events
+		WHERE id = $1
+	`
+
+	var event Event
+	var dataJSON []byte
+
+	err := r.db.QueryRowContext(ctx, query, id).Scan(
+		&event.ID, &event.TenantID, &event.Type, &dataJSON, &event.CreatedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, ErrEventNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	json.Unmarshal(dataJSON, &event.Data)
+
+	return &event, nil
+}
+
+// Store is the persistence used by Service. Repository implements it.
+type Store interface {
+	GetByID(ctx context.Context, id uuid.UUID) (*Webhook, error)
+	ListByTenant(ctx context.Context, tenantID uuid.UUID) ([]*Webhook, error)
+	SaveEvent(ctx context.Context, event *Event) error
+	GetEvent(ctx context.Context, id uuid.UUID) (*Event, error)
+	SaveDelivery(ctx context.Context, delivery *Delivery) error
+	GetPendingDeliveries(ctx context.Context) ([]*Delivery, error)
+	ClaimDelivery(ctx context.Context, id uuid.UUID) (bool, error)
+}
+
+// DefaultMaxConcurrentDeliveries is used when NewService is given no limit
+const DefaultMaxConcurrentDeliveries = 10
+
 // Service handles webhook business logic
 type Service struct {
-	repo       *Repository
+	repo       Store
 	httpClient *http.Client
 	maxRetries int
+	now        func() time.Time
+	slots      chan struct{} // bounds concurrent deliveries
 }
 
-// NewService creates a new webhook service
-func NewService(repo *Repository) *Service {
+// NewService creates a new webhook service that runs at most
+// maxConcurrentDeliveries deliveries at once. A non-positive limit uses
+// DefaultMaxConcurrentDeliveries.
+func NewService(repo Store, maxConcurrentDeliveries int) *Service {
+	if maxConcurrentDeliveries <= 0 {
+		maxConcurrentDeliveries = DefaultMaxConcurrentDeliveries
+	}
+
 	return &Service{
 		repo: repo,
 		httpClient: &http.Client{
 			Timeout: 30 * time.Second,
 		},
 		maxRetries: 5,
+		now:        time.Now,
+		slots:      make(chan struct{}, maxConcurrentDeliveries),
 	}
 }
 
@@ -305,6 +418,11 @@ func (s *Service) Dispatch(ctx context.Context, event *Event) error {
 		return err
 	}
 
+	// Persist the event so the retry worker can redeliver it
+	if err := s.repo.SaveEvent(ctx, event); err != nil {
+		return err
+	}
+
 	// Filter webhooks that are subscribed to this event type
 	for _, webhook := range webhooks {
 		if !webhook.Active {
@@ -331,26 +449,77 @@ func (s *Service) Dispatch(ctx context.Context, event *Event) error {
 			EventID:   event.ID,
 			Status:    "pending",
 			Attempt:   0,
-			CreatedAt: time.Now(),
+			CreatedAt: s.currentTime(),
+		}
+
+		// Wait for a free delivery slot. If none frees up before ctx is
+		// done, leave the delivery to the retry worker.
+		select {
+		case s.slots <- struct{}{}:
+		case <-ctx.Done():
+			s.deferDelivery(ctx, delivery)
+			continue
 		}
 
-		// Attempt delivery
-		go s.deliver(ctx, webhook, event, delivery)
+		go func(webhook *Webhook, delivery *Delivery) {
+			defer func() { <-s.slots }()
+			s.deliver(ctx, webhook, event, delivery)
+		}(webhook, delivery)
 	}
 
 	return nil
 }
 
+// deferDelivery persists a delivery as due immediately so the retry worker
+// picks it up
+func (s *Service) deferDelivery(ctx context.Context, delivery *Delivery) {
+	now := s.currentTime()
+	delivery.Status = "pending"
+	delivery.NextRetryAt = &now
+
+	if err := s.repo.SaveDelivery(context.WithoutCancel(ctx), delivery); err != nil {
+		log.Printf("webhook: failed to save deferred delivery %s: %v", delivery.ID, err)
+	}
+}
+
 // deliver attempts to deliver a webhook
 func (s *Service) deliver(ctx context.Context, webhook *Webhook, event *Event, delivery *Delivery) error {
+	if err := ctx.Err(); err != nil {
+		s.deferDelivery(ctx, delivery)
+		return err
+	}
+
+	// The result must be saved even if ctx is canceled mid-request
+	saveCtx := context.WithoutCancel(ctx)
+
+	err := s.send(ctx, webhook, event, delivery)
+	switch delivery.Status {
+	case "success":
+	case "failed":
+		s.scheduleRetry(delivery)
+	default:
+		// The request could not be built, so nothing was sent
+		return err
+	}
+
+	if saveErr := s.repo.SaveDelivery(saveCtx, delivery); err == nil {
+		err = saveErr
+	}
+	return err
+}
+
+// send makes a single delivery attempt and records its outcome on delivery.
+// Status is left unchanged if the request could not be built.
+func (s *Service) send(ctx context.Context, webhook *Webhook, event *Event, delivery *Delivery) error {
 	delivery.Attempt++
 
 	// Prepare payload
 	payload := map[string]interface{}{
 		"id":         event.ID,
+		"webhook_id": webhook.ID,
 		"type":       event.Type,
 		"data":       event.Data,
-		"created_at": event.Created,
+		"created_at": event.CreatedAt.UTC().Format(time.RFC3339),
 	}
 
 	payloadJSON, err := json.Marshal(payload)
@@ -376,17 +545,19 @@ func (s *Service) deliver(ctx context.Context, webhook *Webhook, event *Event, d
 		req.Header.Set(key, value)
 	}
 
-	// Add HMAC signature
-	signature := s.generateSignature(payloadJSON, webhook.Secret)
-	req.Header.Set("X-Webhook-Signature", signature)
+	// Add HMAC signatures. X-Webhook-Signature covers the payload alone so
+	// receivers using VerifySignature keep working; X-Webhook-Signature-V2
+	// covers "timestamp.payload" so replays can be detected.
+	timestamp := strconv.FormatInt(s.currentTime().Unix(), 10)
+	req.Header.Set("X-Webhook-Signature", s.generateSignature(payloadJSON, webhook.Secret))
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	req.Header.Set("X-Webhook-Signature-V2", s.generateSignature(signedContent(timestamp, payloadJSON), webhook.Secret))
 
 	// Send request
 	resp, err := s.httpClient.Do(req)
 	if err != nil {
 		delivery.Status = "failed"
 		delivery.Error = err.Error()
-		s.scheduleRetry(delivery)
-		s.repo.SaveDelivery(ctx, delivery)
 		return err
 	}
 	defer resp.Body.Close()
@@ -399,15 +570,157 @@ func (s *Service) deliver(ctx context.Context, webhook *Webhook, event *Event, d
 	// Check if successful
 	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
 		delivery.Status = "success"
-		now := time.Now()
+		now := s.currentTime()
 		delivery.DeliveredAt = &now
 	} else {
 		delivery.Status = "failed"
 		delivery.Error = fmt.Sprintf("HTTP %d: %s", resp.StatusCode, string(responseBody))
-		s.scheduleRetry(delivery)
 	}
 
-	return s.repo.SaveDelivery(ctx, delivery)
+	return nil
+}
+
+// SendTestEvent synchronously delivers a ping event to a webhook so users
+// can check that the endpoint is reachable and verifies signatures. The
+// attempt is neither retried nor stored; its outcome is reported through the
+// returned Delivery.
+func (s *Service) SendTestEvent(ctx context.Context, webhookID uuid.UUID) (*Delivery, error) {
+	webhook, err := s.repo.GetByID(ctx, webhookID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.currentTime()
+	event := &Event{
+		ID:       uuid.New(),
+		TenantID: webhook.TenantID,
+		Type:     EventPing,
+		Data: map[string]interface{}{
+			"message": "This is a test event from Marimo",
+		},
+		CreatedAt: now,
+	}
+
+	delivery := &Delivery{
+		ID:        uuid.New(),
+		WebhookID: webhook.ID,
+		EventID:   event.ID,
+		Status:    "pending",
+		CreatedAt: now,
+	}
+
+	if err := s.send(ctx, webhook, event, delivery); err != nil && delivery.Status != "failed" {
+		return nil, err
+	}
+
+	return delivery, nil
+}
+
+// StartRetryWorker starts a goroutine that redelivers due pending deliveries
+// every interval. The worker stops when ctx is canceled; the returned channel
+// is closed once it has exited.
+func (s *Service) StartRetryWorker(ctx context.Context, interval time.Duration) <-chan struct{} {
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := s.RetryPending(ctx); err != nil && ctx.Err() == nil {
+					log.Printf("webhook retry worker: %v", err)
+				}
+			}
+		}
+	}()
+
+	return done
+}
+
+// RetryPending redelivers all pending deliveries whose retry time has passed
+func (s *Service) RetryPending(ctx context.Context) error {
+	deliveries, err := s.repo.GetPendingDeliveries(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, delivery := range deliveries {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		// Claim the delivery first so concurrent workers don't send it twice
+		claimed, err := s.repo.ClaimDelivery(ctx, delivery.ID)
+		if err != nil {
+			return err
+		}
+		if !claimed {
+			continue
+		}
+
+		s.retry(ctx, delivery)
+	}
+
+	return nil
+}
+
+// retry redelivers a claimed delivery, or marks it failed if it can no
+// longer be delivered
+func (s *Service) retry(ctx context.Context, delivery *Delivery) {
+	fail := func(reason string) {
+		delivery.Status = "failed"
+		delivery.Error = reason
+		delivery.NextRetryAt = nil
+		if err := s.repo.SaveDelivery(ctx, delivery); err != nil {
+			log.Printf("webhook retry worker: failed to save delivery %s: %v", delivery.ID, err)
+		}
+	}
+
+	if delivery.Attempt >= s.maxRetries {
+		fail(ErrMaxRetriesExceeded.Error())
+		return
+	}
+
+	// release hands the delivery back to the queue after a transient error
+	release := func(err error) {
+		delivery.Status = "pending"
+		log.Printf("webhook retry worker: delivery %s: %v", delivery.ID, err)
+		if err := s.repo.SaveDelivery(ctx, delivery); err != nil {
+			log.Printf("webhook retry worker: failed to save delivery %s: %v", delivery.ID, err)
+		}
+	}
+
+	webhook, err := s.repo.GetByID(ctx, delivery.WebhookID)
+	if errors.Is(err, ErrWebhookNotFound) {
+		fail(err.Error())
+		return
+	}
+	if err != nil {
+		release(err)
+		return
+	}
+	if !webhook.Active {
+		fail("webhook is inactive")
+		return
+	}
+
+	event, err := s.repo.GetEvent(ctx, delivery.EventID)
+	if errors.Is(err, ErrEventNotFound) {
+		fail(err.Error())
+		return
+	}
+	if err != nil {
+		release(err)
+		return
+	}
+
+	s.deliver(ctx, webhook, event, delivery)
 }
 
 // scheduleRetry schedules a retry with exponential backoff
@@ -429,11 +742,20 @@ func (s *Service) scheduleRetry(delivery *Delivery) {
 	}
 
 	delay := delays[min(delivery.Attempt-1, len(delays)-1)]
-	nextRetry := time.Now().Add(delay)
+	nextRetry := s.currentTime().Add(delay)
 	delivery.NextRetryAt = &nextRetry
 	delivery.Status = "pending"
 }
 
+// currentTime returns the service clock, falling back to time.Now for
+// zero-value services
+func (s *Service) currentTime() time.Time {
+	if s.now == nil {
+		return time.Now()
+	}
+	return s.now()
+}
+
 // generateSignature generates HMAC-SHA256 signature
 func (s *Service) generateSignature(payload []byte, secret string) string {
 	h := hmac.New(sha256.New, []byte(secret))
@@ -441,12 +763,45 @@ func (s *Service) generateSignature(payload []byte, secret string) string {
 	return hex.EncodeToString(h.Sum(nil))
 }
 
-// VerifySignature verifies webhook signature
+// VerifySignature verifies the X-Webhook-Signature header, which is computed
+// over the payload alone. It does not protect against replays; new receivers
+// should use VerifySignatureWithTolerance.
 func VerifySignature(payload []byte, signature, secret string) bool {
 	expected := generateSignatureStatic(payload, secret)
 	return hmac.Equal([]byte(signature), []byte(expected))
 }
 
+// VerifySignatureWithTolerance verifies the X-Webhook-Signature-V2 header,
+// which is computed over "timestamp.payload" where timestamp is the
+// X-Webhook-Timestamp header in Unix seconds. Signatures whose timestamp is more than tolerance away from
+// the current time are rejected.
+func VerifySignatureWithTolerance(payload, signature, timestamp, secret string, tolerance time.Duration) error {
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrInvalidTimestamp
+	}
+
+	age := time.Since(time.Unix(seconds, 0))
+	if age > tolerance || age < -tolerance {
+		return ErrTimestampOutOfRange
+	}
+
+	expected := generateSignatureStatic(signedContent(timestamp, []byte(payload)), secret)
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
+
+// signedContent returns the bytes covered by a timestamped signature
+func signedContent(timestamp string, payload []byte) []byte {
+	content := make([]byte, 0, len(timestamp)+1+len(payload))
+	content = append(content, timestamp...)
+	content = append(content, '.')
+	return append(content, payload...)
+}
+
 func generateSignatureStatic(payload []byte, secret string) string {
 	h := hmac.New(sha256.New, []byte(secret))
 	h.Write(payload)
@@ -1,10 +1,22 @@
 package webhooks
 
 import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
+	_ "github.com/mattn/go-sqlite3"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestGenerateSignature(t *testing.T) {
@@ -127,3 +139,559 @@ func TestScheduleRetry(t *testing.T) {
 		})
 	}
 }
+
+func TestVerifySignatureWithTolerance(t *testing.T) {
+	payload := `{"test": "data"}`
+	secret := "my-secret-key"
+	tolerance := 5 * time.Minute
+
+	sign := func(timestamp, payload string) string {
+		return generateSignatureStatic(signedContent(timestamp, []byte(payload)), secret)
+	}
+
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	stale := strconv.FormatInt(time.Now().Add(-10*time.Minute).Unix(), 10)
+	future := strconv.FormatInt(time.Now().Add(10*time.Minute).Unix(), 10)
+
+	tests := []struct {
+		name      string
+		payload   string
+		signature string
+		timestamp string
+		expected  error
+	}{
+		{
+			name:      "valid signature",
+			payload:   payload,
+			signature: sign(now, payload),
+			timestamp: now,
+			expected:  nil,
+		},
+		{
+			name:      "tampered payload",
+			payload:   `{"test": "tampered"}`,
+			signature: sign(now, payload),
+			timestamp: now,
+			expected:  ErrInvalidSignature,
+		},
+		{
+			name:      "tampered timestamp",
+			payload:   payload,
+			signature: sign(stale, payload),
+			timestamp: now,
+			expected:  ErrInvalidSignature,
+		},
+		{
+			name:      "payload-only signature",
+			payload:   payload,
+			signature: generateSignatureStatic([]byte(payload), secret),
+			timestamp: now,
+			expected:  ErrInvalidSignature,
+		},
+		{
+			name:      "stale timestamp",
+			payload:   payload,
+			signature: sign(stale, payload),
+			timestamp: stale,
+			expected:  ErrTimestampOutOfRange,
+		},
+		{
+			name:      "future timestamp",
+			payload:   payload,
+			signature: sign(future, payload),
+			timestamp: future,
+			expected:  ErrTimestampOutOfRange,
+		},
+		{
+			name:      "malformed timestamp",
+			payload:   payload,
+			signature: sign("yesterday", payload),
+			timestamp: "yesterday",
+			expected:  ErrInvalidTimestamp,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := VerifySignatureWithTolerance(tt.payload, tt.signature, tt.timestamp, secret, tolerance)
+			assert.Equal(t, tt.expected, err)
+		})
+	}
+}
+
+// memoryStore is an in-memory Store for service tests
+type memoryStore struct {
+	mu         sync.Mutex
+	webhooks   map[uuid.UUID]*Webhook
+	events     map[uuid.UUID]*Event
+	deliveries map[uuid.UUID]*Delivery
+	claimedAt  map[uuid.UUID]time.Time
+	now        func() time.Time
+}
+
+func newMemoryStore(webhooks ...*Webhook) *memoryStore {
+	store := &memoryStore{
+		webhooks:   make(map[uuid.UUID]*Webhook),
+		events:     make(map[uuid.UUID]*Event),
+		deliveries: make(map[uuid.UUID]*Delivery),
+		claimedAt:  make(map[uuid.UUID]time.Time),
+		now:        time.Now,
+	}
+	for _, webhook := range webhooks {
+		store.webhooks[webhook.ID] = webhook
+	}
+	return store
+}
+
+func (m *memoryStore) GetByID(ctx context.Context, id uuid.UUID) (*Webhook, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	webhook, ok := m.webhooks[id]
+	if !ok {
+		return nil, ErrWebhookNotFound
+	}
+	return webhook, nil
+}
+
+func (m *memoryStore) ListByTenant(ctx context.Context, tenantID uuid.UUID) ([]*Webhook, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var webhooks []*Webhook
+	for _, webhook := range m.webhooks {
+		if webhook.TenantID == tenantID {
+			webhooks = append(webhooks, webhook)
+		}
+	}
+	return webhooks, nil
+}
+
+func (m *memoryStore) SaveEvent(ctx context.Context, event *Event) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.events[event.ID] = event
+	return nil
+}
+
+func (m *memoryStore) GetEvent(ctx context.Context, id uuid.UUID) (*Event, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	event, ok := m.events[id]
+	if !ok {
+		return nil, ErrEventNotFound
+	}
+	return event, nil
+}
+
+func (m *memoryStore) SaveDelivery(ctx context.Context, delivery *Delivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	saved := *delivery
+	m.deliveries[delivery.ID] = &saved
+	return nil
+}
+
+func (m *memoryStore) GetPendingDeliveries(ctx context.Context) ([]*Delivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var pending []*Delivery
+	for id, delivery := range m.deliveries {
+		due := delivery.Status == "pending" && delivery.NextRetryAt != nil && !delivery.NextRetryAt.After(m.now())
+		if due || m.abandoned(id) {
+			d := *delivery
+			pending = append(pending, &d)
+		}
+	}
+	return pending, nil
+}
+
+func (m *memoryStore) ClaimDelivery(ctx context.Context, id uuid.UUID) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delivery, ok := m.deliveries[id]
+	if !ok || (delivery.Status != "pending" && !m.abandoned(id)) {
+		return false, nil
+	}
+	delivery.Status = "in_flight"
+	m.claimedAt[id] = m.now()
+	return true, nil
+}
+
+// abandoned reports whether a delivery is in flight past ClaimLease. m.mu
+// must be held.
+func (m *memoryStore) abandoned(id uuid.UUID) bool {
+	claimedAt, ok := m.claimedAt[id]
+	return ok && m.deliveries[id].Status == "in_flight" && !m.now().Before(claimedAt.Add(ClaimLease))
+}
+
+func (m *memoryStore) delivery(id uuid.UUID) Delivery {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return *m.deliveries[id]
+}
+
+// fakeClock is a manually advanced clock shared by a Service and memoryStore
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestDeliver_Payload(t *testing.T) {
+	var body []byte
+	var header http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		header = r.Header.Clone()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	webhook := &Webhook{ID: uuid.New(), URL: server.URL, Secret: "secret", Active: true}
+	event := &Event{
+		ID:        uuid.New(),
+		Type:      EventUserCreated,
+		Data:      map[string]interface{}{"user_id": "42"},
+		CreatedAt: time.Date(2024, 5, 17, 10, 30, 0, 0, time.UTC),
+	}
+
+	service := NewService(newMemoryStore(webhook), 0)
+	delivery := &Delivery{ID: uuid.New(), WebhookID: webhook.ID, EventID: event.ID, Status: "pending"}
+
+	err := service.deliver(context.Background(), webhook, event, delivery)
+	require.NoError(t, err)
+	assert.Equal(t, "success", delivery.Status)
+
+	var payload map[string]interface{}
+	require.NoError(t, json.Unmarshal(body, &payload))
+
+	assert.Equal(t, event.ID.String(), payload["id"])
+	assert.Equal(t, webhook.ID.String(), payload["webhook_id"])
+	assert.Equal(t, string(EventUserCreated), payload["type"])
+	assert.Equal(t, "2024-05-17T10:30:00Z", payload["created_at"])
+
+	createdAt, err := time.Parse(time.RFC3339, payload["created_at"].(string))
+	require.NoError(t, err)
+	assert.True(t, createdAt.Equal(event.CreatedAt))
+
+	err = VerifySignatureWithTolerance(string(body), header.Get("X-Webhook-Signature-V2"),
+		header.Get("X-Webhook-Timestamp"), webhook.Secret, time.Minute)
+	assert.NoError(t, err)
+
+	// Receivers on the payload-only scheme keep working
+	assert.True(t, VerifySignature(body, header.Get("X-Webhook-Signature"), webhook.Secret))
+}
+
+func TestRetryWorker_RetriesFailedDelivery(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	clock := &fakeClock{now: time.Date(2024, 5, 17, 10, 30, 0, 0, time.UTC)}
+	webhook := &Webhook{ID: uuid.New(), URL: server.URL, Secret: "secret", Active: true}
+	event := &Event{ID: uuid.New(), Type: EventUserCreated, CreatedAt: clock.Now()}
+
+	store := newMemoryStore(webhook)
+	store.now = clock.Now
+	require.NoError(t, store.SaveEvent(context.Background(), event))
+
+	service := NewService(store, 0)
+	service.now = clock.Now
+
+	delivery := &Delivery{ID: uuid.New(), WebhookID: webhook.ID, EventID: event.ID, Status: "pending", CreatedAt: clock.Now()}
+	require.NoError(t, service.deliver(context.Background(), webhook, event, delivery))
+
+	saved := store.delivery(delivery.ID)
+	require.Equal(t, "pending", saved.Status)
+	require.NotNil(t, saved.NextRetryAt)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := service.StartRetryWorker(ctx, 5*time.Millisecond)
+
+	// Not due yet: the worker must leave the delivery alone
+	time.Sleep(30 * time.Millisecond)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+
+	clock.Advance(time.Minute)
+
+	assert.Eventually(t, func() bool {
+		return store.delivery(delivery.ID).Status == "success"
+	}, time.Second, 5*time.Millisecond)
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("retry worker did not stop after cancel")
+	}
+
+	saved = store.delivery(delivery.ID)
+	assert.Equal(t, 2, saved.Attempt)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+}
+
+func TestRetryPending_RespectsMaxRetries(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	webhook := &Webhook{ID: uuid.New(), URL: server.URL, Active: true}
+	event := &Event{ID: uuid.New(), Type: EventUserCreated, CreatedAt: time.Now()}
+	store := newMemoryStore(webhook)
+	require.NoError(t, store.SaveEvent(context.Background(), event))
+
+	service := NewService(store, 0)
+	due := time.Now().Add(-time.Second)
+	delivery := &Delivery{ID: uuid.New(), WebhookID: webhook.ID, EventID: event.ID, Status: "pending", Attempt: service.maxRetries, NextRetryAt: &due}
+	require.NoError(t, store.SaveDelivery(context.Background(), delivery))
+
+	require.NoError(t, service.RetryPending(context.Background()))
+
+	saved := store.delivery(delivery.ID)
+	assert.Equal(t, "failed", saved.Status)
+	assert.Nil(t, saved.NextRetryAt)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&requests))
+}
+
+func TestRetryPending_ReclaimsAbandonedDelivery(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	clock := &fakeClock{now: time.Date(2024, 5, 17, 10, 30, 0, 0, time.UTC)}
+	webhook := &Webhook{ID: uuid.New(), URL: server.URL, Active: true}
+	event := &Event{ID: uuid.New(), Type: EventUserCreated, CreatedAt: clock.Now()}
+
+	store := newMemoryStore(webhook)
+	store.now = clock.Now
+	require.NoError(t, store.SaveEvent(context.Background(), event))
+
+	service := NewService(store, 0)
+	service.now = clock.Now
+
+	// A worker claims the delivery and dies before recording the outcome
+	due := clock.Now()
+	delivery := &Delivery{ID: uuid.New(), WebhookID: webhook.ID, EventID: event.ID, Status: "pending", Attempt: 1, NextRetryAt: &due}
+	require.NoError(t, store.SaveDelivery(context.Background(), delivery))
+	claimed, err := store.ClaimDelivery(context.Background(), delivery.ID)
+	require.NoError(t, err)
+	require.True(t, claimed)
+
+	// Within the lease the delivery may still be in progress
+	clock.Advance(ClaimLease - time.Second)
+	require.NoError(t, service.RetryPending(context.Background()))
+	assert.Equal(t, int32(0), atomic.LoadInt32(&requests))
+	assert.Equal(t, "in_flight", store.delivery(delivery.ID).Status)
+
+	clock.Advance(time.Second)
+	require.NoError(t, service.RetryPending(context.Background()))
+
+	saved := store.delivery(delivery.ID)
+	assert.Equal(t, "success", saved.Status)
+	assert.Equal(t, 2, saved.Attempt)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+}
+
+func TestDispatch_BoundsConcurrentDeliveries(t *testing.T) {
+	const (
+		events = 100
+		limit  = 5
+	)
+
+	var inFlight, maxInFlight, received int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		current := atomic.AddInt32(&inFlight, 1)
+		for {
+			seen := atomic.LoadInt32(&maxInFlight)
+			if current <= seen || atomic.CompareAndSwapInt32(&maxInFlight, seen, current) {
+				break
+			}
+		}
+
+		time.Sleep(2 * time.Millisecond)
+		atomic.AddInt32(&inFlight, -1)
+		atomic.AddInt32(&received, 1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	tenantID := uuid.New()
+	webhook := &Webhook{ID: uuid.New(), TenantID: tenantID, URL: server.URL, Events: []EventType{"*"}, Active: true}
+	service := NewService(newMemoryStore(webhook), limit)
+
+	for i := 0; i < events; i++ {
+		event := &Event{ID: uuid.New(), TenantID: tenantID, Type: EventUserCreated, CreatedAt: time.Now()}
+		require.NoError(t, service.Dispatch(context.Background(), event))
+	}
+
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt32(&received) == events
+	}, 5*time.Second, 5*time.Millisecond)
+	assert.LessOrEqual(t, atomic.LoadInt32(&maxInFlight), int32(limit))
+}
+
+func TestDispatch_DefersDeliveryWhenNoSlotFree(t *testing.T) {
+	unblock := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-unblock
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	defer close(unblock)
+
+	tenantID := uuid.New()
+	webhook := &Webhook{ID: uuid.New(), TenantID: tenantID, URL: server.URL, Events: []EventType{"*"}, Active: true}
+	store := newMemoryStore(webhook)
+	service := NewService(store, 1)
+
+	// Occupies the only slot until the server is unblocked
+	first := &Event{ID: uuid.New(), TenantID: tenantID, Type: EventUserCreated, CreatedAt: time.Now()}
+	require.NoError(t, service.Dispatch(context.Background(), first))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	second := &Event{ID: uuid.New(), TenantID: tenantID, Type: EventUserCreated, CreatedAt: time.Now()}
+	require.NoError(t, service.Dispatch(ctx, second))
+
+	pending, err := store.GetPendingDeliveries(context.Background())
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	assert.Equal(t, second.ID, pending[0].EventID)
+	assert.Equal(t, 0, pending[0].Attempt)
+}
+
+func TestSendTestEvent(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Echo the request back so the test can inspect what was sent
+		body, _ := io.ReadAll(r.Body)
+		err := VerifySignatureWithTolerance(string(body), r.Header.Get("X-Webhook-Signature-V2"),
+			r.Header.Get("X-Webhook-Timestamp"), "secret", time.Minute)
+		if err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write(body)
+	}))
+	defer server.Close()
+
+	webhook := &Webhook{ID: uuid.New(), URL: server.URL, Secret: "secret", Active: true}
+	store := newMemoryStore(webhook)
+	service := NewService(store, 0)
+
+	delivery, err := service.SendTestEvent(context.Background(), webhook.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "success", delivery.Status)
+	assert.Equal(t, http.StatusOK, delivery.StatusCode)
+	assert.Equal(t, 1, delivery.Attempt)
+
+	var payload map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(delivery.Response), &payload))
+	assert.Equal(t, string(EventPing), payload["type"])
+	assert.Equal(t, webhook.ID.String(), payload["webhook_id"])
+
+	// Test pings are not persisted
+	assert.Empty(t, store.deliveries)
+}
+
+func TestSendTestEvent_FailureIsNotRetried(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+		w.Write([]byte("upstream down"))
+	}))
+	defer server.Close()
+
+	webhook := &Webhook{ID: uuid.New(), URL: server.URL, Secret: "secret", Active: true}
+	service := NewService(newMemoryStore(webhook), 0)
+
+	delivery, err := service.SendTestEvent(context.Background(), webhook.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "failed", delivery.Status)
+	assert.Equal(t, http.StatusBadGateway, delivery.StatusCode)
+	assert.Equal(t, "upstream down", delivery.Response)
+	assert.Nil(t, delivery.NextRetryAt)
+
+	_, err = service.SendTestEvent(context.Background(), uuid.New())
+	assert.ErrorIs(t, err, ErrWebhookNotFound)
+}
+
+func TestRepository_ClaimDelivery(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	_, err = db.Exec(`CREATE TABLE webhook_deliveries (
+		id TEXT PRIMARY KEY, webhook_id TEXT, event_id TEXT, status TEXT, status_code INTEGER,
+		response TEXT, error TEXT, attempt INTEGER, next_retry_at TIMESTAMP, created_at TIMESTAMP,
+		delivered_at TIMESTAMP, claimed_at TIMESTAMP)`)
+	require.NoError(t, err)
+
+	repo := NewRepository(db)
+	ctx := context.Background()
+
+	due := time.Now().Add(-time.Second)
+	fresh := &Delivery{ID: uuid.New(), Status: "pending", NextRetryAt: &due, CreatedAt: due}
+	abandoned := &Delivery{ID: uuid.New(), Status: "pending", NextRetryAt: &due, CreatedAt: due}
+	require.NoError(t, repo.SaveDelivery(ctx, fresh))
+	require.NoError(t, repo.SaveDelivery(ctx, abandoned))
+
+	for _, delivery := range []*Delivery{fresh, abandoned} {
+		claimed, err := repo.ClaimDelivery(ctx, delivery.ID)
+		require.NoError(t, err)
+		require.True(t, claimed)
+
+		claimed, err = repo.ClaimDelivery(ctx, delivery.ID)
+		require.NoError(t, err)
+		assert.False(t, claimed, "a delivery in flight was claimed twice")
+	}
+
+	// Backdate one claim past the lease, as if its worker died
+	_, err = db.Exec(`UPDATE webhook_deliveries SET claimed_at = $1 WHERE id = $2`,
+		time.Now().Add(-ClaimLease-time.Minute), abandoned.ID)
+	require.NoError(t, err)
+
+	pending, err := repo.GetPendingDeliveries(ctx)
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	assert.Equal(t, abandoned.ID, pending[0].ID)
+
+	claimed, err := repo.ClaimDelivery(ctx, abandoned.ID)
+	require.NoError(t, err)
+	assert.True(t, claimed)
+
+	claimed, err = repo.ClaimDelivery(ctx, fresh.ID)
+	require.NoError(t, err)
+	assert.False(t, claimed)
+}
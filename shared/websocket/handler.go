@@ -4,8 +4,10 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"strings"
 	"time"
 
+	"github.com/dayanch951/marimo/shared/middleware"
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 )
@@ -21,21 +23,65 @@ var upgrader = websocket.Upgrader{
 
 // ServeWS handles WebSocket requests from clients
 func ServeWS(hub *Hub, w http.ResponseWriter, r *http.Request) {
-	conn, err := upgrader.Upgrade(w, r, nil)
-	if err != nil {
-		log.Printf("WebSocket upgrade error: %v", err)
-		return
-	}
-
 	// Get user ID from context (if authenticated)
 	userID := ""
 	if user := r.Context().Value("user_id"); user != nil {
 		userID = user.(string)
 	}
 
+	hub.serve(w, r, userID)
+}
+
+// ServeWS handles WebSocket requests from authenticated clients. The JWT
+// is taken from claims set by middleware.AuthMiddleware, the Authorization
+// header or the token query parameter, since browsers can't set headers
+// on WebSocket requests. Requests without a valid token get 401 and are
+// not upgraded.
+func (h *Hub) ServeWS(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(middleware.UserContextKey).(*middleware.Claims)
+	if !ok {
+		token := requestToken(r)
+		if token == "" {
+			http.Error(w, "Authorization required", http.StatusUnauthorized)
+			return
+		}
+
+		var err error
+		claims, err = middleware.ValidateToken(token)
+		if err != nil {
+			http.Error(w, "Invalid token", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	h.serve(w, r, claims.UserID)
+}
+
+// requestToken returns the bearer token from the Authorization header or
+// the token query parameter
+func requestToken(r *http.Request) string {
+	if authHeader := r.Header.Get("Authorization"); authHeader != "" {
+		parts := strings.Split(authHeader, " ")
+		if len(parts) != 2 || parts[0] != "Bearer" {
+			return ""
+		}
+		return parts[1]
+	}
+
+	return r.URL.Query().Get("token")
+}
+
+// serve upgrades the connection and registers a client for userID
+func (h *Hub) serve(w http.ResponseWriter, r *http.Request, userID string) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("WebSocket upgrade error: %v", err)
+		return
+	}
+
 	// Create new client
 	client := &Client{
-		hub:      hub,
+		hub:      h,
 		conn:     conn,
 		send:     make(chan []byte, 256),
 		id:       uuid.New().String(),
@@ -45,7 +91,7 @@ func ServeWS(hub *Hub, w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Register client
-	hub.register <- client
+	h.register <- client
 
 	// Send welcome message
 	welcomeMsg := Message{
@@ -32,6 +32,11 @@ type Hub struct {
 
 	// Room support
 	rooms map[string]map[*Client]bool
+
+	// Per-client limit on incoming messages
+	messageRate       float64
+	messageBurst      int
+	maxRateViolations int
 }
 
 // Client represents a WebSocket client connection
@@ -55,6 +60,12 @@ type Client struct {
 
 	// Metadata
 	metadata map[string]interface{}
+
+	// Set, with the hub's lock held, when send is closed
+	closed bool
+
+	// Close frame payload sent once send is closed, if not empty
+	closeMessage []byte
 }
 
 // Message represents a WebSocket message
@@ -81,6 +92,13 @@ const (
 	maxMessageSize = 512 * 1024 // 512 KB
 )
 
+// Defaults for the per-client message rate limit
+const (
+	DefaultMessageRate       = 20 // messages per second
+	DefaultMessageBurst      = 40
+	DefaultMaxRateViolations = 20
+)
+
 // NewHub creates a new WebSocket hub
 func NewHub() *Hub {
 	return &Hub{
@@ -90,9 +108,28 @@ func NewHub() *Hub {
 		unregister: make(chan *Client),
 		handlers:   make(map[string]MessageHandler),
 		rooms:      make(map[string]map[*Client]bool),
+
+		messageRate:       DefaultMessageRate,
+		messageBurst:      DefaultMessageBurst,
+		maxRateViolations: DefaultMaxRateViolations,
 	}
 }
 
+// SetMessageRateLimit limits how many messages per second each client may
+// send, allowing bursts of up to burst messages. Messages over the limit
+// are dropped with an error message to the client, which is disconnected
+// after maxViolations dropped messages. A rate of 0 disables the limit and
+// maxViolations of 0 never disconnects. It applies to clients that
+// connect afterwards.
+func (h *Hub) SetMessageRateLimit(rate float64, burst, maxViolations int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.messageRate = rate
+	h.messageBurst = burst
+	h.maxRateViolations = maxViolations
+}
+
 // Run starts the hub
 func (h *Hub) Run() {
 	for {
@@ -104,34 +141,60 @@ func (h *Hub) Run() {
 			log.Printf("Client registered: %s", client.id)
 
 		case client := <-h.unregister:
-			h.mu.Lock()
-			if _, ok := h.clients[client]; ok {
-				delete(h.clients, client)
-				close(client.send)
-
-				// Remove from all rooms
-				for room := range client.rooms {
-					h.leaveRoom(client, room)
-				}
-			}
-			h.mu.Unlock()
+			h.removeClients([]*Client{client})
 			log.Printf("Client unregistered: %s", client.id)
 
 		case message := <-h.broadcast:
 			h.mu.RLock()
+			var slow []*Client
 			for client := range h.clients {
-				select {
-				case client.send <- message:
-				default:
-					close(client.send)
-					delete(h.clients, client)
+				if !client.trySend(message) {
+					slow = append(slow, client)
 				}
 			}
 			h.mu.RUnlock()
+			h.removeClients(slow)
 		}
 	}
 }
 
+// removeClients disconnects clients, closing each send channel exactly
+// once. Everything that drops a client goes through here, with the write
+// lock held, so sends made under the read lock never see a closed channel.
+func (h *Hub) removeClients(clients []*Client) {
+	if len(clients) == 0 {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, client := range clients {
+		if client.closed {
+			continue
+		}
+		client.closed = true
+		delete(h.clients, client)
+		close(client.send)
+
+		// Remove from all rooms
+		for room := range client.rooms {
+			h.leaveRoom(client, room)
+		}
+	}
+}
+
+// trySend queues data for a registered client, reporting false if its
+// buffer is full. The hub's lock must be held.
+func (c *Client) trySend(data []byte) bool {
+	select {
+	case c.send <- data:
+		return true
+	default:
+		return false
+	}
+}
+
 // RegisterHandler registers a message handler for a specific message type
 func (h *Hub) RegisterHandler(messageType string, handler MessageHandler) {
 	h.mu.Lock()
@@ -158,19 +221,16 @@ func (h *Hub) BroadcastToRoom(room string, message Message) error {
 	}
 
 	h.mu.RLock()
-	defer h.mu.RUnlock()
-
-	if clients, ok := h.rooms[room]; ok {
-		for client := range clients {
-			select {
-			case client.send <- data:
-			default:
-				close(client.send)
-				delete(h.clients, client)
-			}
+	var slow []*Client
+	for client := range h.rooms[room] {
+		if !client.trySend(data) {
+			slow = append(slow, client)
 		}
 	}
+	h.mu.RUnlock()
 
+	// Slow clients are disconnected rather than allowed to block others
+	h.removeClients(slow)
 	return nil
 }
 
@@ -182,28 +242,58 @@ func (h *Hub) SendToClient(clientID string, message Message) error {
 	}
 
 	h.mu.RLock()
-	defer h.mu.RUnlock()
-
+	var slow []*Client
 	for client := range h.clients {
 		if client.id == clientID {
-			select {
-			case client.send <- data:
-			default:
-				close(client.send)
-				delete(h.clients, client)
+			if !client.trySend(data) {
+				slow = append(slow, client)
 			}
 			break
 		}
 	}
+	h.mu.RUnlock()
 
+	h.removeClients(slow)
 	return nil
 }
 
+// SendToUser sends a message to every connection of a user and returns
+// how many received it. Clients whose send buffer is full are disconnected.
+func (h *Hub) SendToUser(userID string, message Message) (int, error) {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return 0, err
+	}
+
+	h.mu.RLock()
+	delivered := 0
+	var slow []*Client
+	for client := range h.clients {
+		if client.userID != userID {
+			continue
+		}
+		if client.trySend(data) {
+			delivered++
+		} else {
+			slow = append(slow, client)
+		}
+	}
+	h.mu.RUnlock()
+
+	h.removeClients(slow)
+	return delivered, nil
+}
+
 // JoinRoom adds a client to a room
 func (h *Hub) JoinRoom(client *Client, room string) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 
+	// A handler may still be running for a client that was just dropped
+	if client.closed {
+		return
+	}
+
 	if h.rooms[room] == nil {
 		h.rooms[room] = make(map[*Client]bool)
 	}
@@ -265,6 +355,16 @@ func (c *Client) readPump() {
 		return nil
 	})
 
+	c.hub.mu.RLock()
+	var limiter *tokenBucket
+	if c.hub.messageRate > 0 {
+		limiter = newTokenBucket(c.hub.messageRate, c.hub.messageBurst)
+	}
+	maxViolations := c.hub.maxRateViolations
+	c.hub.mu.RUnlock()
+	violations := 0
+	disconnecting := false
+
 	for {
 		_, message, err := c.conn.ReadMessage()
 		if err != nil {
@@ -274,6 +374,32 @@ func (c *Client) readPump() {
 			break
 		}
 
+		// Discard anything that arrives while writePump closes the connection
+		if disconnecting {
+			continue
+		}
+
+		if limiter != nil && !limiter.allow(time.Now()) {
+			violations++
+			if maxViolations > 0 && violations >= maxViolations {
+				log.Printf("Disconnecting client %s: message rate limit exceeded", c.id)
+				// Closing send lets writePump flush queued messages
+				// before the close frame
+				c.closeMessage = websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "rate limit exceeded")
+				c.hub.removeClients([]*Client{c})
+				disconnecting = true
+				continue
+			}
+
+			c.Send(Message{
+				Type: "error",
+				Payload: map[string]interface{}{
+					"error": "rate limit exceeded",
+				},
+			})
+			continue
+		}
+
 		// Parse message
 		var msg Message
 		if err := json.Unmarshal(message, &msg); err != nil {
@@ -308,7 +434,7 @@ func (c *Client) writePump() {
 		case message, ok := <-c.send:
 			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
 			if !ok {
-				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				c.conn.WriteMessage(websocket.CloseMessage, c.closeMessage)
 				return
 			}
 
@@ -338,6 +464,16 @@ func (c *Client) writePump() {
 	}
 }
 
+// ID returns the client's connection ID
+func (c *Client) ID() string {
+	return c.id
+}
+
+// UserID returns the authenticated user's ID, or "" for anonymous clients
+func (c *Client) UserID() string {
+	return c.userID
+}
+
 // Send sends a message to the client
 func (c *Client) Send(message Message) error {
 	data, err := json.Marshal(message)
@@ -345,6 +481,13 @@ func (c *Client) Send(message Message) error {
 		return err
 	}
 
+	c.hub.mu.RLock()
+	defer c.hub.mu.RUnlock()
+
+	if c.closed {
+		return fmt.Errorf("client is disconnected")
+	}
+
 	select {
 	case c.send <- data:
 	default:
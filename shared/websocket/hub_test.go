@@ -0,0 +1,276 @@
+package websocket
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dayanch951/marimo/shared/middleware"
+	"github.com/gorilla/websocket"
+)
+
+// dial opens a WebSocket connection, reads the welcome message and returns
+// the connection with its client ID
+func dial(t *testing.T, url string, header http.Header) (*websocket.Conn, string) {
+	t.Helper()
+
+	conn, resp, err := websocket.DefaultDialer.Dial(url, header)
+	if err != nil {
+		status := 0
+		if resp != nil {
+			status = resp.StatusCode
+		}
+		t.Fatalf("Dial() error = %v (status %d)", err, status)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	msg := readMessage(t, conn)
+	if msg.Type != "welcome" {
+		t.Fatalf("first message type = %q, want welcome", msg.Type)
+	}
+
+	id, _ := msg.Payload["client_id"].(string)
+	return conn, id
+}
+
+func readMessage(t *testing.T, conn *websocket.Conn) Message {
+	t.Helper()
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, data, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("ReadMessage() error = %v", err)
+	}
+
+	var msg Message
+	if err := json.Unmarshal(data, &msg); err != nil {
+		t.Fatalf("failed to decode message %q: %v", data, err)
+	}
+	return msg
+}
+
+// clientFor returns the registered client with the given connection ID
+func clientFor(t *testing.T, hub *Hub, id string) *Client {
+	t.Helper()
+
+	hub.mu.RLock()
+	defer hub.mu.RUnlock()
+	for client := range hub.clients {
+		if client.id == id {
+			return client
+		}
+	}
+	t.Fatalf("client %s is not registered", id)
+	return nil
+}
+
+func TestHub_ServeWS(t *testing.T) {
+	hub := NewHub()
+	go hub.Run()
+
+	server := httptest.NewServer(http.HandlerFunc(hub.ServeWS))
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	token, err := middleware.GenerateToken("user-42", "user@example.com", "user")
+	if err != nil {
+		t.Fatalf("GenerateToken() error = %v", err)
+	}
+
+	t.Run("authorization header", func(t *testing.T) {
+		_, id := dial(t, url, http.Header{"Authorization": {"Bearer " + token}})
+		if got := clientFor(t, hub, id).UserID(); got != "user-42" {
+			t.Errorf("client userID = %q, want user-42", got)
+		}
+	})
+
+	t.Run("token query parameter", func(t *testing.T) {
+		_, id := dial(t, url+"?token="+token, nil)
+		if got := clientFor(t, hub, id).UserID(); got != "user-42" {
+			t.Errorf("client userID = %q, want user-42", got)
+		}
+	})
+
+	for name, header := range map[string]http.Header{
+		"no token":      nil,
+		"invalid token": {"Authorization": {"Bearer not-a-jwt"}},
+		"basic auth":    {"Authorization": {"Basic dXNlcjpwYXNz"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, resp, err := websocket.DefaultDialer.Dial(url, header)
+			if err == nil {
+				t.Fatal("Dial() succeeded without a valid token")
+			}
+			if resp == nil || resp.StatusCode != http.StatusUnauthorized {
+				t.Errorf("response = %v, want 401", resp)
+			}
+		})
+	}
+}
+
+// newTestClient registers a client without a connection, whose messages
+// can be read from its send channel
+func newTestClient(hub *Hub, id, userID string) *Client {
+	client := &Client{
+		hub:      hub,
+		send:     make(chan []byte, 8),
+		id:       id,
+		userID:   userID,
+		rooms:    make(map[string]bool),
+		metadata: make(map[string]interface{}),
+	}
+	hub.register <- client
+	return client
+}
+
+func TestHub_SendToUser(t *testing.T) {
+	hub := NewHub()
+	go hub.Run()
+
+	laptop := newTestClient(hub, "laptop", "user-1")
+	phone := newTestClient(hub, "phone", "user-1")
+	other := newTestClient(hub, "other", "user-2")
+
+	delivered, err := hub.SendToUser("user-1", Message{Type: "notification", Payload: map[string]interface{}{"text": "hi"}})
+	if err != nil {
+		t.Fatalf("SendToUser() error = %v", err)
+	}
+	if delivered != 2 {
+		t.Errorf("SendToUser() delivered = %d, want 2", delivered)
+	}
+
+	for _, client := range []*Client{laptop, phone} {
+		select {
+		case data := <-client.send:
+			var msg Message
+			if err := json.Unmarshal(data, &msg); err != nil || msg.Type != "notification" {
+				t.Errorf("client %s got %s, want the notification", client.id, data)
+			}
+		default:
+			t.Errorf("client %s got no message", client.id)
+		}
+	}
+
+	if len(other.send) != 0 {
+		t.Error("another user's client got the message")
+	}
+}
+
+func TestHub_DropsStalledClient(t *testing.T) {
+	hub := NewHub()
+	go hub.Run()
+
+	// Nothing reads from stalled's send channel
+	stalled := newTestClient(hub, "stalled", "user-1")
+	hub.JoinRoom(stalled, "orders")
+
+	msg := Message{Type: "update", Room: "orders"}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				switch (i + j) % 5 {
+				case 0:
+					hub.BroadcastToRoom("orders", msg)
+				case 1:
+					hub.SendToClient("stalled", msg)
+				case 2:
+					hub.SendToUser("user-1", msg)
+				case 3:
+					hub.Broadcast(msg)
+				case 4:
+					stalled.Send(msg)
+				}
+			}
+		}(i)
+	}
+
+	// Unregistering a client that was already dropped must not close its
+	// channel again
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		hub.unregister <- stalled
+	}()
+
+	wg.Wait()
+
+	if n := hub.GetClientCount(); n != 0 {
+		t.Errorf("GetClientCount() = %d, want the stalled client dropped", n)
+	}
+	if n := hub.GetRoomClientCount("orders"); n != 0 {
+		t.Errorf("GetRoomClientCount() = %d, want 0", n)
+	}
+
+	// The channel is closed once its buffered messages are drained
+	for range stalled.send {
+	}
+	if err := stalled.Send(msg); err == nil {
+		t.Error("Send() to a dropped client succeeded")
+	}
+}
+
+func TestHub_MessageRateLimit(t *testing.T) {
+	hub := NewHub()
+	hub.SetMessageRateLimit(0.001, 3, 4)
+	go hub.Run()
+
+	var handled atomic.Int32
+	hub.RegisterHandler("work", func(client *Client, msg Message) error {
+		handled.Add(1)
+		return nil
+	})
+
+	server := httptest.NewServer(http.HandlerFunc(hub.ServeWS))
+	defer server.Close()
+
+	token, err := middleware.GenerateToken("user-1", "user@example.com", "user")
+	if err != nil {
+		t.Fatalf("GenerateToken() error = %v", err)
+	}
+	conn, _ := dial(t, "ws"+strings.TrimPrefix(server.URL, "http")+"?token="+token, nil)
+
+	for i := 0; i < 10; i++ {
+		if err := conn.WriteJSON(Message{Type: "work"}); err != nil {
+			break // the server may already have hung up
+		}
+	}
+
+	// The hub batches queued messages into one frame, one per line
+	errorsSeen := 0
+	var closeErr *websocket.CloseError
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			if ce, ok := err.(*websocket.CloseError); ok {
+				closeErr = ce
+			}
+			break
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			var msg Message
+			if json.Unmarshal([]byte(line), &msg) == nil && msg.Type == "error" {
+				errorsSeen++
+			}
+		}
+	}
+
+	if n := handled.Load(); n != 3 {
+		t.Errorf("handled %d messages, want the burst of 3", n)
+	}
+	if errorsSeen != 3 {
+		t.Errorf("got %d rate limit errors, want 3 before the disconnect", errorsSeen)
+	}
+	if closeErr == nil || closeErr.Code != websocket.ClosePolicyViolation {
+		t.Errorf("connection closed with %v, want a policy violation", closeErr)
+	}
+}
@@ -14,15 +14,22 @@ import (
 	"github.com/gorilla/mux"
 )
 
+// nopMailer drops the emails of the auth flows
+type nopMailer struct{}
+
+func (nopMailer) SendVerificationEmail(to, name, verifyLink string) error { return nil }
+func (nopMailer) SendPasswordResetEmail(to, resetLink string) error       { return nil }
+
 func setupTestServer() *httptest.Server {
 	db := utils.NewMemoryDB()
-	authHandler := handlers.NewAuthHandler(db)
+	authHandler := handlers.NewAuthHandler(db, nopMailer{}, handlers.AuthConfig{})
 
 	router := mux.NewRouter()
 	router.HandleFunc("/api/users/register", authHandler.Register).Methods("POST")
 	router.HandleFunc("/api/users/login", authHandler.Login).Methods("POST")
 	router.HandleFunc("/api/users/refresh", authHandler.RefreshToken).Methods("POST")
 	router.HandleFunc("/api/users/logout", authHandler.Logout).Methods("POST")
+	router.HandleFunc("/api/users/verify", authHandler.VerifyEmail).Methods("GET")
 
 	protected := router.PathPrefix("/api/users").Subrouter()
 	protected.Use(middleware.AuthMiddleware)
@@ -33,6 +40,7 @@ func setupTestServer() *httptest.Server {
 	admin.Use(middleware.AuthMiddleware)
 	admin.Use(middleware.RoleMiddleware(models.RoleAdmin))
 	admin.HandleFunc("/assign-role", authHandler.AssignRole).Methods("POST")
+	admin.HandleFunc("/{id}", authHandler.DeleteUser).Methods("DELETE")
 
 	handler := middleware.CORS(router)
 	return httptest.NewServer(handler)